@@ -0,0 +1,352 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"strconv"
+)
+
+type binaryItemKind int
+
+const (
+	binaryItemNull binaryItemKind = iota
+	binaryItemFalse
+	binaryItemTrue
+	binaryItemInt
+	binaryItemUint
+	// binaryItemNegUint is the integer -1 - u, for values below the range
+	// of an int64
+	binaryItemNegUint
+	binaryItemFloat
+	// binaryItemDecimal is a number given as the JSON text in str
+	binaryItemDecimal
+	binaryItemString
+	binaryItemBytes
+	binaryItemArray
+	binaryItemMap
+)
+
+// binaryItem is a single value decoded from a binary encoding.  Arrays and
+// maps are only their headers, with their length in entries (or -1 when the
+// length is indefinite), and are followed by their entries.
+type binaryItem struct {
+	kind   binaryItemKind
+	i      int64
+	u      uint64
+	f      float64
+	str    []byte
+	length int
+}
+
+// binaryDecoder decodes the items of a self-describing binary encoding.
+// Items are always decoded in document order, so decoders may keep state
+// about where in the document they are.
+type binaryDecoder interface {
+	reset()
+
+	// decodeItem decodes the item which starts at pos, and returns the
+	// position of whatever follows it
+	decodeItem(data []byte, pos int, item *binaryItem) (int, error)
+
+	// decodeBreak checks whether the item at pos ends the innermost
+	// container of indefinite length, returning the position after it
+	// if so
+	decodeBreak(data []byte, pos int) (int, bool, error)
+}
+
+var errBinaryUnexpectedEnd = errors.New("unexpected end of input")
+var errBinaryKeyNotString = errors.New("object keys must be strings")
+
+// binaryToken is a token recorded by the binaryTokenizer.  start and end
+// locate its JSON text, and for binary tokens rawStart and rawEnd locate
+// their value.
+type binaryToken struct {
+	token    tokenType
+	start    int
+	end      int
+	rawStart int
+	rawEnd   int
+}
+
+type binaryContainer struct {
+	isMap bool
+	// length is the number of entries, counting keys and values separately,
+	// or -1 when it is indefinite
+	length    int
+	count     int
+	delimited bool
+}
+
+// binaryTokenizer presents a document in a binary encoding as the tokens of
+// its JSON equivalent.  The encodings have no delimiters and may describe
+// containers by their length rather than by an end marker, so the tokenizer
+// has to track each open container.  To allow seeking back over the document
+// the tokens are recorded as they are decoded, and positions are indexes
+// into that record.
+//
+// The JSON text of the tokens is built in a single buffer in document order,
+// which makes the text of any run of tokens a contiguous slice of it.
+type binaryTokenizer struct {
+	decoder binaryDecoder
+	data    []byte
+	pos     int
+	started bool
+	stack   []binaryContainer
+	tokens  []binaryToken
+	text    []byte
+	raw     []byte
+	index   int
+	item    binaryItem
+}
+
+func (tkn *binaryTokenizer) Reset(data []byte, decoder binaryDecoder) {
+	tkn.decoder = decoder
+	tkn.decoder.reset()
+	tkn.data = data
+	tkn.pos = 0
+	tkn.started = false
+	tkn.stack = tkn.stack[:0]
+	tkn.tokens = tkn.tokens[:0]
+	tkn.text = tkn.text[:0]
+	tkn.raw = tkn.raw[:0]
+	tkn.index = 0
+}
+
+func (tkn *binaryTokenizer) Position() int {
+	return tkn.index
+}
+
+func (tkn *binaryTokenizer) Seek(pos int) {
+	tkn.index = pos
+}
+
+func (tkn *binaryTokenizer) Slice(start, end int) []byte {
+	if start >= end {
+		return nil
+	}
+	return tkn.text[tkn.tokens[start].start:tkn.tokens[end-1].end]
+}
+
+func (tkn *binaryTokenizer) Step() (tokenType, []byte, int, error) {
+	if tkn.index == len(tkn.tokens) {
+		end, err := tkn.decodeToken()
+		if err != nil {
+			return tknUnknown, nil, 0, err
+		}
+		if end {
+			return tknEnd, nil, 0, nil
+		}
+	}
+
+	token := tkn.tokens[tkn.index]
+	tkn.index++
+	if token.token == tknBinary {
+		return token.token, tkn.raw[token.rawStart:token.rawEnd], 1, nil
+	}
+	return token.token, tkn.text[token.start:token.end], 1, nil
+}
+
+func (tkn *binaryTokenizer) addToken(token tokenType, start int) {
+	tkn.tokens = append(tkn.tokens, binaryToken{
+		token: token,
+		start: start,
+		end:   len(tkn.text),
+	})
+}
+
+func (tkn *binaryTokenizer) addSymbol(token tokenType, symbol byte) {
+	start := len(tkn.text)
+	tkn.text = append(tkn.text, symbol)
+	tkn.addToken(token, start)
+}
+
+// decodeToken decodes the next token of the document onto the end of the
+// record, returning true instead once the document has ended.
+func (tkn *binaryTokenizer) decodeToken() (bool, error) {
+	if len(tkn.stack) == 0 {
+		if tkn.started || tkn.pos >= len(tkn.data) {
+			return true, nil
+		}
+		tkn.started = true
+		return false, tkn.decodeValue(false)
+	}
+
+	top := &tkn.stack[len(tkn.stack)-1]
+	if top.length < 0 {
+		next, isBreak, err := tkn.decoder.decodeBreak(tkn.data, tkn.pos)
+		if err != nil {
+			return false, err
+		}
+		if isBreak {
+			if top.isMap && top.count%2 == 1 {
+				return false, ErrorMalformedDocument
+			}
+			tkn.pos = next
+			top.length = top.count
+		}
+	}
+
+	if top.count == top.length {
+		tkn.stack = tkn.stack[:len(tkn.stack)-1]
+		if top.isMap {
+			tkn.addSymbol(tknObjectEnd, '}')
+		} else {
+			tkn.addSymbol(tknArrayEnd, ']')
+		}
+		return false, nil
+	}
+
+	if top.count > 0 && !top.delimited {
+		top.delimited = true
+		if top.isMap && top.count%2 == 1 {
+			tkn.addSymbol(tknObjectKeyDelim, ':')
+		} else {
+			tkn.addSymbol(tknListDelim, ',')
+		}
+		return false, nil
+	}
+
+	top.delimited = false
+	top.count++
+	return false, tkn.decodeValue(top.isMap && top.count%2 == 1)
+}
+
+func (tkn *binaryTokenizer) decodeValue(isKey bool) error {
+	if tkn.pos >= len(tkn.data) {
+		return errBinaryUnexpectedEnd
+	}
+
+	item := &tkn.item
+	next, err := tkn.decoder.decodeItem(tkn.data, tkn.pos, item)
+	if err != nil {
+		return err
+	}
+	tkn.pos = next
+
+	if isKey && item.kind != binaryItemString {
+		return errBinaryKeyNotString
+	}
+
+	start := len(tkn.text)
+	switch item.kind {
+	case binaryItemNull:
+		tkn.text = append(tkn.text, "null"...)
+		tkn.addToken(tknNull, start)
+	case binaryItemFalse:
+		tkn.text = append(tkn.text, "false"...)
+		tkn.addToken(tknFalse, start)
+	case binaryItemTrue:
+		tkn.text = append(tkn.text, "true"...)
+		tkn.addToken(tknTrue, start)
+	case binaryItemInt:
+		tkn.text = strconv.AppendInt(tkn.text, item.i, 10)
+		tkn.addToken(tknInteger, start)
+	case binaryItemUint:
+		tkn.text = strconv.AppendUint(tkn.text, item.u, 10)
+		tkn.addToken(tknInteger, start)
+	case binaryItemNegUint:
+		tkn.text = append(tkn.text, '-')
+		if item.u == math.MaxUint64 {
+			tkn.text = append(tkn.text, "18446744073709551616"...)
+		} else {
+			tkn.text = strconv.AppendUint(tkn.text, item.u+1, 10)
+		}
+		tkn.addToken(tknInteger, start)
+	case binaryItemFloat:
+		if math.IsNaN(item.f) || math.IsInf(item.f, 0) {
+			// JSON has no way to express these
+			tkn.text = append(tkn.text, "null"...)
+			tkn.addToken(tknNull, start)
+		} else {
+			tkn.text = appendJsonFloat(tkn.text, item.f)
+			tkn.addToken(tknNumber, start)
+		}
+	case binaryItemDecimal:
+		tkn.text = append(tkn.text, item.str...)
+		tkn.addToken(tknNumber, start)
+	case binaryItemString:
+		var escaped bool
+		tkn.text, escaped = appendEscapedJsonString(tkn.text, item.str)
+		if escaped {
+			tkn.addToken(tknEscString, start)
+		} else {
+			tkn.addToken(tknString, start)
+		}
+	case binaryItemBytes:
+		// The JSON text of a binary value is its base64 encoding
+		encodedLen := base64.StdEncoding.EncodedLen(len(item.str))
+		tkn.text = append(tkn.text, '"')
+		textStart := len(tkn.text)
+		for i := 0; i < encodedLen; i++ {
+			tkn.text = append(tkn.text, 0)
+		}
+		base64.StdEncoding.Encode(tkn.text[textStart:], item.str)
+		tkn.text = append(tkn.text, '"')
+
+		rawStart := len(tkn.raw)
+		tkn.raw = append(tkn.raw, item.str...)
+		tkn.tokens = append(tkn.tokens, binaryToken{
+			token:    tknBinary,
+			start:    start,
+			end:      len(tkn.text),
+			rawStart: rawStart,
+			rawEnd:   len(tkn.raw),
+		})
+	case binaryItemArray, binaryItemMap:
+		isMap := item.kind == binaryItemMap
+		length := item.length
+		if isMap && length > 0 {
+			length *= 2
+		}
+		tkn.stack = append(tkn.stack, binaryContainer{
+			isMap:  isMap,
+			length: length,
+		})
+		if isMap {
+			tkn.addSymbol(tknObjectStart, '{')
+		} else {
+			tkn.addSymbol(tknArrayStart, '[')
+		}
+	default:
+		return ErrorMalformedDocument
+	}
+	return nil
+}
+
+// appendJsonFloat appends the JSON text of a finite float, always written
+// so that it is read back as a float rather than an integer.
+func appendJsonFloat(buf []byte, value float64) []byte {
+	start := len(buf)
+	buf = strconv.AppendFloat(buf, value, 'g', -1, 64)
+	for _, c := range buf[start:] {
+		if c == '.' || c == 'e' {
+			return buf
+		}
+	}
+	return append(buf, ".0"...)
+}
+
+// appendEscapedJsonString appends str as a quoted JSON string, returning
+// whether anything within it needed to be escaped.
+func appendEscapedJsonString(buf []byte, str []byte) ([]byte, bool) {
+	const hexDigits = "0123456789abcdef"
+
+	escaped := false
+	buf = append(buf, '"')
+	for _, c := range str {
+		switch {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+			escaped = true
+		case c < 0x20:
+			buf = append(buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			escaped = true
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return append(buf, '"'), escaped
+}
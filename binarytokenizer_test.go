@@ -0,0 +1,346 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type binaryTestField struct {
+	key   string
+	value interface{}
+}
+
+// binaryTestObject is a decoded JSON object which keeps its fields in the
+// order they appeared in, so that it can be encoded in the same order.
+type binaryTestObject []binaryTestField
+
+func decodeBinaryTestValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '{' {
+			obj := binaryTestObject{}
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeBinaryTestValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				obj = append(obj, binaryTestField{key.(string), value})
+			}
+			_, err = decoder.Token()
+			return obj, err
+		}
+
+		arr := []interface{}{}
+		for decoder.More() {
+			value, err := decodeBinaryTestValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		_, err = decoder.Token()
+		return arr, err
+	case json.Number:
+		if !strings.ContainsAny(string(token), ".eE") {
+			if value, err := strconv.ParseInt(string(token), 10, 64); err == nil {
+				return value, nil
+			}
+		}
+		return strconv.ParseFloat(string(token), 64)
+	}
+	return token, nil
+}
+
+func appendCborHead(buf []byte, major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return append(buf, major<<5|byte(arg))
+	case arg <= math.MaxUint8:
+		return append(buf, major<<5|24, byte(arg))
+	case arg <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, major<<5|25), uint16(arg))
+	case arg <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, major<<5|26), uint32(arg))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, major<<5|27), arg)
+}
+
+func appendCborValue(buf []byte, value interface{}) []byte {
+	switch value := value.(type) {
+	case nil:
+		return append(buf, 0xf6)
+	case bool:
+		if value {
+			return append(buf, 0xf5)
+		}
+		return append(buf, 0xf4)
+	case int64:
+		if value < 0 {
+			return appendCborHead(buf, cborMajorNegInt, uint64(-1-value))
+		}
+		return appendCborHead(buf, cborMajorUint, uint64(value))
+	case float64:
+		return binary.BigEndian.AppendUint64(append(buf, 0xfb), math.Float64bits(value))
+	case string:
+		return append(appendCborHead(buf, cborMajorText, uint64(len(value))), value...)
+	case []interface{}:
+		buf = appendCborHead(buf, cborMajorArray, uint64(len(value)))
+		for _, elem := range value {
+			buf = appendCborValue(buf, elem)
+		}
+		return buf
+	case binaryTestObject:
+		buf = appendCborHead(buf, cborMajorMap, uint64(len(value)))
+		for _, field := range value {
+			buf = appendCborValue(buf, field.key)
+			buf = appendCborValue(buf, field.value)
+		}
+		return buf
+	}
+	panic("unexpected test value")
+}
+
+func appendMsgpackHead(buf []byte, fixed byte, fixedMax int, sized byte, length int) []byte {
+	switch {
+	case length <= fixedMax:
+		return append(buf, fixed|byte(length))
+	case length <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, sized), uint16(length))
+	}
+	return binary.BigEndian.AppendUint32(append(buf, sized+1), uint32(length))
+}
+
+func appendMsgpackValue(buf []byte, value interface{}) []byte {
+	switch value := value.(type) {
+	case nil:
+		return append(buf, 0xc0)
+	case bool:
+		if value {
+			return append(buf, 0xc3)
+		}
+		return append(buf, 0xc2)
+	case int64:
+		if value >= -32 && value <= math.MaxInt8 {
+			return append(buf, byte(value))
+		}
+		return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(value))
+	case float64:
+		return binary.BigEndian.AppendUint64(append(buf, 0xcb), math.Float64bits(value))
+	case string:
+		if len(value) > 31 && len(value) <= math.MaxUint8 {
+			return append(append(buf, 0xd9, byte(len(value))), value...)
+		}
+		return append(appendMsgpackHead(buf, 0xa0, 31, 0xda, len(value)), value...)
+	case []interface{}:
+		buf = appendMsgpackHead(buf, 0x90, 15, 0xdc, len(value))
+		for _, elem := range value {
+			buf = appendMsgpackValue(buf, elem)
+		}
+		return buf
+	case binaryTestObject:
+		buf = appendMsgpackHead(buf, 0x80, 15, 0xde, len(value))
+		for _, field := range value {
+			buf = appendMsgpackValue(buf, field.key)
+			buf = appendMsgpackValue(buf, field.value)
+		}
+		return buf
+	}
+	panic("unexpected test value")
+}
+
+func binaryTokenizerTokens(t *testing.T, tok *binaryTokenizer) []string {
+	var tokens []string
+	for {
+		token, tokenData, _, err := tok.Step()
+		if err != nil {
+			t.Fatalf("failed to tokenize: %v", err)
+		}
+		if token == tknEnd {
+			return tokens
+		}
+		tokens = append(tokens, tokenToText(token)+" "+string(tokenData))
+	}
+}
+
+func TestBinaryTokenizerCbor(t *testing.T) {
+	assert := assert.New(t)
+
+	data := []byte{
+		0xbf,
+		0x64, 'n', 'a', 'm', 'e',
+		0x7f, 0x62, 'N', 'e', 0x62, 'i', 'l', 0xff,
+		0x63, 'a', 'g', 'e',
+		0xc1, 0x18, 30,
+		0x64, 't', 'a', 'g', 's',
+		0x9f, 0xf9, 0x3e, 0x00, 0xf6, 0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0x61, 'q',
+		0x62, '"', '\\',
+		0xff,
+	}
+
+	var decoder cborDecoder
+	var tok binaryTokenizer
+	tok.Reset(data, &decoder)
+	assert.Equal([]string{
+		"object_start {", `string "name"`, "object_key_delim :", `string "Neil"`, "list_delim ,",
+		`string "age"`, "object_key_delim :", "integer 30", "list_delim ,",
+		`string "tags"`, "object_key_delim :",
+		"array_start [", "number 1.5", "list_delim ,", "null null", "list_delim ,", "integer -18446744073709551616", "array_end ]",
+		"list_delim ,", `string "q"`, "object_key_delim :", `escaped_string "\"\\"`, "object_end }",
+	}, binaryTokenizerTokens(t, &tok))
+
+	assert.Equal(`{"name":"Neil","age":30,"tags":[1.5,null,-18446744073709551616],"q":"\"\\"}`,
+		string(tok.Slice(0, tok.Position())))
+
+	// Seeking back replays the same tokens
+	tok.Seek(11)
+	token, tokenData, _, err := tok.Step()
+	assert.Nil(err)
+	assert.Equal(tknArrayStart, token)
+	assert.Equal("[", string(tokenData))
+	assert.Equal(`[1.5,null,-18446744073709551616]`, string(tok.Slice(11, 18)))
+}
+
+func TestBinaryTokenizerMsgpack(t *testing.T) {
+	assert := assert.New(t)
+
+	data := []byte{
+		0x83,
+		0xa4, 'n', 'a', 'm', 'e', 0xd9, 0x04, 'N', 'e', 'i', 'l',
+		0xa3, 'a', 'g', 'e', 0xd0, 0xe2,
+		0xa2, 't', 's', 0xd6, 0xff, 0x00, 0x00, 0x00, 0x00,
+	}
+
+	var decoder msgpackDecoder
+	var tok binaryTokenizer
+	tok.Reset(data, &decoder)
+	binaryTokenizerTokens(t, &tok)
+	assert.Equal(`{"name":"Neil","age":-30,"ts":"1970-01-01T00:00:00Z"}`, string(tok.Slice(0, tok.Position())))
+
+	m, err := GetFilterExpressionMatcher(`name = "Neil" AND age < 0 AND ts < "2000-01-01T00:00:00Z"`)
+	assert.Nil(err)
+	match, err := m.(*FastMatcher).MatchFormat(data, FormatMsgPack)
+	assert.Nil(err)
+	assert.True(match)
+}
+
+func TestMatchFormatErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	var trans Transformer
+	m := NewFastMatcher(trans.Transform([]Expression{
+		NotExistsExpr{FieldExpr{0, []string{"missing"}}},
+	}))
+
+	for _, data := range [][]byte{
+		{0xbf, 0x61, 'a'},
+		{0xa2, 0x61, 'a', 0x01},
+		{0xa1, 0x01, 0x02},
+		{0xbf, 0x61, 'a', 0xff},
+		{0x9f, 0x01},
+		{0x7a, 0xff, 0xff, 0xff, 0xff},
+		{0xff},
+	} {
+		m.Reset()
+		_, err := m.MatchFormat(data, FormatCBOR)
+		assert.NotNil(err, "%x", data)
+	}
+
+	for _, data := range [][]byte{
+		{0x82, 0xa1, 'a'},
+		{0x81, 0x01, 0x02},
+		{0x81, 0xa1, 'a'},
+		{0xdf, 0xff, 0xff, 0xff, 0xff},
+		{0xc1},
+		{0xd4, 0x01, 0x00},
+	} {
+		m.Reset()
+		_, err := m.MatchFormat(data, FormatMsgPack)
+		assert.NotNil(err, "%x", data)
+	}
+
+	_, err := m.MatchFormat([]byte{0xa0}, DocumentFormat(7))
+	assert.Equal(ErrorUnknownDocumentFormat, err)
+}
+
+func TestMatchFormatRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		expr := genRandomExpression(rng, 3)
+
+		var trans Transformer
+		m := NewFastMatcher(trans.Transform([]Expression{expr}))
+
+		for j := 0; j < 8; j++ {
+			doc := genRandomDocument(rng, 3)
+			decoder := json.NewDecoder(bytes.NewReader(doc))
+			decoder.UseNumber()
+			value, err := decodeBinaryTestValue(decoder)
+			if err != nil {
+				t.Fatalf("failed to decode %s: %v", doc, err)
+			}
+
+			m.Reset()
+			expected, err := m.Match(doc)
+			if err != nil {
+				t.Fatalf("failed to match %s: %v", doc, err)
+			}
+
+			for format, data := range map[DocumentFormat][]byte{
+				FormatCBOR:    appendCborValue(nil, value),
+				FormatMsgPack: appendMsgpackValue(nil, value),
+				FormatBSON:    appendBsonDocument(nil, value.(binaryTestObject)),
+			} {
+				m.Reset()
+				matched, err := m.MatchFormat(data, format)
+				if err != nil {
+					t.Fatalf("failed to match %v document %s: %v", format, doc, err)
+				}
+				if matched != expected {
+					t.Fatalf("%v document matched %v, but JSON matched %v\ndoc: %s\nexpression: %v",
+						format, matched, expected, doc, expr)
+				}
+			}
+		}
+	}
+}
+
+func FuzzMatchFormat(f *testing.F) {
+	f.Add([]byte{0xbf, 0x61, 'a', 0x9f, 0x01, 0xff, 0xff})
+	f.Add([]byte{0x82, 0xa1, 'a', 0x91, 0x01, 0xa1, 'b', 0xc0})
+	f.Add([]byte{0x0f, 0, 0, 0, bsonInt32, 'a', 0, 0x02, 0, 0, 0, bsonNull, 'b', 0, 0})
+
+	exprs := []Expression{
+		NotExistsExpr{FieldExpr{0, []string{"missing"}}},
+		AnyInExpr{1, FieldExpr{0, []string{"a"}}, EqualsExpr{FieldExpr{1, nil}, ValueExpr{int64(2)}}},
+		EqualsExpr{FieldExpr{0, []string{"a"}}, FieldExpr{0, []string{"b"}}},
+	}
+	var trans Transformer
+	m := NewFastMatcher(trans.Transform(exprs))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, format := range []DocumentFormat{FormatCBOR, FormatMsgPack, FormatBSON} {
+			m.Reset()
+			m.MatchFormat(data, format)
+		}
+	})
+}
@@ -258,8 +258,22 @@ func (state *binTreeState) Resolve() {
 		return
 	}
 
-	// Do depth-first resolution of the entire tree state
+	// Loops which were never executed did not find an array to iterate,
+	// so they are false regardless of what their bodies would resolve to.
+	// These are marked first, parents before children, so that the bodies
+	// are never resolved on their own below.
 	treeLength := len(state.data)
+	for i := 0; i < treeLength; i++ {
+		if state.tree.data[i].NodeType == nodeTypeLoop && state.data[i] == binTreeStateUnknown {
+			state.MarkNode(i, false)
+		}
+
+		if state.data[0] != binTreeStateUnknown {
+			return
+		}
+	}
+
+	// Do depth-first resolution of the entire tree state
 	for i := treeLength - 1; i >= 0; i-- {
 		// If this bucket is not resolved, resolve it with false
 		if state.data[i] == binTreeStateUnknown {
@@ -273,6 +287,34 @@ func (state *binTreeState) Resolve() {
 	}
 }
 
+func (state *binTreeState) resolveNodeRecursive(index int) {
+	defNode := state.tree.data[index]
+	if defNode.NodeType == nodeTypeLoop {
+		// As with Resolve, a loop which never executed is false
+		state.MarkNode(index, false)
+		return
+	}
+	if binTreeNodeTypeHasLeft(defNode.NodeType) && !state.IsResolved(defNode.Left) {
+		state.resolveNodeRecursive(defNode.Left)
+	}
+	if binTreeNodeTypeHasRight(defNode.NodeType) && !state.IsResolved(index) && !state.IsResolved(defNode.Right) {
+		state.resolveNodeRecursive(defNode.Right)
+	}
+	if !state.IsResolved(index) {
+		state.MarkNode(index, false)
+	}
+}
+
+// ResolveNode is the equivalent of Resolve for the subtree rooted at the
+// given index.  This is used to finish resolving a single loop iteration.
+func (state *binTreeState) ResolveNode(index int) {
+	if state.IsResolved(index) {
+		return
+	}
+
+	state.resolveNodeRecursive(index)
+}
+
 func (state *binTreeState) Reset() {
 	state.stallIndex = 0
 	for i := range state.data {
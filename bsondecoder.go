@@ -0,0 +1,345 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"time"
+)
+
+const (
+	bsonDouble        = 0x01
+	bsonString        = 0x02
+	bsonDocument      = 0x03
+	bsonArray         = 0x04
+	bsonBinary        = 0x05
+	bsonUndefined     = 0x06
+	bsonObjectId      = 0x07
+	bsonBoolean       = 0x08
+	bsonDateTime      = 0x09
+	bsonNull          = 0x0a
+	bsonRegex         = 0x0b
+	bsonJavaScript    = 0x0d
+	bsonSymbol        = 0x0e
+	bsonCodeWithScope = 0x0f
+	bsonInt32         = 0x10
+	bsonTimestamp     = 0x11
+	bsonInt64         = 0x12
+	bsonDecimal128    = 0x13
+
+	bsonBinaryOld = 0x02
+
+	bsonDecimalBias = 6176
+)
+
+type bsonContainer struct {
+	isArray bool
+	// end is the position after the terminator of the document
+	end int
+}
+
+// bsonDecoder decodes documents encoded as BSON.  BSON describes each
+// element as a type and a name followed by the value, so once the name of
+// a field has been decoded as its key, the type is held until its value is
+// decoded.  The names of array elements are skipped.
+//
+// ObjectIds are decoded as hex strings, datetimes as RFC 3339 strings,
+// regular expressions as their pattern and JavaScript as its code.
+// Decimal128 values are decoded as numbers, or as null when they are NaN or
+// infinite.  DBPointers, MinKey and MaxKey are not supported.
+type bsonDecoder struct {
+	stack       []bsonContainer
+	pending     bool
+	pendingType byte
+	text        []byte
+}
+
+func (d *bsonDecoder) reset() {
+	d.stack = d.stack[:0]
+	d.pending = false
+}
+
+// bsonLength reads the int32 length at pos, which must be at least min and
+// no more than max.
+func bsonLength(data []byte, pos int, limit int, min int, max int) (int, error) {
+	if limit-pos < 4 {
+		return 0, errBinaryUnexpectedEnd
+	}
+	length := int(int32(binary.LittleEndian.Uint32(data[pos:])))
+	if length < min {
+		return 0, fmt.Errorf("invalid BSON length %d", length)
+	}
+	if length > max {
+		return 0, errBinaryUnexpectedEnd
+	}
+	return length, nil
+}
+
+// bsonCString finds the end of the null terminated string at pos, returning
+// the position after its terminator.
+func bsonCString(data []byte, pos int, limit int) (int, error) {
+	end := bytes.IndexByte(data[pos:limit], 0)
+	if end < 0 {
+		return pos, errBinaryUnexpectedEnd
+	}
+	return pos + end + 1, nil
+}
+
+// bsonStringValue reads a string value, which is an int32 length followed
+// by the string and a null terminator.
+func bsonStringValue(data []byte, pos int, limit int) ([]byte, int, error) {
+	length, err := bsonLength(data, pos, limit, 1, limit-pos-4)
+	if err != nil {
+		return nil, pos, err
+	}
+	end := pos + 4 + length
+	if data[end-1] != 0 {
+		return nil, pos, fmt.Errorf("BSON string is not null terminated")
+	}
+	return data[pos+4 : end-1], end, nil
+}
+
+// appendBsonDecimal appends the JSON text of a Decimal128 value in the IEEE
+// 754 binary integer decimal encoding, returning false if it is NaN or
+// infinite.
+func appendBsonDecimal(buf []byte, low, high uint64) ([]byte, bool) {
+	var exp int
+	var coeffHigh uint64
+	if (high>>61)&3 == 3 {
+		if (high>>59)&3 == 3 {
+			return buf, false
+		}
+		// The coefficient would exceed the largest one allowed, so the
+		// value is not canonical and is treated as zero
+		exp = int(high>>47) & 0x3fff
+		coeffHigh, low = 0, 0
+	} else {
+		exp = int(high>>49) & 0x3fff
+		coeffHigh = high & (1<<49 - 1)
+	}
+
+	const tenPow19 = 10000000000000000000
+	const tenPow15 = 1000000000000000
+	upper, lower := bits.Div64(coeffHigh, low, tenPow19)
+	if upper >= tenPow15 {
+		upper, lower = 0, 0
+	}
+
+	if high>>63 != 0 {
+		buf = append(buf, '-')
+	}
+	if upper > 0 {
+		buf = strconv.AppendUint(buf, upper, 10)
+		digits := strconv.AppendUint(make([]byte, 0, 20), lower, 10)
+		for i := len(digits); i < 19; i++ {
+			buf = append(buf, '0')
+		}
+		buf = append(buf, digits...)
+	} else {
+		buf = strconv.AppendUint(buf, lower, 10)
+	}
+	buf = append(buf, 'E')
+	return strconv.AppendInt(buf, int64(exp-bsonDecimalBias), 10), true
+}
+
+func (d *bsonDecoder) pushDocument(data []byte, pos int, limit int, isArray bool, item *binaryItem) (int, error) {
+	length, err := bsonLength(data, pos, limit, 5, limit-pos)
+	if err != nil {
+		return pos, err
+	}
+	d.stack = append(d.stack, bsonContainer{
+		isArray: isArray,
+		end:     pos + length,
+	})
+
+	item.kind = binaryItemMap
+	if isArray {
+		item.kind = binaryItemArray
+	}
+	item.length = -1
+	return pos + 4, nil
+}
+
+func (d *bsonDecoder) decodeBreak(data []byte, pos int) (int, bool, error) {
+	if d.pending || len(d.stack) == 0 {
+		return pos, false, nil
+	}
+
+	top := d.stack[len(d.stack)-1]
+	if data[pos] != 0 {
+		if pos >= top.end-1 {
+			return pos, false, fmt.Errorf("BSON document is not null terminated")
+		}
+		return pos, false, nil
+	}
+	if pos != top.end-1 {
+		return pos, false, fmt.Errorf("BSON document ended before its length")
+	}
+
+	d.stack = d.stack[:len(d.stack)-1]
+	return pos + 1, true, nil
+}
+
+func (d *bsonDecoder) decodeItem(data []byte, pos int, item *binaryItem) (int, error) {
+	if len(d.stack) == 0 {
+		return d.pushDocument(data, pos, len(data), false, item)
+	}
+
+	top := d.stack[len(d.stack)-1]
+	// Values may not run into the terminator of their document
+	limit := top.end - 1
+
+	if d.pending {
+		d.pending = false
+		return d.decodeValue(data, pos, limit, d.pendingType, item)
+	}
+
+	if pos >= limit {
+		return pos, errBinaryUnexpectedEnd
+	}
+	elemType := data[pos]
+	next, err := bsonCString(data, pos+1, limit)
+	if err != nil {
+		return pos, err
+	}
+
+	if top.isArray {
+		return d.decodeValue(data, next, limit, elemType, item)
+	}
+
+	d.pending = true
+	d.pendingType = elemType
+	item.kind = binaryItemString
+	item.str = data[pos+1 : next-1]
+	return next, nil
+}
+
+func (d *bsonDecoder) decodeValue(data []byte, pos int, limit int, elemType byte, item *binaryItem) (int, error) {
+	fixedSize := 0
+	switch elemType {
+	case bsonDouble, bsonDateTime, bsonTimestamp, bsonInt64:
+		fixedSize = 8
+	case bsonObjectId:
+		fixedSize = 12
+	case bsonBoolean:
+		fixedSize = 1
+	case bsonInt32:
+		fixedSize = 4
+	case bsonDecimal128:
+		fixedSize = 16
+	}
+	if limit-pos < fixedSize {
+		return pos, errBinaryUnexpectedEnd
+	}
+
+	switch elemType {
+	case bsonDouble:
+		item.kind = binaryItemFloat
+		item.f = math.Float64frombits(binary.LittleEndian.Uint64(data[pos:]))
+	case bsonString, bsonJavaScript, bsonSymbol:
+		str, next, err := bsonStringValue(data, pos, limit)
+		if err != nil {
+			return pos, err
+		}
+		item.kind = binaryItemString
+		item.str = str
+		return next, nil
+	case bsonDocument, bsonArray:
+		return d.pushDocument(data, pos, limit, elemType == bsonArray, item)
+	case bsonBinary:
+		length, err := bsonLength(data, pos, limit, 0, limit-pos-5)
+		if err != nil {
+			return pos, err
+		}
+		subtype := data[pos+4]
+		value := data[pos+5 : pos+5+length]
+		if subtype == bsonBinaryOld && len(value) >= 4 &&
+			int(binary.LittleEndian.Uint32(value)) == len(value)-4 {
+			// The old binary subtype repeats the length within the value
+			value = value[4:]
+		}
+		item.kind = binaryItemBytes
+		item.str = value
+		return pos + 5 + length, nil
+	case bsonUndefined, bsonNull:
+		item.kind = binaryItemNull
+	case bsonObjectId:
+		d.text = append(d.text[:0], make([]byte, 24)...)
+		hex.Encode(d.text, data[pos:pos+12])
+		item.kind = binaryItemString
+		item.str = d.text
+	case bsonBoolean:
+		switch data[pos] {
+		case 0:
+			item.kind = binaryItemFalse
+		case 1:
+			item.kind = binaryItemTrue
+		default:
+			return pos, fmt.Errorf("invalid BSON boolean %d", data[pos])
+		}
+	case bsonDateTime:
+		millis := int64(binary.LittleEndian.Uint64(data[pos:]))
+		d.text = time.UnixMilli(millis).UTC().AppendFormat(d.text[:0], time.RFC3339Nano)
+		item.kind = binaryItemString
+		item.str = d.text
+	case bsonRegex:
+		patternEnd, err := bsonCString(data, pos, limit)
+		if err != nil {
+			return pos, err
+		}
+		next, err := bsonCString(data, patternEnd, limit)
+		if err != nil {
+			return pos, err
+		}
+		item.kind = binaryItemString
+		item.str = data[pos : patternEnd-1]
+		return next, nil
+	case bsonCodeWithScope:
+		length, err := bsonLength(data, pos, limit, 14, limit-pos)
+		if err != nil {
+			return pos, err
+		}
+		code, _, err := bsonStringValue(data, pos+4, pos+length)
+		if err != nil {
+			return pos, err
+		}
+		item.kind = binaryItemString
+		item.str = code
+		return pos + length, nil
+	case bsonInt32:
+		item.kind = binaryItemInt
+		item.i = int64(int32(binary.LittleEndian.Uint32(data[pos:])))
+	case bsonInt64:
+		item.kind = binaryItemInt
+		item.i = int64(binary.LittleEndian.Uint64(data[pos:]))
+	case bsonTimestamp:
+		value := binary.LittleEndian.Uint64(data[pos:])
+		if value <= math.MaxInt64 {
+			item.kind = binaryItemInt
+			item.i = int64(value)
+		} else {
+			item.kind = binaryItemUint
+			item.u = value
+		}
+	case bsonDecimal128:
+		low := binary.LittleEndian.Uint64(data[pos:])
+		high := binary.LittleEndian.Uint64(data[pos+8:])
+		var finite bool
+		d.text, finite = appendBsonDecimal(d.text[:0], low, high)
+		if finite {
+			item.kind = binaryItemDecimal
+			item.str = d.text
+		} else {
+			item.kind = binaryItemNull
+		}
+	default:
+		return pos, fmt.Errorf("unsupported BSON type 0x%02x", elemType)
+	}
+	return pos + fixedSize, nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bsonTestValue is an element value which is encoded exactly as given.
+type bsonTestValue struct {
+	elemType byte
+	data     []byte
+}
+
+func appendBsonDocument(buf []byte, fields binaryTestObject) []byte {
+	start := len(buf)
+	buf = append(buf, 0, 0, 0, 0)
+	for _, field := range fields {
+		buf = appendBsonElement(buf, field.key, field.value)
+	}
+	buf = append(buf, 0)
+	binary.LittleEndian.PutUint32(buf[start:], uint32(len(buf)-start))
+	return buf
+}
+
+func appendBsonElement(buf []byte, name string, value interface{}) []byte {
+	var elemType byte
+	var data []byte
+	switch value := value.(type) {
+	case nil:
+		elemType = bsonNull
+	case bool:
+		elemType = bsonBoolean
+		data = []byte{0}
+		if value {
+			data[0] = 1
+		}
+	case int64:
+		if value >= math.MinInt32 && value <= math.MaxInt32 {
+			elemType = bsonInt32
+			data = binary.LittleEndian.AppendUint32(nil, uint32(value))
+		} else {
+			elemType = bsonInt64
+			data = binary.LittleEndian.AppendUint64(nil, uint64(value))
+		}
+	case float64:
+		elemType = bsonDouble
+		data = binary.LittleEndian.AppendUint64(nil, math.Float64bits(value))
+	case string:
+		elemType = bsonString
+		data = binary.LittleEndian.AppendUint32(nil, uint32(len(value)+1))
+		data = append(append(data, value...), 0)
+	case []interface{}:
+		elemType = bsonArray
+		var fields binaryTestObject
+		for i, elem := range value {
+			fields = append(fields, binaryTestField{strconv.Itoa(i), elem})
+		}
+		data = appendBsonDocument(nil, fields)
+	case binaryTestObject:
+		elemType = bsonDocument
+		data = appendBsonDocument(nil, value)
+	case bsonTestValue:
+		elemType = value.elemType
+		data = value.data
+	default:
+		panic("unexpected test value")
+	}
+
+	buf = append(buf, elemType)
+	buf = append(append(buf, name...), 0)
+	return append(buf, data...)
+}
+
+func bsonTestDecimal(low, high uint64) bsonTestValue {
+	data := binary.LittleEndian.AppendUint64(nil, low)
+	return bsonTestValue{bsonDecimal128, binary.LittleEndian.AppendUint64(data, high)}
+}
+
+func TestBsonDecoderTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	data := appendBsonDocument(nil, binaryTestObject{
+		{"_id", bsonTestValue{bsonObjectId, []byte{
+			0x5f, 0x1d, 0x7a, 0x3b, 0x9c, 0x8e, 0x4a, 0x2b, 0x1c, 0x0d, 0x9e, 0x8f}}},
+		{"created", bsonTestValue{bsonDateTime,
+			binary.LittleEndian.AppendUint64(nil, 1577934245123)}},
+		{"price", bsonTestDecimal(250, 6174<<49)},
+		{"small", int64(-7)},
+		{"big", int64(1) << 40},
+		{"data", bsonTestValue{bsonBinary, []byte{3, 0, 0, 0, 0, 1, 2, 3}}},
+		{"old", bsonTestValue{bsonBinary, []byte{6, 0, 0, 0, bsonBinaryOld, 2, 0, 0, 0, 1, 2}}},
+		{"re", bsonTestValue{bsonRegex, []byte{'^', 'a', 0, 'i', 0}}},
+		{"ts", bsonTestValue{bsonTimestamp, []byte{1, 0, 0, 0, 2, 0, 0, 0}}},
+		{"undef", bsonTestValue{bsonUndefined, nil}},
+		{"tags", []interface{}{"a", int64(1), binaryTestObject{{"b", true}}}},
+	})
+
+	var decoder bsonDecoder
+	var tok binaryTokenizer
+	tok.Reset(data, &decoder)
+	binaryTokenizerTokens(t, &tok)
+	assert.Equal(`{"_id":"5f1d7a3b9c8e4a2b1c0d9e8f","created":"2020-01-02T03:04:05.123Z",`+
+		`"price":250E-2,"small":-7,"big":1099511627776,"data":"AQID","old":"AQI=",`+
+		`"re":"^a","ts":8589934593,"undef":null,"tags":["a",1,{"b":true}]}`,
+		string(tok.Slice(0, tok.Position())))
+
+	m, err := GetFilterExpressionMatcher(`_id = "5f1d7a3b9c8e4a2b1c0d9e8f" AND ` +
+		`DATE(created) > DATE("2020-01-02T03:04:05Z") AND price > 2.4 AND price < 2.6 AND ` +
+		`small < 0 AND big > 1000000000000 AND tags[2].b = true`)
+	assert.Nil(err)
+	match, err := m.(*FastMatcher).MatchFormat(data, FormatBSON)
+	assert.Nil(err)
+	assert.True(match)
+
+	var trans Transformer
+	fm := NewFastMatcher(trans.Transform([]Expression{
+		AndExpr{
+			EqualsExpr{FieldExpr{0, []string{"data"}}, ValueExpr{[]byte{1, 2, 3}}},
+			NotEqualsExpr{FieldExpr{0, []string{"old"}}, ValueExpr{[]byte{1, 2, 3}}},
+			GreaterThanExpr{FieldExpr{0, []string{"old"}}, ValueExpr{[]byte{1}}},
+		},
+	}))
+	match, err = fm.MatchFormat(data, FormatBSON)
+	assert.Nil(err)
+	assert.True(match)
+}
+
+func TestBsonDecimal(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		low, high uint64
+		text      string
+	}{
+		{250, 6174 << 49, "250E-2"},
+		{1, 1<<63 | 6176<<49, "-1E0"},
+		{0, 6176 << 49, "0E0"},
+		{0x378d8e63ffffffff, 0x3041ed09bead87c0, "9999999999999999999999999999999999E0"},
+		{0x378d8e6400000000, 0x3040000000000000 | 0x1ed09bead87c0, "0E0"},
+		{0, 0x6000000000000000 | 6176<<47, "0E0"},
+		{0, 0x7800000000000000, ""},
+		{0, 0x7c00000000000000, ""},
+	}
+	for _, test := range tests {
+		text, finite := appendBsonDecimal(nil, test.low, test.high)
+		assert.Equal(test.text != "", finite, "%x %x", test.high, test.low)
+		assert.Equal(test.text, string(text), "%x %x", test.high, test.low)
+	}
+}
+
+func TestBsonDecoderErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	var trans Transformer
+	m := NewFastMatcher(trans.Transform([]Expression{
+		NotExistsExpr{FieldExpr{0, []string{"missing"}}},
+	}))
+
+	for _, data := range [][]byte{
+		{0x04, 0, 0, 0},
+		{0x10, 0, 0, 0, 0},
+		{0x08, 0, 0, 0, bsonNull, 'a', 0, 1},
+		{0x09, 0, 0, 0, 0, 0, 0, 0, 0},
+		{0x09, 0, 0, 0, bsonBoolean, 'a', 0, 2, 0},
+		{0x08, 0, 0, 0, 0xff, 'a', 0, 0},
+		{0x0d, 0, 0, 0, bsonString, 'a', 0, 0x05, 0, 0, 0, 'b', 0},
+		{0x0e, 0, 0, 0, bsonString, 'a', 0, 0x02, 0, 0, 0, 'b', 'c', 0},
+		{0x0d, 0, 0, 0, bsonDocument, 'a', 0, 0x06, 0, 0, 0, 0, 0},
+		{0x0a, 0, 0, 0, bsonInt32, 'a', 0, 1, 0, 0},
+	} {
+		m.Reset()
+		_, err := m.MatchFormat(data, FormatBSON)
+		assert.NotNil(err, "%x", data)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	cborMajorUint   = 0
+	cborMajorNegInt = 1
+	cborMajorBytes  = 2
+	cborMajorText   = 3
+	cborMajorArray  = 4
+	cborMajorMap    = 5
+	cborMajorTag    = 6
+	cborMajorSimple = 7
+
+	cborIndefinite = 31
+	cborBreak      = 0xff
+)
+
+// cborDecoder decodes documents encoded as CBOR (RFC 8949).  Tags are
+// skipped, leaving only the value they describe.  The undefined value is
+// decoded as null.
+type cborDecoder struct {
+	chunks []byte
+}
+
+func (d *cborDecoder) reset() {
+}
+
+func (d *cborDecoder) decodeBreak(data []byte, pos int) (int, bool, error) {
+	if pos < len(data) && data[pos] == cborBreak {
+		return pos + 1, true, nil
+	}
+	return pos, false, nil
+}
+
+// cborArgument decodes the argument which follows an initial byte with the
+// given additional information.
+func cborArgument(data []byte, pos int, info byte) (uint64, int, error) {
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), pos, nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, pos, fmt.Errorf("invalid CBOR additional information %d", info)
+	}
+
+	if len(data)-pos < size {
+		return 0, pos, errBinaryUnexpectedEnd
+	}
+	switch size {
+	case 1:
+		return uint64(data[pos]), pos + 1, nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(data[pos:])), pos + 2, nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(data[pos:])), pos + 4, nil
+	}
+	return binary.BigEndian.Uint64(data[pos:]), pos + 8, nil
+}
+
+func cborHalfFloat(bits uint16) float64 {
+	exp := int(bits>>10) & 0x1f
+	mant := float64(bits & 0x3ff)
+
+	var value float64
+	switch exp {
+	case 0:
+		value = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			value = math.Inf(1)
+		} else {
+			value = math.NaN()
+		}
+	default:
+		value = math.Ldexp(mant+1024, exp-25)
+	}
+
+	if bits&0x8000 != 0 {
+		return -value
+	}
+	return value
+}
+
+// decodeChunks joins the chunks of a string of indefinite length.
+func (d *cborDecoder) decodeChunks(data []byte, pos int, major byte) ([]byte, int, error) {
+	d.chunks = d.chunks[:0]
+	for {
+		if pos >= len(data) {
+			return nil, pos, errBinaryUnexpectedEnd
+		}
+		if data[pos] == cborBreak {
+			return d.chunks, pos + 1, nil
+		}
+
+		initial := data[pos]
+		if initial>>5 != major || initial&0x1f == cborIndefinite {
+			return nil, pos, fmt.Errorf("invalid chunk in CBOR string of indefinite length")
+		}
+		length, next, err := cborArgument(data, pos+1, initial&0x1f)
+		if err != nil {
+			return nil, pos, err
+		}
+		if length > uint64(len(data)-next) {
+			return nil, pos, errBinaryUnexpectedEnd
+		}
+		d.chunks = append(d.chunks, data[next:next+int(length)]...)
+		pos = next + int(length)
+	}
+}
+
+func (d *cborDecoder) decodeItem(data []byte, pos int, item *binaryItem) (int, error) {
+	var initial byte
+	for {
+		if pos >= len(data) {
+			return pos, errBinaryUnexpectedEnd
+		}
+		initial = data[pos]
+		pos++
+		if initial>>5 != cborMajorTag {
+			break
+		}
+
+		_, next, err := cborArgument(data, pos, initial&0x1f)
+		if err != nil {
+			return pos, err
+		}
+		pos = next
+	}
+
+	major := initial >> 5
+	info := initial & 0x1f
+
+	if major == cborMajorSimple {
+		switch info {
+		case 20:
+			item.kind = binaryItemFalse
+		case 21:
+			item.kind = binaryItemTrue
+		case 22, 23:
+			item.kind = binaryItemNull
+		case 25:
+			if len(data)-pos < 2 {
+				return pos, errBinaryUnexpectedEnd
+			}
+			item.kind = binaryItemFloat
+			item.f = cborHalfFloat(binary.BigEndian.Uint16(data[pos:]))
+			return pos + 2, nil
+		case 26:
+			if len(data)-pos < 4 {
+				return pos, errBinaryUnexpectedEnd
+			}
+			item.kind = binaryItemFloat
+			item.f = float64(math.Float32frombits(binary.BigEndian.Uint32(data[pos:])))
+			return pos + 4, nil
+		case 27:
+			if len(data)-pos < 8 {
+				return pos, errBinaryUnexpectedEnd
+			}
+			item.kind = binaryItemFloat
+			item.f = math.Float64frombits(binary.BigEndian.Uint64(data[pos:]))
+			return pos + 8, nil
+		default:
+			return pos, fmt.Errorf("unsupported CBOR simple value %d", info)
+		}
+		return pos, nil
+	}
+
+	if info == cborIndefinite {
+		switch major {
+		case cborMajorBytes, cborMajorText:
+			str, next, err := d.decodeChunks(data, pos, major)
+			if err != nil {
+				return pos, err
+			}
+			item.kind = binaryItemString
+			if major == cborMajorBytes {
+				item.kind = binaryItemBytes
+			}
+			item.str = str
+			return next, nil
+		case cborMajorArray:
+			item.kind = binaryItemArray
+		case cborMajorMap:
+			item.kind = binaryItemMap
+		default:
+			return pos, fmt.Errorf("invalid indefinite length for CBOR major type %d", major)
+		}
+		item.length = -1
+		return pos, nil
+	}
+
+	arg, pos, err := cborArgument(data, pos, info)
+	if err != nil {
+		return pos, err
+	}
+
+	switch major {
+	case cborMajorUint:
+		if arg <= math.MaxInt64 {
+			item.kind = binaryItemInt
+			item.i = int64(arg)
+		} else {
+			item.kind = binaryItemUint
+			item.u = arg
+		}
+	case cborMajorNegInt:
+		if arg <= math.MaxInt64 {
+			item.kind = binaryItemInt
+			item.i = -1 - int64(arg)
+		} else {
+			item.kind = binaryItemNegUint
+			item.u = arg
+		}
+	case cborMajorBytes, cborMajorText:
+		if arg > uint64(len(data)-pos) {
+			return pos, errBinaryUnexpectedEnd
+		}
+		item.kind = binaryItemString
+		if major == cborMajorBytes {
+			item.kind = binaryItemBytes
+		}
+		item.str = data[pos : pos+int(arg)]
+		pos += int(arg)
+	case cborMajorArray:
+		// Every entry takes at least a byte
+		if arg > uint64(len(data)-pos) {
+			return pos, errBinaryUnexpectedEnd
+		}
+		item.kind = binaryItemArray
+		item.length = int(arg)
+	case cborMajorMap:
+		if arg > uint64(len(data)-pos)/2 {
+			return pos, errBinaryUnexpectedEnd
+		}
+		item.kind = binaryItemMap
+		item.length = int(arg)
+	}
+	return pos, nil
+}
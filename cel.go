@@ -0,0 +1,891 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// celMaxDepth limits how deeply parenthesis, operators and calls may be
+// nested within a CEL expression.
+const celMaxDepth = 128
+
+type celTokenKind int
+
+const (
+	celEOF celTokenKind = iota
+	celIdent
+	celPunct
+	celInt
+	celUint
+	celDouble
+	celString
+	celBytes
+)
+
+type celToken struct {
+	kind celTokenKind
+	text string
+	pos  int
+
+	// The decoded value of string and bytes literals
+	value string
+}
+
+var celReserved = map[string]bool{
+	"as": true, "break": true, "const": true, "continue": true, "else": true,
+	"for": true, "function": true, "if": true, "import": true, "let": true,
+	"loop": true, "package": true, "namespace": true, "return": true,
+	"var": true, "void": true, "while": true,
+}
+
+// celPuncts lists the operators and punctuation of CEL, longest first.
+var celPuncts = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"<", ">", "!", "+", "-", "*", "/", "%", ".", ",", "(", ")", "[", "]", "{", "}", "?", ":",
+}
+
+// celAbort is raised to abandon parsing a CEL expression.
+type celAbort struct {
+	err *ParseError
+}
+
+// celOperand is the result of parsing part of an expression.  value is set
+// when it can be compared, test when it is a condition, and list when it
+// is a list literal, which may only be searched with `in`.
+type celOperand struct {
+	value  Expression
+	test   Expression
+	list   []Expression
+	isList bool
+	pos    int
+}
+
+type celParser struct {
+	text    string
+	tokens  []celToken
+	pos     int
+	depth   int
+	vars    map[string]VariableID
+	nextVar VariableID
+}
+
+func (p *celParser) failAt(pos int, format string, args ...interface{}) {
+	token := ""
+	if pos < len(p.text) {
+		_, size := utf8.DecodeRuneInString(p.text[pos:])
+		token = p.text[pos : pos+size]
+	}
+	panic(celAbort{newParseError(p.text, pos, token, nil, fmt.Errorf(format, args...))})
+}
+
+func (p *celParser) fail(format string, args ...interface{}) {
+	p.failAt(p.token().pos, format, args...)
+}
+
+func (p *celParser) enter() {
+	p.depth++
+	if p.depth > celMaxDepth {
+		token := p.token()
+		panic(celAbort{newParseError(p.text, token.pos, token.text, nil, ErrorFilterExpressionTooDeep)})
+	}
+}
+
+func (p *celParser) leave() {
+	p.depth--
+}
+
+func celIsIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func celIsDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func celIsHexDigit(c byte) bool {
+	return celIsDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func (p *celParser) lex() {
+	text := p.text
+	pos := 0
+	for {
+		for pos < len(text) {
+			if c := text[pos]; c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' {
+				pos++
+			} else if strings.HasPrefix(text[pos:], "//") {
+				for pos < len(text) && text[pos] != '\n' {
+					pos++
+				}
+			} else {
+				break
+			}
+		}
+		if pos >= len(text) {
+			p.tokens = append(p.tokens, celToken{kind: celEOF, pos: pos})
+			return
+		}
+
+		start := pos
+		c := text[pos]
+		switch {
+		case celIsIdentStart(c):
+			for pos < len(text) && (celIsIdentStart(text[pos]) || celIsDigit(text[pos])) {
+				pos++
+			}
+			prefix := strings.ToLower(text[start:pos])
+			if pos < len(text) && (text[pos] == '"' || text[pos] == '\'') &&
+				(prefix == "r" || prefix == "b" || prefix == "rb" || prefix == "br") {
+				token := p.lexString(start, pos, prefix)
+				p.tokens = append(p.tokens, token)
+				pos = start + len(token.text)
+				continue
+			}
+			p.tokens = append(p.tokens, celToken{kind: celIdent, text: text[start:pos], pos: start})
+		case c == '"' || c == '\'':
+			token := p.lexString(start, pos, "")
+			p.tokens = append(p.tokens, token)
+			pos = start + len(token.text)
+		case celIsDigit(c) || (c == '.' && pos+1 < len(text) && celIsDigit(text[pos+1])):
+			token := p.lexNumber(start)
+			p.tokens = append(p.tokens, token)
+			pos = start + len(token.text)
+		default:
+			matched := false
+			for _, punct := range celPuncts {
+				if strings.HasPrefix(text[pos:], punct) {
+					p.tokens = append(p.tokens, celToken{kind: celPunct, text: punct, pos: start})
+					pos += len(punct)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				p.failAt(start, "unexpected `%s`", p.text[start:start+1])
+			}
+		}
+	}
+}
+
+func (p *celParser) lexNumber(start int) celToken {
+	text := p.text
+	pos := start
+
+	if strings.HasPrefix(text[pos:], "0x") || strings.HasPrefix(text[pos:], "0X") {
+		pos += 2
+		for pos < len(text) && celIsHexDigit(text[pos]) {
+			pos++
+		}
+		if pos == start+2 {
+			p.failAt(start, "invalid number")
+		}
+		if pos < len(text) && (text[pos] == 'u' || text[pos] == 'U') {
+			return celToken{kind: celUint, text: text[start : pos+1], pos: start}
+		}
+		return celToken{kind: celInt, text: text[start:pos], pos: start}
+	}
+
+	kind := celInt
+	for pos < len(text) && celIsDigit(text[pos]) {
+		pos++
+	}
+	if pos+1 < len(text) && text[pos] == '.' && celIsDigit(text[pos+1]) {
+		kind = celDouble
+		pos++
+		for pos < len(text) && celIsDigit(text[pos]) {
+			pos++
+		}
+	}
+	if pos < len(text) && (text[pos] == 'e' || text[pos] == 'E') {
+		kind = celDouble
+		pos++
+		if pos < len(text) && (text[pos] == '+' || text[pos] == '-') {
+			pos++
+		}
+		digits := pos
+		for pos < len(text) && celIsDigit(text[pos]) {
+			pos++
+		}
+		if pos == digits {
+			p.failAt(start, "invalid number")
+		}
+	}
+	if kind == celInt && pos < len(text) && (text[pos] == 'u' || text[pos] == 'U') {
+		return celToken{kind: celUint, text: text[start : pos+1], pos: start}
+	}
+	return celToken{kind: kind, text: text[start:pos], pos: start}
+}
+
+// lexString lexes a string or bytes literal whose quotes begin at pos,
+// after any prefix which starts at start.
+func (p *celParser) lexString(start, pos int, prefix string) celToken {
+	text := p.text
+	raw := strings.Contains(prefix, "r")
+	isBytes := strings.Contains(prefix, "b")
+
+	quote := text[pos : pos+1]
+	if strings.HasPrefix(text[pos:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	pos += len(quote)
+
+	var out []byte
+	for {
+		if pos >= len(text) {
+			p.failAt(start, "unterminated string")
+		}
+		if strings.HasPrefix(text[pos:], quote) {
+			pos += len(quote)
+			break
+		}
+
+		c := text[pos]
+		if (c == '\n' || c == '\r') && len(quote) == 1 {
+			p.failAt(pos, "unterminated string")
+		}
+		if c != '\\' || raw {
+			out = append(out, c)
+			pos++
+			continue
+		}
+
+		escapePos := pos
+		pos++
+		if pos >= len(text) {
+			p.failAt(escapePos, "invalid escape sequence")
+		}
+		switch c := text[pos]; c {
+		case 'a':
+			out = append(out, '\a')
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'v':
+			out = append(out, '\v')
+		case '\\', '?', '"', '\'', '`':
+			out = append(out, c)
+		case 'x', 'X', 'u', 'U', '0', '1', '2', '3':
+			digits, base := 2, 16
+			switch {
+			case c == 'u':
+				digits = 4
+			case c == 'U':
+				digits = 8
+			case c >= '0' && c <= '3':
+				digits, base = 3, 8
+				pos--
+			}
+			if (c == 'u' || c == 'U') && isBytes {
+				p.failAt(escapePos, "invalid escape sequence")
+			}
+			if len(text)-pos-1 < digits {
+				p.failAt(escapePos, "invalid escape sequence")
+			}
+			value, err := strconv.ParseUint(text[pos+1:pos+1+digits], base, 32)
+			if err != nil || value > utf8.MaxRune || (value >= 0xd800 && value < 0xe000) {
+				p.failAt(escapePos, "invalid escape sequence")
+			}
+			pos += digits
+			if isBytes {
+				out = append(out, byte(value))
+			} else {
+				out = utf8.AppendRune(out, rune(value))
+			}
+		default:
+			p.failAt(escapePos, "invalid escape sequence")
+		}
+		pos++
+	}
+
+	kind := celString
+	if isBytes {
+		kind = celBytes
+	}
+	return celToken{kind: kind, text: text[start:pos], pos: start, value: string(out)}
+}
+
+func (p *celParser) token() celToken {
+	return p.tokens[p.pos]
+}
+
+func (p *celParser) isPunct(punct string) bool {
+	token := p.token()
+	return token.kind == celPunct && token.text == punct
+}
+
+func (p *celParser) consume(punct string) bool {
+	if p.isPunct(punct) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *celParser) expect(punct string) {
+	if !p.consume(punct) {
+		p.fail("expected `%s`", punct)
+	}
+}
+
+func (p *celParser) expectIdent() celToken {
+	token := p.token()
+	if token.kind != celIdent {
+		p.fail("expected an identifier")
+	}
+	p.pos++
+	return token
+}
+
+// condition returns an operand as a condition.  Fields and literals are
+// expected to be booleans.
+func (p *celParser) condition(operand celOperand) Expression {
+	if operand.test != nil {
+		return operand.test
+	}
+	switch value := operand.value.(type) {
+	case FieldExpr:
+		return EqualsExpr{value, ValueExpr{true}}
+	case ValueExpr:
+		if value.Value == true {
+			return TrueExpr{}
+		} else if value.Value == false {
+			return FalseExpr{}
+		}
+	}
+	p.failAt(operand.pos, "expected a condition")
+	return nil
+}
+
+// valueOf returns an operand as a value which can be compared.
+func (p *celParser) valueOf(operand celOperand) Expression {
+	if operand.value == nil {
+		if operand.isList {
+			p.failAt(operand.pos, "lists can only be searched with `in`")
+		}
+		p.failAt(operand.pos, "expected a value rather than a condition")
+	}
+	return operand.value
+}
+
+func (p *celParser) parseExpr() celOperand {
+	p.enter()
+	defer p.leave()
+
+	operand := p.parseOr()
+	if p.isPunct("?") {
+		p.fail("the conditional operator is not supported")
+	}
+	return operand
+}
+
+func (p *celParser) parseOr() celOperand {
+	first := p.parseAnd()
+	if !p.isPunct("||") {
+		return first
+	}
+
+	exprs := OrExpr{p.condition(first)}
+	for p.consume("||") {
+		exprs = append(exprs, p.condition(p.parseAnd()))
+	}
+	return celOperand{test: exprs, pos: first.pos}
+}
+
+func (p *celParser) parseAnd() celOperand {
+	first := p.parseRelation()
+	if !p.isPunct("&&") {
+		return first
+	}
+
+	exprs := AndExpr{p.condition(first)}
+	for p.consume("&&") {
+		exprs = append(exprs, p.condition(p.parseRelation()))
+	}
+	return celOperand{test: exprs, pos: first.pos}
+}
+
+func (p *celParser) parseRelationOp() string {
+	token := p.token()
+	if token.kind == celIdent && token.text == "in" {
+		p.pos++
+		return "in"
+	}
+	for _, op := range []string{"==", "!=", "<", "<=", ">", ">="} {
+		if p.consume(op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func (p *celParser) parseRelation() celOperand {
+	lhs := p.parseAddition()
+	opPos := p.token().pos
+	op := p.parseRelationOp()
+	if op == "" {
+		return lhs
+	}
+	rhs := p.parseAddition()
+	if p.parseRelationOp() != "" {
+		p.failAt(opPos, "comparisons cannot be chained")
+	}
+
+	lhsValue := p.valueOf(lhs)
+	if op == "in" {
+		return celOperand{test: p.in(lhsValue, rhs), pos: lhs.pos}
+	}
+	rhsValue := p.valueOf(rhs)
+
+	// Literals are kept on the right hand side
+	_, lhsLiteral := lhsValue.(ValueExpr)
+	_, rhsLiteral := rhsValue.(ValueExpr)
+	if lhsLiteral && rhsLiteral {
+		p.failAt(opPos, "comparing two literals is not supported")
+	}
+	if lhsLiteral {
+		lhsValue, rhsValue = rhsValue, lhsValue
+		switch op {
+		case "<":
+			op = ">"
+		case "<=":
+			op = ">="
+		case ">":
+			op = "<"
+		case ">=":
+			op = "<="
+		}
+	}
+
+	var expr Expression
+	switch op {
+	case "==":
+		expr = EqualsExpr{lhsValue, rhsValue}
+	case "!=":
+		expr = NotEqualsExpr{lhsValue, rhsValue}
+	case "<":
+		expr = LessThanExpr{lhsValue, rhsValue}
+	case "<=":
+		expr = LessEqualsExpr{lhsValue, rhsValue}
+	case ">":
+		expr = GreaterThanExpr{lhsValue, rhsValue}
+	default:
+		expr = GreaterEqualsExpr{lhsValue, rhsValue}
+	}
+	return celOperand{test: expr, pos: lhs.pos}
+}
+
+// in searches a list literal, or a list within the document, for a value.
+func (p *celParser) in(value Expression, list celOperand) Expression {
+	if list.isList {
+		if len(list.list) == 0 {
+			return FalseExpr{}
+		}
+		exprs := OrExpr{}
+		for _, elem := range list.list {
+			exprs = append(exprs, EqualsExpr{value, elem})
+		}
+		if len(exprs) == 1 {
+			return exprs[0]
+		}
+		return exprs
+	}
+
+	field, ok := list.value.(FieldExpr)
+	if !ok {
+		p.failAt(list.pos, "`in` requires a list or a field")
+	}
+	elemVar := p.newVar()
+	return AnyInExpr{elemVar, field, EqualsExpr{FieldExpr{elemVar, nil}, value}}
+}
+
+func (p *celParser) newVar() VariableID {
+	p.nextVar++
+	return p.nextVar
+}
+
+func (p *celParser) parseAddition() celOperand {
+	lhs := p.parseMultiplication()
+	for {
+		var funcName string
+		switch {
+		case p.consume("+"):
+			funcName = MathFuncAdd
+		case p.consume("-"):
+			funcName = MathFuncSub
+		default:
+			return lhs
+		}
+		rhs := p.parseMultiplication()
+		lhs = p.arithmetic(funcName, lhs, rhs)
+	}
+}
+
+func (p *celParser) parseMultiplication() celOperand {
+	lhs := p.parseUnary()
+	for {
+		var funcName string
+		switch {
+		case p.consume("*"):
+			funcName = MathFuncMul
+		case p.consume("/"):
+			funcName = MathFuncDiv
+		case p.consume("%"):
+			funcName = MathFuncMod
+		default:
+			return lhs
+		}
+		rhs := p.parseUnary()
+		lhs = p.arithmetic(funcName, lhs, rhs)
+	}
+}
+
+func (p *celParser) arithmetic(funcName string, lhs, rhs celOperand) celOperand {
+	params := []Expression{p.valueOf(lhs), p.valueOf(rhs)}
+	for i, param := range params {
+		if value, ok := param.(ValueExpr); ok {
+			switch value.Value.(type) {
+			case int64, uint64, float64:
+			default:
+				p.failAt([]int{lhs.pos, rhs.pos}[i], "arithmetic is only supported on numbers")
+			}
+		}
+	}
+	return celOperand{value: FuncExpr{funcName, params}, pos: lhs.pos}
+}
+
+func (p *celParser) parseUnary() celOperand {
+	p.enter()
+	defer p.leave()
+
+	start := p.token().pos
+	if p.consume("!") {
+		operand := p.parseUnary()
+		return celOperand{test: NotExpr{p.condition(operand)}, pos: start}
+	}
+	if p.consume("-") {
+		if token := p.token(); token.kind == celInt || token.kind == celDouble {
+			p.pos++
+			operand := p.literal(token, "-")
+			operand.pos = start
+			return p.parseMemberSuffix(operand)
+		}
+		operand := p.parseUnary()
+		return celOperand{value: FuncExpr{MathFuncNeg, []Expression{p.valueOf(operand)}}, pos: start}
+	}
+	return p.parseMemberSuffix(p.parsePrimary())
+}
+
+func (p *celParser) literal(token celToken, sign string) celOperand {
+	var value interface{}
+	var err error
+	switch token.kind {
+	case celInt:
+		if strings.HasPrefix(token.text, "0x") || strings.HasPrefix(token.text, "0X") {
+			value, err = strconv.ParseInt(sign+token.text[2:], 16, 64)
+		} else {
+			value, err = strconv.ParseInt(sign+token.text, 10, 64)
+		}
+	case celUint:
+		digits := strings.TrimRight(token.text, "uU")
+		if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+			value, err = strconv.ParseUint(digits[2:], 16, 64)
+		} else {
+			value, err = strconv.ParseUint(digits, 10, 64)
+		}
+	case celDouble:
+		value, err = strconv.ParseFloat(sign+token.text, 64)
+	case celString:
+		value = token.value
+	case celBytes:
+		value = []byte(token.value)
+	}
+	if err != nil {
+		p.failAt(token.pos, "invalid number")
+	}
+	return celOperand{value: ValueExpr{value}, pos: token.pos}
+}
+
+func (p *celParser) parsePrimary() celOperand {
+	token := p.token()
+	switch token.kind {
+	case celInt, celUint, celDouble, celString, celBytes:
+		p.pos++
+		return p.literal(token, "")
+	case celEOF:
+		p.fail("unexpected end of expression")
+	case celIdent:
+		p.pos++
+		if p.consume("(") {
+			return p.parseFunction(token)
+		}
+		switch token.text {
+		case "true":
+			return celOperand{value: ValueExpr{true}, pos: token.pos}
+		case "false":
+			return celOperand{value: ValueExpr{false}, pos: token.pos}
+		case "null":
+			return celOperand{value: ValueExpr{nil}, pos: token.pos}
+		case "in":
+			p.failAt(token.pos, "unexpected `in`")
+		}
+		if celReserved[token.text] {
+			p.failAt(token.pos, "`%s` is a reserved word", token.text)
+		}
+		if varId, ok := p.vars[token.text]; ok {
+			return celOperand{value: FieldExpr{varId, nil}, pos: token.pos}
+		}
+		return celOperand{value: FieldExpr{0, []string{token.text}}, pos: token.pos}
+	}
+
+	switch {
+	case p.consume("."):
+		// A leading dot refers to a field even if a loop variable shares
+		// its name
+		name := p.expectIdent()
+		return celOperand{value: FieldExpr{0, []string{name.text}}, pos: token.pos}
+	case p.consume("("):
+		operand := p.parseExpr()
+		p.expect(")")
+		return operand
+	case p.consume("["):
+		list := celOperand{isList: true, pos: token.pos}
+		for !p.consume("]") {
+			list.list = append(list.list, p.valueOf(p.parseExpr()))
+			if !p.consume(",") {
+				p.expect("]")
+				break
+			}
+		}
+		return list
+	case p.isPunct("{"):
+		p.fail("map literals are not supported")
+	}
+	p.fail("unexpected `%s`", token.text)
+	return celOperand{}
+}
+
+func (p *celParser) parseMemberSuffix(operand celOperand) celOperand {
+	var path []string
+	for {
+		switch {
+		case p.consume("."):
+			name := p.expectIdent()
+			if p.consume("(") {
+				operand = p.parseMethod(operand, name)
+				path = nil
+				continue
+			}
+			operand.value, path = p.selectField(operand, path, name.text)
+		case p.consume("["):
+			indexPos := p.token().pos
+			index := p.valueOf(p.parseExpr())
+			p.expect("]")
+
+			literal, _ := index.(ValueExpr)
+			var elem string
+			switch value := literal.Value.(type) {
+			case int64:
+				if value < 0 {
+					p.failAt(indexPos, "negative indexes are not supported")
+				}
+				elem = "[" + strconv.FormatInt(value, 10) + "]"
+			case uint64:
+				elem = "[" + strconv.FormatUint(value, 10) + "]"
+			case string:
+				elem = value
+			default:
+				p.failAt(indexPos, "only integer and string literals can be used as indexes")
+			}
+			operand.value, path = p.selectField(operand, path, elem)
+		default:
+			return operand
+		}
+	}
+}
+
+// selectField selects elem from operand.  path holds the path built so far
+// by the current chain of selectors, which is copied from the operand once
+// and then extended in place, as copying it for every selector makes long
+// chains quadratic.
+func (p *celParser) selectField(operand celOperand, path []string, elem string) (Expression, []string) {
+	field, ok := operand.value.(FieldExpr)
+	if !ok {
+		p.failAt(operand.pos, "only fields can be selected from")
+	}
+	if path == nil {
+		path = append(make([]string, 0, len(field.Path)+1), field.Path...)
+	}
+	path = append(path, elem)
+	return FieldExpr{field.Root, path}, path
+}
+
+func (p *celParser) parseArgs() []celOperand {
+	var args []celOperand
+	for !p.consume(")") {
+		args = append(args, p.parseExpr())
+		if !p.consume(",") {
+			p.expect(")")
+			break
+		}
+	}
+	return args
+}
+
+func (p *celParser) checkArgs(name celToken, args []celOperand, count int) {
+	if len(args) != count {
+		p.failAt(name.pos, "%s() takes %d argument(s)", name.text, count)
+	}
+}
+
+// stringArg returns an argument which must be a string literal.
+func (p *celParser) stringArg(name celToken, arg celOperand) string {
+	if value, ok := arg.value.(ValueExpr); ok {
+		if str, ok := value.Value.(string); ok {
+			return str
+		}
+	}
+	p.failAt(arg.pos, "%s() requires a string literal", name.text)
+	return ""
+}
+
+func (p *celParser) matches(target celOperand, arg celOperand, pattern string) celOperand {
+	if _, err := regexp.Compile(pattern); err != nil {
+		p.failAt(arg.pos, "invalid pattern: %v", err)
+	}
+	return celOperand{test: LikeExpr{p.valueOf(target), RegexExpr{pattern}}, pos: target.pos}
+}
+
+func (p *celParser) parseFunction(name celToken) celOperand {
+	if name.text == "has" {
+		arg := p.parseExpr()
+		selected := p.pos >= 2 && p.tokens[p.pos-1].kind == celIdent && p.tokens[p.pos-2].text == "."
+		p.expect(")")
+		if field, ok := arg.value.(FieldExpr); !ok || !selected || len(field.Path) == 0 {
+			p.failAt(arg.pos, "has() requires a field selection")
+		}
+		return celOperand{test: ExistsExpr{arg.value}, pos: name.pos}
+	}
+
+	args := p.parseArgs()
+	switch name.text {
+	case "size":
+		p.checkArgs(name, args, 1)
+		return p.size(args[0], name.pos)
+	case "matches":
+		p.checkArgs(name, args, 2)
+		return p.matches(args[0], args[1], p.stringArg(name, args[1]))
+	}
+	p.failAt(name.pos, "unknown function `%s`", name.text)
+	return celOperand{}
+}
+
+// size only counts the elements of lists.  Unlike CEL, the size of a
+// string is not its length but null, so any comparison with it is false.
+func (p *celParser) size(target celOperand, pos int) celOperand {
+	return celOperand{value: FuncExpr{ArrayLengthFunc, []Expression{p.valueOf(target)}}, pos: pos}
+}
+
+func (p *celParser) parseMethod(target celOperand, name celToken) celOperand {
+	switch name.text {
+	case "exists", "all":
+		field, ok := target.value.(FieldExpr)
+		if !ok {
+			p.failAt(target.pos, "%s() requires a field", name.text)
+		}
+		varName := p.expectIdent()
+		p.expect(",")
+
+		if p.vars == nil {
+			p.vars = make(map[string]VariableID)
+		}
+		elemVar := p.newVar()
+		outer, shadowed := p.vars[varName.text]
+		p.vars[varName.text] = elemVar
+		pred := p.condition(p.parseExpr())
+		if shadowed {
+			p.vars[varName.text] = outer
+		} else {
+			delete(p.vars, varName.text)
+		}
+		p.expect(")")
+
+		if name.text == "all" {
+			return celOperand{test: EveryInExpr{elemVar, field, pred}, pos: target.pos}
+		}
+		return celOperand{test: AnyInExpr{elemVar, field, pred}, pos: target.pos}
+	case "exists_one", "map", "filter":
+		p.failAt(name.pos, "the %s() macro is not supported", name.text)
+	}
+
+	args := p.parseArgs()
+	switch name.text {
+	case "size":
+		p.checkArgs(name, args, 0)
+		return p.size(target, target.pos)
+	case "matches":
+		p.checkArgs(name, args, 1)
+		return p.matches(target, args[0], p.stringArg(name, args[0]))
+	case "contains":
+		p.checkArgs(name, args, 1)
+		return p.matches(target, args[0], regexp.QuoteMeta(p.stringArg(name, args[0])))
+	case "startsWith":
+		p.checkArgs(name, args, 1)
+		return p.matches(target, args[0], "^"+regexp.QuoteMeta(p.stringArg(name, args[0])))
+	case "endsWith":
+		p.checkArgs(name, args, 1)
+		return p.matches(target, args[0], regexp.QuoteMeta(p.stringArg(name, args[0]))+"$")
+	}
+	p.failAt(name.pos, "unknown function `%s`", name.text)
+	return celOperand{}
+}
+
+// ParseCELExpression compiles an expression in a subset of the Common
+// Expression Language into an Expression.  Identifiers refer to the fields
+// of the document, and a bare field is a test of whether it is true.
+//
+// The supported subset is field selection and indexing with literals,
+// comparisons, arithmetic, `&&`, `||`, `!`, `in` with list literals or
+// list fields, has(), size() of lists, matches(), contains(), startsWith()
+// and endsWith() with literal arguments, and the exists() and all()
+// macros, which become AnyInExpr and EveryInExpr over lists.  size() does
+// not count the characters of strings, and is null for them.  A missing
+// field behaves as it does in other expressions rather than being an
+// error.  Errors are always a *ParseError.
+//
+// CEL has no heterogeneous equality, so values of different types never
+// compare equal or ordered.  The expression only matches as CEL would when
+// it is transformed with Transformer{CompareMode: CompareModeStrict}, or
+// matched by a SlowMatcher with the same CompareMode.  Under the default
+// CompareModeCollate, a == "1" would also match {"a": 1}.
+func ParseCELExpression(text string) (expr Expression, err error) {
+	p := &celParser{text: text}
+
+	defer func() {
+		if r := recover(); r != nil {
+			abort, ok := r.(celAbort)
+			if !ok {
+				panic(r)
+			}
+			expr, err = nil, abort.err
+		}
+	}()
+
+	p.lex()
+	operand := p.parseExpr()
+	if token := p.token(); token.kind != celEOF {
+		p.fail("unexpected `%s`", token.text)
+	}
+	return p.condition(operand), nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCELExpression(t *testing.T) {
+	tests := []struct {
+		expr    string
+		matches []string
+		misses  []string
+	}{
+		{
+			`request.auth.claims.role == "admin" && request.size <= 1024`,
+			[]string{`{"request": {"auth": {"claims": {"role": "admin"}}, "size": 10}}`},
+			[]string{`{"request": {"auth": {"claims": {"role": "user"}}, "size": 10}}`,
+				`{"request": {"auth": {"claims": {"role": "admin"}}, "size": 2048}}`},
+		},
+		{
+			`!(a.enabled) || 10 < a.count`,
+			[]string{`{"a": {"enabled": false}}`, `{"a": {"enabled": true, "count": 11}}`},
+			[]string{`{"a": {"enabled": true, "count": 10}}`},
+		},
+		{
+			`role in ["admin", 'owner'] && "write" in perms && !("delete" in perms)`,
+			[]string{`{"role": "owner", "perms": ["read", "write"]}`},
+			[]string{`{"role": "guest", "perms": ["write"]}`, `{"role": "admin", "perms": ["read"]}`,
+				`{"role": "admin", "perms": ["write", "delete"]}`},
+		},
+		{
+			`has(user.email) && user.email.matches("^[a-z]+@example\\.com$") && size(user.groups) > 1`,
+			[]string{`{"user": {"email": "bob@example.com", "groups": ["a", "b"]}}`},
+			[]string{`{"user": {"groups": ["a", "b"]}}`, `{"user": {"email": "bob@example.org", "groups": ["a", "b"]}}`,
+				`{"user": {"email": "bob@example.com", "groups": ["a"]}}`},
+		},
+		{
+			`items.exists(i, i.qty > 1 && i.tags.all(t, t != "hidden")) && items.size() < 3`,
+			[]string{`{"items": [{"qty": 1, "tags": []}, {"qty": 2, "tags": ["a"]}]}`},
+			[]string{`{"items": [{"qty": 1, "tags": []}, {"qty": 2, "tags": ["hidden"]}]}`,
+				`{"items": [{"qty": 2, "tags": []}, {"qty": 2}, {"qty": 2}]}`},
+		},
+		{
+			`name.startsWith("a.") && name.endsWith('z') && name.contains(r"\d") && matches(name, "b")`,
+			[]string{`{"name": "a.b\\dz"}`},
+			[]string{`{"name": "axb\\dz"}`, `{"name": "a.b\\dy"}`, `{"name": "a.b1z"}`},
+		},
+		{
+			`price * 2 + 1 > 9.5 && -discount > -10 && stock % 2 == 1 && a[0]["b"] == 0x10 && n == -1`,
+			[]string{`{"price": 5, "discount": 5, "stock": 3, "a": [{"b": 16}], "n": -1}`},
+			[]string{`{"price": 4, "discount": 5, "stock": 3, "a": [{"b": 16}], "n": -1}`,
+				`{"price": 5, "discount": 10, "stock": 3, "a": [{"b": 16}], "n": -1}`,
+				`{"price": 5, "discount": 5, "stock": 2, "a": [{"b": 16}], "n": -1}`},
+		},
+		{
+			`x.exists(x, x == .y) // loop variables shadow fields`,
+			[]string{`{"x": [2, 1], "y": 1}`},
+			[]string{`{"x": [2], "y": 1}`},
+		},
+		{
+			`name.size() == 3 // strings are not counted`,
+			[]string{`{"name": [1, 2, 3]}`},
+			[]string{`{"name": "abc"}`, `{"name": {"a": 1, "b": 2, "c": 3}}`},
+		},
+		{
+			`a == "1" || b < 2`,
+			[]string{`{"a": "1"}`, `{"b": 1.5}`},
+			[]string{`{"a": 1}`, `{"b": "1"}`, `{"b": null}`, `{"a": true, "b": false}`},
+		},
+	}
+
+	for _, test := range tests {
+		expr, err := ParseCELExpression(test.expr)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", test.expr, err)
+		}
+
+		// CEL never compares values of different types
+		trans := Transformer{CompareMode: CompareModeStrict}
+		fast := NewFastMatcher(trans.Transform([]Expression{expr}))
+		slow := NewSlowMatcher([]Expression{expr})
+		slow.CompareMode = CompareModeStrict
+
+		for _, doc := range append(append([]string{}, test.matches...), test.misses...) {
+			expected := false
+			for _, match := range test.matches {
+				if doc == match {
+					expected = true
+				}
+			}
+
+			for _, m := range []Matcher{fast, slow} {
+				m.Reset()
+				matched, err := m.Match([]byte(doc))
+				if err != nil {
+					t.Fatalf("failed to match %s: %v", doc, err)
+				}
+				if matched != expected {
+					t.Errorf("%T: %s matched %v, expected %v\ncel: %s\nexpression: %v",
+						m, doc, matched, expected, test.expr, expr)
+				}
+			}
+		}
+	}
+}
+
+func TestParseCELExpressionLiterals(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		literal string
+		value   interface{}
+	}{
+		{`-9223372036854775808`, int64(-9223372036854775808)},
+		{`0xffu`, uint64(255)},
+		{`10u`, uint64(10)},
+		{`1e3`, 1000.0},
+		{`.5`, 0.5},
+		{`"a\x41é\101\n"`, "aAéA\n"},
+		{`'''it's'''`, "it's"},
+		{`r'\n'`, `\n`},
+		{`b"\xff\000"`, []byte{0xff, 0}},
+		{`null`, nil},
+	}
+	for _, test := range tests {
+		expr, err := ParseCELExpression("a == " + test.literal)
+		assert.Nil(err, test.literal)
+		assert.Equal(EqualsExpr{FieldExpr{0, []string{"a"}}, ValueExpr{test.value}}, expr, test.literal)
+	}
+}
+
+func TestParseCELExpressionSelectors(t *testing.T) {
+	assert := assert.New(t)
+
+	expr, err := ParseCELExpression(`a.b[0]["c"].d == a.b.e`)
+	assert.Nil(err)
+	assert.Equal(EqualsExpr{
+		FieldExpr{0, []string{"a", "b", "[0]", "c", "d"}},
+		FieldExpr{0, []string{"a", "b", "e"}},
+	}, expr)
+
+	expr, err = ParseCELExpression(`a.b.exists(x, x.c.d == 1)`)
+	assert.Nil(err)
+	assert.Equal(AnyInExpr{1, FieldExpr{0, []string{"a", "b"}},
+		EqualsExpr{FieldExpr{1, []string{"c", "d"}}, ValueExpr{int64(1)}}}, expr)
+
+	// Long chains of selectors are built without copying the path each time
+	expr, err = ParseCELExpression("a" + strings.Repeat(".b", 20000) + strings.Repeat("[0]", 20000) + " == 1")
+	if assert.Nil(err) {
+		assert.Len(expr.(EqualsExpr).Lhs.(FieldExpr).Path, 40001)
+	}
+}
+
+func TestParseCELExpressionErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{`a ? b : c`, "1:3: the conditional operator is not supported"},
+		{`a < b < c`, "1:3: comparisons cannot be chained"},
+		{`1 == 1`, "1:3: comparing two literals is not supported"},
+		{`a = 1`, "1:3: unexpected `=`"},
+		{`a == `, "1:6: unexpected end of expression"},
+		{`a == [1]`, "1:6: lists can only be searched with `in`"},
+		{`a == {"b": 1}`, "1:6: map literals are not supported"},
+		{`a in size(b)`, "1:6: `in` requires a list or a field"},
+		{`has(a)`, "1:5: has() requires a field selection"},
+		{`size(a) + "x" > 1`, "1:11: arithmetic is only supported on numbers"},
+		{`a[-1] == 1`, "1:3: negative indexes are not supported"},
+		{`a[b] == 1`, "1:3: only integer and string literals can be used as indexes"},
+		{`a.exists_one(x, x)`, "1:3: the exists_one() macro is not supported"},
+		{`a.exists(1, true)`, "1:10: expected an identifier"},
+		{`int(a) == 1`, "1:1: unknown function `int`"},
+		{`a.matches(b)`, "1:11: matches() requires a string literal"},
+		{`a.matches("(")`, "1:11: invalid pattern: error parsing regexp: missing closing ): `(`"},
+		{`size(a, b) > 1`, "1:1: size() takes 1 argument(s)"},
+		{`a == "\q"`, "1:7: invalid escape sequence"},
+		{`a == "b`, "1:6: unterminated string"},
+		{`a == 9223372036854775808`, "1:6: invalid number"},
+		{`has(a.b) == true`, "1:1: expected a value rather than a condition"},
+		{`a.b + 1`, "1:1: expected a condition"},
+		{`while`, "1:1: `while` is a reserved word"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseCELExpression(test.expr)
+		if !assert.NotNil(err, test.expr) {
+			continue
+		}
+		assert.IsType(&ParseError{}, err)
+		assert.Equal(test.err, err.Error(), test.expr)
+	}
+}
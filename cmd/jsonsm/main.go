@@ -0,0 +1,77 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+// Command jsonsm is a small command line companion to the gojsonsm library.
+//
+// Usage:
+//
+//	jsonsm repl [-corpus testdata/people.json] [-mode filter|simple]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+type subcommand struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var subcommands = []subcommand{
+	{"repl", "interactively author filters against a sample corpus", runRepl},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: jsonsm <command> [arguments]\n\ncommands:\n")
+	for _, cmd := range subcommands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.usage)
+	}
+}
+
+func runRepl(args []string) error {
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	corpus := flags.String("corpus", "", "JSON array (or newline-delimited JSON) file of sample documents")
+	mode := flags.String("mode", modeFilter, "parser to use: filter or simple")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	repl := newRepl(os.Stdin, os.Stdout)
+	err = repl.setMode(*mode)
+	if err != nil {
+		return err
+	}
+
+	if *corpus != "" {
+		err = repl.loadCorpus(*corpus)
+		if err != nil {
+			return err
+		}
+	}
+
+	return repl.run()
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range subcommands {
+		if cmd.name == os.Args[1] {
+			err := cmd.run(os.Args[2:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "jsonsm %s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	usage()
+	os.Exit(2)
+}
@@ -0,0 +1,398 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/couchbaselabs/gojsonsm"
+)
+
+const (
+	modeFilter = "filter"
+	modeSimple = "simple"
+)
+
+const replHelp = `Enter a filter expression to compile it and run it against the corpus.
+
+Commands:
+  :help              show this help
+  :load <file>       load a corpus of sample documents
+  :mode filter|simple  select the parser (currently %s)
+  :def on|off        toggle the MatchDef dump (currently %s)
+  :history           list previously entered filters
+  !<n>               re-run filter <n> from the history
+  :explain <doc>     show how the last filter evaluated against a document,
+                     by corpus index or by its "_id"
+  :quit              exit
+`
+
+type replDoc struct {
+	id   string
+	data []byte
+}
+
+type repl struct {
+	in      *bufio.Scanner
+	out     io.Writer
+	mode    string
+	showDef bool
+	docs    []replDoc
+	history []string
+	last    gojsonsm.Expression
+}
+
+func newRepl(in io.Reader, out io.Writer) *repl {
+	return &repl{
+		in:      bufio.NewScanner(in),
+		out:     out,
+		mode:    modeFilter,
+		showDef: true,
+	}
+}
+
+func (r *repl) printf(format string, args ...interface{}) {
+	fmt.Fprintf(r.out, format, args...)
+}
+
+func (r *repl) setMode(mode string) error {
+	switch mode {
+	case modeFilter, modeSimple:
+		r.mode = mode
+		return nil
+	}
+	return fmt.Errorf("unknown parser mode %q", mode)
+}
+
+func (r *repl) loadCorpus(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var rawDocs []json.RawMessage
+	if err := json.Unmarshal(data, &rawDocs); err != nil {
+		// Fall back to newline-delimited JSON
+		rawDocs = nil
+		for lineNum, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			if !json.Valid([]byte(line)) {
+				return fmt.Errorf("%s:%d: invalid JSON document", path, lineNum+1)
+			}
+			rawDocs = append(rawDocs, json.RawMessage(line))
+		}
+	}
+
+	r.docs = make([]replDoc, len(rawDocs))
+	for i, rawDoc := range rawDocs {
+		var header struct {
+			Id interface{} `json:"_id"`
+		}
+		json.Unmarshal(rawDoc, &header)
+
+		r.docs[i].data = rawDoc
+		if header.Id != nil {
+			r.docs[i].id = fmt.Sprintf("%v", header.Id)
+		}
+	}
+
+	r.printf("loaded %d documents from %s\n", len(r.docs), path)
+	return nil
+}
+
+func (r *repl) run() error {
+	r.printf("jsonsm filter repl, type :help for help\n")
+
+	for {
+		r.printf("%s> ", r.mode)
+		if !r.in.Scan() {
+			r.printf("\n")
+			return r.in.Err()
+		}
+
+		line := strings.TrimSpace(r.in.Text())
+		if line == "" {
+			continue
+		}
+
+		if !r.handleLine(line) {
+			return nil
+		}
+	}
+}
+
+// handleLine processes a single line of input, returning false once the
+// user has asked to leave the repl.
+func (r *repl) handleLine(line string) bool {
+	if strings.HasPrefix(line, "!") {
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 1 || n > len(r.history) {
+			r.printf("no such history entry: %s\n", line[1:])
+			return true
+		}
+		line = r.history[n-1]
+		r.printf("%s\n", line)
+	} else if strings.HasPrefix(line, ":") {
+		return r.handleCommand(line)
+	}
+
+	r.history = append(r.history, line)
+	r.evaluate(line)
+	return true
+}
+
+func (r *repl) handleCommand(line string) bool {
+	fields := strings.Fields(line)
+	arg := strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+
+	switch fields[0] {
+	case ":quit", ":q", ":exit":
+		return false
+	case ":help":
+		defState := "off"
+		if r.showDef {
+			defState = "on"
+		}
+		r.printf(replHelp, r.mode, defState)
+	case ":load":
+		if err := r.loadCorpus(arg); err != nil {
+			r.printf("error: %v\n", err)
+		}
+	case ":mode":
+		if err := r.setMode(arg); err != nil {
+			r.printf("error: %v\n", err)
+		}
+	case ":def":
+		r.showDef = arg != "off"
+	case ":history":
+		for i, entry := range r.history {
+			r.printf("%4d  %s\n", i+1, entry)
+		}
+	case ":explain":
+		r.explain(arg)
+	default:
+		r.printf("unknown command %s, type :help for help\n", fields[0])
+	}
+	return true
+}
+
+func (r *repl) parse(text string) (gojsonsm.Expression, error) {
+	if r.mode == modeSimple {
+		return gojsonsm.ParseSimpleExpression(text)
+	}
+
+	_, fe, err := gojsonsm.NewBoundedFilterExpressionParser(text)
+	if err != nil {
+		return nil, err
+	}
+	return fe.OutputExpression()
+}
+
+func (r *repl) printParseError(text string, err error) {
+	var parseErr *gojsonsm.ParseError
+	if !errors.As(err, &parseErr) || !parseErr.HasPosition() {
+		r.printf("parse error: %v\n", err)
+		return
+	}
+
+	// Underline the offending token on its own line of the input
+	line := strings.Split(text, "\n")[parseErr.Line-1]
+	width := utf8.RuneCountInString(parseErr.Token)
+	if width == 0 {
+		width = 1
+	}
+	r.printf("  %s\n  %s%s\n", line, strings.Repeat(" ", parseErr.Column-1), strings.Repeat("^", width))
+	r.printf("parse error: %v\n", err)
+	if len(parseErr.Expected) > 0 {
+		r.printf("expected one of: %s\n", strings.Join(parseErr.Expected, " "))
+	}
+}
+
+func (r *repl) evaluate(text string) {
+	expr, err := r.parse(text)
+	if err != nil {
+		r.printParseError(text, err)
+		return
+	}
+
+	expr = gojsonsm.OptimizeExpression(expr)
+	r.last = expr
+
+	r.printf("expression:\n%s\n", indent(expr.String(), "  "))
+
+	def, err := compile([]gojsonsm.Expression{expr})
+	if err != nil {
+		r.printf("compile error: %v\n", err)
+		return
+	}
+
+	if r.showDef {
+		if def.ParseNode != nil {
+			r.printf("match def:\n%s\n", indent(def.String(), "  "))
+		} else {
+			r.printf("match def: constant expression\n")
+		}
+	}
+
+	if len(r.docs) == 0 {
+		r.printf("no corpus loaded, use :load <file>\n")
+		return
+	}
+
+	matcher := gojsonsm.NewFastMatcher(def)
+	numMatched := 0
+	for i, doc := range r.docs {
+		matched, err := matchDoc(matcher, def, expr, doc.data)
+		if err != nil {
+			r.printf("  %s: error: %v\n", docName(i, doc), err)
+			continue
+		}
+		if matched {
+			r.printf("  %s\n", docName(i, doc))
+			numMatched++
+		}
+	}
+	r.printf("%d of %d documents matched\n", numMatched, len(r.docs))
+}
+
+func (r *repl) findDoc(ref string) (int, bool) {
+	for i, doc := range r.docs {
+		if doc.id != "" && doc.id == ref {
+			return i, true
+		}
+	}
+
+	i, err := strconv.Atoi(ref)
+	if err != nil || i < 0 || i >= len(r.docs) {
+		return 0, false
+	}
+	return i, true
+}
+
+// explain evaluates every boolean sub-expression of the last filter as its
+// own expression, so that the result of each step can be shown to the user.
+func (r *repl) explain(ref string) {
+	if r.last == nil {
+		r.printf("no filter has been entered yet\n")
+		return
+	}
+
+	docIdx, ok := r.findDoc(ref)
+	if !ok {
+		r.printf("no such document: %s\n", ref)
+		return
+	}
+	doc := r.docs[docIdx]
+
+	var steps []explainStep
+	collectExplainSteps(r.last, 0, &steps)
+
+	exprs := make([]gojsonsm.Expression, len(steps))
+	for i, step := range steps {
+		exprs[i] = step.expr
+	}
+
+	def, err := compile(exprs)
+	if err != nil {
+		r.printf("compile error: %v\n", err)
+		return
+	}
+
+	matcher := gojsonsm.NewFastMatcher(def)
+	if def.ParseNode != nil {
+		_, err = matcher.Match(doc.data)
+		if err != nil {
+			r.printf("match error: %v\n", err)
+			return
+		}
+	}
+
+	r.printf("%s:\n", docName(docIdx, doc))
+	for i, step := range steps {
+		var result bool
+		switch step.expr.(type) {
+		case gojsonsm.TrueExpr:
+			result = true
+		case gojsonsm.FalseExpr:
+			result = false
+		default:
+			result = matcher.ExpressionMatched(i)
+		}
+		r.printf("  %-5v %s%s\n", result, strings.Repeat("  ", step.depth), step.label)
+	}
+}
+
+type explainStep struct {
+	expr  gojsonsm.Expression
+	depth int
+	label string
+}
+
+func collectExplainSteps(expr gojsonsm.Expression, depth int, steps *[]explainStep) {
+	switch expr := expr.(type) {
+	case gojsonsm.AndExpr:
+		*steps = append(*steps, explainStep{expr, depth, "AND"})
+		for _, subExpr := range expr {
+			collectExplainSteps(subExpr, depth+1, steps)
+		}
+	case gojsonsm.OrExpr:
+		*steps = append(*steps, explainStep{expr, depth, "OR"})
+		for _, subExpr := range expr {
+			collectExplainSteps(subExpr, depth+1, steps)
+		}
+	case gojsonsm.NotExpr:
+		*steps = append(*steps, explainStep{expr, depth, "NOT"})
+		collectExplainSteps(expr.SubExpr, depth+1, steps)
+	default:
+		// Loop bodies reference their loop variables, so they cannot be
+		// evaluated on their own and are shown as a single step.
+		label := strings.Join(strings.Fields(expr.String()), " ")
+		*steps = append(*steps, explainStep{expr, depth, label})
+	}
+}
+
+// compile transforms the expressions into a MatchDef, converting any panic
+// raised by the Transformer into an error.
+func compile(exprs []gojsonsm.Expression) (def *gojsonsm.MatchDef, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	var trans gojsonsm.Transformer
+	def = trans.Transform(exprs)
+	return def, nil
+}
+
+func matchDoc(matcher *gojsonsm.FastMatcher, def *gojsonsm.MatchDef, expr gojsonsm.Expression, data []byte) (bool, error) {
+	if def.ParseNode == nil {
+		_, isTrue := expr.(gojsonsm.TrueExpr)
+		return isTrue, nil
+	}
+
+	matcher.Reset()
+	return matcher.Match(data)
+}
+
+func docName(idx int, doc replDoc) string {
+	if doc.id != "" {
+		return fmt.Sprintf("[%d] %s", idx, doc.id)
+	}
+	return fmt.Sprintf("[%d]", idx)
+}
+
+func indent(str string, prefix string) string {
+	return prefix + strings.Replace(str, "\n", "\n"+prefix, -1)
+}
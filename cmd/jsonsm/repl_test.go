@@ -0,0 +1,64 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/couchbaselabs/gojsonsm"
+	"github.com/stretchr/testify/assert"
+)
+
+func runReplScript(t *testing.T, mode string, script ...string) string {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+	repl := newRepl(strings.NewReader(strings.Join(script, "\n")), &out)
+	assert.Nil(repl.setMode(mode))
+	assert.Nil(repl.loadCorpus("../../testdata/people.json"))
+	assert.Nil(repl.run())
+	return out.String()
+}
+
+func TestReplMatchesCorpus(t *testing.T) {
+	assert := assert.New(t)
+
+	out := runReplScript(t, modeFilter,
+		`name = "Daphne Sutton"`)
+
+	assert.Contains(out, "expression:")
+	assert.Contains(out, "match def:")
+	assert.Contains(out, "[0] 5b47eb0936ff92a567a0307e")
+	assert.Contains(out, "1 of 10 documents matched")
+}
+
+func TestReplParseErrorPosition(t *testing.T) {
+	assert := assert.New(t)
+
+	out := runReplScript(t, modeFilter, `name = "x" AND )`)
+	assert.Contains(out, "parse error:")
+	assert.Contains(out, "  name = \"x\" AND )\n                 ^\n")
+	assert.Contains(out, "expected one of:")
+
+	out = runReplScript(t, modeSimple, `age >= 5 && (name == "x"`)
+	assert.Contains(out, "parse error: 1:25: "+gojsonsm.ErrorParenMismatch.Error())
+}
+
+func TestReplHistoryAndExplain(t *testing.T) {
+	assert := assert.New(t)
+
+	out := runReplScript(t, modeSimple,
+		`age > 20 && isActive == true`,
+		`:def off`,
+		`:history`,
+		`!1`,
+		`:explain 0`)
+
+	assert.Contains(out, "   1  age > 20 && isActive == true")
+	assert.Equal(2, strings.Count(out, "documents matched"))
+	assert.Equal(1, strings.Count(out, "match def:"))
+	assert.Contains(out, "true  AND")
+	assert.Contains(out, "true    $doc.age > 20")
+}
@@ -10,6 +10,11 @@ import (
 // Function related constants
 const (
 	DateFunc        string = "date"
+	TypeFunc        string = "type"
+	ArrayLengthFunc string = "arrayLength"
+	LowerFunc       string = "lower"
+	UpperFunc       string = "upper"
+	CollateFunc     string = "collate"
 	MathFuncAbs     string = "mathAbs"
 	MathFuncAcos    string = "mathAcos"
 	MathFuncAsin    string = "mathAsin"
@@ -37,26 +42,29 @@ const (
 	MathFuncMod     string = "mathModulo"
 	MathFuncNeg     string = "mathNegate"
 
-	FuncAbs    string = "ABS"
-	FuncAcos   string = "ACOS"
-	FuncAsin   string = "ASIN"
-	FuncAtan   string = "ATAN"
-	FuncAtan2  string = "ATAN2"
-	FuncCeil   string = "CEIL"
-	FuncCos    string = "COS"
-	FuncDate   string = "DATE"
-	FuncDeg    string = "DEGREES"
-	FuncExp    string = "EXP"
-	FuncFloor  string = "FLOOR"
-	FuncLog    string = "LOG"
-	FuncLn     string = "LN"
-	FuncPower  string = "POW"
-	FuncRad    string = "RADIANS"
-	FuncRegexp string = "REGEXP_CONTAINS"
-	FuncSin    string = "SIN"
-	FuncTan    string = "TAN"
-	FuncRound  string = "ROUND"
-	FuncSqrt   string = "SQRT"
+	FuncAbs     string = "ABS"
+	FuncAcos    string = "ACOS"
+	FuncAsin    string = "ASIN"
+	FuncAtan    string = "ATAN"
+	FuncAtan2   string = "ATAN2"
+	FuncCeil    string = "CEIL"
+	FuncCollate string = "COLLATE"
+	FuncCos     string = "COS"
+	FuncDate    string = "DATE"
+	FuncDeg     string = "DEGREES"
+	FuncExp     string = "EXP"
+	FuncFloor   string = "FLOOR"
+	FuncLog     string = "LOG"
+	FuncLn      string = "LN"
+	FuncLower   string = "LOWER"
+	FuncPower   string = "POW"
+	FuncRad     string = "RADIANS"
+	FuncRegexp  string = "REGEXP_CONTAINS"
+	FuncSin     string = "SIN"
+	FuncTan     string = "TAN"
+	FuncRound   string = "ROUND"
+	FuncSqrt    string = "SQRT"
+	FuncUpper   string = "UPPER"
 )
 
 // Parser related constants
@@ -75,6 +83,9 @@ const (
 	OperatorGreaterThanEq string = ">="
 	OperatorLessThan      string = "<"
 	OperatorLessThanEq    string = "<="
+	OperatorLike          string = "LIKE"
+	OperatorLikeEscape    string = "ESCAPE"
+	OperatorRegexMatch    string = "=~"
 	OperatorExists        string = "EXISTS"
 	OperatorMissing       string = "IS MISSING"
 	OperatorNotMissing    string = "IS NOT MISSING"
@@ -82,13 +93,13 @@ const (
 	OperatorNotNull       string = "IS NOT NULL"
 )
 
-// Participle parser can cause stack overflow if certain inputs (i.e. a single word regex) is passed in
-// This slice allows callers to get a list of valid operators that are used, so they can check whether
-// or not a valid expression is valid prior to passing into the FilterExpression Parser
+// GojsonsmOperators lists the operators used by filter expressions.  It was used to pre-check inputs
+// before passing them to the FilterExpression Parser, which is no longer needed as the parser limits
+// how deeply expressions may be nested and always terminates.
 var GojsonsmOperators []string = []string{OperatorOr, OperatorAnd, OperatorNot, OperatorTrue,
 	OperatorFalse, OperatorMeta, OperatorEquals, OperatorEquals2, OperatorNotEquals, OperatorNotEquals2, OperatorGreaterThan,
-	OperatorGreaterThanEq, OperatorLessThan, OperatorLessThanEq, OperatorExists, OperatorMissing, OperatorNotMissing,
-	OperatorNull, OperatorNotNull /* BooleanFuncs*/, FuncRegexp}
+	OperatorGreaterThanEq, OperatorLessThan, OperatorLessThanEq, OperatorLike, OperatorLikeEscape, OperatorRegexMatch, OperatorExists,
+	OperatorMissing, OperatorNotMissing, OperatorNull, OperatorNotNull /* BooleanFuncs*/, FuncRegexp}
 
 // Error constants
 var emptyExpression Expression
@@ -112,6 +123,12 @@ var ErrorPcreNotSupported error = fmt.Errorf("Error: Current instance of gojsons
 var ErrorFieldPathNotFound error = fmt.Errorf("Error: Unable to find internally stored field path")
 var ErrorMalformedFxInternals error = fmt.Errorf("Error: Malformed internal function helper")
 var ErrorMalformedParenthesis error = fmt.Errorf("Invalid parenthesis case")
+var ErrorMalformedDocument error = fmt.Errorf("Error: Document is not well-formed JSON")
+var ErrorMalformedCompression error = fmt.Errorf("Error: Document is not valid Snappy compressed data")
+var ErrorDivisionByZero error = fmt.Errorf("Error: Division by zero")
+var ErrorIntegerOverflow error = fmt.Errorf("Error: Integer arithmetic overflowed")
+var ErrorLikeTrailingEscape error = fmt.Errorf("Invalid LIKE pattern - escape character must be followed by another character")
+var ErrorLikeEscapeLength error = fmt.Errorf("Invalid LIKE escape - must be a single character")
 
 // Parse mode is within the context that a valid expression should be generically of the type of:
 // field > op -> value -> chain, repeat.
@@ -155,6 +172,7 @@ const (
 	chainOp   opTokenContext = iota
 	compareOp opTokenContext = iota
 	matchOp   opTokenContext = iota
+	likeOp    opTokenContext = iota
 	noFieldOp opTokenContext = iota
 )
 
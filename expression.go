@@ -4,14 +4,23 @@ package gojsonsm
 
 import (
 	"fmt"
+	"math/big"
+	"strconv"
 	"strings"
 )
 
 type VariableID int
 
+// metaVariableID is the root which META() refers to.  It is filled from the
+// DocumentMeta passed to the matcher rather than from the document, so the
+// document body can never stand in for its own metadata.
+const metaVariableID VariableID = -1
+
 func (id VariableID) String() string {
 	if id == 0 {
 		return "$doc"
+	} else if id == metaVariableID {
+		return "META()"
 	}
 
 	return fmt.Sprintf("$%d", id)
@@ -40,6 +49,9 @@ type ValueExpr struct {
 }
 
 func (expr ValueExpr) String() string {
+	if decimal, ok := expr.Value.(*big.Rat); ok {
+		return formatDecimal(decimal)
+	}
 	return fmt.Sprintf("%v", expr.Value)
 }
 
@@ -67,6 +79,24 @@ func (expr PcreExpr) String() string {
 	return fmt.Sprintf("/%v/", expr.Pcre)
 }
 
+// LikePatternExpr is a SQL LIKE pattern, where % matches any number of
+// characters and _ matches exactly one.  Escape makes the character after
+// it literal, and is 0 when the pattern has no escape character.
+type LikePatternExpr struct {
+	Pattern string
+	Escape  rune
+}
+
+func (expr LikePatternExpr) String() string {
+	escape := ""
+	if expr.Escape == DefaultLikeEscape {
+		return strconv.Quote(expr.Pattern)
+	} else if expr.Escape != 0 {
+		escape = string(expr.Escape)
+	}
+	return fmt.Sprintf("%s ESCAPE %s", strconv.Quote(expr.Pattern), strconv.Quote(escape))
+}
+
 type NotExpr struct {
 	SubExpr Expression
 }
@@ -127,6 +157,26 @@ func (expr FieldExpr) String() string {
 	}
 }
 
+// MetaExpr refers to the metadata of the document being matched, such as
+// META().id or META().xattrs._sync.rev.  The metadata is supplied to the
+// matcher through MatchWithMeta.
+type MetaExpr struct {
+	Path []string
+}
+
+func (expr MetaExpr) String() string {
+	if len(expr.Path) > 0 {
+		return "META()." + strings.Join(expr.Path, ".")
+	} else {
+		return "META()"
+	}
+}
+
+// fieldExpr returns the field of the metadata root which expr refers to.
+func (expr MetaExpr) fieldExpr() FieldExpr {
+	return FieldExpr{metaVariableID, expr.Path}
+}
+
 type FuncExpr struct {
 	FuncName string
 	Params   []Expression
@@ -253,5 +303,8 @@ type LikeExpr struct {
 }
 
 func (expr LikeExpr) String() string {
+	if _, ok := expr.Rhs.(LikePatternExpr); ok {
+		return fmt.Sprintf("%s LIKE %s", expr.Lhs, expr.Rhs)
+	}
 	return fmt.Sprintf("%s =~ %s", expr.Lhs, expr.Rhs)
 }
@@ -0,0 +1,376 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+)
+
+type canonicalizer struct {
+	vars  map[VariableID]VariableID
+	depth int
+}
+
+// CanonicalizeExpression rewrites an expression into a canonical form, so
+// that filters which only differ in how they were written end up identical.
+// The operands of ANDs and ORs are flattened, deduplicated and sorted,
+// comparisons keep constants on their right hand side, numeric literals are
+// widened to 64 bits, and loop variables are numbered by their nesting
+// depth.  Unlike OptimizeExpression, it never changes how an expression
+// matches.
+func CanonicalizeExpression(expr Expression) Expression {
+	c := &canonicalizer{
+		vars: make(map[VariableID]VariableID),
+	}
+	return c.canonicalize(expr)
+}
+
+// ExpressionEqual reports whether two expressions have the same canonical
+// form.  Integer and float constants are never equal to each other, even
+// when they hold the same number, as a = 5 and a = 5.0 match different
+// documents when a holds a string.
+func ExpressionEqual(lhs, rhs Expression) bool {
+	return canonicalExpressionKey(CanonicalizeExpression(lhs)) ==
+		canonicalExpressionKey(CanonicalizeExpression(rhs))
+}
+
+// ExpressionHash returns a hash of the canonical form of an expression.  Any
+// two expressions for which ExpressionEqual is true have the same hash.
+func ExpressionHash(expr Expression) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(canonicalExpressionKey(CanonicalizeExpression(expr))))
+	return hash.Sum64()
+}
+
+func (c *canonicalizer) canonicalizeLoop(varID VariableID, inExpr, subExpr Expression) (VariableID, Expression, Expression) {
+	inExpr = c.canonicalize(inExpr)
+
+	newVarID := VariableID(c.depth + 1)
+	oldMapping, hadMapping := c.vars[varID]
+	c.vars[varID] = newVarID
+	c.depth++
+
+	subExpr = c.canonicalize(subExpr)
+
+	c.depth--
+	if hadMapping {
+		c.vars[varID] = oldMapping
+	} else {
+		delete(c.vars, varID)
+	}
+
+	return newVarID, inExpr, subExpr
+}
+
+func (c *canonicalizer) canonicalizeTerms(terms []Expression, isAnd bool) []Expression {
+	var newTerms []Expression
+	keys := make(map[string]bool)
+
+	var addTerm func(term Expression)
+	addTerm = func(term Expression) {
+		switch subTerms := term.(type) {
+		case AndExpr:
+			if isAnd {
+				for _, subTerm := range subTerms {
+					addTerm(subTerm)
+				}
+				return
+			}
+		case OrExpr:
+			if !isAnd {
+				for _, subTerm := range subTerms {
+					addTerm(subTerm)
+				}
+				return
+			}
+		}
+
+		key := canonicalExpressionKey(term)
+		if !keys[key] {
+			keys[key] = true
+			newTerms = append(newTerms, term)
+		}
+	}
+
+	for _, term := range terms {
+		addTerm(c.canonicalize(term))
+	}
+
+	sort.SliceStable(newTerms, func(i, j int) bool {
+		return canonicalExpressionKey(newTerms[i]) < canonicalExpressionKey(newTerms[j])
+	})
+
+	return newTerms
+}
+
+// canonicalizeOperands orders the operands of a comparison, returning true
+// if they were swapped.  Constants always end up on the right, and other
+// operands are ordered by their canonical keys.
+func (c *canonicalizer) canonicalizeOperands(lhs, rhs Expression) (Expression, Expression, bool) {
+	lhs = c.canonicalize(lhs)
+	rhs = c.canonicalize(rhs)
+
+	lhsIsConst := isConstantExpression(lhs)
+	rhsIsConst := isConstantExpression(rhs)
+	if lhsIsConst != rhsIsConst {
+		if lhsIsConst {
+			return rhs, lhs, true
+		}
+		return lhs, rhs, false
+	}
+
+	if canonicalExpressionKey(lhs) > canonicalExpressionKey(rhs) {
+		return rhs, lhs, true
+	}
+	return lhs, rhs, false
+}
+
+func isConstantExpression(expr Expression) bool {
+	switch expr.(type) {
+	case ValueExpr, TimeExpr, RegexExpr, PcreExpr, LikePatternExpr:
+		return true
+	}
+	return false
+}
+
+func canonicalizeValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case int:
+		return int64(value)
+	case int8:
+		return int64(value)
+	case int16:
+		return int64(value)
+	case int32:
+		return int64(value)
+	case uint:
+		return canonicalizeValue(uint64(value))
+	case uint8:
+		return int64(value)
+	case uint16:
+		return int64(value)
+	case uint32:
+		return int64(value)
+	case uint64:
+		if value <= math.MaxInt64 {
+			return int64(value)
+		}
+		return value
+	case *big.Int:
+		return new(big.Rat).SetInt(value)
+	case float32:
+		return float64(value)
+	}
+	return value
+}
+
+func (c *canonicalizer) canonicalize(expr Expression) Expression {
+	switch expr := expr.(type) {
+	case ValueExpr:
+		return ValueExpr{canonicalizeValue(expr.Value)}
+	case FieldExpr:
+		if newRoot, ok := c.vars[expr.Root]; ok {
+			return FieldExpr{newRoot, expr.Path}
+		}
+		return expr
+	case FuncExpr:
+		params := make([]Expression, len(expr.Params))
+		for i, param := range expr.Params {
+			params[i] = c.canonicalize(param)
+		}
+		return FuncExpr{expr.FuncName, params}
+	case NotExpr:
+		switch subExpr := c.canonicalize(expr.SubExpr).(type) {
+		case NotExpr:
+			return subExpr.SubExpr
+		case EqualsExpr:
+			return NotEqualsExpr{subExpr.Lhs, subExpr.Rhs}
+		case NotEqualsExpr:
+			return EqualsExpr{subExpr.Lhs, subExpr.Rhs}
+		case ExistsExpr:
+			return NotExistsExpr{subExpr.SubExpr}
+		case NotExistsExpr:
+			return ExistsExpr{subExpr.SubExpr}
+		default:
+			return NotExpr{subExpr}
+		}
+	case AndExpr:
+		terms := c.canonicalizeTerms(expr, true)
+		if len(terms) == 1 {
+			return terms[0]
+		}
+		return AndExpr(terms)
+	case OrExpr:
+		terms := c.canonicalizeTerms(expr, false)
+		if len(terms) == 1 {
+			return terms[0]
+		}
+		return OrExpr(terms)
+	case AnyInExpr:
+		varID, inExpr, subExpr := c.canonicalizeLoop(expr.VarId, expr.InExpr, expr.SubExpr)
+		return AnyInExpr{varID, inExpr, subExpr}
+	case EveryInExpr:
+		varID, inExpr, subExpr := c.canonicalizeLoop(expr.VarId, expr.InExpr, expr.SubExpr)
+		return EveryInExpr{varID, inExpr, subExpr}
+	case AnyEveryInExpr:
+		varID, inExpr, subExpr := c.canonicalizeLoop(expr.VarId, expr.InExpr, expr.SubExpr)
+		return AnyEveryInExpr{varID, inExpr, subExpr}
+	case ExistsExpr:
+		return ExistsExpr{c.canonicalize(expr.SubExpr)}
+	case NotExistsExpr:
+		return NotExistsExpr{c.canonicalize(expr.SubExpr)}
+	case EqualsExpr:
+		lhs, rhs, _ := c.canonicalizeOperands(expr.Lhs, expr.Rhs)
+		return EqualsExpr{lhs, rhs}
+	case NotEqualsExpr:
+		lhs, rhs, _ := c.canonicalizeOperands(expr.Lhs, expr.Rhs)
+		return NotEqualsExpr{lhs, rhs}
+	case LessThanExpr:
+		lhs, rhs, swapped := c.canonicalizeOperands(expr.Lhs, expr.Rhs)
+		if swapped {
+			return GreaterThanExpr{lhs, rhs}
+		}
+		return LessThanExpr{lhs, rhs}
+	case LessEqualsExpr:
+		lhs, rhs, swapped := c.canonicalizeOperands(expr.Lhs, expr.Rhs)
+		if swapped {
+			return GreaterEqualsExpr{lhs, rhs}
+		}
+		return LessEqualsExpr{lhs, rhs}
+	case GreaterThanExpr:
+		lhs, rhs, swapped := c.canonicalizeOperands(expr.Lhs, expr.Rhs)
+		if swapped {
+			return LessThanExpr{lhs, rhs}
+		}
+		return GreaterThanExpr{lhs, rhs}
+	case GreaterEqualsExpr:
+		lhs, rhs, swapped := c.canonicalizeOperands(expr.Lhs, expr.Rhs)
+		if swapped {
+			return LessEqualsExpr{lhs, rhs}
+		}
+		return GreaterEqualsExpr{lhs, rhs}
+	case LikeExpr:
+		return LikeExpr{c.canonicalize(expr.Lhs), c.canonicalize(expr.Rhs)}
+	}
+
+	return expr
+}
+
+// canonicalExpressionKey encodes an expression into a string which, unlike
+// String(), distinguishes between every expression and value type.
+func canonicalExpressionKey(expr Expression) string {
+	var out bytes.Buffer
+	writeExpressionKey(&out, expr)
+	return out.String()
+}
+
+func writeValueKey(out *bytes.Buffer, value interface{}) {
+	switch value := value.(type) {
+	case nil:
+		out.WriteString("null")
+	case bool:
+		out.WriteString(strconv.FormatBool(value))
+	case int64:
+		out.WriteString("i:" + strconv.FormatInt(value, 10))
+	case uint64:
+		out.WriteString("u:" + strconv.FormatUint(value, 10))
+	case float64:
+		out.WriteString("f:" + strconv.FormatFloat(value, 'g', -1, 64))
+	case *big.Rat:
+		out.WriteString("d:" + value.RatString())
+	case string:
+		out.WriteString("s:" + strconv.Quote(value))
+	default:
+		out.WriteString(strconv.Quote(fmt.Sprintf("%T:%v", value, value)))
+	}
+}
+
+func writeExpressionKeys(out *bytes.Buffer, name string, exprs ...Expression) {
+	out.WriteString("(" + name)
+	for _, expr := range exprs {
+		out.WriteByte(' ')
+		writeExpressionKey(out, expr)
+	}
+	out.WriteByte(')')
+}
+
+func writeExpressionKey(out *bytes.Buffer, expr Expression) {
+	switch expr := expr.(type) {
+	case TrueExpr:
+		out.WriteString("(true)")
+	case FalseExpr:
+		out.WriteString("(false)")
+	case ValueExpr:
+		out.WriteString("(value ")
+		writeValueKey(out, expr.Value)
+		out.WriteByte(')')
+	case TimeExpr:
+		out.WriteString("(time ")
+		writeValueKey(out, expr.Time)
+		out.WriteByte(')')
+	case RegexExpr:
+		out.WriteString("(regex ")
+		writeValueKey(out, expr.Regex)
+		out.WriteByte(')')
+	case PcreExpr:
+		out.WriteString("(pcre ")
+		writeValueKey(out, expr.Pcre)
+		out.WriteByte(')')
+	case LikePatternExpr:
+		out.WriteString("(likepattern ")
+		writeValueKey(out, expr.Pattern)
+		out.WriteString(" " + strconv.Itoa(int(expr.Escape)) + ")")
+	case FieldExpr:
+		out.WriteString("(field " + strconv.Itoa(int(expr.Root)))
+		for _, elem := range expr.Path {
+			out.WriteString(" " + strconv.Quote(elem))
+		}
+		out.WriteByte(')')
+	case MetaExpr:
+		out.WriteString("(meta")
+		for _, elem := range expr.Path {
+			out.WriteString(" " + strconv.Quote(elem))
+		}
+		out.WriteByte(')')
+	case FuncExpr:
+		writeExpressionKeys(out, "func "+strconv.Quote(expr.FuncName), expr.Params...)
+	case NotExpr:
+		writeExpressionKeys(out, "not", expr.SubExpr)
+	case AndExpr:
+		writeExpressionKeys(out, "and", expr...)
+	case OrExpr:
+		writeExpressionKeys(out, "or", expr...)
+	case AnyInExpr:
+		writeExpressionKeys(out, "anyin "+strconv.Itoa(int(expr.VarId)), expr.InExpr, expr.SubExpr)
+	case EveryInExpr:
+		writeExpressionKeys(out, "everyin "+strconv.Itoa(int(expr.VarId)), expr.InExpr, expr.SubExpr)
+	case AnyEveryInExpr:
+		writeExpressionKeys(out, "anyeveryin "+strconv.Itoa(int(expr.VarId)), expr.InExpr, expr.SubExpr)
+	case ExistsExpr:
+		writeExpressionKeys(out, "exists", expr.SubExpr)
+	case NotExistsExpr:
+		writeExpressionKeys(out, "notexists", expr.SubExpr)
+	case EqualsExpr:
+		writeExpressionKeys(out, "eq", expr.Lhs, expr.Rhs)
+	case NotEqualsExpr:
+		writeExpressionKeys(out, "neq", expr.Lhs, expr.Rhs)
+	case LessThanExpr:
+		writeExpressionKeys(out, "lt", expr.Lhs, expr.Rhs)
+	case LessEqualsExpr:
+		writeExpressionKeys(out, "lte", expr.Lhs, expr.Rhs)
+	case GreaterThanExpr:
+		writeExpressionKeys(out, "gt", expr.Lhs, expr.Rhs)
+	case GreaterEqualsExpr:
+		writeExpressionKeys(out, "gte", expr.Lhs, expr.Rhs)
+	case LikeExpr:
+		writeExpressionKeys(out, "like", expr.Lhs, expr.Rhs)
+	default:
+		out.WriteString(strconv.Quote(fmt.Sprintf("%T:%v", expr, expr)))
+	}
+}
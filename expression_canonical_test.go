@@ -0,0 +1,146 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalizeExpression(t *testing.T) {
+	assert := assert.New(t)
+
+	a := FieldExpr{0, []string{"a"}}
+	b := FieldExpr{0, []string{"b"}}
+
+	assert.Equal(
+		GreaterThanExpr{a, ValueExpr{int64(5)}},
+		CanonicalizeExpression(LessThanExpr{ValueExpr{5}, a}))
+
+	assert.Equal(
+		AndExpr{EqualsExpr{a, ValueExpr{int64(1)}}, NotEqualsExpr{b, ValueExpr{"x"}}},
+		CanonicalizeExpression(AndExpr{
+			NotExpr{EqualsExpr{ValueExpr{"x"}, b}},
+			AndExpr{EqualsExpr{a, ValueExpr{uint32(1)}}, EqualsExpr{ValueExpr{int8(1)}, a}},
+		}))
+
+	// Floats are not made into integers as they collate differently
+	assert.Equal(
+		EqualsExpr{a, ValueExpr{float64(1)}},
+		CanonicalizeExpression(EqualsExpr{a, ValueExpr{float32(1)}}))
+
+	assert.Equal(
+		AnyInExpr{1, a, EveryInExpr{2, FieldExpr{1, []string{"c"}}, ExistsExpr{FieldExpr{2, nil}}}},
+		CanonicalizeExpression(AnyInExpr{7, a, EveryInExpr{3, FieldExpr{7, []string{"c"}}, ExistsExpr{FieldExpr{3, nil}}}}))
+}
+
+func TestExpressionEqualAndHash(t *testing.T) {
+	assert := assert.New(t)
+
+	a := FieldExpr{0, []string{"a"}}
+	b := FieldExpr{0, []string{"b"}}
+
+	equivalent := [][]Expression{
+		{
+			AndExpr{GreaterThanExpr{a, ValueExpr{5}}, EqualsExpr{b, ValueExpr{"x"}}},
+			AndExpr{EqualsExpr{ValueExpr{"x"}, b}, LessThanExpr{ValueExpr{int64(5)}, a}},
+		},
+		{
+			OrExpr{NotExistsExpr{a}, LessEqualsExpr{a, b}},
+			OrExpr{GreaterEqualsExpr{b, a}, NotExpr{ExistsExpr{a}}, NotExistsExpr{a}},
+		},
+		{
+			AnyInExpr{1, a, EqualsExpr{FieldExpr{1, []string{"x"}}, ValueExpr{1}}},
+			AnyInExpr{4, a, EqualsExpr{ValueExpr{uint64(1)}, FieldExpr{4, []string{"x"}}}},
+		},
+		{
+			AndExpr{GreaterThanExpr{a, ValueExpr{5.0}}, EqualsExpr{a, ValueExpr{float32(1)}}},
+			AndExpr{LessThanExpr{ValueExpr{5.0}, a}, EqualsExpr{a, ValueExpr{1.0}}},
+		},
+		{
+			EqualsExpr{MetaExpr{[]string{"id"}}, ValueExpr{"x"}},
+			EqualsExpr{ValueExpr{"x"}, MetaExpr{[]string{"id"}}},
+		},
+	}
+	for _, exprs := range equivalent {
+		assert.True(ExpressionEqual(exprs[0], exprs[1]), "%v\n%v", exprs[0], exprs[1])
+		assert.Equal(ExpressionHash(exprs[0]), ExpressionHash(exprs[1]))
+	}
+
+	different := [][]Expression{
+		{EqualsExpr{a, ValueExpr{"1"}}, EqualsExpr{a, ValueExpr{1}}},
+		{EqualsExpr{a, ValueExpr{1}}, EqualsExpr{a, ValueExpr{1.0}}},
+		{GreaterThanExpr{a, ValueExpr{5}}, GreaterThanExpr{a, ValueExpr{5.0}}},
+		{FuncExpr{"div", []Expression{a, ValueExpr{2}}}, FuncExpr{"div", []Expression{a, ValueExpr{2.0}}}},
+		{MetaExpr{[]string{"id"}}, FieldExpr{0, []string{"id"}}},
+		{LessThanExpr{a, b}, LessThanExpr{b, a}},
+		{AnyInExpr{1, a, ExistsExpr{FieldExpr{1, nil}}}, EveryInExpr{1, a, ExistsExpr{FieldExpr{1, nil}}}},
+		{FieldExpr{0, []string{"a.b"}}, FieldExpr{0, []string{"a", "b"}}},
+	}
+	for _, exprs := range different {
+		assert.False(ExpressionEqual(exprs[0], exprs[1]), "%v\n%v", exprs[0], exprs[1])
+		assert.NotEqual(ExpressionHash(exprs[0]), ExpressionHash(exprs[1]))
+	}
+}
+
+func TestExpressionEqualNumericTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	a := FieldExpr{0, []string{"a"}}
+	doc := []byte(`{"a":"5"}`)
+
+	// Integers and floats collate differently against strings, so the two
+	// forms must not be treated as the same expression.
+	for _, exprs := range [][]Expression{
+		{EqualsExpr{a, ValueExpr{5}}, EqualsExpr{a, ValueExpr{5.0}}},
+		{GreaterThanExpr{a, ValueExpr{5}}, GreaterThanExpr{a, ValueExpr{5.0}}},
+	} {
+		var results []bool
+		for _, expr := range exprs {
+			var trans Transformer
+			matched, err := NewFastMatcher(trans.Transform([]Expression{expr})).Match(doc)
+			assert.Nil(err)
+			results = append(results, matched)
+		}
+		assert.NotEqual(results[0], results[1], "%v", exprs)
+		assert.False(ExpressionEqual(exprs[0], exprs[1]), "%v", exprs)
+	}
+}
+
+func TestCanonicalizePreservesMatches(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 500; i++ {
+		expr := genRandomExpression(rng, 3)
+		canonical := CanonicalizeExpression(expr)
+
+		if !ExpressionEqual(expr, canonical) {
+			t.Fatalf("canonical form is not equal to the original:\n%v\n%v", expr, canonical)
+		}
+		if !ExpressionEqual(canonical, CanonicalizeExpression(canonical)) {
+			t.Fatalf("canonical form is not stable:\n%v", canonical)
+		}
+
+		docs := make([][]byte, 8)
+		for j := range docs {
+			docs[j] = genRandomDocument(rng, 3)
+		}
+
+		// Both forms are matched together to also check that the FastMatcher
+		// agrees with the SlowMatcher on the canonical form.
+		checkMatcherParity(t, []Expression{expr, canonical}, docs...)
+
+		slow := NewSlowMatcher([]Expression{expr, canonical})
+		for _, doc := range docs {
+			slow.Reset()
+			if _, err := slow.Match(doc); err != nil {
+				t.Fatalf("failed to match: %v", err)
+			}
+			if slow.ExpressionMatched(0) != slow.ExpressionMatched(1) {
+				t.Fatalf("canonicalization changed the result\ndoc: %s\nexpression:\n%v\ncanonical:\n%v",
+					doc, expr, canonical)
+			}
+		}
+	}
+}
@@ -31,6 +31,19 @@ func parseJsonField(data []interface{}) (Expression, error) {
 	return out, nil
 }
 
+func parseJsonMeta(data []interface{}) (Expression, error) {
+	var out MetaExpr
+	for pos := 1; pos < len(data); pos++ {
+		dataElem, ok := data[pos].(string)
+		if !ok {
+			return nil, errors.New("invalid meta expression format")
+		}
+		out.Path = append(out.Path, dataElem)
+	}
+
+	return out, nil
+}
+
 func parseJsonFunc(data []interface{}) (Expression, error) {
 	var out FuncExpr
 	pos := 1
@@ -282,6 +295,29 @@ func parseJsonRegex(data []interface{}) (Expression, error) {
 	}, nil
 }
 
+func parseJsonLikePattern(data []interface{}) (Expression, error) {
+	pattern, ok := data[1].(string)
+	if !ok {
+		return nil, errors.New("invalid like pattern format")
+	}
+
+	escape := DefaultLikeEscape
+	if len(data) > 2 {
+		escapeStr, ok := data[2].(string)
+		if !ok {
+			return nil, errors.New("invalid like pattern format")
+		}
+
+		var err error
+		escape, err = ParseLikeEscape(escapeStr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return LikePatternExpr{pattern, escape}, nil
+}
+
 func parseJsonTime(data []interface{}) (Expression, error) {
 	if dateStr, ok := data[1].(string); ok && !validTimeChecker(dateStr) {
 		return nil, ErrorInvalidTimeFormat
@@ -303,6 +339,8 @@ func parseJsonSubexpr(data []interface{}) (Expression, error) {
 		return parseJsonValue(data)
 	case "field":
 		return parseJsonField(data)
+	case "meta":
+		return parseJsonMeta(data)
 	case "func":
 		return parseJsonFunc(data)
 	case "not":
@@ -337,6 +375,8 @@ func parseJsonSubexpr(data []interface{}) (Expression, error) {
 		return parseJsonLike(data)
 	case "regex":
 		return parseJsonRegex(data)
+	case "likepattern":
+		return parseJsonLikePattern(data)
 	case "time":
 		return parseJsonTime(data)
 	}
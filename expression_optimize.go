@@ -0,0 +1,351 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"math"
+	"reflect"
+)
+
+// OptimizeExpression rewrites an expression into a smaller equivalent one.
+// Functions whose parameters are all constants are folded into a single
+// value, NOTs are pushed down towards the leaves, and duplicate, always true
+// or always false terms are removed from ANDs and ORs.  Machine-generated
+// filters often contain such redundancy, and removing it keeps the binary
+// tree built by the Transformer small.
+//
+// Note that, as is already the case for PI() and E() in the parsers, a
+// folded function result behaves like a constant supplied by the user when
+// it is compared against values of a different type.
+//
+// The expression is assumed to be matched with CompareModeCollate, which
+// is the default of the Transformer.
+func OptimizeExpression(expr Expression) Expression {
+	return OptimizeExpressionForMode(expr, CompareModeCollate)
+}
+
+// OptimizeExpressionForMode is OptimizeExpression for an expression which
+// will be matched with the given CompareMode.  Equalities of one value with
+// two different constants only contradict each other under some modes, so
+// the mode decides whether an AND of them is known to be false.
+func OptimizeExpressionForMode(expr Expression, mode CompareMode) Expression {
+	switch expr := expr.(type) {
+	case AndExpr:
+		return optimizeExpressionAnd(expr, mode)
+	case OrExpr:
+		return optimizeExpressionOr(expr, mode)
+	case NotExpr:
+		return negateExpression(OptimizeExpressionForMode(expr.SubExpr, mode), mode)
+	case AnyInExpr:
+		expr.SubExpr = OptimizeExpressionForMode(expr.SubExpr, mode)
+		if _, ok := expr.SubExpr.(FalseExpr); ok {
+			return FalseExpr{}
+		}
+		return expr
+	case EveryInExpr:
+		// Every is true for an empty array, so nothing can be assumed
+		// about the loop from a constant body.
+		expr.SubExpr = OptimizeExpressionForMode(expr.SubExpr, mode)
+		return expr
+	case AnyEveryInExpr:
+		expr.SubExpr = OptimizeExpressionForMode(expr.SubExpr, mode)
+		if _, ok := expr.SubExpr.(FalseExpr); ok {
+			return FalseExpr{}
+		}
+		return expr
+	case EqualsExpr:
+		return EqualsExpr{optimizeOperand(expr.Lhs), optimizeOperand(expr.Rhs)}
+	case NotEqualsExpr:
+		return NotEqualsExpr{optimizeOperand(expr.Lhs), optimizeOperand(expr.Rhs)}
+	case LessThanExpr:
+		return LessThanExpr{optimizeOperand(expr.Lhs), optimizeOperand(expr.Rhs)}
+	case LessEqualsExpr:
+		return LessEqualsExpr{optimizeOperand(expr.Lhs), optimizeOperand(expr.Rhs)}
+	case GreaterThanExpr:
+		return GreaterThanExpr{optimizeOperand(expr.Lhs), optimizeOperand(expr.Rhs)}
+	case GreaterEqualsExpr:
+		return GreaterEqualsExpr{optimizeOperand(expr.Lhs), optimizeOperand(expr.Rhs)}
+	case LikeExpr:
+		return LikeExpr{optimizeOperand(expr.Lhs), optimizeOperand(expr.Rhs)}
+	}
+
+	return expr
+}
+
+func optimizeOperand(expr Expression) Expression {
+	funcExpr, ok := expr.(FuncExpr)
+	if !ok {
+		return expr
+	}
+
+	return foldFuncExpr(funcExpr)
+}
+
+// foldFuncExpr evaluates a function whose parameters are all numeric
+// constants, returning the function unchanged if that is not possible.
+func foldFuncExpr(expr FuncExpr) Expression {
+	params := make([]Expression, len(expr.Params))
+	isConstant := true
+	for i, param := range expr.Params {
+		params[i] = optimizeOperand(param)
+		if _, ok := params[i].(ValueExpr); !ok {
+			isConstant = false
+		}
+	}
+	expr = FuncExpr{expr.FuncName, params}
+
+	if len(params) == 0 {
+		if isConst, val := funcIsConstantType(expr.FuncName); isConst {
+			return ValueExpr{val}
+		}
+		return expr
+	}
+
+	// Dates produce times rather than values, so are left for the matcher
+	if !isConstant || expr.FuncName == DateFunc {
+		return expr
+	}
+
+	fastParams := make([]FastVal, len(params))
+	for i, param := range params {
+		fastParams[i] = NewFastVal(param.(ValueExpr).Value)
+		if !fastParams[i].IsNumeric() {
+			return expr
+		}
+	}
+
+	// Division by zero and overflow are errors when matching strictly, so
+	// leave those for the matcher to report rather than folding them here.
+	result := callFastValFunc(expr.FuncName, fastParams)
+	if checkFastValMath(expr.FuncName, fastParams, result) != nil {
+		return expr
+	}
+
+	switch result.Type() {
+	case IntValue:
+		return ValueExpr{result.GetInt()}
+	case UintValue:
+		return ValueExpr{result.GetUint()}
+	case FloatValue:
+		floatVal := result.GetFloat()
+		if math.IsNaN(floatVal) || math.IsInf(floatVal, 0) {
+			return expr
+		}
+		return ValueExpr{floatVal}
+	case DecimalValue:
+		return ValueExpr{result.GetDecimal()}
+	}
+
+	return expr
+}
+
+// negateExpression returns the negation of an already optimized expression,
+// applying De Morgan's laws to move the NOT as far down as it can go.  Only
+// rewrites which are exact under the matchers' handling of missing values
+// are made, so NOT is kept in front of ordering comparisons and loops.
+func negateExpression(expr Expression, mode CompareMode) Expression {
+	switch expr := expr.(type) {
+	case TrueExpr:
+		return FalseExpr{}
+	case FalseExpr:
+		return TrueExpr{}
+	case NotExpr:
+		return expr.SubExpr
+	case AndExpr:
+		newOrExpr := make(OrExpr, len(expr))
+		for i, subExpr := range expr {
+			newOrExpr[i] = negateExpression(subExpr, mode)
+		}
+		return optimizeExpressionOr(newOrExpr, mode)
+	case OrExpr:
+		newAndExpr := make(AndExpr, len(expr))
+		for i, subExpr := range expr {
+			newAndExpr[i] = negateExpression(subExpr, mode)
+		}
+		return optimizeExpressionAnd(newAndExpr, mode)
+	case EqualsExpr:
+		return NotEqualsExpr{expr.Lhs, expr.Rhs}
+	case NotEqualsExpr:
+		return EqualsExpr{expr.Lhs, expr.Rhs}
+	case ExistsExpr:
+		return NotExistsExpr{expr.SubExpr}
+	case NotExistsExpr:
+		return ExistsExpr{expr.SubExpr}
+	}
+
+	return NotExpr{expr}
+}
+
+// optimizeTerms optimizes the terms of an AND or OR, flattening nested
+// expressions of the same kind and dropping duplicates and identity terms.
+// If one of the terms decides the result on its own, it is returned as the
+// second value.
+func optimizeTerms(terms []Expression, isAnd bool, mode CompareMode) ([]Expression, Expression) {
+	var newTerms []Expression
+	var addTerm func(term Expression) Expression
+	addTerm = func(term Expression) Expression {
+		switch term := term.(type) {
+		case TrueExpr:
+			if !isAnd {
+				return TrueExpr{}
+			}
+			return nil
+		case FalseExpr:
+			if isAnd {
+				return FalseExpr{}
+			}
+			return nil
+		case AndExpr:
+			if isAnd {
+				for _, subTerm := range term {
+					if result := addTerm(subTerm); result != nil {
+						return result
+					}
+				}
+				return nil
+			}
+		case OrExpr:
+			if !isAnd {
+				for _, subTerm := range term {
+					if result := addTerm(subTerm); result != nil {
+						return result
+					}
+				}
+				return nil
+			}
+		}
+
+		negatedTerm := negateExpression(term, mode)
+		for _, otherTerm := range newTerms {
+			if reflect.DeepEqual(term, otherTerm) {
+				return nil
+			}
+
+			// The matchers never leave a term undecided, so a term alongside
+			// its own negation is always true in an OR and false in an AND.
+			if reflect.DeepEqual(negatedTerm, otherTerm) {
+				if isAnd {
+					return FalseExpr{}
+				}
+				return TrueExpr{}
+			}
+
+			if isAnd && equalsContradict(term, otherTerm, mode) {
+				return FalseExpr{}
+			}
+		}
+
+		newTerms = append(newTerms, term)
+		return nil
+	}
+
+	for _, term := range terms {
+		if result := addTerm(OptimizeExpressionForMode(term, mode)); result != nil {
+			return nil, result
+		}
+	}
+
+	return newTerms, nil
+}
+
+func optimizeExpressionAnd(expr AndExpr, mode CompareMode) Expression {
+	terms, result := optimizeTerms(expr, true, mode)
+	if result != nil {
+		return result
+	}
+
+	switch len(terms) {
+	case 0:
+		return TrueExpr{}
+	case 1:
+		return terms[0]
+	}
+	return AndExpr(terms)
+}
+
+func optimizeExpressionOr(expr OrExpr, mode CompareMode) Expression {
+	terms, result := optimizeTerms(expr, false, mode)
+	if result != nil {
+		return result
+	}
+
+	switch len(terms) {
+	case 0:
+		return FalseExpr{}
+	case 1:
+		return terms[0]
+	}
+	return OrExpr(terms)
+}
+
+// splitEqualsConstant splits an equality against a constant into the
+// compared expression and the constant.
+func splitEqualsConstant(expr Expression) (Expression, interface{}, bool) {
+	equalsExpr, ok := expr.(EqualsExpr)
+	if !ok {
+		return nil, nil, false
+	}
+
+	if value, ok := equalsExpr.Rhs.(ValueExpr); ok {
+		if _, ok := equalsExpr.Lhs.(ValueExpr); !ok {
+			return equalsExpr.Lhs, value.Value, true
+		}
+	}
+	if value, ok := equalsExpr.Lhs.(ValueExpr); ok {
+		return equalsExpr.Rhs, value.Value, true
+	}
+	return nil, nil, false
+}
+
+// usesCollation checks whether an expression applies a collation, under
+// which different strings can compare equal.
+func usesCollation(expr Expression) bool {
+	funcExpr, ok := expr.(FuncExpr)
+	if !ok {
+		return false
+	}
+
+	if funcExpr.FuncName == CollateFunc {
+		return true
+	}
+	for _, param := range funcExpr.Params {
+		if usesCollation(param) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalsContradict checks whether two terms compare the same expression for
+// equality against two different constants, which cannot both be true.  In
+// the strict and collating modes any one value converts to a single value of
+// each of these constant types, but floats are excluded as they are compared
+// with a tolerance, and collated strings as they compare equal to others.
+// The loose mode converts strings to numbers, so that a value such as 1 is
+// equal to both "1" and "01", and nothing is assumed under it.
+func equalsContradict(lhs, rhs Expression, mode CompareMode) bool {
+	if mode != CompareModeStrict && mode != CompareModeCollate {
+		return false
+	}
+
+	lhsField, lhsValue, ok := splitEqualsConstant(lhs)
+	if !ok {
+		return false
+	}
+	rhsField, rhsValue, ok := splitEqualsConstant(rhs)
+	if !ok {
+		return false
+	}
+
+	if !reflect.DeepEqual(lhsField, rhsField) || usesCollation(lhsField) {
+		return false
+	}
+
+	switch lhsValue.(type) {
+	case int, int64, uint64, string, bool:
+	default:
+		return false
+	}
+
+	return reflect.TypeOf(lhsValue) == reflect.TypeOf(rhsValue) && lhsValue != rhsValue
+}
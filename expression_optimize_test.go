@@ -0,0 +1,152 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptimizeConstantFolding(t *testing.T) {
+	assert := assert.New(t)
+
+	field := FieldExpr{0, []string{"a"}}
+
+	assert.Equal(
+		EqualsExpr{field, ValueExpr{float64(1024)}},
+		OptimizeExpression(EqualsExpr{field, FuncExpr{MathFuncPow, []Expression{ValueExpr{int64(2)}, ValueExpr{int64(10)}}}}))
+
+	assert.Equal(
+		LessThanExpr{field, ValueExpr{math.Pi}},
+		OptimizeExpression(LessThanExpr{field, FuncExpr{MathFuncPi, nil}}))
+
+	assert.Equal(
+		GreaterThanExpr{field, ValueExpr{int64(3)}},
+		OptimizeExpression(GreaterThanExpr{field, FuncExpr{MathFuncAbs, []Expression{
+			FuncExpr{MathFuncNeg, []Expression{ValueExpr{int64(3)}}},
+		}}}))
+
+	// Functions of fields, dates and divisions by zero are left alone
+	fieldFunc := FuncExpr{MathFuncAdd, []Expression{field, ValueExpr{int64(1)}}}
+	assert.Equal(EqualsExpr{fieldFunc, ValueExpr{int64(2)}},
+		OptimizeExpression(EqualsExpr{fieldFunc, ValueExpr{int64(2)}}))
+
+	divFunc := FuncExpr{MathFuncDiv, []Expression{ValueExpr{int64(1)}, ValueExpr{int64(0)}}}
+	assert.Equal(EqualsExpr{field, divFunc},
+		OptimizeExpression(EqualsExpr{field, divFunc}))
+
+	dateFunc := FuncExpr{DateFunc, []Expression{ValueExpr{"2019-01-01"}}}
+	assert.Equal(EqualsExpr{field, dateFunc},
+		OptimizeExpression(EqualsExpr{field, dateFunc}))
+}
+
+func TestOptimizeBooleans(t *testing.T) {
+	assert := assert.New(t)
+
+	a := FieldExpr{0, []string{"a"}}
+	b := FieldExpr{0, []string{"b"}}
+	aIs1 := EqualsExpr{a, ValueExpr{int64(1)}}
+	bIs1 := EqualsExpr{b, ValueExpr{int64(1)}}
+
+	// Absorption and flattening
+	assert.Equal(aIs1, OptimizeExpression(AndExpr{TrueExpr{}, aIs1}))
+	assert.Equal(FalseExpr{}, OptimizeExpression(AndExpr{FalseExpr{}, aIs1}))
+	assert.Equal(TrueExpr{}, OptimizeExpression(OrExpr{aIs1, TrueExpr{}}))
+	assert.Equal(AndExpr{aIs1, bIs1}, OptimizeExpression(AndExpr{aIs1, AndExpr{bIs1, aIs1}}))
+
+	// Contradictions and tautologies
+	assert.Equal(FalseExpr{}, OptimizeExpression(AndExpr{aIs1, EqualsExpr{ValueExpr{int64(2)}, a}}))
+	assert.Equal(FalseExpr{}, OptimizeExpression(AndExpr{aIs1, NotExpr{aIs1}}))
+	assert.Equal(TrueExpr{}, OptimizeExpression(OrExpr{ExistsExpr{a}, NotExistsExpr{a}}))
+	assert.Equal(AndExpr{EqualsExpr{a, ValueExpr{int64(1)}}, EqualsExpr{a, ValueExpr{float64(1)}}},
+		OptimizeExpression(AndExpr{EqualsExpr{a, ValueExpr{int64(1)}}, EqualsExpr{a, ValueExpr{float64(1)}}}))
+
+	// De Morgan
+	assert.Equal(
+		OrExpr{NotEqualsExpr{a, ValueExpr{int64(1)}}, NotExistsExpr{b}},
+		OptimizeExpression(NotExpr{AndExpr{aIs1, ExistsExpr{b}}}))
+	assert.Equal(
+		AndExpr{NotExpr{LessThanExpr{a, b}}, bIs1},
+		OptimizeExpression(NotExpr{OrExpr{LessThanExpr{a, b}, NotExpr{bIs1}}}))
+	assert.Equal(aIs1, OptimizeExpression(NotExpr{NotExpr{aIs1}}))
+
+	// Loops
+	assert.Equal(FalseExpr{}, OptimizeExpression(AnyInExpr{1, a, AndExpr{FalseExpr{}, aIs1}}))
+	assert.Equal(EveryInExpr{1, a, FalseExpr{}}, OptimizeExpression(EveryInExpr{1, a, FalseExpr{}}))
+}
+
+func TestOptimizeEqualsContradictModes(t *testing.T) {
+	assert := assert.New(t)
+
+	a := FieldExpr{0, []string{"a"}}
+	numbers := AndExpr{EqualsExpr{a, ValueExpr{"1"}}, EqualsExpr{a, ValueExpr{"01"}}}
+	collated := FuncExpr{CollateFunc, []Expression{a, ValueExpr{"nocase"}}}
+	cases := AndExpr{EqualsExpr{collated, ValueExpr{"abc"}}, EqualsExpr{collated, ValueExpr{"ABC"}}}
+
+	tests := []struct {
+		expr   Expression
+		mode   CompareMode
+		doc    string
+		folded bool
+	}{
+		{numbers, CompareModeStrict, `{"a": "1"}`, true},
+		{numbers, CompareModeCollate, `{"a": 1}`, true},
+		{numbers, CompareModeLoose, `{"a": 1}`, false},
+		{cases, CompareModeStrict, `{"a": "Abc"}`, false},
+		{cases, CompareModeCollate, `{"a": "Abc"}`, false},
+	}
+
+	for _, test := range tests {
+		optimized := OptimizeExpressionForMode(test.expr, test.mode)
+		if test.folded {
+			assert.Equal(FalseExpr{}, optimized, "%v %v", test.mode, test.expr)
+		} else {
+			assert.Equal(test.expr, optimized, "%v %v", test.mode, test.expr)
+		}
+
+		// Both terms hold for the document unless they were folded away
+		m := NewSlowMatcher([]Expression{test.expr})
+		m.CompareMode = test.mode
+		matched, err := m.Match([]byte(test.doc))
+		assert.Nil(err)
+		assert.Equal(!test.folded, matched, "%v %v", test.mode, test.expr)
+	}
+}
+
+func TestOptimizePreservesMatches(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	modes := []CompareMode{CompareModeCollate, CompareModeStrict, CompareModeLoose}
+	for i := 0; i < 1000; i++ {
+		mode := modes[i%len(modes)]
+		expr := genRandomExpression(rng, 3)
+		optimized := OptimizeExpressionForMode(expr, mode)
+
+		original := NewSlowMatcher([]Expression{expr})
+		original.CompareMode = mode
+		optimizedMatcher := NewSlowMatcher([]Expression{optimized})
+		optimizedMatcher.CompareMode = mode
+		for j := 0; j < 8; j++ {
+			doc := genRandomDocument(rng, 3)
+
+			original.Reset()
+			optimizedMatcher.Reset()
+
+			expected, err := original.Match(doc)
+			if err != nil {
+				t.Fatalf("failed to match: %v", err)
+			}
+			matched, err := optimizedMatcher.Match(doc)
+			if err != nil {
+				t.Fatalf("failed to match: %v", err)
+			}
+
+			if matched != expected {
+				t.Fatalf("optimization changed the result to %v in %v mode\ndoc: %s\nexpression:\n%v\noptimized:\n%v",
+					matched, mode, doc, expr, optimized)
+			}
+		}
+	}
+}
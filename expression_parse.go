@@ -0,0 +1,181 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"fmt"
+)
+
+// ParseDialect selects which filter syntax ParseExpression accepts.
+type ParseDialect int
+
+const (
+	// DialectAny accepts a single grammar covering both the filter
+	// expression syntax and the simple syntax, so the two can be mixed
+	// within one filter, as in a == 1 && EXISTS(b).  It is the filter
+	// expression grammar along with the simple syntax's && and || and its
+	// postfix NOT LIKE and EXISTS operators.  Where the two syntaxes
+	// disagree, the filter expression syntax is followed: AND binds
+	// tighter than OR, and a single-quoted 'x' names a field rather than
+	// being a string.
+	DialectAny ParseDialect = iota
+
+	// DialectFilter only accepts the filter expression syntax, as used by
+	// GetFilterExpressionMatcher.
+	DialectFilter
+
+	// DialectSimple only accepts the simple syntax, as used by
+	// ParseSimpleExpression.
+	DialectSimple
+)
+
+func (dialect ParseDialect) String() string {
+	switch dialect {
+	case DialectAny:
+		return "any"
+	case DialectFilter:
+		return "filter"
+	case DialectSimple:
+		return "simple"
+	}
+	return fmt.Sprintf("ParseDialect(%d)", int(dialect))
+}
+
+type ParseOptions struct {
+	Dialect ParseDialect
+}
+
+// ParseExpression parses a filter written in the supported syntaxes.  The
+// result is normalized so that constructs both syntaxes can express
+// produce identical trees regardless of which one was used.  Errors are
+// always a *ParseError.
+func ParseExpression(text string, opts ParseOptions) (Expression, error) {
+	switch opts.Dialect {
+	case DialectFilter:
+		return parseFilterDialect(text, FilterExpressionParser{})
+	case DialectSimple:
+		return parseSimpleDialect(text)
+	case DialectAny:
+		return parseFilterDialect(text, FilterExpressionParser{simpleSyntax: true})
+	}
+	return nil, &ParseError{Err: fmt.Errorf("Invalid parse dialect %v", opts.Dialect)}
+}
+
+func parseFilterDialect(text string, parser FilterExpressionParser) (Expression, error) {
+	if len(text) == 0 {
+		return nil, newParseError(text, 0, "", nil, ErrorEmptyInput)
+	}
+
+	fe := &FilterExpression{}
+	err := parser.ParseString(text, fe)
+	if err != nil {
+		return nil, err
+	}
+
+	expr, err := fe.OutputExpression()
+	if err != nil {
+		return nil, &ParseError{Err: err}
+	}
+	return normalizeParsedExpression(expr), nil
+}
+
+func parseSimpleDialect(text string) (expr Expression, err error) {
+	// The simple parser can panic on input outside of its grammar, which
+	// would otherwise take down the caller.
+	defer func() {
+		if r := recover(); r != nil {
+			expr, err = nil, &ParseError{Err: fmt.Errorf("Error: Unable to parse expression: %v", r)}
+		}
+	}()
+
+	expr, err = ParseSimpleExpression(text)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeParsedExpression(expr), nil
+}
+
+// normalizeParsedExpression irons out the differences in how the two
+// parsers build equivalent trees.  The filter parser wraps every term in
+// an OR of ANDs, negates comparisons with a NotExpr and produces int
+// constants, while the simple parser nests chained ANDs and ORs pairwise
+// and produces int64 constants.  A boolean used as a condition is a
+// ValueExpr from the simple parser, and TrueExpr or FalseExpr from the
+// filter parser.
+func normalizeParsedExpression(expr Expression) Expression {
+	switch expr := expr.(type) {
+	case ValueExpr:
+		if value, ok := expr.Value.(bool); ok {
+			if value {
+				return TrueExpr{}
+			}
+			return FalseExpr{}
+		}
+	case AndExpr:
+		var out AndExpr
+		for _, subExpr := range expr {
+			subExpr = normalizeParsedExpression(subExpr)
+			if nested, ok := subExpr.(AndExpr); ok {
+				out = append(out, nested...)
+			} else {
+				out = append(out, subExpr)
+			}
+		}
+		if len(out) == 1 {
+			return out[0]
+		}
+		return out
+	case OrExpr:
+		var out OrExpr
+		for _, subExpr := range expr {
+			subExpr = normalizeParsedExpression(subExpr)
+			if nested, ok := subExpr.(OrExpr); ok {
+				out = append(out, nested...)
+			} else {
+				out = append(out, subExpr)
+			}
+		}
+		if len(out) == 1 {
+			return out[0]
+		}
+		return out
+	case NotExpr:
+		subExpr := normalizeParsedExpression(expr.SubExpr)
+		switch subExpr := subExpr.(type) {
+		case EqualsExpr:
+			return NotEqualsExpr{subExpr.Lhs, subExpr.Rhs}
+		case ExistsExpr:
+			return NotExistsExpr{subExpr.SubExpr}
+		}
+		return NotExpr{subExpr}
+	case EqualsExpr:
+		return EqualsExpr{normalizeParsedOperand(expr.Lhs), normalizeParsedOperand(expr.Rhs)}
+	case NotEqualsExpr:
+		return NotEqualsExpr{normalizeParsedOperand(expr.Lhs), normalizeParsedOperand(expr.Rhs)}
+	case LessThanExpr:
+		return LessThanExpr{normalizeParsedOperand(expr.Lhs), normalizeParsedOperand(expr.Rhs)}
+	case LessEqualsExpr:
+		return LessEqualsExpr{normalizeParsedOperand(expr.Lhs), normalizeParsedOperand(expr.Rhs)}
+	case GreaterThanExpr:
+		return GreaterThanExpr{normalizeParsedOperand(expr.Lhs), normalizeParsedOperand(expr.Rhs)}
+	case GreaterEqualsExpr:
+		return GreaterEqualsExpr{normalizeParsedOperand(expr.Lhs), normalizeParsedOperand(expr.Rhs)}
+	case LikeExpr:
+		return LikeExpr{normalizeParsedOperand(expr.Lhs), normalizeParsedOperand(expr.Rhs)}
+	}
+	return expr
+}
+
+func normalizeParsedOperand(expr Expression) Expression {
+	switch expr := expr.(type) {
+	case ValueExpr:
+		return ValueExpr{canonicalizeValue(expr.Value)}
+	case FuncExpr:
+		params := make([]Expression, len(expr.Params))
+		for i, param := range expr.Params {
+			params[i] = normalizeParsedOperand(param)
+		}
+		return FuncExpr{expr.FuncName, params}
+	}
+	return expr
+}
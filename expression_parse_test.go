@@ -0,0 +1,191 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Filters from simpleParser_test.go and filterExprParser_test.go which are
+// valid in both syntaxes and must produce the same tree from either parser.
+var parseCompatOverlap = []string{
+	// simpleParser_test.go
+	"((`name`.`first` == \"Neil\"))",
+	"( `name`.`first` == \"Neil\")",
+	"`[XDCRInternal]`.`Version` > 1.0",
+	"name.first IS NOT NULL",
+	"`name`.`first` IS MISSING",
+	"name.`first and last` ==  \"Neil Huang\"",
+	"company.name ==  \"'dummy space Corp'\"",
+	"`something` >= \"somethingElse\"",
+	"name.first LIKE \"Ne_l\"",
+	"name.first =~ \"Ne[a|i]l\"",
+
+	// filterExprParser_test.go
+	"fieldpath.path IS NOT NULL AND fieldpath.path2 IS NOT NULL",
+	"fieldpath.path = \"value\"",
+	"fieldpath.path == \"value\"",
+	"string > 123",
+	"int > \"0a\"",
+	"`[$%XDCRInternalMeta*%$]`.metaKey = \"value\"",
+	"`1DarrayPath`[1] = \"arrayVal1\"",
+	"fieldpath.path <= ABS(5)",
+	"DATE(fieldpath.path) > DATE(\"2019-01-01\") AND DATE(fieldpath.path) < DATE('2019-01-01T23:59:59.999Z')",
+	"fieldpath.path >= ABS(CEIL(PI()))",
+	"fieldpath.path != POW(ABS(CEIL(PI())),2)",
+	"fieldpath.path IS NULL",
+	"fieldpath.path2 IS MISSING",
+	"achievements < -1",
+}
+
+// Filters which only one of the two syntaxes accepts.
+var parseCompatFilterOnly = []string{
+	"TRUE OR FALSE AND NOT FALSE",
+	"(TRUE AND FALSE OR TRUE) AND FALSE OR TRUE",
+	"EXISTS(onePath) AND onePath.field1 <> onePath.field2",
+	"META().`onePath.Only` = \"value\"",
+	"arrayPath[1].path2.arrayPath3[10].`multiword array`[20] = fieldpath2.path2",
+	"key < PI() AND -key < 0 AND key > -PI() AND key < ABS(-PI()) AND key > -ABS(-PI())",
+	"ABS(-achievements[2]*10) > 0",
+	"`field`[01] == 1",
+}
+
+var parseCompatSimpleOnly = []string{
+	"`name`.`first` == \"Neil\" && (`age` < 50 || `isActive` == true)",
+	"true && `name`.`first` == \"Neil\" || `age` < 50",
+	"`name`.`first` NOT LIKE \"abc\"",
+	"`name`.`first` IS NOT NULL && isActive == true",
+}
+
+func TestParseExpressionCompatibility(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, text := range parseCompatOverlap {
+		filterExpr, err := ParseExpression(text, ParseOptions{Dialect: DialectFilter})
+		assert.Nil(err, text)
+		simpleExpr, err := ParseExpression(text, ParseOptions{Dialect: DialectSimple})
+		assert.Nil(err, text)
+		anyExpr, err := ParseExpression(text, ParseOptions{})
+		assert.Nil(err, text)
+
+		assert.Equal(filterExpr, simpleExpr, text)
+		assert.Equal(filterExpr, anyExpr, text)
+	}
+
+	for _, text := range parseCompatFilterOnly {
+		filterExpr, err := ParseExpression(text, ParseOptions{Dialect: DialectFilter})
+		assert.Nil(err, text)
+		anyExpr, err := ParseExpression(text, ParseOptions{})
+		assert.Nil(err, text)
+		assert.Equal(filterExpr, anyExpr, text)
+
+		// The simple parser misreads arithmetic as part of a field name
+		// rather than failing, so only insist that it does not agree.
+		simpleExpr, err := ParseExpression(text, ParseOptions{Dialect: DialectSimple})
+		if err == nil {
+			assert.NotEqual(filterExpr, simpleExpr, text)
+		}
+	}
+
+	for _, text := range parseCompatSimpleOnly {
+		simpleExpr, err := ParseExpression(text, ParseOptions{Dialect: DialectSimple})
+		assert.Nil(err, text)
+		anyExpr, err := ParseExpression(text, ParseOptions{})
+		assert.Nil(err, text)
+		assert.Equal(simpleExpr, anyExpr, text)
+
+		_, err = ParseExpression(text, ParseOptions{Dialect: DialectFilter})
+		assert.NotNil(err, text)
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+	assert := assert.New(t)
+
+	// Where the syntaxes disagree the filter grammar wins
+	expr, err := ParseExpression(`a = 1 OR b = 2 AND c = 3`, ParseOptions{})
+	assert.Nil(err)
+	assert.Equal(OrExpr{
+		EqualsExpr{FieldExpr{0, []string{"a"}}, ValueExpr{int64(1)}},
+		AndExpr{
+			EqualsExpr{FieldExpr{0, []string{"b"}}, ValueExpr{int64(2)}},
+			EqualsExpr{FieldExpr{0, []string{"c"}}, ValueExpr{int64(3)}},
+		},
+	}, expr)
+
+	expr, err = ParseExpression(`a = 1 OR b = 2 AND c = 3`, ParseOptions{Dialect: DialectSimple})
+	assert.Nil(err)
+	assert.Equal(AndExpr{
+		OrExpr{
+			EqualsExpr{FieldExpr{0, []string{"a"}}, ValueExpr{int64(1)}},
+			EqualsExpr{FieldExpr{0, []string{"b"}}, ValueExpr{int64(2)}},
+		},
+		EqualsExpr{FieldExpr{0, []string{"c"}}, ValueExpr{int64(3)}},
+	}, expr)
+
+	expr, err = ParseExpression(`a = 'x'`, ParseOptions{})
+	assert.Nil(err)
+	assert.Equal(EqualsExpr{FieldExpr{0, []string{"a"}}, FieldExpr{0, []string{"x"}}}, expr)
+
+	expr, err = ParseExpression(`a = 'x'`, ParseOptions{Dialect: DialectSimple})
+	assert.Nil(err)
+	assert.Equal(EqualsExpr{FieldExpr{0, []string{"a"}}, ValueExpr{"x"}}, expr)
+
+	expr, err = ParseExpression(`NOT a = 1 AND NOT EXISTS(b)`, ParseOptions{})
+	assert.Nil(err)
+	assert.Equal(AndExpr{
+		NotEqualsExpr{FieldExpr{0, []string{"a"}}, ValueExpr{int64(1)}},
+		NotExistsExpr{FieldExpr{0, []string{"b"}}},
+	}, expr)
+
+	// Errors are reported where the combined grammar stopped matching
+	_, err = ParseExpression(`a == 1 && (b == 2`, ParseOptions{})
+	parseErr, ok := err.(*ParseError)
+	assert.True(ok)
+	assert.Equal(17, parseErr.Offset)
+
+	_, err = ParseExpression(`a = 1 AND b >`, ParseOptions{})
+	parseErr, ok = err.(*ParseError)
+	assert.True(ok)
+	assert.Equal(13, parseErr.Offset)
+
+	_, err = ParseExpression(`a & & b = 1`, ParseOptions{})
+	parseErr, ok = err.(*ParseError)
+	assert.True(ok)
+	assert.Equal(2, parseErr.Offset)
+
+	// The two syntaxes can be mixed within one filter
+	for _, test := range []struct {
+		mixed  string
+		filter string
+	}{
+		{`a == 1 && EXISTS(b)`, `a = 1 AND EXISTS(b)`},
+		{`x == 1 || ABS(y) > 2`, `x = 1 OR ABS(y) > 2`},
+		{`a <> 1 && b EXISTS || META().id = "k"`, `a != 1 AND EXISTS(b) OR META().id = "k"`},
+		{`(a NOT LIKE "x%" AND b.c EXISTS) && c[0] * 2 > 1`, `(NOT a LIKE "x%" AND EXISTS(b.c)) AND c[0] * 2 > 1`},
+		{`true && a = 1`, `TRUE AND a = 1`},
+		{`a = 1 || b = 2 && c = 3`, `a = 1 OR (b = 2 AND c = 3)`},
+	} {
+		mixedExpr, err := ParseExpression(test.mixed, ParseOptions{Dialect: DialectAny})
+		if !assert.Nil(err, test.mixed) {
+			continue
+		}
+		filterExpr, err := ParseExpression(test.filter, ParseOptions{Dialect: DialectFilter})
+		assert.Nil(err, test.filter)
+		assert.Equal(filterExpr, mixedExpr, test.mixed)
+
+		// The filter dialect on its own does not accept the simple syntax
+		_, err = ParseExpression(test.mixed, ParseOptions{Dialect: DialectFilter})
+		assert.NotNil(err, test.mixed)
+	}
+
+	// Panics within the simple parser are reported as errors
+	_, err = ParseExpression("TRUE OR FALSE OR `123abc`", ParseOptions{Dialect: DialectSimple})
+	_, ok = err.(*ParseError)
+	assert.True(ok)
+
+	_, err = ParseExpression(`a = 1`, ParseOptions{Dialect: ParseDialect(7)})
+	assert.NotNil(err)
+}
@@ -43,9 +43,14 @@ func fetchExprFieldRefsRecurse(expr Expression, loopVars []VariableID, fields []
 		}
 
 		fields = append(fields, expr)
+	case MetaExpr:
+		fields = fetchExprFieldRefsRecurse(expr.fieldExpr(), loopVars, fields)
+	case TrueExpr:
+	case FalseExpr:
 	case ValueExpr:
 	case RegexExpr:
 	case PcreExpr:
+	case LikePatternExpr:
 	case TimeExpr:
 	case FuncExpr:
 		for _, subexpr := range expr.Params {
@@ -96,6 +101,8 @@ func fetchExprFieldRefsRecurse(expr Expression, loopVars []VariableID, fields []
 		fields = fetchExprFieldRefsRecurse(expr.Rhs, loopVars, fields)
 	case ExistsExpr:
 		fields = fetchExprFieldRefsRecurse(expr.SubExpr, loopVars, fields)
+	case NotExistsExpr:
+		fields = fetchExprFieldRefsRecurse(expr.SubExpr, loopVars, fields)
 	case LikeExpr:
 		fields = fetchExprFieldRefsRecurse(expr.Lhs, loopVars, fields)
 		fields = fetchExprFieldRefsRecurse(expr.Rhs, loopVars, fields)
@@ -32,7 +32,7 @@ func (stats *ExpressionStats) scanOne(expr Expression, loopDepth int) error {
 	}
 
 	switch expr := expr.(type) {
-	case FieldExpr:
+	case FieldExpr, MetaExpr:
 		stats.NumFields++
 	case ValueExpr:
 		stats.NumValues++
@@ -6,19 +6,31 @@ import (
 	"fmt"
 )
 
+// slotData records where a stored value sits in the token stream it was
+// read from.  Values of the document and of its metadata come from separate
+// streams, and a slot with no stream has not been filled.
 type slotData struct {
-	start int
-	size  int
+	tokens tokenStream
+	start  int
+	size   int
 }
 
 var emptySlotData slotData
 
 type FastMatcher struct {
-	def         MatchDef
-	slots       []slotData
-	buckets     *binTreeState
-	tokens      jsonTokenizer
-	collateUsed bool
+	def            MatchDef
+	slots          []slotData
+	buckets        *binTreeState
+	tokens         tokenStream
+	jsonTokens     jsonTokenizer
+	binaryTokens   binaryTokenizer
+	cborDecoder    cborDecoder
+	msgpackDecoder msgpackDecoder
+	bsonDecoder    bsonDecoder
+	snappyTokens   snappyTokenizer
+	collateUsed    bool
+	metaBuf        []byte
+	metaTokens     jsonTokenizer
 }
 
 func NewFastMatcher(def *MatchDef) *FastMatcher {
@@ -39,7 +51,7 @@ func (m *FastMatcher) Reset() {
 func (m *FastMatcher) leaveValue() error {
 	depth := 0
 
-	tokens := &m.tokens
+	tokens := m.tokens
 	for {
 		token, _, _, err := tokens.Step()
 		if err != nil {
@@ -62,7 +74,7 @@ func (m *FastMatcher) leaveValue() error {
 			}
 			depth--
 		case tknEnd:
-			panic("unexpected EOF")
+			return ErrorMalformedDocument
 		}
 	}
 }
@@ -83,140 +95,155 @@ func (m *FastMatcher) skipValue(token tokenType) error {
 		return nil
 	case tknFalse:
 		return nil
+	case tknBinary:
+		return nil
 	case tknObjectStart:
 		return m.leaveValue()
 	case tknArrayStart:
 		return m.leaveValue()
 	}
-	panic(fmt.Sprintf("unexpected value: %v", token))
+	return ErrorMalformedDocument
 }
 
 func (m *FastMatcher) literalFromSlot(slot SlotID) FastVal {
 	value := NewMissingFastVal()
 
-	savePos := m.tokens.Position()
-
 	slotInfo := m.slots[slot-1]
-	m.tokens.Seek(slotInfo.start)
-	token, tokenData, _, _ := m.tokens.Step()
+	tokens := slotInfo.tokens
+	if tokens == nil {
+		return value
+	}
+
+	savePos := tokens.Position()
+
+	tokens.Seek(slotInfo.start)
+	token, tokenData, _, _ := tokens.Step()
 
 	if isLiteralToken(token) {
 		var parser fastLitParser
 		value = parser.Parse(token, tokenData)
 	} else if slotInfo.size > 0 {
 		if token == tknObjectStart {
-			value = NewObjectFastVal(m.tokens.data[slotInfo.start : slotInfo.start+slotInfo.size])
+			value = NewObjectFastVal(tokens.Slice(slotInfo.start, slotInfo.start+slotInfo.size))
 		} else if token == tknArrayStart {
-			value = NewArrayFastVal(m.tokens.data[slotInfo.start : slotInfo.start+slotInfo.size])
+			value = NewArrayFastVal(tokens.Slice(slotInfo.start, slotInfo.start+slotInfo.size))
 		}
 	}
 
-	m.tokens.Seek(savePos)
+	tokens.Seek(savePos)
 
 	return value
 }
 
-func (m *FastMatcher) resolveFunc(fn FuncRef, activeLit *FastVal) FastVal {
-	switch fn.FuncName {
+func (m *FastMatcher) resolveFunc(fn FuncRef, activeLit *FastVal) (FastVal, error) {
+	var params [2]FastVal
+	if len(fn.Params) > len(params) {
+		panic(fmt.Sprintf("too many parameters for function: %v", fn.FuncName))
+	}
+
+	for i, param := range fn.Params {
+		var err error
+		params[i], err = m.resolveParam(param, activeLit)
+		if err != nil {
+			return NewInvalidFastVal(), err
+		}
+	}
+
+	result := callFastValFunc(fn.FuncName, params[:len(fn.Params)])
+	if m.def.StrictMath {
+		return result, checkFastValMath(fn.FuncName, params[:len(fn.Params)], result)
+	}
+	return result, nil
+}
+
+// callFastValFunc applies the named function to its already resolved
+// parameters.  A missing parameter makes the result missing as well, so
+// that the comparison using it is treated like any other missing field.
+func callFastValFunc(funcName string, params []FastVal) FastVal {
+	for _, param := range params {
+		if param.IsMissing() {
+			return NewMissingFastVal()
+		}
+	}
+
+	switch funcName {
 	case MathFuncAbs:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathAbs(p1)
+		return FastValMathAbs(params[0])
 	case MathFuncAcos:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathAcos(p1)
+		return FastValMathAcos(params[0])
 	case MathFuncAsin:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathAsin(p1)
+		return FastValMathAsin(params[0])
 	case MathFuncAtan:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathAtan(p1)
+		return FastValMathAtan(params[0])
 	case MathFuncAtan2:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		p2 := m.resolveParam(fn.Params[1], activeLit)
-		return FastValMathAtan2(p1, p2)
+		return FastValMathAtan2(params[0], params[1])
 	case MathFuncRound:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathRound(p1)
+		return FastValMathRound(params[0])
 	case MathFuncCos:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathCos(p1)
+		return FastValMathCos(params[0])
 	case MathFuncSin:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathSin(p1)
+		return FastValMathSin(params[0])
 	case MathFuncTan:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathTan(p1)
+		return FastValMathTan(params[0])
 	case MathFuncSqrt:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathSqrt(p1)
+		return FastValMathSqrt(params[0])
 	case MathFuncExp:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathExp(p1)
+		return FastValMathExp(params[0])
 	case MathFuncLn:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathLn(p1)
+		return FastValMathLn(params[0])
 	case MathFuncLog:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathLog(p1)
+		return FastValMathLog(params[0])
 	case MathFuncCeil:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathCeil(p1)
+		return FastValMathCeil(params[0])
 	case MathFuncFloor:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathFloor(p1)
+		return FastValMathFloor(params[0])
 	case MathFuncDegrees:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathDegrees(p1)
+		return FastValMathDegrees(params[0])
 	case MathFuncRadians:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathRadians(p1)
+		return FastValMathRadians(params[0])
 	case MathFuncPow:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		p2 := m.resolveParam(fn.Params[1], activeLit)
-		return FastValMathPow(p1, p2)
+		return FastValMathPow(params[0], params[1])
 	case DateFunc:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValDateFunc(p1)
+		return FastValDateFunc(params[0])
+	case TypeFunc:
+		return FastValTypeFunc(params[0])
+	case ArrayLengthFunc:
+		return FastValArrayLengthFunc(params[0])
+	case LowerFunc:
+		return FastValLowerFunc(params[0])
+	case UpperFunc:
+		return FastValUpperFunc(params[0])
+	case CollateFunc:
+		return FastValCollateFunc(params[0], params[1])
 	case MathFuncAdd:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		p2 := m.resolveParam(fn.Params[1], activeLit)
-		return FastValMathAdd(p1, p2)
+		return FastValMathAdd(params[0], params[1])
 	case MathFuncSub:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		p2 := m.resolveParam(fn.Params[1], activeLit)
-		return FastValMathSub(p1, p2)
+		return FastValMathSub(params[0], params[1])
 	case MathFuncMul:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		p2 := m.resolveParam(fn.Params[1], activeLit)
-		return FastValMathMul(p1, p2)
+		return FastValMathMul(params[0], params[1])
 	case MathFuncDiv:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		p2 := m.resolveParam(fn.Params[1], activeLit)
-		return FastValMathDiv(p1, p2)
+		return FastValMathDiv(params[0], params[1])
 	case MathFuncMod:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		p2 := m.resolveParam(fn.Params[1], activeLit)
-		return FastValMathMod(p1, p2)
+		return FastValMathMod(params[0], params[1])
 	case MathFuncNeg:
-		p1 := m.resolveParam(fn.Params[0], activeLit)
-		return FastValMathNeg(p1)
+		return FastValMathNeg(params[0])
 	default:
-		panic(fmt.Sprintf("encountered unexpected function name: %v", fn.FuncName))
+		panic(fmt.Sprintf("encountered unexpected function name: %v", funcName))
 	}
 }
 
-func (m *FastMatcher) resolveParam(in interface{}, activeLit *FastVal) FastVal {
+func (m *FastMatcher) resolveParam(in interface{}, activeLit *FastVal) (FastVal, error) {
 	switch opVal := in.(type) {
 	case FastVal:
-		return opVal
+		return opVal, nil
 	case activeLitRef:
 		if activeLit == nil {
 			panic("cannot resolve active literal without having an active context")
 		}
 
-		return *activeLit
+		return *activeLit, nil
 	case SlotRef:
-		return m.literalFromSlot(opVal.Slot)
+		return m.literalFromSlot(opVal.Slot), nil
 	case FuncRef:
 		return m.resolveFunc(opVal, activeLit)
 	default:
@@ -224,21 +251,45 @@ func (m *FastMatcher) resolveParam(in interface{}, activeLit *FastVal) FastVal {
 	}
 }
 
-func (m *FastMatcher) matchOp(op *OpNode, litVal *FastVal) error {
-	bucketIdx := int(op.BucketIdx)
+func (m *FastMatcher) isOpResolved(op *OpNode) bool {
+	if !m.buckets.IsResolved(int(op.BucketIdx)) {
+		return false
+	}
+	for _, bucketIdx := range op.Fanout {
+		if !m.buckets.IsResolved(int(bucketIdx)) {
+			return false
+		}
+	}
+	return true
+}
 
-	if m.buckets.IsResolved(bucketIdx) {
-		// If the bucket for this op is already resolved  in the binary tree,
+// markOp applies the result of an op to its bucket and to any buckets it
+// fans out to.  Marking one bucket can resolve others further up the tree,
+// so only those buckets which are still outstanding are marked.
+func (m *FastMatcher) markOp(op *OpNode, value bool) {
+	if !m.buckets.IsResolved(int(op.BucketIdx)) {
+		m.buckets.MarkNode(int(op.BucketIdx), value)
+	}
+	for _, bucketIdx := range op.Fanout {
+		if !m.buckets.IsResolved(int(bucketIdx)) {
+			m.buckets.MarkNode(int(bucketIdx), value)
+		}
+	}
+}
+
+func (m *FastMatcher) matchOp(op *OpNode, litVal *FastVal) error {
+	if m.isOpResolved(op) {
+		// If the buckets for this op are already resolved in the binary tree,
 		// we don't need to perform the op and can just skip it.
 		return nil
 	}
 
-	var slotNotFound bool
+	var err error
 	lhsVal := NewMissingFastVal()
 	if op.Lhs != nil {
-		lhsVal = m.resolveParam(op.Lhs, litVal)
-		if _, ok := op.Lhs.(SlotRef); ok && lhsVal.IsMissing() {
-			slotNotFound = true
+		lhsVal, err = m.resolveParam(op.Lhs, litVal)
+		if err != nil {
+			return err
 		}
 	} else if litVal != nil {
 		lhsVal = *litVal
@@ -246,54 +297,25 @@ func (m *FastMatcher) matchOp(op *OpNode, litVal *FastVal) error {
 
 	rhsVal := NewMissingFastVal()
 	if op.Rhs != nil {
-		rhsVal = m.resolveParam(op.Rhs, litVal)
-		if _, ok := op.Rhs.(SlotRef); ok && rhsVal.IsMissing() {
-			slotNotFound = true
+		rhsVal, err = m.resolveParam(op.Rhs, litVal)
+		if err != nil {
+			return err
 		}
 	} else if litVal != nil {
 		rhsVal = *litVal
 	}
 
-	if slotNotFound {
-		// If references are for slots and at least one wasn't found
-		// then the matchOp should not execute
-		m.buckets.MarkNode(bucketIdx, false)
-
-		if m.buckets.IsResolved(0) {
-			return nil
-		}
+	if (op.Lhs != nil && lhsVal.IsMissing()) || (op.Rhs != nil && rhsVal.IsMissing()) {
+		// If references are for slots (directly or through a function)
+		// and at least one wasn't found then the matchOp should not execute
+		m.markOp(op, false)
 		return nil
 	}
 
-	var opRes bool
-	var validOp bool
-	var compareOut int
-	switch op.Op {
-	case OpTypeEquals:
-		opRes, validOp = lhsVal.Equals(rhsVal)
-	case OpTypeLessThan:
-		compareOut, validOp = lhsVal.Compare(rhsVal)
-		opRes = compareOut < 0
-	case OpTypeLessEquals:
-		compareOut, validOp = lhsVal.Compare(rhsVal)
-		opRes = compareOut <= 0
-	case OpTypeGreaterThan:
-		compareOut, validOp = lhsVal.Compare(rhsVal)
-		opRes = compareOut > 0
-	case OpTypeGreaterEquals:
-		compareOut, validOp = lhsVal.Compare(rhsVal)
-		opRes = compareOut >= 0
-	case OpTypeMatches:
-		opRes, validOp = lhsVal.Matches(rhsVal)
-	case OpTypeExists:
-		opRes = true
-		validOp = true
-	default:
-		panic("invalid op type")
-	}
+	opRes, validOp := evalOpWithMode(op.Op, op.Mode, lhsVal, rhsVal)
 
 	// Mark the result of this operation
-	m.buckets.MarkNode(bucketIdx, opRes)
+	m.markOp(op, opRes)
 
 	if !validOp {
 		m.collateUsed = true
@@ -308,6 +330,32 @@ func (m *FastMatcher) matchOp(op *OpNode, litVal *FastVal) error {
 	return nil
 }
 
+// evalOp performs a single operation against resolved values, returning the
+// result along with whether the comparison was valid without collation.
+func evalOp(op OpType, lhsVal, rhsVal FastVal) (bool, bool) {
+	switch op {
+	case OpTypeEquals:
+		return lhsVal.Equals(rhsVal)
+	case OpTypeLessThan:
+		compareOut, validOp := lhsVal.Compare(rhsVal)
+		return compareOut < 0, validOp
+	case OpTypeLessEquals:
+		compareOut, validOp := lhsVal.Compare(rhsVal)
+		return compareOut <= 0, validOp
+	case OpTypeGreaterThan:
+		compareOut, validOp := lhsVal.Compare(rhsVal)
+		return compareOut > 0, validOp
+	case OpTypeGreaterEquals:
+		compareOut, validOp := lhsVal.Compare(rhsVal)
+		return compareOut >= 0, validOp
+	case OpTypeMatches:
+		return lhsVal.Matches(rhsVal)
+	case OpTypeExists:
+		return true, true
+	}
+	panic("invalid op type")
+}
+
 func (m *FastMatcher) matchElems(token tokenType, tokenData []byte, elems map[string]*ExecNode) error {
 	// Note that this assumes that the tokenizer has already been placed at the target
 	// that referenced the elements themselves...
@@ -400,8 +448,7 @@ func (m *FastMatcher) matchLoop(token tokenType, tokenData []byte, loop *LoopNod
 	if m.buckets.IsResolved(loopBucketIdx) {
 		// If the bucket for this op is already resolved  in the binary tree,
 		// we don't need to perform the op and can just skip it.
-		m.skipValue(token)
-		return nil
+		return m.skipValue(token)
 	}
 
 	// We need to keep track of the overall loop result value while the bin tree
@@ -436,7 +483,7 @@ func (m *FastMatcher) matchLoop(token tokenType, tokenData []byte, loop *LoopNod
 				break
 			}
 			if token != tknListDelim {
-				panic(fmt.Sprintf("expected array element delimiter got %s", tokenToText(token)))
+				return ErrorMalformedDocument
 			}
 		}
 
@@ -458,6 +505,10 @@ func (m *FastMatcher) matchLoop(token tokenType, tokenData []byte, loop *LoopNod
 			return err
 		}
 
+		// Resolve anything left outstanding in this iteration so that
+		// operators such as NOT behave the same as they do outside a loop.
+		m.buckets.ResolveNode(loopBucketIdx)
+
 		iterationMatched := m.buckets.IsTrue(loopBucketIdx)
 		if loop.Mode == LoopTypeAny {
 			if iterationMatched {
@@ -466,7 +517,9 @@ func (m *FastMatcher) matchLoop(token tokenType, tokenData []byte, loop *LoopNod
 				loopState = true
 
 				// Skip the remainder of the array and leave the loop
-				m.leaveValue()
+				if err := m.leaveValue(); err != nil {
+					return err
+				}
 				break
 			}
 		} else if loop.Mode == LoopTypeEvery {
@@ -476,7 +529,9 @@ func (m *FastMatcher) matchLoop(token tokenType, tokenData []byte, loop *LoopNod
 				loopState = false
 
 				// Skip the remainder of the array and leave the loop
-				m.leaveValue()
+				if err := m.leaveValue(); err != nil {
+					return err
+				}
 				break
 			}
 		} else if loop.Mode == LoopTypeAnyEvery {
@@ -486,7 +541,9 @@ func (m *FastMatcher) matchLoop(token tokenType, tokenData []byte, loop *LoopNod
 				loopState = false
 
 				// Skip the remainder of the array and leave the loop
-				m.leaveValue()
+				if err := m.leaveValue(); err != nil {
+					return err
+				}
 				break
 			} else {
 				// If we encounter a truthy value, we have satisfied the 'any'
@@ -526,12 +583,24 @@ func (m *FastMatcher) matchAfter(node *AfterNode) error {
 	for _, loop := range node.Loops {
 		if slot, ok := loop.Target.(SlotRef); ok {
 			slotInfo := m.slots[slot.Slot-1]
+			if slotInfo.tokens == nil {
+				// Like any other value which is not an array, a missing
+				// value is never looped over
+				continue
+			}
 
+			// The loop runs over the stream the slot was filled from, which
+			// is the metadata rather than the document for META() arrays
+			tokens := m.tokens
+			m.tokens = slotInfo.tokens
 			m.tokens.Seek(slotInfo.start)
 			token, tokenData, _, err := m.tokens.Step()
 
 			// run the loop matcher
-			err = m.matchLoop(token, tokenData, &loop)
+			if err == nil {
+				err = m.matchLoop(token, tokenData, &loop)
+			}
+			m.tokens = tokens
 			if err != nil {
 				return err
 			}
@@ -592,14 +661,17 @@ func (m *FastMatcher) matchExec(token tokenType, tokenData []byte, tokenDataLen
 			}
 		}
 	} else if token == tknObjectStart {
-		objStartPos := m.tokens.Position() - 1 /* to include the objStart itself*/
+		objStartPos := startPos
 		if len(node.Elems) == 0 {
 			// If we have no element handlers, we can just skip the whole thing...
-			m.skipValue(token)
+			err := m.skipValue(token)
+			if err != nil {
+				return err
+			}
 		} else {
 			err, shouldReturn := m.matchObjectOrArray(token, tokenData, node)
 			if err == nil && node.After != nil {
-				m.matchAfter(node.After)
+				err = m.matchAfter(node.After)
 			}
 
 			if shouldReturn {
@@ -612,7 +684,7 @@ func (m *FastMatcher) matchExec(token tokenType, tokenData []byte, tokenDataLen
 		}
 		objEndPos := m.tokens.Position()
 
-		objFastVal := NewObjectFastVal(m.tokens.data[objStartPos:objEndPos])
+		objFastVal := NewObjectFastVal(m.tokens.Slice(objStartPos, objEndPos))
 
 		for _, op := range node.Ops {
 			err := m.matchOp(&op, &objFastVal)
@@ -625,7 +697,7 @@ func (m *FastMatcher) matchExec(token tokenType, tokenData []byte, tokenDataLen
 			}
 		}
 	} else if token == tknArrayStart {
-		arrayStartPos := m.tokens.Position() - 1 // Should be -1 to include the [
+		arrayStartPos := startPos
 		if len(node.Loops) == 0 {
 			err, shouldReturn := m.matchObjectOrArray(token, tokenData, node)
 			if shouldReturn {
@@ -662,10 +734,20 @@ func (m *FastMatcher) matchExec(token tokenType, tokenData []byte, tokenDataLen
 				}
 			}
 
+			// Elements which are referenced by index also need a pass over
+			// the array once all of the loops are finished with it.
+			if len(node.Elems) > 0 {
+				m.tokens.Seek(savePos)
+
+				err, shouldReturn := m.matchObjectOrArray(token, tokenData, node)
+				if shouldReturn {
+					return err
+				}
+			}
 		}
 		arrayEndPos := m.tokens.Position()
 
-		arrayFastVal := NewArrayFastVal(m.tokens.data[arrayStartPos:arrayEndPos])
+		arrayFastVal := NewArrayFastVal(m.tokens.Slice(arrayStartPos, arrayEndPos))
 		for _, op := range node.Ops {
 			err := m.matchOp(&op, &arrayFastVal)
 			if err != nil {
@@ -677,11 +759,14 @@ func (m *FastMatcher) matchExec(token tokenType, tokenData []byte, tokenDataLen
 			}
 		}
 	} else {
-		panic(fmt.Sprintf("invalid token read - tokenType: %v data: %v", token, string(tokenData)))
+		return ErrorMalformedDocument
 	}
 
 	if node.After != nil {
-		m.matchAfter(node.After)
+		err := m.matchAfter(node.After)
+		if err != nil {
+			return err
+		}
 
 		if m.buckets.IsResolved(0) {
 			return nil
@@ -692,6 +777,7 @@ func (m *FastMatcher) matchExec(token tokenType, tokenData []byte, tokenDataLen
 
 	if node.StoreId > 0 {
 		slotData := &m.slots[node.StoreId-1]
+		slotData.tokens = m.tokens
 		slotData.start = startPos
 		slotData.size = endPos - startPos
 	}
@@ -730,13 +816,10 @@ func (m *FastMatcher) matchObjectOrArray(token tokenType, tokenData []byte, node
 				return nil, false
 			case tknArrayEnd:
 				return nil, false
-			case tknEnd:
-				return nil, true
 			case tknListDelim:
 				arrayIndex++
-			// nothing
 			default:
-				panic(fmt.Sprintf("expected object field element delimiter, received: %v", token))
+				return ErrorMalformedDocument, true
 			}
 		}
 
@@ -745,9 +828,10 @@ func (m *FastMatcher) matchObjectOrArray(token tokenType, tokenData []byte, node
 			return err, true
 		}
 
-		// Keep this here to catch any empty array or empty objs
+		// Keep this here to catch any empty array or empty objs.  These are
+		// still complete values which the ops on this node need to see.
 		if token == endToken {
-			return nil, true
+			return nil, false
 		}
 
 		// TODO(brett19): These byte-string conversion pieces are a bit wierd
@@ -755,17 +839,17 @@ func (m *FastMatcher) matchObjectOrArray(token tokenType, tokenData []byte, node
 		var keyBytes []byte
 		switch token {
 		case tknString:
-			keyBytes = keyLitParse.ParseStringWLen(tokenData, tokenDataLen)
+			keyBytes = keyLitParse.ParseString(tokenData)
 		case tknEscString:
-			keyBytes = keyLitParse.ParseEscStringWLen(tokenData, tokenDataLen)
+			keyBytes = keyLitParse.ParseEscString(tokenData)
 		case tknArrayStart:
 			// Do nothing
 		case tknObjectStart:
 			// Do nothing
 		default:
-			// If it's an array, it's possible that we're grabbing a literal like int or float, and we should not panic
+			// If it's an array, it's possible that we're grabbing a literal like int or float, which is not an error
 			if !arrayMode {
-				panic(fmt.Sprintf("expected literal, received: %v", token))
+				return ErrorMalformedDocument, true
 			}
 		}
 
@@ -779,7 +863,7 @@ func (m *FastMatcher) matchObjectOrArray(token tokenType, tokenData []byte, node
 			}
 
 			if token != tknObjectKeyDelim {
-				panic(fmt.Sprintf("expected object key delimiter: got %v, %v", token, string(tokenData)))
+				return ErrorMalformedDocument, true
 			}
 
 			token, tokenData, tokenDataLen, err = m.tokens.Step()
@@ -792,7 +876,10 @@ func (m *FastMatcher) matchObjectOrArray(token tokenType, tokenData []byte, node
 		if keyElem, ok := node.Elems[keyString]; ok {
 			// Run the execution node that applies to this particular
 			// key of the object.
-			m.matchExec(token, tokenData, tokenDataLen, keyElem)
+			err = m.matchExec(token, tokenData, tokenDataLen, keyElem)
+			if err != nil {
+				return err, true
+			}
 
 			// Check if running this keys execution has resolved the entirety
 			// of the expression, if so we can leave immediately.
@@ -802,19 +889,82 @@ func (m *FastMatcher) matchObjectOrArray(token tokenType, tokenData []byte, node
 		} else {
 			// If we don't have any parse requirements for this key in
 			// the object, we can just skip its value and continue
-			m.skipValue(token)
+			err = m.skipValue(token)
+			if err != nil {
+				return err, true
+			}
 		}
 	}
 	return nil, false
 }
 
 func (m *FastMatcher) Match(data []byte) (bool, error) {
-	m.tokens.Reset(data)
+	m.jsonTokens.Reset(data)
+	m.tokens = &m.jsonTokens
 
 	if len(data) == 0 {
 		return false, nil
 	}
 
+	return m.matchTokens()
+}
+
+// MatchFormat matches a document in the given encoding.  Documents encoded
+// as CBOR, MessagePack or BSON are matched directly, with the same result as
+// matching their JSON equivalent.  Binary values compare equal to []byte
+// values, while the other types which JSON lacks are matched as the strings
+// or numbers they are decoded as.
+func (m *FastMatcher) MatchFormat(data []byte, format DocumentFormat) (bool, error) {
+	switch format {
+	case FormatJSON:
+		return m.Match(data)
+	case FormatCBOR:
+		m.binaryTokens.Reset(data, &m.cborDecoder)
+	case FormatMsgPack:
+		m.binaryTokens.Reset(data, &m.msgpackDecoder)
+	case FormatBSON:
+		m.binaryTokens.Reset(data, &m.bsonDecoder)
+	default:
+		return false, ErrorUnknownDocumentFormat
+	}
+	m.tokens = &m.binaryTokens
+
+	if len(data) == 0 {
+		return false, nil
+	}
+
+	return m.matchTokens()
+}
+
+// MatchSnappy matches a JSON document compressed in the Snappy block format.
+// The document is decompressed into a buffer owned by the matcher as it is
+// matched, and when earlyExit is set decompression stops as soon as the
+// result is known, leaving the rest of the document unchecked.
+func (m *FastMatcher) MatchSnappy(data []byte, earlyExit bool) (bool, error) {
+	err := m.snappyTokens.Reset(data)
+	if err != nil {
+		return false, err
+	}
+	if !earlyExit {
+		err = m.snappyTokens.DecodeAll()
+		if err != nil {
+			return false, err
+		}
+	}
+	m.tokens = &m.snappyTokens
+
+	if m.snappyTokens.decoder.dstLen == 0 {
+		return false, nil
+	}
+
+	return m.matchTokens()
+}
+
+func (m *FastMatcher) matchTokens() (bool, error) {
+	if m.def.ParseNode == nil {
+		return m.def.isConstantMatch(), nil
+	}
+
 	token, tokenData, tokenDataLen, err := m.tokens.Step()
 	if err != nil {
 		return false, err
@@ -829,7 +979,89 @@ func (m *FastMatcher) Match(data []byte) (bool, error) {
 	// operators such as NOT and NEOR to correctly be resolved.
 	m.buckets.Resolve()
 
-	return m.buckets.IsTrue(0), nil
+	return m.buckets.IsTrue(0) || m.def.isConstantMatch(), nil
+}
+
+// matchMeta runs the expressions which only use META() against the
+// metadata, which is tokenized separately from the document.  Anything
+// depending on the document body is left unresolved rather than treated
+// as missing, and values of the metadata used alongside the body are kept
+// in their slots for when the body is matched.
+func (m *FastMatcher) matchMeta(meta *DocumentMeta) error {
+	var err error
+	m.metaBuf, err = appendMetaObject(m.metaBuf[:0], meta)
+	if err != nil {
+		return err
+	}
+
+	m.metaTokens.Reset(m.metaBuf)
+	m.tokens = &m.metaTokens
+	token, tokenData, tokenDataLen, err := m.tokens.Step()
+	if err != nil {
+		return err
+	}
+	return m.matchExec(token, tokenData, tokenDataLen, m.def.MetaNode)
+}
+
+// MatchWithMeta matches a JSON document along with its metadata, which the
+// expressions reach through META().  Expressions on the metadata are
+// evaluated first, and when they alone decide the result the document body
+// is never read.
+func (m *FastMatcher) MatchWithMeta(data []byte, meta *DocumentMeta) (bool, error) {
+	if m.def.MetaNode == nil || meta == nil {
+		return m.Match(data)
+	}
+
+	err := m.matchMeta(meta)
+	if err != nil {
+		return false, err
+	}
+	if m.buckets.IsResolved(0) {
+		m.buckets.Resolve()
+		return m.buckets.IsTrue(0) || m.def.isConstantMatch(), nil
+	}
+
+	return m.Match(data)
+}
+
+// MatchBinary matches a document whose body is not JSON.  The body is never
+// parsed: the document itself is a binary value with no fields, so every
+// expression on a field of the body sees it as missing, while expressions
+// using META() are evaluated against meta as usual.  A nil meta matches the
+// document without any metadata.
+func (m *FastMatcher) MatchBinary(data []byte, meta *DocumentMeta) (bool, error) {
+	node := m.def.ParseNode
+	if node == nil {
+		return m.def.isConstantMatch(), nil
+	}
+
+	if m.def.MetaNode != nil && meta != nil {
+		err := m.matchMeta(meta)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	binVal := NewBinaryFastVal(data)
+	for _, op := range node.Ops {
+		if m.buckets.IsResolved(0) {
+			break
+		}
+
+		err := m.matchOp(&op, &binVal)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	m.buckets.Resolve()
+	return m.buckets.IsTrue(0) || m.def.isConstantMatch(), nil
+}
+
+// MatchWithKey matches a JSON document whose key expressions can refer to
+// as META().id.
+func (m *FastMatcher) MatchWithKey(key []byte, data []byte) (bool, error) {
+	return m.MatchWithMeta(data, &DocumentMeta{Key: key})
 }
 
 func (m *FastMatcher) MatchWithStatus(data []byte) (bool, int, error) {
@@ -843,6 +1075,12 @@ func (m *FastMatcher) MatchWithStatus(data []byte) (bool, int, error) {
 
 func (m *FastMatcher) ExpressionMatched(expressionIdx int) bool {
 	binTreeIdx := m.def.MatchBuckets[expressionIdx]
+	switch binTreeIdx {
+	case AlwaysTrueIdent:
+		return true
+	case AlwaysFalseIdent:
+		return false
+	}
 	return m.buckets.IsResolved(binTreeIdx) &&
 		m.buckets.IsTrue(binTreeIdx)
 }
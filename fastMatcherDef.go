@@ -2,6 +2,7 @@ package gojsonsm
 
 import (
 	"fmt"
+	"reflect"
 	"sort"
 	"strings"
 )
@@ -29,6 +30,34 @@ func dataRefToString(ref DataRef) string {
 	return ref.String()
 }
 
+func dataRefEquals(lhs, rhs DataRef) bool {
+	switch lhs := lhs.(type) {
+	case nil:
+		return rhs == nil
+	case activeLitRef:
+		_, ok := rhs.(activeLitRef)
+		return ok
+	case SlotRef:
+		rhs, ok := rhs.(SlotRef)
+		return ok && lhs.Slot == rhs.Slot
+	case FuncRef:
+		rhs, ok := rhs.(FuncRef)
+		if !ok || lhs.FuncName != rhs.FuncName || len(lhs.Params) != len(rhs.Params) {
+			return false
+		}
+		for i := range lhs.Params {
+			if !dataRefEquals(lhs.Params[i], rhs.Params[i]) {
+				return false
+			}
+		}
+		return true
+	case FastVal:
+		rhs, ok := rhs.(FastVal)
+		return ok && reflect.DeepEqual(lhs, rhs)
+	}
+	return false
+}
+
 type activeLitRef struct {
 }
 
@@ -97,19 +126,53 @@ func (value OpType) String() string {
 	return "??unknown??"
 }
 
+// mirrorOpType returns the op which gives the same result once the operands
+// have been swapped, if there is one.
+func mirrorOpType(op OpType) (OpType, bool) {
+	switch op {
+	case OpTypeEquals:
+		return OpTypeEquals, true
+	case OpTypeLessThan:
+		return OpTypeGreaterThan, true
+	case OpTypeLessEquals:
+		return OpTypeGreaterEquals, true
+	case OpTypeGreaterThan:
+		return OpTypeLessThan, true
+	case OpTypeGreaterEquals:
+		return OpTypeLessEquals, true
+	}
+	return op, false
+}
+
 type OpNode struct {
 	BucketIdx BucketID
 	Op        OpType
 	Lhs       DataRef
 	Rhs       DataRef
+
+	// Mode is how values of different types are compared by this op.
+	Mode CompareMode
+
+	// Fanout lists any further buckets which depend on the result of this
+	// op, where the same comparison appears more than once in the inputs.
+	Fanout []BucketID
 }
 
 func (op OpNode) String() string {
-	return fmt.Sprintf("[%d] %s %s %s",
-		op.BucketIdx,
+	buckets := fmt.Sprintf("%d", op.BucketIdx)
+	for _, bucketIdx := range op.Fanout {
+		buckets += fmt.Sprintf(",%d", bucketIdx)
+	}
+
+	value := fmt.Sprintf("[%s] %s %s %s",
+		buckets,
 		dataRefToString(op.Lhs),
 		op.Op,
 		dataRefToString(op.Rhs))
+	if op.Mode != CompareModeCollate {
+		value += fmt.Sprintf(" (%s)", op.Mode)
+	}
+	return value
 }
 
 type LoopType int
@@ -160,12 +223,38 @@ type ExecNode struct {
 	After   *AfterNode
 }
 
+func (node *ExecNode) isEmpty() bool {
+	return node.StoreId == 0 && len(node.Elems) == 0 && len(node.Ops) == 0 &&
+		len(node.Loops) == 0 && node.After == nil
+}
+
 type MatchDef struct {
-	ParseNode    *ExecNode
+	ParseNode *ExecNode
+
+	// MetaNode is matched against the document metadata which META()
+	// refers to, and is nil when none of the expressions use it.
+	MetaNode *ExecNode
+
 	MatchTree    binTree
 	MatchBuckets []int
 	NumBuckets   int
 	NumSlots     int
+
+	// StrictMath makes matching fail with ErrorDivisionByZero or
+	// ErrorIntegerOverflow rather than continuing with a null result or
+	// a decimal one.
+	StrictMath bool
+}
+
+// isConstantMatch reports whether any of the expressions is always true,
+// in which case every document matches whatever the others evaluate to.
+func (def MatchDef) isConstantMatch() bool {
+	for _, bucketID := range def.MatchBuckets {
+		if bucketID == AlwaysTrueIdent {
+			return true
+		}
+	}
+	return false
 }
 
 func (def MatchDef) String() string {
@@ -174,6 +263,11 @@ func (def MatchDef) String() string {
 	out += "  $doc:\n"
 	out += reindentString(def.ParseNode.String(), "    ")
 	out += "\n"
+	if def.MetaNode != nil {
+		out += "  META():\n"
+		out += reindentString(def.MetaNode.String(), "    ")
+		out += "\n"
+	}
 	out += "bin tree:\n"
 	out += reindentString(def.MatchTree.String(), "  ")
 	out += "\n"
@@ -3,6 +3,7 @@
 package gojsonsm
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -108,3 +109,65 @@ func BenchmarkSlowMatcher(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkMatcherWithKey(b *testing.B) {
+	data, totalBytes, err := generateRandomData(1)
+	if err != nil || len(data) == 0 {
+		b.Fatalf("Data generation error: %s", err)
+	}
+
+	keys := make([][]byte, len(data))
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("user::%d", i))
+	}
+
+	// Only one in ten keys match, so most documents are decided by the key
+	m, err := GetFilterExpressionMatcher(`META().id =~ "0$" AND name.first = "Brett"`)
+	if err != nil {
+		b.Fatalf("Failed to parse expression: %s", err)
+	}
+
+	b.SetBytes(int64(totalBytes))
+	b.ResetTimer()
+	for j := 0; j < b.N; j++ {
+		for i := 0; i < len(data); i++ {
+			m.Reset()
+			_, err := m.MatchWithKey(keys[i], data[i])
+
+			if err != nil {
+				b.Fatalf("FastMatcher error: %s", err)
+			}
+		}
+	}
+}
+
+func BenchmarkMatcherWithMeta(b *testing.B) {
+	data, totalBytes, err := generateRandomData(1)
+	if err != nil || len(data) == 0 {
+		b.Fatalf("Data generation error: %s", err)
+	}
+
+	metas := make([]*DocumentMeta, len(data))
+	for i := range metas {
+		metas[i] = &DocumentMeta{Key: []byte(fmt.Sprintf("user::%d", i)), Flags: uint32(i % 2)}
+	}
+
+	// The metadata never decides the result alone, so every body is read
+	m, err := GetFilterExpressionMatcher(`META().flags = 1 AND (META().id = name.first OR age < 50)`)
+	if err != nil {
+		b.Fatalf("Failed to parse expression: %s", err)
+	}
+
+	b.SetBytes(int64(totalBytes))
+	b.ResetTimer()
+	for j := 0; j < b.N; j++ {
+		for i := 0; i < len(data); i++ {
+			m.Reset()
+			_, err := m.MatchWithMeta(data[i], metas[i])
+
+			if err != nil {
+				b.Fatalf("FastMatcher error: %s", err)
+			}
+		}
+	}
+}
@@ -354,3 +354,121 @@ func TestMatcherEqualsFunc(t *testing.T) {
 		"5b47eb093771f06ced629663",
 	})
 }
+
+func runDocMatchTest(t *testing.T, expr Expression, doc string, expected bool) {
+	var trans Transformer
+	matchDef := trans.Transform([]Expression{expr})
+
+	m := NewFastMatcher(matchDef)
+	matched, err := m.Match([]byte(doc))
+	if err != nil {
+		t.Errorf("Matcher error: %s", err)
+		return
+	}
+
+	if matched != expected {
+		t.Errorf("Expected %v against %s but got %v", expected, doc, matched)
+		t.Errorf("  Matcher Definition:\n%s", matchDef.String())
+	}
+}
+
+func TestMatcherAnyInNotEquals(t *testing.T) {
+	// Elements without the field leave the NOT unresolved until the end
+	// of the iteration, where it has to resolve just as it would outside
+	// of a loop.
+	expr := AnyInExpr{1, FieldExpr{0, []string{"b"}},
+		NotExpr{EqualsExpr{FieldExpr{1, []string{"a"}}, ValueExpr{"B"}}}}
+
+	runDocMatchTest(t, expr, `{"b":[{"a":"B"},{"c":1}]}`, true)
+	runDocMatchTest(t, expr, `{"b":[{"a":"B"},{"a":"B"}]}`, false)
+}
+
+func TestMatcherAnyInNotExecuted(t *testing.T) {
+	// A loop with no array to iterate is false, even when its body would
+	// be true for a missing element.
+	expr := AnyInExpr{1, FieldExpr{0, []string{"b"}},
+		NotExpr{EqualsExpr{FieldExpr{1, []string{}}, ValueExpr{int64(1)}}}}
+
+	runDocMatchTest(t, expr, `{}`, false)
+	runDocMatchTest(t, NotExpr{expr}, `{}`, true)
+	runDocMatchTest(t, expr, `{"b":[2]}`, true)
+}
+
+func TestMatcherEmptyContainers(t *testing.T) {
+	runDocMatchTest(t, ExistsExpr{FieldExpr{0, []string{"b"}}}, `{"b":[]}`, true)
+	runDocMatchTest(t, ExistsExpr{FieldExpr{0, []string{"b"}}}, `{"b":{}}`, true)
+	runDocMatchTest(t, NotExistsExpr{FieldExpr{0, []string{"b"}}}, `{"b":[]}`, false)
+}
+
+func TestMatcherLoopAndIndex(t *testing.T) {
+	// Elements referenced by index are still matched when the same array
+	// is also being looped over.
+	expr := AndExpr{
+		AnyInExpr{1, FieldExpr{0, []string{"b"}},
+			EqualsExpr{FieldExpr{1, []string{}}, ValueExpr{int64(1)}}},
+		EqualsExpr{FieldExpr{0, []string{"b", "[1]"}}, ValueExpr{int64(2)}},
+	}
+
+	runDocMatchTest(t, expr, `{"b":[1,2]}`, true)
+	runDocMatchTest(t, expr, `{"b":[1,3]}`, false)
+}
+
+func TestMatcherSharedOps(t *testing.T) {
+	isOrder := EqualsExpr{FieldExpr{0, []string{"type"}}, ValueExpr{"order"}}
+	exprs := []Expression{
+		isOrder,
+		AndExpr{EqualsExpr{ValueExpr{"order"}, FieldExpr{0, []string{"type"}}}, GreaterThanExpr{FieldExpr{0, []string{"qty"}}, ValueExpr{int64(1)}}},
+		NotExpr{isOrder},
+		OrExpr{LessThanExpr{ValueExpr{int64(1)}, FieldExpr{0, []string{"qty"}}}, isOrder},
+	}
+
+	var trans Transformer
+	matchDef := trans.Transform(exprs)
+
+	typeNode := matchDef.ParseNode.Elems["type"]
+	qtyNode := matchDef.ParseNode.Elems["qty"]
+	if len(typeNode.Ops) != 1 || len(typeNode.Ops[0].Fanout) != 3 {
+		t.Fatalf("expected a single shared type op:\n%s", matchDef.String())
+	}
+	if len(qtyNode.Ops) != 1 || len(qtyNode.Ops[0].Fanout) != 1 {
+		t.Fatalf("expected a single shared qty op:\n%s", matchDef.String())
+	}
+
+	checkMatcherParity(t, exprs,
+		[]byte(`{"type":"order","qty":2}`),
+		[]byte(`{"type":"order","qty":1}`),
+		[]byte(`{"type":"refund","qty":2}`),
+		[]byte(`{"qty":2}`))
+}
+
+func TestMatcherMalformedDocument(t *testing.T) {
+	// None of these fields exist, so every document is read to its end
+	exprs := []Expression{
+		NotExistsExpr{FieldExpr{0, []string{"missing"}}},
+		AnyInExpr{1, FieldExpr{0, []string{"arr"}}, EqualsExpr{FieldExpr{1, []string{"missing"}}, ValueExpr{int64(1)}}},
+	}
+	var trans Transformer
+	m := NewFastMatcher(trans.Transform(exprs))
+
+	for _, doc := range []string{
+		`{"a" 1}`,
+		`{"a": 1 "b": 2}`,
+		`{"a": 1`,
+		`{"a": {"b": 1}`,
+		`{"arr": [1 2]}`,
+		`{"arr": [{"x": 1}`,
+		`{1: 2}`,
+		`}`,
+	} {
+		m.Reset()
+		_, err := m.Match([]byte(doc))
+		if err != ErrorMalformedDocument {
+			t.Errorf("expected malformed document error for %s, got %v", doc, err)
+		}
+	}
+
+	m.Reset()
+	if _, err := m.Match([]byte("\x00\x01binary")); err == nil {
+		t.Errorf("expected an error for a binary document")
+	}
+}
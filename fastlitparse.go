@@ -3,6 +3,7 @@
 package gojsonsm
 
 import (
+	"math/big"
 	"strconv"
 )
 
@@ -47,6 +48,12 @@ func (p *fastLitParser) ParseNumber(bytes []byte) float64 {
 	return val
 }
 
+// ParseDecimal parses a number which would lose precision as an int64 or
+// float64.  Numbers with very large exponents are not parsed.
+func (p *fastLitParser) ParseDecimal(bytes []byte) (*big.Rat, bool) {
+	return parseDecimal(string(bytes))
+}
+
 func (p *fastLitParser) ParseString(bytes []byte) []byte {
 	return bytes[1 : len(bytes)-1]
 }
@@ -72,8 +79,18 @@ func (p *fastLitParser) Parse(token tokenType, bytes []byte) FastVal {
 	case tknEscString:
 		return NewBinStringFastVal(p.ParseEscString(bytes))
 	case tknInteger:
+		if intLiteralOverflows(bytes) {
+			if value, ok := p.ParseDecimal(bytes); ok {
+				return NewDecimalFastVal(value)
+			}
+		}
 		return NewIntFastVal(p.ParseInt(bytes))
 	case tknNumber:
+		if numberLiteralIsInexact(bytes) {
+			if value, ok := p.ParseDecimal(bytes); ok {
+				return NewDecimalFastVal(value)
+			}
+		}
 		return NewFloatFastVal(p.ParseNumber(bytes))
 	case tknNull:
 		return NewNullFastVal()
@@ -81,6 +98,8 @@ func (p *fastLitParser) Parse(token tokenType, bytes []byte) FastVal {
 		return NewBoolFastVal(true)
 	case tknFalse:
 		return NewBoolFastVal(false)
+	case tknBinary:
+		return NewBinaryFastVal(bytes)
 	}
 
 	panic("invalid token")
@@ -3,9 +3,11 @@
 package gojsonsm
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"math"
+	"math/big"
 	"regexp"
 	"strconv"
 	"strings"
@@ -30,6 +32,7 @@ const (
 	JsonIntValue
 	FloatValue
 	JsonFloatValue
+	DecimalValue
 	// String types
 	StringValue
 	BinStringValue
@@ -43,6 +46,7 @@ const (
 	BinaryValue
 	RegexValue
 	PcreValue
+	LikePatternValue
 )
 
 // Implicit Conversion Table
@@ -51,29 +55,33 @@ const (
 // If a ValueType does not exist in this table, that means there is no possible target conversion
 var ImplicitConvTable = map[ValueType]map[ValueType]bool{
 	// Numerics
-	IntValue: map[ValueType]bool{UintValue: false, JsonUintValue: false, FloatValue: true, JsonFloatValue: true,
+	IntValue: map[ValueType]bool{UintValue: false, JsonUintValue: false, FloatValue: true, JsonFloatValue: true, DecimalValue: true,
 		StringValue: true, BinStringValue: true, JsonStringValue: true, NullValue: true, TrueValue: true, FalseValue: true},
-	JsonIntValue: map[ValueType]bool{UintValue: false, JsonUintValue: false, FloatValue: true, JsonFloatValue: true,
+	JsonIntValue: map[ValueType]bool{UintValue: false, JsonUintValue: false, FloatValue: true, JsonFloatValue: true, DecimalValue: true,
 		StringValue: true, BinStringValue: true, JsonStringValue: true, NullValue: true, TrueValue: true, FalseValue: true},
-	UintValue: map[ValueType]bool{IntValue: true, JsonIntValue: true, FloatValue: true, JsonFloatValue: true, StringValue: true,
+	UintValue: map[ValueType]bool{IntValue: true, JsonIntValue: true, FloatValue: true, JsonFloatValue: true, DecimalValue: true, StringValue: true,
 		BinStringValue: true, JsonStringValue: true, NullValue: true, TrueValue: true, FalseValue: true},
-	JsonUintValue: map[ValueType]bool{IntValue: true, JsonIntValue: true, FloatValue: true, JsonFloatValue: true, StringValue: true,
+	JsonUintValue: map[ValueType]bool{IntValue: true, JsonIntValue: true, FloatValue: true, JsonFloatValue: true, DecimalValue: true, StringValue: true,
 		BinStringValue: true, JsonStringValue: true, NullValue: true, TrueValue: true, FalseValue: true},
-	FloatValue: map[ValueType]bool{StringValue: true, BinStringValue: true, JsonStringValue: true, NullValue: true, TrueValue: true,
+	FloatValue: map[ValueType]bool{DecimalValue: true, StringValue: true, BinStringValue: true, JsonStringValue: true, NullValue: true, TrueValue: true,
 		FalseValue: true},
-	JsonFloatValue: map[ValueType]bool{StringValue: true, BinStringValue: true, JsonStringValue: true, NullValue: true, TrueValue: true,
+	JsonFloatValue: map[ValueType]bool{DecimalValue: true, StringValue: true, BinStringValue: true, JsonStringValue: true, NullValue: true, TrueValue: true,
+		FalseValue: true},
+	DecimalValue: map[ValueType]bool{StringValue: true, BinStringValue: true, JsonStringValue: true, NullValue: true, TrueValue: true,
 		FalseValue: true},
 	// Non-Numerics
 	TrueValue: map[ValueType]bool{IntValue: true, JsonIntValue: true, UintValue: true, JsonUintValue: true, FloatValue: true,
-		JsonFloatValue: true, StringValue: true, BinStringValue: true, JsonStringValue: true, NullValue: true, FalseValue: true},
+		JsonFloatValue: true, DecimalValue: true, StringValue: true, BinStringValue: true, JsonStringValue: true, NullValue: true,
+		FalseValue: true},
 	FalseValue: map[ValueType]bool{IntValue: true, JsonIntValue: true, UintValue: true, JsonUintValue: true, FloatValue: true,
-		JsonFloatValue: true, StringValue: true, BinStringValue: true, JsonStringValue: true, NullValue: true, TrueValue: true},
+		JsonFloatValue: true, DecimalValue: true, StringValue: true, BinStringValue: true, JsonStringValue: true, NullValue: true,
+		TrueValue: true},
 	StringValue: map[ValueType]bool{IntValue: false, JsonIntValue: false, UintValue: false, JsonUintValue: false, FloatValue: false,
-		JsonFloatValue: false, NullValue: true, TrueValue: false, FalseValue: false, TimeValue: false},
+		JsonFloatValue: false, DecimalValue: false, NullValue: true, TrueValue: false, FalseValue: false, TimeValue: false},
 	BinStringValue: map[ValueType]bool{IntValue: false, JsonIntValue: false, UintValue: false, JsonUintValue: false, FloatValue: false,
-		JsonFloatValue: false, NullValue: true, TrueValue: false, FalseValue: false, TimeValue: false},
+		JsonFloatValue: false, DecimalValue: false, NullValue: true, TrueValue: false, FalseValue: false, TimeValue: false},
 	JsonStringValue: map[ValueType]bool{IntValue: false, JsonIntValue: false, UintValue: false, JsonUintValue: false, FloatValue: false,
-		JsonFloatValue: false, NullValue: true, TrueValue: false, FalseValue: false, TimeValue: false},
+		JsonFloatValue: false, DecimalValue: false, NullValue: true, TrueValue: false, FalseValue: false, TimeValue: false},
 }
 
 // When users try to match a string to a bool, the bool is converted to a JSON string
@@ -95,6 +103,7 @@ type FastVal struct {
 	sliceData   []byte
 	rawData     [8]byte
 	userDefined bool
+	collation   Collation
 }
 
 func (val FastVal) String() string {
@@ -115,6 +124,8 @@ func (val FastVal) String() string {
 		return "(jsonUint)" + string(val.sliceData)
 	case JsonFloatValue:
 		return "(jsonFloat)" + string(val.sliceData)
+	case DecimalValue:
+		return "(decimal)" + formatDecimal(val.GetDecimal())
 	case StringValue:
 		return "(string)" + val.data.(string)
 	case BinStringValue:
@@ -139,6 +150,8 @@ func (val FastVal) String() string {
 		return val.GetTime().String()
 	case RegexValue:
 		return "(regexp)" + val.data.(*regexp.Regexp).String()
+	case LikePatternValue:
+		return "(like)" + val.data.(*LikePattern).String()
 	}
 
 	panic(fmt.Sprintf("unexpected data type %v", val.dataType))
@@ -188,7 +201,8 @@ func (val FastVal) IsFloat() bool {
 func (val FastVal) IsNumeric() bool {
 	return val.IsInt() ||
 		val.IsUInt() ||
-		val.IsFloat()
+		val.IsFloat() ||
+		val.IsDecimal()
 }
 
 func (val FastVal) IsString() bool {
@@ -226,6 +240,9 @@ func (val FastVal) AsInt() (int64, bool) {
 		return int64(uintVal), uintVal <= math.MaxInt64
 	case FloatValue:
 		return int64(val.GetFloat()), false
+	case DecimalValue:
+		decVal := val.GetDecimal()
+		return decVal.Num().Int64(), decVal.IsInt() && decVal.Num().IsInt64()
 	case BinStringValue:
 		fallthrough
 	case JsonStringValue:
@@ -264,6 +281,9 @@ func (val FastVal) AsUint() (uint64, bool) {
 		return val.GetUint(), true
 	case FloatValue:
 		return uint64(val.GetFloat()), false
+	case DecimalValue:
+		decVal := val.GetDecimal()
+		return decVal.Num().Uint64(), decVal.IsInt() && decVal.Num().IsUint64()
 	case JsonIntValue:
 		parsedVal, err := strconv.ParseInt(string(val.sliceData), 10, 64)
 		if err == nil && parsedVal > 0 {
@@ -299,6 +319,9 @@ func (val FastVal) AsFloat() (float64, bool) {
 		return float64(val.GetUint()), true
 	case FloatValue:
 		return val.GetFloat(), true
+	case DecimalValue:
+		floatVal, _ := val.GetDecimal().Float64()
+		return floatVal, true
 	case JsonIntValue:
 		parsedVal, err := strconv.ParseInt(string(val.sliceData), 10, 64)
 		return float64(parsedVal), err == nil
@@ -334,6 +357,8 @@ func (val FastVal) AsBoolean() (bool, bool) {
 		return val.GetUint() != 0, true
 	case FloatValue:
 		return val.GetFloat() != 0.0, true
+	case DecimalValue:
+		return val.GetDecimal().Sign() != 0, true
 	case JsonIntValue:
 		parsedVal, err := strconv.ParseInt(string(val.sliceData), 10, 64)
 		return parsedVal != 0, err == nil
@@ -368,6 +393,8 @@ func (val FastVal) AsString() (string, bool) {
 		return fmt.Sprintf("%d", val.GetUint()), true
 	case FloatValue:
 		return fmt.Sprintf("%f", val.GetFloat()), true
+	case DecimalValue:
+		return formatDecimal(val.GetDecimal()), true
 	case JsonIntValue:
 		return string(val.sliceData), true
 	case JsonUintValue:
@@ -443,6 +470,9 @@ func (val FastVal) toJsonStringInternal() (FastVal, error) {
 			toJsonStringBuffer = toJsonStringBuffer[:0]
 			toJsonStringBuffer = strconv.AppendFloat(toJsonStringBuffer, val.GetFloat(), 'E', -1, 64)
 			return NewJsonStringFastVal(toJsonStringBuffer), nil
+		case DecimalValue:
+			toJsonStringBuffer = append(toJsonStringBuffer[:0], formatDecimal(val.GetDecimal())...)
+			return NewJsonStringFastVal(toJsonStringBuffer), nil
 		}
 	}
 
@@ -580,6 +610,12 @@ func (val FastVal) compareBoolean(other FastVal) (int, bool) {
 }
 
 func (val FastVal) compareStrings(other FastVal) (int, bool) {
+	if other.IsString() {
+		if collation := val.stringCollation(other); collation != CollationBinary {
+			return compareCollated(val.stringData(), other.stringData(), collation), true
+		}
+	}
+
 	if other.IsString() || other.IsNumeric() {
 		escVal, err := val.toJsonStringInternal()
 		escOval, err1 := other.toJsonStringInternal()
@@ -657,6 +693,13 @@ func (val FastVal) compareObjArrData(other FastVal) (int, bool) {
 	}
 }
 
+func (val FastVal) compareBinary(other FastVal) (int, bool) {
+	if !other.IsBinary() {
+		return val.Collate(other)
+	}
+	return bytes.Compare(val.sliceData, other.sliceData), true
+}
+
 // This is really using other as the baseline for calling compare,
 // and then reversing the result
 // This is so that comparisons between different data types are bidirectionally consistent
@@ -742,6 +785,12 @@ func (val FastVal) compareUserDefined(other FastVal) (int, bool) {
 
 // Prereq: This call should only be called when "other" is a compatible type
 func (val FastVal) compareNumerics(other FastVal) (int, bool) {
+	if val.IsDecimal() || other.IsDecimal() {
+		// Decimals are only used where the other types would lose
+		// precision, so compare everything else exactly against them
+		return val.compareDecimal(other)
+	}
+
 	switch val.dataType {
 	case JsonIntValue:
 		fallthrough
@@ -754,11 +803,14 @@ func (val FastVal) compareNumerics(other FastVal) (int, bool) {
 		case UintValue:
 			fallthrough
 		case JsonUintValue:
-			intVal, _ := val.AsInt()
+			intVal, valid := val.AsInt()
 			if intVal >= 0 {
 				return val.compareUint(other)
 			} else {
-				return val.compareInt(other)
+				// Every uint is greater than a negative int, including
+				// those which are too large to compare as ints
+				_, valid2 := other.AsUint()
+				return -1, valid && valid2
 			}
 		default:
 			return val.compareInt(other)
@@ -770,11 +822,12 @@ func (val FastVal) compareNumerics(other FastVal) (int, bool) {
 		case IntValue:
 			fallthrough
 		case JsonIntValue:
-			intVal, _ := val.AsInt()
+			intVal, valid := other.AsInt()
 			if intVal >= 0 {
 				return val.compareUint(other)
 			} else {
-				return val.compareInt(other)
+				_, valid2 := val.AsUint()
+				return 1, valid && valid2
 			}
 		case FloatValue:
 			fallthrough
@@ -843,6 +896,8 @@ func (val FastVal) checkCompatibility(other FastVal) bool {
 			fallthrough
 		case JsonFloatValue:
 			_, compatible = other.AsFloat()
+		case DecimalValue:
+			_, compatible = other.AsDecimal()
 		case TrueValue:
 			fallthrough
 		case FalseValue:
@@ -870,6 +925,8 @@ func (val FastVal) compareInternal(other FastVal) (int, bool) {
 	case JsonUintValue:
 		fallthrough
 	case JsonFloatValue:
+		fallthrough
+	case DecimalValue:
 		return val.compareNumerics(other)
 	case StringValue:
 		fallthrough
@@ -887,6 +944,8 @@ func (val FastVal) compareInternal(other FastVal) (int, bool) {
 		return val.compareArray(other)
 	case ObjectValue:
 		return val.compareObject(other)
+	case BinaryValue:
+		return val.compareBinary(other)
 	case NullValue:
 		return val.compareNull(other)
 	}
@@ -904,6 +963,10 @@ func (val FastVal) Equals(other FastVal) (bool, bool) {
 }
 
 func (val FastVal) matchStrings(other FastVal) (bool, bool) {
+	if other.dataType == LikePatternValue {
+		return other.data.(*LikePattern).Match(val.stringData()), true
+	}
+
 	escVal, err := val.toJsonStringInternal()
 	if err != nil {
 		return false, false
@@ -956,6 +1019,10 @@ func NewFastVal(val interface{}) FastVal {
 		return NewFloatFastVal(float64(val))
 	case float64:
 		return NewFloatFastVal(val)
+	case *big.Rat:
+		return NewDecimalFastVal(val)
+	case *big.Int:
+		return NewDecimalFastVal(new(big.Rat).SetInt(val))
 	case bool:
 		return NewBoolFastVal(val)
 	case string:
@@ -966,6 +1033,8 @@ func NewFastVal(val interface{}) FastVal {
 		return NewRegexpFastVal(val)
 	case PcreWrapperInterface:
 		return NewPcreFastVal(val)
+	case *LikePattern:
+		return NewLikePatternFastVal(val)
 	case *time.Time:
 		return NewTimeFastVal(val)
 	case nil:
@@ -1096,6 +1165,14 @@ func NewPcreFastVal(value PcreWrapperInterface) FastVal {
 	return val
 }
 
+func NewLikePatternFastVal(value *LikePattern) FastVal {
+	val := FastVal{
+		dataType: LikePatternValue,
+		data:     value,
+	}
+	return val
+}
+
 func NewTimeFastVal(value *time.Time) FastVal {
 	val := FastVal{
 		dataType: TimeValue,
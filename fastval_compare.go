@@ -0,0 +1,136 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareMode selects how comparisons between values of different types
+// are resolved.  It is chosen when an expression is transformed, and is
+// recorded against each op of the resulting MatchDef.
+type CompareMode int
+
+const (
+	// CompareModeCollate compares values of different types by implicit
+	// conversion where ImplicitConvTable allows it, and otherwise by the
+	// N1QL collation order of their types.
+	CompareModeCollate CompareMode = iota
+
+	// CompareModeStrict only compares numbers with numbers, strings with
+	// strings, booleans with booleans and so on.  Comparisons between
+	// values of different types are always false.
+	CompareModeStrict
+
+	// CompareModeLoose follows the loose comparison rules of JavaScript.
+	// Booleans compare as 0 and 1, strings compared with numbers or
+	// booleans are converted to numbers, and null is only equal to itself
+	// but orders as 0.  Comparisons whose operands cannot be converted are
+	// always false, and any other values compare as they do when collating.
+	CompareModeLoose
+)
+
+func (mode CompareMode) String() string {
+	switch mode {
+	case CompareModeCollate:
+		return "collate"
+	case CompareModeStrict:
+		return "strict"
+	case CompareModeLoose:
+		return "loose"
+	}
+
+	return "??unknown??"
+}
+
+// isSameKindAs checks whether two values are of the same type once the
+// different representations of numbers, strings and booleans are ignored.
+func (val FastVal) isSameKindAs(other FastVal) bool {
+	switch {
+	case val.IsNumeric():
+		return other.IsNumeric()
+	case val.IsString():
+		return other.IsString()
+	case val.IsBoolean():
+		return other.IsBoolean()
+	}
+	return val.dataType == other.dataType
+}
+
+func (val FastVal) isLoosePrimitive() bool {
+	return val.IsNull() || val.IsBoolean() || val.IsNumeric() || val.IsString()
+}
+
+// looseToNumber converts a value to a number in the way that JavaScript
+// does, where strings which are empty or only whitespace are 0.
+func looseToNumber(val FastVal) (FastVal, bool) {
+	switch {
+	case val.IsNumeric():
+		return val, true
+	case val.IsNull():
+		return NewIntFastVal(0), true
+	case val.IsBoolean():
+		if val.dataType == TrueValue {
+			return NewIntFastVal(1), true
+		}
+		return NewIntFastVal(0), true
+	case val.IsString():
+		strVal, valid := val.AsString()
+		if !valid {
+			return NewInvalidFastVal(), false
+		}
+
+		strVal = strings.TrimSpace(strVal)
+		if strVal == "" {
+			return NewIntFastVal(0), true
+		} else if intVal, err := strconv.ParseInt(strVal, 10, 64); err == nil {
+			return NewIntFastVal(intVal), true
+		} else if decVal, ok := parseDecimal(strVal); ok {
+			return NewDecimalFastVal(decVal), true
+		}
+	}
+
+	return NewInvalidFastVal(), false
+}
+
+// looseOperands converts the operands of an op as JavaScript would before
+// comparing them.  The last value is false when the comparison can never be
+// true, such as when a string is not a number.
+func looseOperands(op OpType, lhsVal, rhsVal FastVal) (FastVal, FastVal, bool) {
+	if lhsVal.isSameKindAs(rhsVal) ||
+		!lhsVal.isLoosePrimitive() || !rhsVal.isLoosePrimitive() {
+		return lhsVal, rhsVal, true
+	}
+
+	if (lhsVal.IsNull() || rhsVal.IsNull()) && op == OpTypeEquals {
+		return lhsVal, rhsVal, false
+	}
+
+	lhsNum, valid := looseToNumber(lhsVal)
+	rhsNum, valid2 := looseToNumber(rhsVal)
+	return lhsNum, rhsNum, valid && valid2
+}
+
+// evalOpWithMode performs an op as evalOp does, but resolves comparisons
+// between values of different types according to mode.
+func evalOpWithMode(op OpType, mode CompareMode, lhsVal, rhsVal FastVal) (bool, bool) {
+	if op == OpTypeExists || op == OpTypeMatches {
+		return evalOp(op, lhsVal, rhsVal)
+	}
+
+	switch mode {
+	case CompareModeStrict:
+		if !lhsVal.isSameKindAs(rhsVal) {
+			return false, true
+		}
+	case CompareModeLoose:
+		var comparable bool
+		lhsVal, rhsVal, comparable = looseOperands(op, lhsVal, rhsVal)
+		if !comparable {
+			return false, true
+		}
+	}
+
+	return evalOp(op, lhsVal, rhsVal)
+}
@@ -0,0 +1,98 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchCompareModes(t *testing.T) {
+	assert := assert.New(t)
+
+	doc := []byte(`{"num": 5, "str": "5", "word": "abc", "blank": " ", "flag": true, "none": null, "big": 12345678901234567891}`)
+	tests := []struct {
+		filter  string
+		collate bool
+		strict  bool
+		loose   bool
+	}{
+		{`num = 5`, true, true, true},
+		{`num = 5.0`, true, true, true},
+		{`str = "5"`, true, true, true},
+		{`num = str`, true, false, true},
+		{`num >= str`, true, false, true},
+		{`word > num`, true, false, false},
+		{`word < num`, false, false, false},
+		{`blank = 0`, false, false, true},
+		{`flag = 1`, true, false, true},
+		{`flag < num`, false, false, true},
+		{`none = 0`, false, false, false},
+		{`none < 1`, true, false, true},
+		{`str <> 5`, false, true, false},
+		{`big = "12345678901234567891"`, true, false, true},
+	}
+
+	modes := []CompareMode{CompareModeCollate, CompareModeStrict, CompareModeLoose}
+	for _, test := range tests {
+		_, fe, err := NewBoundedFilterExpressionParser(test.filter)
+		if !assert.Nil(err, test.filter) {
+			continue
+		}
+		expr, err := fe.OutputExpression()
+		assert.Nil(err, test.filter)
+
+		expected := []bool{test.collate, test.strict, test.loose}
+		for i, mode := range modes {
+			trans := Transformer{CompareMode: mode}
+			matched, err := NewFastMatcher(trans.Transform([]Expression{expr})).Match(doc)
+			assert.Nil(err, test.filter)
+			assert.Equal(expected[i], matched, "%s (%s)", test.filter, mode)
+
+			slow := NewSlowMatcher([]Expression{expr})
+			slow.CompareMode = mode
+			matched, err = slow.Match(doc)
+			assert.Nil(err, test.filter)
+			assert.Equal(expected[i], matched, "%s (%s, slow)", test.filter, mode)
+		}
+	}
+}
+
+func TestTransformCompareMode(t *testing.T) {
+	assert := assert.New(t)
+
+	expr := EqualsExpr{FieldExpr{Path: []string{"name"}}, ValueExpr{"a"}}
+	trans := Transformer{CompareMode: CompareModeStrict}
+	def := trans.Transform([]Expression{expr})
+
+	ops := def.ParseNode.Elems["name"].Ops
+	if assert.Len(ops, 1) {
+		assert.Equal(CompareModeStrict, ops[0].Mode)
+		assert.Contains(ops[0].String(), "(strict)")
+	}
+
+	var collateTrans Transformer
+	def = collateTrans.Transform([]Expression{expr})
+	assert.NotContains(def.String(), "collate")
+}
+
+func TestMatchCompareModeCollateUsed(t *testing.T) {
+	assert := assert.New(t)
+
+	expr := LessThanExpr{FieldExpr{Path: []string{"name"}}, ValueExpr{5}}
+	doc := []byte(`{"name": "abc"}`)
+
+	var trans Transformer
+	m := NewFastMatcher(trans.Transform([]Expression{expr}))
+	_, status, err := m.MatchWithStatus(doc)
+	assert.Nil(err)
+	assert.NotZero(status & MatcherCollateUsed)
+
+	trans = Transformer{CompareMode: CompareModeStrict}
+	m = NewFastMatcher(trans.Transform([]Expression{expr}))
+	matched, status, err := m.MatchWithStatus(doc)
+	assert.Nil(err)
+	assert.False(matched)
+	assert.Zero(status & MatcherCollateUsed)
+}
@@ -0,0 +1,168 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// float64 holds at least 15 significant decimal digits exactly, so number
+// literals with more digits than this are parsed as decimals instead.
+const maxExactFloatDigits = 15
+
+// Decimal literals with exponents beyond this are not expanded into exact
+// values, as doing so could allocate an unbounded amount of memory.
+const maxDecimalExponent = 1024
+
+// Decimals with no finite representation are formatted to this many places.
+const maxDecimalPlaces = 34
+
+// intLiteralOverflows checks whether a JSON integer literal is too large
+// to be held in an int64.
+func intLiteralOverflows(bytes []byte) bool {
+	digits := len(bytes)
+	if digits > 0 && bytes[0] == '-' {
+		digits--
+	}
+	if digits < 19 {
+		return false
+	}
+
+	_, err := strconv.ParseInt(string(bytes), 10, 64)
+	return err != nil
+}
+
+// numberLiteralIsInexact checks whether a JSON number literal has more
+// significant digits than a float64 is able to hold.
+func numberLiteralIsInexact(bytes []byte) bool {
+	digits := 0
+	for _, c := range bytes {
+		if c == 'e' || c == 'E' {
+			break
+		} else if c >= '1' && c <= '9' || c == '0' && digits > 0 {
+			digits++
+		}
+	}
+
+	// Trailing zeros in the fraction are counted above, which only makes
+	// us use a decimal where a float would have done.
+	return digits > maxExactFloatDigits
+}
+
+// parseDecimal parses a JSON number literal into an exact rational value.
+func parseDecimal(str string) (*big.Rat, bool) {
+	for i := 0; i < len(str); i++ {
+		if str[i] == '/' || str[i] == '_' {
+			// big.Rat also accepts fractions and digit separators
+			return nil, false
+		} else if str[i] == 'e' || str[i] == 'E' {
+			exp, err := strconv.Atoi(str[i+1:])
+			if err != nil || exp > maxDecimalExponent || exp < -maxDecimalExponent {
+				return nil, false
+			}
+			break
+		}
+	}
+
+	return new(big.Rat).SetString(str)
+}
+
+// formatDecimal writes a decimal without an exponent.  Values which have
+// no finite decimal representation, such as the results of division, are
+// written to a fixed number of places.
+func formatDecimal(value *big.Rat) string {
+	if value.IsInt() {
+		return value.Num().String()
+	}
+
+	var twos, fives int
+	denom := new(big.Int).Set(value.Denom())
+	rem := new(big.Int)
+	five := big.NewInt(5)
+	for denom.Bit(0) == 0 {
+		denom.Rsh(denom, 1)
+		twos++
+	}
+	for {
+		quo, _ := new(big.Int).QuoRem(denom, five, rem)
+		if rem.Sign() != 0 {
+			break
+		}
+		denom = quo
+		fives++
+	}
+
+	if denom.Cmp(big.NewInt(1)) != 0 {
+		return value.FloatString(maxDecimalPlaces)
+	}
+	if fives > twos {
+		return value.FloatString(fives)
+	}
+	return value.FloatString(twos)
+}
+
+func (val FastVal) IsDecimal() bool {
+	return val.dataType == DecimalValue
+}
+
+func (val FastVal) GetDecimal() *big.Rat {
+	return val.data.(*big.Rat)
+}
+
+// AsDecimal returns the exact value of a number.  Floats are converted
+// from their shortest decimal form, so 0.1 is equal to the decimal 0.1
+// rather than to the binary fraction which is nearest to it.
+func (val FastVal) AsDecimal() (*big.Rat, bool) {
+	switch val.dataType {
+	case DecimalValue:
+		return val.GetDecimal(), true
+	case IntValue:
+		return new(big.Rat).SetInt64(val.GetInt()), true
+	case UintValue:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(val.GetUint())), true
+	case FloatValue:
+		floatVal := val.GetFloat()
+		if math.IsNaN(floatVal) || math.IsInf(floatVal, 0) {
+			return nil, false
+		}
+		return parseDecimal(strconv.FormatFloat(floatVal, 'g', -1, 64))
+	case BinStringValue:
+		fallthrough
+	case JsonStringValue:
+		fallthrough
+	case JsonIntValue:
+		fallthrough
+	case JsonUintValue:
+		fallthrough
+	case JsonFloatValue:
+		return parseDecimal(string(val.sliceData))
+	case StringValue:
+		return parseDecimal(val.data.(string))
+	case TrueValue:
+		return big.NewRat(1, 1), true
+	case FalseValue:
+		return new(big.Rat), true
+	}
+	return nil, false
+}
+
+func (val FastVal) compareDecimal(other FastVal) (int, bool) {
+	decVal, valid := val.AsDecimal()
+	decOval, valid2 := other.AsDecimal()
+	if !valid || !valid2 {
+		// NaN and infinite floats have no exact value, so leave these
+		// for the float comparison to order
+		return val.compareFloat(other)
+	}
+
+	return decVal.Cmp(decOval), true
+}
+
+func NewDecimalFastVal(value *big.Rat) FastVal {
+	return FastVal{
+		dataType: DecimalValue,
+		data:     value,
+	}
+}
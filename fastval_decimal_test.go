@@ -0,0 +1,141 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustDecimal(str string) *big.Rat {
+	value, ok := parseDecimal(str)
+	if !ok {
+		panic("invalid decimal " + str)
+	}
+	return value
+}
+
+func TestFastLitParserDecimals(t *testing.T) {
+	assert := assert.New(t)
+
+	var parser fastLitParser
+	assert.Equal(IntValue, parser.Parse(tknInteger, []byte("9223372036854775807")).Type())
+	assert.Equal(IntValue, parser.Parse(tknInteger, []byte("-9223372036854775808")).Type())
+	assert.Equal(FloatValue, parser.Parse(tknNumber, []byte("1234567.12345678")).Type())
+	assert.Equal(FloatValue, parser.Parse(tknNumber, []byte("0.000000001e-5")).Type())
+
+	val := parser.Parse(tknInteger, []byte("18446744073709551617"))
+	assert.Equal(DecimalValue, val.Type())
+	assert.Equal("(decimal)18446744073709551617", val.String())
+
+	val = parser.Parse(tknNumber, []byte("-12345678901.123456789"))
+	assert.Equal(DecimalValue, val.Type())
+	assert.Equal("(decimal)-12345678901.123456789", val.String())
+
+	// Exponents which would need huge values are left as floats
+	val = parser.Parse(tknNumber, []byte("1.2345678901234567e999999"))
+	assert.Equal(FloatValue, val.Type())
+}
+
+func TestFastValDecimalCompare(t *testing.T) {
+	assert := assert.New(t)
+
+	large := NewDecimalFastVal(mustDecimal("9007199254740993"))
+	result, valid := large.Compare(NewFloatFastVal(9007199254740992))
+	assert.True(valid)
+	assert.Equal(1, result)
+	result, valid = NewIntFastVal(9007199254740993).Compare(large)
+	assert.True(valid)
+	assert.Equal(0, result)
+	result, valid = NewJsonIntFastVal([]byte("9007199254740994")).Compare(large)
+	assert.True(valid)
+	assert.Equal(1, result)
+
+	huge := NewDecimalFastVal(mustDecimal("18446744073709551616"))
+	result, valid = NewUintFastVal(18446744073709551615).Compare(huge)
+	assert.True(valid)
+	assert.Equal(-1, result)
+
+	// Floats compare by their shortest decimal form
+	equals, valid := NewDecimalFastVal(mustDecimal("0.1")).Equals(NewFloatFastVal(0.1))
+	assert.True(valid)
+	assert.True(equals)
+	equals, valid = NewDecimalFastVal(mustDecimal("0.10000000000000001")).Equals(NewFloatFastVal(0.1))
+	assert.True(valid)
+	assert.False(equals)
+
+	userVal := NewDecimalFastVal(mustDecimal("1000000000.000000001"))
+	userVal.userDefined = true
+	result, valid = NewJsonFloatFastVal([]byte("1000000000.000000002")).Compare(userVal)
+	assert.True(valid)
+	assert.Equal(1, result)
+
+	result, valid = NewJsonStringFastVal([]byte("abc")).Compare(large)
+	assert.Equal(1, result)
+}
+
+func TestFastValDecimalMath(t *testing.T) {
+	assert := assert.New(t)
+
+	big1 := NewDecimalFastVal(mustDecimal("18446744073709551616"))
+	assert.Equal("(decimal)18446744073709551617", FastValMathAdd(big1, NewIntFastVal(1)).String())
+	assert.Equal("(decimal)18446744073709551615", FastValMathSub(big1, NewUintFastVal(1)).String())
+	assert.Equal("(decimal)36893488147419103232", FastValMathMul(NewIntFastVal(2), big1).String())
+	assert.Equal("(decimal)4611686018427387904", FastValMathDiv(big1, NewIntFastVal(4)).String())
+	assert.Equal("(decimal)6", FastValMathMod(big1, NewIntFastVal(10)).String())
+	assert.Equal("(decimal)-18446744073709551616", FastValMathNeg(big1).String())
+	assert.Equal(NullValue, FastValMathDiv(big1, NewIntFastVal(0)).Type())
+	assert.Equal(InvalidValue, FastValMathMod(big1, NewFloatFastVal(1.5)).Type())
+
+	third := FastValMathDiv(NewDecimalFastVal(mustDecimal("1")), NewIntFastVal(3))
+	assert.Equal("(decimal)0.3333333333333333333333333333333333", third.String())
+	result, valid := FastValMathMul(third, NewIntFastVal(3)).Compare(NewIntFastVal(1))
+	assert.True(valid)
+	assert.Equal(0, result)
+
+	amount := NewDecimalFastVal(mustDecimal("-2.5"))
+	assert.Equal("(decimal)-3", FastValMathRound(amount).String())
+	assert.Equal("(decimal)-3", FastValMathFloor(amount).String())
+	assert.Equal("(decimal)-2", FastValMathCeil(amount).String())
+	assert.Equal("(decimal)2.5", FastValMathAbs(amount).String())
+}
+
+func TestMatchDecimals(t *testing.T) {
+	assert := assert.New(t)
+
+	doc := []byte(`{"id": 12345678901234567891, "amount": 1234567890.123456789, "small": 5}`)
+	tests := []struct {
+		filter  string
+		matched bool
+	}{
+		{`id = 12345678901234567891`, true},
+		{`id = 12345678901234567890`, false},
+		{`id > 12345678901234567890`, true},
+		{`amount > 1234567890.123456788`, true},
+		{`amount < 1234567890.123456790`, true},
+		{`amount = 1234567890.12345679`, false},
+		{`small < 12345678901234567890`, true},
+		{`id - 12345678901234567890 = 1`, true},
+		{`-id < -12345678901234567890`, true},
+	}
+
+	for _, test := range tests {
+		m, err := GetFilterExpressionMatcher(test.filter)
+		if !assert.Nil(err, test.filter) {
+			continue
+		}
+		matched, err := m.Match(doc)
+		assert.Nil(err, test.filter)
+		assert.Equal(test.matched, matched, test.filter)
+	}
+
+	// Filters may also opt in to exact comparisons with a decimal value
+	expr := EqualsExpr{FieldExpr{Path: []string{"amount"}}, ValueExpr{mustDecimal("1234567890.123456789")}}
+	var trans Transformer
+	m := NewFastMatcher(trans.Transform([]Expression{expr}))
+	matched, err := m.Match(doc)
+	assert.Nil(err)
+	assert.True(matched)
+}
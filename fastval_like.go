@@ -0,0 +1,217 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultLikeEscape is the escape character of a LIKE pattern which does
+// not name one with ESCAPE, as in N1QL.
+const DefaultLikeEscape = '\\'
+
+type likeKind int
+
+const (
+	likeExact likeKind = iota
+	likePrefix
+	likeSuffix
+	likeContains
+	likeGeneral
+)
+
+// likeSegment is the part of a pattern between two % wildcards.  It holds
+// the literal text either side of each _ wildcard, so a segment of n parts
+// always matches exactly n-1 characters besides its literals.
+type likeSegment []string
+
+// LikePattern is a compiled SQL LIKE pattern.  Patterns which only have a
+// % wildcard at their start or end are matched with a single prefix,
+// suffix or substring check.
+type LikePattern struct {
+	source   string
+	kind     likeKind
+	literal  string
+	segments []likeSegment
+}
+
+// CompileLikePattern compiles a LIKE pattern, where % matches any number of
+// characters and _ matches exactly one.  The character following escape is
+// always literal, and an escape of 0 disables escaping.
+func CompileLikePattern(pattern string, escape rune) (*LikePattern, error) {
+	var segments []likeSegment
+	var segment likeSegment
+	var part strings.Builder
+	hasAnyChar := false
+	escaped := false
+
+	for _, char := range pattern {
+		switch {
+		case escaped:
+			part.WriteRune(char)
+			escaped = false
+		case escape != 0 && char == escape:
+			escaped = true
+		case char == '%':
+			segment = append(segment, part.String())
+			part.Reset()
+			// Consecutive % wildcards are no different to a single one
+			if len(segments) == 0 || len(segment) > 1 || segment[0] != "" {
+				segments = append(segments, segment)
+			}
+			segment = nil
+		case char == '_':
+			segment = append(segment, part.String())
+			part.Reset()
+			hasAnyChar = true
+		default:
+			part.WriteRune(char)
+		}
+	}
+	if escaped {
+		return nil, ErrorLikeTrailingEscape
+	}
+	segments = append(segments, append(segment, part.String()))
+
+	compiled := &LikePattern{
+		source:   pattern,
+		kind:     likeGeneral,
+		segments: segments,
+	}
+
+	if !hasAnyChar {
+		first := segments[0][0]
+		last := segments[len(segments)-1][0]
+		switch {
+		case len(segments) == 1:
+			compiled.kind, compiled.literal = likeExact, first
+		case len(segments) == 2 && last == "":
+			compiled.kind, compiled.literal = likePrefix, first
+		case len(segments) == 2 && first == "":
+			compiled.kind, compiled.literal = likeSuffix, last
+		case len(segments) == 3 && first == "" && last == "":
+			compiled.kind, compiled.literal = likeContains, segments[1][0]
+		}
+	}
+
+	return compiled, nil
+}
+
+// ParseLikeEscape returns the escape character named by the ESCAPE clause
+// of a LIKE, where an empty string means that there is no escape character.
+func ParseLikeEscape(escape string) (rune, error) {
+	if escape == "" {
+		return 0, nil
+	}
+
+	char, size := utf8.DecodeRuneInString(escape)
+	if size != len(escape) {
+		return 0, ErrorLikeEscapeLength
+	}
+	return char, nil
+}
+
+func (pattern *LikePattern) String() string {
+	return pattern.source
+}
+
+// Match checks whether the whole of str matches the pattern.
+func (pattern *LikePattern) Match(str string) bool {
+	switch pattern.kind {
+	case likeExact:
+		return str == pattern.literal
+	case likePrefix:
+		return strings.HasPrefix(str, pattern.literal)
+	case likeSuffix:
+		return strings.HasSuffix(str, pattern.literal)
+	case likeContains:
+		return strings.Contains(str, pattern.literal)
+	}
+
+	segments := pattern.segments
+	end, ok := segments[0].matchAt(str, 0)
+	if !ok {
+		return false
+	} else if len(segments) == 1 {
+		return end == len(str)
+	}
+
+	// The last segment is anchored to the end of the string, and the ones
+	// between are matched as early as possible in what remains.
+	lastStart, ok := segments[len(segments)-1].matchBefore(str, len(str))
+	if !ok || lastStart < end {
+		return false
+	}
+
+	rest := str[end:lastStart]
+	for _, segment := range segments[1 : len(segments)-1] {
+		end, ok := segment.find(rest)
+		if !ok {
+			return false
+		}
+		rest = rest[end:]
+	}
+	return true
+}
+
+// matchAt matches the segment against the start of str[pos:], returning
+// the position just after it.
+func (segment likeSegment) matchAt(str string, pos int) (int, bool) {
+	for i, part := range segment {
+		if !strings.HasPrefix(str[pos:], part) {
+			return 0, false
+		}
+		pos += len(part)
+
+		if i < len(segment)-1 {
+			if pos >= len(str) {
+				return 0, false
+			}
+			_, size := utf8.DecodeRuneInString(str[pos:])
+			pos += size
+		}
+	}
+	return pos, true
+}
+
+// matchBefore matches the segment against the end of str[:end], returning
+// the position where it starts.
+func (segment likeSegment) matchBefore(str string, end int) (int, bool) {
+	for i := len(segment) - 1; i >= 0; i-- {
+		if !strings.HasSuffix(str[:end], segment[i]) {
+			return 0, false
+		}
+		end -= len(segment[i])
+
+		if i > 0 {
+			if end <= 0 {
+				return 0, false
+			}
+			_, size := utf8.DecodeLastRuneInString(str[:end])
+			end -= size
+		}
+	}
+	return end, true
+}
+
+// find returns the end of the first match of the segment within str.
+func (segment likeSegment) find(str string) (int, bool) {
+	for offset := 0; offset <= len(str); {
+		index := strings.Index(str[offset:], segment[0])
+		if index < 0 {
+			return 0, false
+		}
+
+		start := offset + index
+		if end, ok := segment.matchAt(str, start); ok {
+			return end, true
+		} else if start == len(str) {
+			break
+		}
+
+		_, size := utf8.DecodeRuneInString(str[start:])
+		offset = start + size
+	}
+	return 0, false
+}
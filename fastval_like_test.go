@@ -0,0 +1,160 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileLikePattern(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		pattern string
+		kind    likeKind
+		literal string
+	}{
+		{`Jo`, likeExact, "Jo"},
+		{`Jo%`, likePrefix, "Jo"},
+		{`%son`, likeSuffix, "son"},
+		{`%oh%`, likeContains, "oh"},
+		{`%%oh%%%`, likeContains, "oh"},
+		{`%`, likePrefix, ""},
+		{`100\%`, likeExact, "100%"},
+		{`\%%`, likePrefix, "%"},
+		{`J_`, likeGeneral, ""},
+		{`J%n`, likeGeneral, ""},
+		{`%a%b%`, likeGeneral, ""},
+	}
+
+	for _, test := range tests {
+		pattern, err := CompileLikePattern(test.pattern, DefaultLikeEscape)
+		if !assert.Nil(err, test.pattern) {
+			continue
+		}
+		assert.Equal(test.kind, pattern.kind, test.pattern)
+		assert.Equal(test.literal, pattern.literal, test.pattern)
+		assert.Equal(test.pattern, pattern.String())
+	}
+
+	_, err := CompileLikePattern(`abc\`, DefaultLikeEscape)
+	assert.Equal(ErrorLikeTrailingEscape, err)
+	_, err = CompileLikePattern(`abc\`, 0)
+	assert.Nil(err)
+
+	escape, err := ParseLikeEscape("!")
+	assert.Nil(err)
+	assert.Equal('!', escape)
+	escape, err = ParseLikeEscape("")
+	assert.Nil(err)
+	assert.Equal(rune(0), escape)
+	_, err = ParseLikeEscape("!!")
+	assert.Equal(ErrorLikeEscapeLength, err)
+}
+
+func TestLikePatternMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		pattern string
+		escape  rune
+		str     string
+		matched bool
+	}{
+		{`Jo%`, '\\', "John", true},
+		{`Jo%`, '\\', "jo", false},
+		{`%son`, '\\', "Johnson", true},
+		{`%oh%`, '\\', "John", true},
+		{`J_hn`, '\\', "John", true},
+		{`J_hn`, '\\', "Jhn", false},
+		{`J__n`, '\\', "Jöhn", true},
+		{`_`, '\\', "ö", true},
+		{`__`, '\\', "ö", false},
+		{`J%n`, '\\', "Jn", true},
+		{`J%n`, '\\', "John Dunn", true},
+		{`J%n`, '\\', "Johnny", false},
+		{`a%a`, '\\', "a", false},
+		{`a%b_d%e`, '\\', "abcdbxde", true},
+		{`a%b_d%e`, '\\', "abde", false},
+		{`%b_%_d`, '\\', "xbcyzd", true},
+		{`%b_%_d`, '\\', "xbcd", false},
+		{`%_`, '\\', "", false},
+		{`%_`, '\\', "x", true},
+		{`100\%`, '\\', "100%", true},
+		{`100\%`, '\\', "1000", false},
+		{`a\_%`, '\\', "a_b", true},
+		{`a\_%`, '\\', "ab", false},
+		{`a!_%`, '!', "a_b", true},
+		{`a\%`, '!', `a\x`, true},
+		{`a\%`, 0, `a\x`, true},
+	}
+
+	for _, test := range tests {
+		pattern, err := CompileLikePattern(test.pattern, test.escape)
+		if !assert.Nil(err, test.pattern) {
+			continue
+		}
+		assert.Equal(test.matched, pattern.Match(test.str), "%s LIKE %s", test.str, test.pattern)
+	}
+}
+
+func TestMatchLikePattern(t *testing.T) {
+	assert := assert.New(t)
+
+	doc := []byte(`{"name": "Jöhn", "path": "a\\b_c", "num": 10}`)
+	tests := []struct {
+		filter  string
+		matched bool
+	}{
+		{`name LIKE "J%"`, true},
+		{`name LIKE "J_hn"`, true},
+		{`name LIKE "j%"`, false},
+		{`NOT name LIKE "J%"`, false},
+		{`name =~ "^J.hn$"`, true},
+		{`REGEXP_CONTAINS(name, "hn$")`, true},
+		{`path LIKE "a\\\\b\\_%"`, true},
+		{`path LIKE "a\\b!_c" ESCAPE "!"`, true},
+		{`path LIKE "a\\b_c" ESCAPE ""`, true},
+		{`num LIKE "1%"`, false},
+	}
+
+	for _, test := range tests {
+		_, fe, err := NewBoundedFilterExpressionParser(test.filter)
+		if !assert.Nil(err, test.filter) {
+			continue
+		}
+		expr, err := fe.OutputExpression()
+		if !assert.Nil(err, test.filter) {
+			continue
+		}
+
+		var trans Transformer
+		matched, err := NewFastMatcher(trans.Transform([]Expression{expr})).Match(doc)
+		assert.Nil(err, test.filter)
+		assert.Equal(test.matched, matched, test.filter)
+
+		matched, err = NewSlowMatcher([]Expression{expr}).Match(doc)
+		assert.Nil(err, test.filter)
+		assert.Equal(test.matched, matched, test.filter)
+	}
+
+	_, fe, err := NewBoundedFilterExpressionParser(`name LIKE "J%" ESCAPE "ab"`)
+	if assert.Nil(err) {
+		_, err = fe.OutputExpression()
+		assert.Equal(ErrorLikeEscapeLength, err)
+	}
+
+	simpleExpr, err := ParseExpression(`name LIKE "J_hn" && name =~ "^J"`, ParseOptions{Dialect: DialectSimple})
+	assert.Nil(err)
+	filterExpr, err := ParseExpression(`name LIKE "J_hn" AND name =~ "^J"`, ParseOptions{Dialect: DialectFilter})
+	assert.Nil(err)
+	assert.Equal(filterExpr, simpleExpr)
+
+	expr := LikeExpr{FieldExpr{Path: []string{"name"}}, LikePatternExpr{"J!%", '!'}}
+	assert.Equal(`$doc.name LIKE "J!%" ESCAPE "!"`, expr.String())
+	parsed, err := ParseJsonExpression([]byte(`["like", ["field", "name"], ["likepattern", "J!%", "!"]]`))
+	assert.Nil(err)
+	assert.Equal(expr, parsed)
+}
@@ -2,6 +2,7 @@ package gojsonsm
 
 import (
 	"math"
+	"math/big"
 )
 
 // floatRound implements math.Round for Go versions older than
@@ -21,8 +22,31 @@ var mathRadiansFunc func(float64) float64 = func(deg float64) float64 {
 	return deg * math.Pi / 180
 }
 
+// decimalFloor rounds a decimal towards negative infinity.  big.Int's Div
+// is Euclidean, which floors when dividing by a positive denominator.
+func decimalFloor(val *big.Rat) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Div(val.Num(), val.Denom()))
+}
+
+func decimalCeil(val *big.Rat) *big.Rat {
+	floor := decimalFloor(new(big.Rat).Neg(val))
+	return floor.Neg(floor)
+}
+
+// decimalRound rounds half away from zero, as floatMathRound does.
+func decimalRound(val *big.Rat) *big.Rat {
+	abs := new(big.Rat).Abs(val)
+	rounded := decimalFloor(abs.Add(abs, big.NewRat(1, 2)))
+	if val.Sign() < 0 {
+		rounded.Neg(rounded)
+	}
+	return rounded
+}
+
 func FastValMathRound(val FastVal) FastVal {
-	if val.IsFloat() {
+	if val.IsDecimal() {
+		return NewDecimalFastVal(decimalRound(val.GetDecimal()))
+	} else if val.IsFloat() {
 		originalValue, valid := val.AsFloat()
 		if !valid {
 			return NewInvalidFastVal()
@@ -38,9 +62,13 @@ func FastValMathRound(val FastVal) FastVal {
 }
 
 func FastValMathAbs(val FastVal) FastVal {
-	if val.IsUInt() {
+	if val.IsDecimal() {
+		return NewDecimalFastVal(fastValAbsDecimal(val.GetDecimal()))
+	} else if val.IsUInt() {
 		// Not gonna do abs on an uint
 		return val
+	} else if val.IsInt() {
+		return genericFastValIntOp(val, fastValAbsInt, fastValAbsDecimal)
 	} else {
 		floatVal, valid := val.AsFloat()
 		if !valid {
@@ -48,110 +76,230 @@ func FastValMathAbs(val FastVal) FastVal {
 		}
 		if val.IsFloat() {
 			return NewFloatFastVal(math.Abs(floatVal))
-		} else if val.IsInt() {
-			return NewIntFastVal(int64(math.Abs(floatVal)))
 		}
 	}
 
 	return NewInvalidFastVal()
 }
 
-type intToIntOp func(int64) int64
-type int2ToIntOp func(int64, int64) int64
-type uint2ToUintOp func(uint64, uint64) uint64
+// The integer operations also return whether the result fitted, so that
+// results which overflow can be calculated again as decimals.
+type intToIntOp func(int64) (int64, bool)
+type int2ToIntOp func(int64, int64) (int64, bool)
+type uint2ToUintOp func(uint64, uint64) (uint64, bool)
 type floatToFloatOp func(float64) float64
 type float2ToFloatOp func(float64, float64) float64
+type decimalToDecimalOp func(*big.Rat) *big.Rat
+type decimal2ToDecimalOp func(*big.Rat, *big.Rat) *big.Rat
 
 func fastValMathAdd(a, b float64) float64 {
 	return a + b
 }
 
-func fastValMathAddInt(a, b int64) int64 {
-	return a + b
+func fastValMathAddInt(a, b int64) (int64, bool) {
+	sum := a + b
+	return sum, (sum > a) == (b > 0)
 }
 
-func fastValMathAddUint(a, b uint64) uint64 {
-	return a + b
+func fastValMathAddUint(a, b uint64) (uint64, bool) {
+	sum := a + b
+	return sum, sum >= a
 }
 
 func fastValMathSub(a, b float64) float64 {
 	return a - b
 }
 
-func fastValMathSubInt(a, b int64) int64 {
-	return a - b
+func fastValMathSubInt(a, b int64) (int64, bool) {
+	diff := a - b
+	return diff, (diff < a) == (b > 0)
 }
 
-func fastValMathSubUint(a, b uint64) uint64 {
-	return a - b
+func fastValMathSubUint(a, b uint64) (uint64, bool) {
+	return a - b, a >= b
 }
 
 func fastValMathMult(a, b float64) float64 {
 	return a * b
 }
 
-func fastValMathMultInt(a, b int64) int64 {
-	return a * b
+func fastValMathMultInt(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	product := a * b
+	// MinInt64 / -1 overflows back to MinInt64, so the check needs help
+	return product, product/b == a && !(b == -1 && a == math.MinInt64)
 }
 
-func fastValMathMultUint(a, b uint64) uint64 {
-	return a * b
+func fastValMathMultUint(a, b uint64) (uint64, bool) {
+	if a == 0 {
+		return 0, true
+	}
+	product := a * b
+	return product, product/a == b
 }
 
 func fastValMathDiv(a, b float64) float64 {
 	return a / b
 }
 
-func fastValMathDivInt(a, b int64) int64 {
-	return a / b
+func fastValMathDivInt(a, b int64) (int64, bool) {
+	return a / b, !(a == math.MinInt64 && b == -1)
 }
 
-func fastValMathDivUint(a, b uint64) uint64 {
-	return a / b
+func fastValMathDivUint(a, b uint64) (uint64, bool) {
+	return a / b, true
+}
+
+func fastValMathMod(a, b int64) (int64, bool) {
+	return a % b, true
+}
+
+func fastValMathModUint(a, b uint64) (uint64, bool) {
+	return a % b, true
+}
+
+func fastValMathAddDecimal(a, b *big.Rat) *big.Rat {
+	return new(big.Rat).Add(a, b)
+}
+
+func fastValMathSubDecimal(a, b *big.Rat) *big.Rat {
+	return new(big.Rat).Sub(a, b)
 }
 
-func fastValMathMod(a, b int64) int64 {
-	return a % b
+func fastValMathMultDecimal(a, b *big.Rat) *big.Rat {
+	return new(big.Rat).Mul(a, b)
 }
 
-func fastValMathModUint(a, b uint64) uint64 {
-	return a % b
+func fastValMathDivDecimal(a, b *big.Rat) *big.Rat {
+	return new(big.Rat).Quo(a, b)
+}
+
+// fastValMathDivIntDecimal truncates towards zero like integer division,
+// for integers which do not fit in an int64 or uint64.
+func fastValMathDivIntDecimal(a, b *big.Rat) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Quo(a.Num(), b.Num()))
+}
+
+// fastValMathModDecimal follows the sign of the dividend like Go's %, and
+// expects both operands to be integers.
+func fastValMathModDecimal(a, b *big.Rat) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Rem(a.Num(), b.Num()))
+}
+
+func fastValAbsInt(a int64) (int64, bool) {
+	if a < 0 {
+		return fastValNegateInt(a)
+	}
+	return a, true
+}
+
+func fastValNegateDecimal(a *big.Rat) *big.Rat {
+	return new(big.Rat).Neg(a)
+}
+
+func fastValAbsDecimal(a *big.Rat) *big.Rat {
+	return new(big.Rat).Abs(a)
 }
 
 func fastValNegate(a float64) float64 {
 	return -1.0 * a
 }
 
-func fastValNegateInt(a int64) int64 {
-	return -1 * a
+func fastValNegateInt(a int64) (int64, bool) {
+	return -a, a != math.MinInt64
 }
 
-func genericFastVal2IntsOp(val, val1 FastVal, op int2ToIntOp) FastVal {
+// genericFastVal2IntsOp falls back to overflowOp when either the operands
+// or the result are outside the range of an int64.
+func genericFastVal2IntsOp(val, val1 FastVal, op int2ToIntOp, overflowOp decimal2ToDecimalOp) FastVal {
 	valInt, valid := val.AsInt()
 	val1Int, valid2 := val1.AsInt()
-	if !val.IsNumeric() || !val1.IsNumeric() || !valid || !valid2 {
+	if !val.IsNumeric() || !val1.IsNumeric() {
 		return NewInvalidFastVal()
+	} else if !valid || !valid2 {
+		return genericFastVal2IntegersOverflowOp(val, val1, overflowOp)
 	}
 
-	return NewIntFastVal(op(valInt, val1Int))
+	result, fits := op(valInt, val1Int)
+	if !fits {
+		return genericFastVal2IntegersOverflowOp(val, val1, overflowOp)
+	}
+	return NewIntFastVal(result)
 }
 
-func genericFastVal2UintsOp(val, val1 FastVal, op uint2ToUintOp) FastVal {
+// genericFastVal2UintsOp falls back to overflowOp when either the operands
+// or the result are outside the range of a uint64.
+func genericFastVal2UintsOp(val, val1 FastVal, op uint2ToUintOp, overflowOp decimal2ToDecimalOp) FastVal {
 	valUint, valid := val.AsUint()
 	val1Uint, valid2 := val1.AsUint()
-	if !val.IsNumeric() || !val1.IsNumeric() || !valid || !valid2 {
+	if !val.IsNumeric() || !val1.IsNumeric() {
+		return NewInvalidFastVal()
+	} else if !valid || !valid2 {
+		return genericFastVal2IntegersOverflowOp(val, val1, overflowOp)
+	}
+
+	result, fits := op(valUint, val1Uint)
+	if !fits {
+		return genericFastVal2IntegersOverflowOp(val, val1, overflowOp)
+	}
+	return NewUintFastVal(result)
+}
+
+// genericFastVal2IntegersOverflowOp calculates the result of an integer
+// operation as a decimal.  Integers from JSON which are not valid numbers
+// remain invalid.
+func genericFastVal2IntegersOverflowOp(val, val1 FastVal, op decimal2ToDecimalOp) FastVal {
+	valDecimal, valid := val.AsDecimal()
+	val1Decimal, valid2 := val1.AsDecimal()
+	if !valid || !valid2 || !valDecimal.IsInt() || !val1Decimal.IsInt() {
 		return NewInvalidFastVal()
 	}
 
-	return NewUintFastVal(op(valUint, val1Uint))
+	return newIntegerFastVal(op(valDecimal, val1Decimal))
 }
 
-func genericFastValIntOp(val FastVal, op intToIntOp) FastVal {
+// genericFastVal2DecimalsOp falls back to floatOp for values such as NaN
+// which have no exact value.
+func genericFastVal2DecimalsOp(val, val1 FastVal, op decimal2ToDecimalOp, floatOp float2ToFloatOp) FastVal {
+	if !val.IsNumeric() || !val1.IsNumeric() {
+		return NewInvalidFastVal()
+	}
+
+	valDecimal, valid := val.AsDecimal()
+	val1Decimal, valid2 := val1.AsDecimal()
+	if !valid || !valid2 {
+		return genericFastVal2FloatsOp(val, val1, floatOp)
+	}
+
+	return NewDecimalFastVal(op(valDecimal, val1Decimal))
+}
+
+// newIntegerFastVal returns an integer as an int or uint when it fits in
+// one, so that only results which really overflowed become decimals.
+func newIntegerFastVal(value *big.Rat) FastVal {
+	if value.IsInt() && value.Num().IsInt64() {
+		return NewIntFastVal(value.Num().Int64())
+	} else if value.IsInt() && value.Num().IsUint64() {
+		return NewUintFastVal(value.Num().Uint64())
+	}
+	return NewDecimalFastVal(value)
+}
+
+func genericFastValIntOp(val FastVal, op intToIntOp, overflowOp decimalToDecimalOp) FastVal {
 	intVal, valid := val.AsInt()
 	if valid && val.IsNumeric() {
-		return NewIntFastVal(op(intVal))
+		result, fits := op(intVal)
+		if fits {
+			return NewIntFastVal(result)
+		}
 	}
 
+	decimalVal, valid := val.AsDecimal()
+	if val.IsNumeric() && valid && decimalVal.IsInt() {
+		return newIntegerFastVal(overflowOp(decimalVal))
+	}
 	return NewInvalidFastVal()
 }
 
@@ -215,10 +363,16 @@ func FastValMathLog(val FastVal) FastVal {
 }
 
 func FastValMathCeil(val FastVal) FastVal {
+	if val.IsDecimal() {
+		return NewDecimalFastVal(decimalCeil(val.GetDecimal()))
+	}
 	return genericFastValFloatOp(val, math.Ceil)
 }
 
 func FastValMathFloor(val FastVal) FastVal {
+	if val.IsDecimal() {
+		return NewDecimalFastVal(decimalFloor(val.GetDecimal()))
+	}
 	return genericFastValFloatOp(val, math.Floor)
 }
 
@@ -238,7 +392,12 @@ func FastValMathRadians(val FastVal) FastVal {
 	return genericFastValFloatOp(val, mathRadiansFunc)
 }
 
-func fastValMathAddMultSharedLogic(val, val1 FastVal, intOp int2ToIntOp, uintOp uint2ToUintOp, floatOp float2ToFloatOp) FastVal {
+func fastValMathAddMultSharedLogic(val, val1 FastVal, intOp int2ToIntOp, uintOp uint2ToUintOp, floatOp float2ToFloatOp,
+	decimalOp decimal2ToDecimalOp) FastVal {
+	if val.IsDecimal() || val1.IsDecimal() {
+		return genericFastVal2DecimalsOp(val, val1, decimalOp, floatOp)
+	}
+
 	switch val.dataType {
 	case UintValue:
 		fallthrough
@@ -247,7 +406,7 @@ func fastValMathAddMultSharedLogic(val, val1 FastVal, intOp int2ToIntOp, uintOp
 		case UintValue:
 			fallthrough
 		case JsonUintValue:
-			return genericFastVal2UintsOp(val, val1, uintOp)
+			return genericFastVal2UintsOp(val, val1, uintOp, decimalOp)
 		case IntValue:
 			fallthrough
 		case JsonIntValue:
@@ -256,13 +415,9 @@ func fastValMathAddMultSharedLogic(val, val1 FastVal, intOp int2ToIntOp, uintOp
 				return NewInvalidFastVal()
 			}
 			if intCheck >= 0 {
-				return genericFastVal2UintsOp(val, val1, uintOp)
+				return genericFastVal2UintsOp(val, val1, uintOp, decimalOp)
 			} else {
-				uintCheck, valid1 := val.AsUint()
-				if !valid1 || uintCheck > math.MaxInt64 {
-					return NewInvalidFastVal()
-				}
-				return genericFastVal2IntsOp(val, val1, intOp)
+				return genericFastVal2IntsOp(val, val1, intOp, decimalOp)
 			}
 		case FloatValue:
 			fallthrough
@@ -283,18 +438,14 @@ func fastValMathAddMultSharedLogic(val, val1 FastVal, intOp int2ToIntOp, uintOp
 				return NewInvalidFastVal()
 			}
 			if intCheck >= 0 {
-				return genericFastVal2UintsOp(val, val1, uintOp)
+				return genericFastVal2UintsOp(val, val1, uintOp, decimalOp)
 			} else {
-				uint1Check, valid1 := val1.AsUint()
-				if !valid1 || uint1Check > math.MaxInt64 {
-					return NewInvalidFastVal()
-				}
-				return genericFastVal2IntsOp(val, val1, intOp)
+				return genericFastVal2IntsOp(val, val1, intOp, decimalOp)
 			}
 		case IntValue:
 			fallthrough
 		case JsonIntValue:
-			return genericFastVal2IntsOp(val, val1, intOp)
+			return genericFastVal2IntsOp(val, val1, intOp, decimalOp)
 		case FloatValue:
 			fallthrough
 		case JsonFloatValue:
@@ -312,14 +463,20 @@ func fastValMathAddMultSharedLogic(val, val1 FastVal, intOp int2ToIntOp, uintOp
 }
 
 func FastValMathAdd(val, val1 FastVal) FastVal {
-	return fastValMathAddMultSharedLogic(val, val1, fastValMathAddInt, fastValMathAddUint, fastValMathAdd)
+	return fastValMathAddMultSharedLogic(val, val1, fastValMathAddInt, fastValMathAddUint, fastValMathAdd,
+		fastValMathAddDecimal)
 }
 
 func FastValMathMul(val, val1 FastVal) FastVal {
-	return fastValMathAddMultSharedLogic(val, val1, fastValMathMultInt, fastValMathMultUint, fastValMathMult)
+	return fastValMathAddMultSharedLogic(val, val1, fastValMathMultInt, fastValMathMultUint, fastValMathMult,
+		fastValMathMultDecimal)
 }
 
 func FastValMathSub(val, val1 FastVal) FastVal {
+	if val.IsDecimal() || val1.IsDecimal() {
+		return genericFastVal2DecimalsOp(val, val1, fastValMathSubDecimal, fastValMathSub)
+	}
+
 	switch val.dataType {
 	case UintValue:
 		fallthrough
@@ -334,10 +491,10 @@ func FastValMathSub(val, val1 FastVal) FastVal {
 				return NewInvalidFastVal()
 			}
 			if uintCheck >= uint1Check {
-				return genericFastVal2UintsOp(val, val1, fastValMathSubUint)
+				return genericFastVal2UintsOp(val, val1, fastValMathSubUint, fastValMathSubDecimal)
 			} else {
 				// Negative result
-				return genericFastVal2IntsOp(val, val1, fastValMathSubInt)
+				return genericFastVal2IntsOp(val, val1, fastValMathSubInt, fastValMathSubDecimal)
 			}
 		case IntValue:
 			fallthrough
@@ -354,14 +511,14 @@ func FastValMathSub(val, val1 FastVal) FastVal {
 				}
 				if int1AsUint > uintCheck {
 					// Result will be negative
-					return genericFastVal2IntsOp(val, val1, fastValMathSubInt)
+					return genericFastVal2IntsOp(val, val1, fastValMathSubInt, fastValMathSubDecimal)
 				} else {
-					return genericFastVal2UintsOp(val, val1, fastValMathSubUint)
+					return genericFastVal2UintsOp(val, val1, fastValMathSubUint, fastValMathSubDecimal)
 				}
 			} else {
 				// Subtracting a neg int == adding int to uint to be prevent potential overflow
-				positiveIntFastVal := NewIntFastVal(fastValNegateInt(int1Check))
-				return genericFastVal2UintsOp(val, positiveIntFastVal, fastValMathAddUint)
+				positiveUintFastVal := NewUintFastVal(uint64(-(int1Check + 1)) + 1)
+				return genericFastVal2UintsOp(val, positiveUintFastVal, fastValMathAddUint, fastValMathAddDecimal)
 			}
 		case FloatValue:
 			fallthrough
@@ -383,25 +540,25 @@ func FastValMathSub(val, val1 FastVal) FastVal {
 				return NewInvalidFastVal()
 			}
 			if uint1Check > math.MaxInt64 {
-				// Instead of invalid - best effort and let float take care of it
-				return genericFastVal2FloatsOp(val, val1, fastValMathSub)
+				// The result may not fit an int64, which is checked for here
+				return genericFastVal2IntsOp(val, val1, fastValMathSubInt, fastValMathSubDecimal)
 			}
 			if intCheck >= 0 {
 				uint1AsInt, _ := val1.AsInt()
 				if intCheck > uint1AsInt {
 					// positive result
-					return genericFastVal2UintsOp(val, val1, fastValMathSubUint)
+					return genericFastVal2UintsOp(val, val1, fastValMathSubUint, fastValMathSubDecimal)
 				} else {
-					return genericFastVal2IntsOp(val, val1, fastValMathSubInt)
+					return genericFastVal2IntsOp(val, val1, fastValMathSubInt, fastValMathSubDecimal)
 				}
 			} else {
 				// Result will be negative
-				return genericFastVal2IntsOp(val, val1, fastValMathSubInt)
+				return genericFastVal2IntsOp(val, val1, fastValMathSubInt, fastValMathSubDecimal)
 			}
 		case IntValue:
 			fallthrough
 		case JsonIntValue:
-			return genericFastVal2IntsOp(val, val1, fastValMathSubInt)
+			return genericFastVal2IntsOp(val, val1, fastValMathSubInt, fastValMathSubDecimal)
 		case FloatValue:
 			fallthrough
 		case JsonFloatValue:
@@ -418,7 +575,42 @@ func FastValMathSub(val, val1 FastVal) FastVal {
 	}
 }
 
+// fastValIsZero checks for a numeric zero, which cannot be divided by.
+func fastValIsZero(val FastVal) bool {
+	if val.IsDecimal() {
+		return val.GetDecimal().Sign() == 0
+	}
+	floatVal, valid := val.AsFloat()
+	return val.IsNumeric() && valid && floatVal == 0
+}
+
+// checkFastValMath returns the error which strict matching reports for a
+// function, given the parameters and result of calling it.  Results which
+// were promoted to decimals from integer parameters have overflowed.
+func checkFastValMath(funcName string, params []FastVal, result FastVal) error {
+	if (funcName == MathFuncDiv || funcName == MathFuncMod) && fastValIsZero(params[1]) {
+		return ErrorDivisionByZero
+	}
+
+	if !result.IsDecimal() {
+		return nil
+	}
+	for _, param := range params {
+		if !param.IsIntegral() {
+			return nil
+		}
+	}
+	return ErrorIntegerOverflow
+}
+
 func FastValMathDiv(val, val1 FastVal) FastVal {
+	if val.IsNumeric() && fastValIsZero(val1) {
+		// As in N1QL, dividing by zero gives null rather than an error
+		return NewNullFastVal()
+	} else if val.IsDecimal() || val1.IsDecimal() {
+		return genericFastVal2DecimalsOp(val, val1, fastValMathDivDecimal, fastValMathDiv)
+	}
+
 	switch val.dataType {
 	case UintValue:
 		fallthrough
@@ -427,21 +619,17 @@ func FastValMathDiv(val, val1 FastVal) FastVal {
 		case UintValue:
 			fallthrough
 		case JsonUintValue:
-			val1Check, valid := val1.AsUint()
-			if !valid || val1Check == 0 {
-				return NewInvalidFastVal()
-			}
-			return genericFastVal2UintsOp(val, val1, fastValMathDivUint)
+			return genericFastVal2UintsOp(val, val1, fastValMathDivUint, fastValMathDivIntDecimal)
 		case IntValue:
 			fallthrough
 		case JsonIntValue:
 			int1Check, valid1 := val1.AsInt()
-			if !valid1 || int1Check == 0 {
+			if !valid1 {
 				return NewInvalidFastVal()
 			} else if int1Check > 0 {
-				return genericFastVal2UintsOp(val, val1, fastValMathDivUint)
+				return genericFastVal2UintsOp(val, val1, fastValMathDivUint, fastValMathDivIntDecimal)
 			} else {
-				return genericFastVal2IntsOp(val, val1, fastValMathDivInt)
+				return genericFastVal2IntsOp(val, val1, fastValMathDivInt, fastValMathDivIntDecimal)
 			}
 		case FloatValue:
 			fallthrough
@@ -461,21 +649,15 @@ func FastValMathDiv(val, val1 FastVal) FastVal {
 		case UintValue:
 			fallthrough
 		case JsonUintValue:
-			uint1Check, valid1 := val1.AsUint()
-			if !valid1 || intCheck < 0 && uint1Check > math.MaxInt64 {
-				// Cannot convert to int type
-				return genericFastVal2FloatsOp(val, val1, fastValMathDiv)
+			if intCheck >= 0 {
+				return genericFastVal2UintsOp(val, val1, fastValMathDivUint, fastValMathDivIntDecimal)
 			} else {
-				if intCheck >= 0 {
-					return genericFastVal2UintsOp(val, val1, fastValMathDivUint)
-				} else {
-					return genericFastVal2IntsOp(val, val1, fastValMathDivInt)
-				}
+				return genericFastVal2IntsOp(val, val1, fastValMathDivInt, fastValMathDivIntDecimal)
 			}
 		case IntValue:
 			fallthrough
 		case JsonIntValue:
-			return genericFastVal2IntsOp(val, val1, fastValMathDivInt)
+			return genericFastVal2IntsOp(val, val1, fastValMathDivInt, fastValMathDivIntDecimal)
 		case FloatValue:
 			fallthrough
 		case JsonFloatValue:
@@ -493,6 +675,18 @@ func FastValMathDiv(val, val1 FastVal) FastVal {
 }
 
 func FastValMathMod(val, val1 FastVal) FastVal {
+	if val.IsNumeric() && fastValIsZero(val1) {
+		return NewNullFastVal()
+	} else if val.IsDecimal() || val1.IsDecimal() {
+		// Like the other numeric types, only integers have a modulo
+		valDecimal, valid := val.AsDecimal()
+		val1Decimal, valid1 := val1.AsDecimal()
+		if !valid || !valid1 || !valDecimal.IsInt() || !val1Decimal.IsInt() || val.IsFloat() || val1.IsFloat() {
+			return NewInvalidFastVal()
+		}
+		return genericFastVal2DecimalsOp(val, val1, fastValMathModDecimal, nil)
+	}
+
 	switch val.dataType {
 	case UintValue:
 		fallthrough
@@ -501,21 +695,17 @@ func FastValMathMod(val, val1 FastVal) FastVal {
 		case UintValue:
 			fallthrough
 		case JsonUintValue:
-			val1Check, valid := val1.AsUint()
-			if !valid || val1Check == 0 {
-				return NewInvalidFastVal()
-			}
-			return genericFastVal2UintsOp(val, val1, fastValMathModUint)
+			return genericFastVal2UintsOp(val, val1, fastValMathModUint, fastValMathModDecimal)
 		case IntValue:
 			fallthrough
 		case JsonIntValue:
 			int1Check, valid1 := val1.AsInt()
-			if !valid1 || int1Check == 0 {
+			if !valid1 {
 				return NewInvalidFastVal()
 			} else if int1Check > 0 {
-				return genericFastVal2UintsOp(val, val1, fastValMathModUint)
+				return genericFastVal2UintsOp(val, val1, fastValMathModUint, fastValMathModDecimal)
 			} else {
-				return genericFastVal2IntsOp(val, val1, fastValMathMod)
+				return genericFastVal2IntsOp(val, val1, fastValMathMod, fastValMathModDecimal)
 			}
 		default:
 			return NewInvalidFastVal()
@@ -531,21 +721,15 @@ func FastValMathMod(val, val1 FastVal) FastVal {
 		case UintValue:
 			fallthrough
 		case JsonUintValue:
-			uint1Check, valid1 := val1.AsUint()
-			if !valid1 || intCheck < 0 && uint1Check > math.MaxInt64 {
-				// Cannot convert to int type
-				return NewInvalidFastVal()
+			if intCheck >= 0 {
+				return genericFastVal2UintsOp(val, val1, fastValMathModUint, fastValMathModDecimal)
 			} else {
-				if intCheck >= 0 {
-					return genericFastVal2UintsOp(val, val1, fastValMathModUint)
-				} else {
-					return genericFastVal2IntsOp(val, val1, fastValMathMod)
-				}
+				return genericFastVal2IntsOp(val, val1, fastValMathMod, fastValMathModDecimal)
 			}
 		case IntValue:
 			fallthrough
 		case JsonIntValue:
-			return genericFastVal2IntsOp(val, val1, fastValMathMod)
+			return genericFastVal2IntsOp(val, val1, fastValMathMod, fastValMathModDecimal)
 		default:
 			return NewInvalidFastVal()
 		}
@@ -556,18 +740,16 @@ func FastValMathMod(val, val1 FastVal) FastVal {
 
 func FastValMathNeg(val FastVal) FastVal {
 	switch val.dataType {
+	case DecimalValue:
+		return NewDecimalFastVal(fastValNegateDecimal(val.GetDecimal()))
 	case UintValue:
 		fallthrough
 	case JsonUintValue:
-		checkUint, _ := val.AsUint()
-		if checkUint > math.MaxInt64 {
-			return NewInvalidFastVal()
-		}
 		fallthrough
 	case IntValue:
 		fallthrough
 	case JsonIntValue:
-		return genericFastValIntOp(val, fastValNegateInt)
+		return genericFastValIntOp(val, fastValNegateInt, fastValNegateDecimal)
 	case FloatValue:
 		fallthrough
 	case JsonFloatValue:
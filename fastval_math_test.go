@@ -0,0 +1,101 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFastValMathOverflow(t *testing.T) {
+	assert := assert.New(t)
+
+	maxInt := NewIntFastVal(math.MaxInt64)
+	minInt := NewIntFastVal(math.MinInt64)
+	maxUint := NewUintFastVal(math.MaxUint64)
+
+	assert.Equal("(decimal)27670116110564327422", FastValMathAdd(maxInt, maxUint).String())
+	assert.Equal("(decimal)-9223372036854775809", FastValMathSub(minInt, NewIntFastVal(1)).String())
+	assert.Equal("(decimal)18446744073709551616", FastValMathAdd(maxUint, NewUintFastVal(1)).String())
+	assert.Equal("(decimal)-18446744073709551614", FastValMathSub(NewIntFastVal(1), maxUint).String())
+	assert.Equal("(decimal)-18446744073709551615", FastValMathMul(maxUint, NewIntFastVal(-1)).String())
+	assert.Equal("(decimal)36893488147419103230", FastValMathMul(maxUint, NewJsonUintFastVal([]byte("2"))).String())
+
+	// Results which fit are still integers, even when the operands needed
+	// decimals to calculate them
+	assert.Equal("(uint)9223372036854775808", FastValMathAdd(maxInt, NewIntFastVal(1)).String())
+	assert.Equal("(uint)9223372036854775808", FastValMathDiv(minInt, NewIntFastVal(-1)).String())
+	assert.Equal("(uint)9223372036854775808", FastValMathNeg(minInt).String())
+	assert.Equal("(uint)9223372036854775808", FastValMathAbs(minInt).String())
+	assert.Equal("(int)-9223372036854775807", FastValMathMul(maxInt, NewIntFastVal(-1)).String())
+	assert.Equal("(uint)18446744073709551614", FastValMathAdd(maxUint, NewIntFastVal(-1)).String())
+	assert.Equal("(int)-9223372036854775808", FastValMathNeg(NewUintFastVal(1<<63)).String())
+	assert.Equal("(int)-1", FastValMathMod(NewIntFastVal(-1), maxUint).String())
+	assert.Equal("(int)9223372036854775806", FastValMathAbs(NewIntFastVal(-math.MaxInt64+1)).String())
+}
+
+func TestFastValMathDivideByZero(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(NullValue, FastValMathDiv(NewIntFastVal(1), NewIntFastVal(0)).Type())
+	assert.Equal(NullValue, FastValMathDiv(NewUintFastVal(1), NewJsonIntFastVal([]byte("0"))).Type())
+	assert.Equal(NullValue, FastValMathDiv(NewFloatFastVal(1.5), NewFloatFastVal(0)).Type())
+	assert.Equal(NullValue, FastValMathMod(NewIntFastVal(1), NewUintFastVal(0)).Type())
+	assert.Equal(InvalidValue, FastValMathDiv(NewStringFastVal("1"), NewIntFastVal(0)).Type())
+
+	assert.Equal(ErrorDivisionByZero,
+		checkFastValMath(MathFuncDiv, []FastVal{NewIntFastVal(1), NewIntFastVal(0)}, NewNullFastVal()))
+	assert.Equal(ErrorIntegerOverflow,
+		checkFastValMath(MathFuncAdd, []FastVal{NewUintFastVal(math.MaxUint64), NewIntFastVal(1)},
+			FastValMathAdd(NewUintFastVal(math.MaxUint64), NewIntFastVal(1))))
+	assert.Nil(checkFastValMath(MathFuncMul, []FastVal{NewFloatFastVal(2), NewIntFastVal(2)}, NewFloatFastVal(4)))
+}
+
+func TestMatchStrictMath(t *testing.T) {
+	assert := assert.New(t)
+
+	doc := []byte(`{"count": 9223372036854775807, "min": -9223372036854775808, "zero": 0}`)
+	tests := []struct {
+		filter  string
+		matched bool
+		err     error
+	}{
+		{`count + 1 > count`, true, nil},
+		{`count * 4 = 36893488147419103228`, true, ErrorIntegerOverflow},
+		{`min - 1 < min`, true, ErrorIntegerOverflow},
+		{`count / zero IS NULL`, true, ErrorDivisionByZero},
+		{`count / zero = 1`, false, ErrorDivisionByZero},
+		{`count % 10 = 7`, true, nil},
+	}
+
+	for _, test := range tests {
+		_, fe, err := NewBoundedFilterExpressionParser(test.filter)
+		if !assert.Nil(err, test.filter) {
+			continue
+		}
+		expr, err := fe.OutputExpression()
+		assert.Nil(err, test.filter)
+
+		var trans Transformer
+		def := trans.Transform([]Expression{expr})
+		matched, err := NewFastMatcher(def).Match(doc)
+		assert.Nil(err, test.filter)
+		assert.Equal(test.matched, matched, test.filter)
+
+		def.StrictMath = true
+		_, err = NewFastMatcher(def).Match(doc)
+		assert.Equal(test.err, err, test.filter)
+
+		slow := NewSlowMatcher([]Expression{expr})
+		matched, err = slow.Match(doc)
+		assert.Nil(err, test.filter)
+		assert.Equal(test.matched, matched, test.filter)
+
+		slow = NewSlowMatcher([]Expression{expr})
+		slow.StrictMath = true
+		_, err = slow.Match(doc)
+		assert.Equal(test.err, err, test.filter)
+	}
+}
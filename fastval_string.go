@@ -0,0 +1,207 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+	"unsafe"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Collation selects how strings are compared with each other.  It is
+// applied to a value with CollateFunc, and is used for any comparison
+// between that value and another string.
+type Collation int
+
+const (
+	// CollationBinary compares strings byte by byte.  This is how strings
+	// are compared when no collation has been given.
+	CollationBinary Collation = iota
+
+	// CollationNFC compares strings in Unicode Normalization Form C, so
+	// that precomposed characters equal their decomposed forms.
+	CollationNFC
+
+	// CollationNFKC compares strings in Unicode Normalization Form KC,
+	// which also equates compatibility characters such as ligatures and
+	// full width letters with their plain forms.
+	CollationNFKC
+
+	// CollationNoCase compares strings as CollationNFC does, but ignores
+	// differences in case using Unicode's locale independent case folding.
+	CollationNoCase
+
+	// CollationNFKCNoCase compares strings as CollationNFKC does, but
+	// ignores differences in case.
+	CollationNFKCNoCase
+)
+
+var collationNames = map[Collation]string{
+	CollationBinary:     "binary",
+	CollationNFC:        "nfc",
+	CollationNFKC:       "nfkc",
+	CollationNoCase:     "nocase",
+	CollationNFKCNoCase: "nfkc_nocase",
+}
+
+func (collation Collation) String() string {
+	if name, ok := collationNames[collation]; ok {
+		return name
+	}
+	return "??unknown??"
+}
+
+// ParseCollation returns the collation with the given name, ignoring case.
+func ParseCollation(name string) (Collation, error) {
+	for collation, collationName := range collationNames {
+		if strings.EqualFold(name, collationName) {
+			return collation, nil
+		}
+	}
+	return CollationBinary, fmt.Errorf("Invalid collation specified: %v", name)
+}
+
+func (collation Collation) foldsCase() bool {
+	return collation == CollationNoCase || collation == CollationNFKCNoCase
+}
+
+// key returns the form of a string which is compared byte by byte under
+// the collation.
+func (collation Collation) key(str string) string {
+	form := norm.NFC
+	if collation == CollationNFKC || collation == CollationNFKCNoCase {
+		form = norm.NFKC
+	}
+
+	str = form.String(str)
+	if collation.foldsCase() {
+		// Folding can leave a string which is no longer normalized
+		str = form.String(cases.Fold().String(str))
+	}
+	return str
+}
+
+func isASCII(str string) bool {
+	for i := 0; i < len(str); i++ {
+		if str[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func foldASCII(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
+
+// compareCollated compares two strings under a collation.  ASCII strings
+// are already normalized, and fold by lowering their case, so these are
+// compared in place.
+func compareCollated(lhs, rhs string, collation Collation) int {
+	if collation == CollationBinary {
+		return strings.Compare(lhs, rhs)
+	} else if !isASCII(lhs) || !isASCII(rhs) {
+		return strings.Compare(collation.key(lhs), collation.key(rhs))
+	} else if !collation.foldsCase() {
+		return strings.Compare(lhs, rhs)
+	}
+
+	for i := 0; i < len(lhs) && i < len(rhs); i++ {
+		lhsChar := foldASCII(lhs[i])
+		rhsChar := foldASCII(rhs[i])
+		if lhsChar < rhsChar {
+			return -1
+		} else if lhsChar > rhsChar {
+			return 1
+		}
+	}
+
+	if len(lhs) < len(rhs) {
+		return -1
+	} else if len(lhs) > len(rhs) {
+		return 1
+	}
+	return 0
+}
+
+// stringData returns the unescaped contents of a string value.  Strings
+// which are held as bytes are returned without being copied, so the result
+// must not be kept beyond the life of the value.
+func (val FastVal) stringData() string {
+	switch val.dataType {
+	case StringValue:
+		return val.data.(string)
+	case JsonStringValue:
+		unescaped, _ := unescapeJsonString(val.sliceData, nil)
+		return *(*string)(unsafe.Pointer(&unescaped))
+	}
+	return *(*string)(unsafe.Pointer(&val.sliceData))
+}
+
+// stringCollation returns the collation to use when comparing two strings,
+// preferring the collation of val where both have one.
+func (val FastVal) stringCollation(other FastVal) Collation {
+	if val.collation != CollationBinary {
+		return val.collation
+	}
+	return other.collation
+}
+
+// FastValCollateFunc returns a value which is compared with other strings
+// under the collation named by name.
+func FastValCollateFunc(val, name FastVal) FastVal {
+	if !name.IsString() {
+		return NewInvalidFastVal()
+	}
+
+	collation, err := ParseCollation(name.stringData())
+	if err != nil {
+		return NewInvalidFastVal()
+	}
+
+	val.collation = collation
+	return val
+}
+
+// FastValLowerFunc converts a string to lower case using Unicode's locale
+// independent case mappings, or returns null for anything else.
+func FastValLowerFunc(val FastVal) FastVal {
+	return fastValChangeCase(val, 'A', 'Z', strings.ToLower)
+}
+
+// FastValUpperFunc converts a string to upper case using Unicode's locale
+// independent case mappings, or returns null for anything else.
+func FastValUpperFunc(val FastVal) FastVal {
+	return fastValChangeCase(val, 'a', 'z', strings.ToUpper)
+}
+
+// fastValChangeCase applies a case mapping to a string value.  ASCII
+// strings with no characters between first and last are left untouched.
+func fastValChangeCase(val FastVal, first, last byte, mapping func(string) string) FastVal {
+	if !val.IsString() {
+		return NewNullFastVal()
+	}
+
+	str := val.stringData()
+	unchanged := true
+	for i := 0; i < len(str); i++ {
+		if str[i] >= utf8.RuneSelf || (str[i] >= first && str[i] <= last) {
+			unchanged = false
+			break
+		}
+	}
+	if unchanged {
+		return val
+	}
+
+	result := NewStringFastVal(mapping(str))
+	result.collation = val.collation
+	return result
+}
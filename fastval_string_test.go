@@ -0,0 +1,111 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareCollated(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NotEqual(0, compareCollated("café", "café", CollationBinary))
+	assert.Equal(0, compareCollated("café", "café", CollationNFC))
+	assert.NotEqual(0, compareCollated("ﬁle", "file", CollationNFC))
+	assert.Equal(0, compareCollated("ﬁle", "file", CollationNFKC))
+	assert.Equal(0, compareCollated("ＡＢ", "ab", CollationNFKCNoCase))
+	assert.Equal(0, compareCollated("STRASSE", "straße", CollationNoCase))
+	assert.Equal(0, compareCollated("Äpfel", "äpfel", CollationNoCase))
+	assert.Equal(-1, compareCollated("abc", "ABD", CollationNoCase))
+	assert.Equal(1, compareCollated("abc", "ABD", CollationNFC))
+	assert.Equal(-1, compareCollated("ab", "ABC", CollationNoCase))
+
+	collation, err := ParseCollation("NFKC_NoCase")
+	assert.Nil(err)
+	assert.Equal(CollationNFKCNoCase, collation)
+	_, err = ParseCollation("bogus")
+	assert.NotNil(err)
+}
+
+func TestFastValStringFuncs(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("(string)école", FastValLowerFunc(NewBinStringFastVal([]byte("ÉCOLE"))).String())
+	assert.Equal("(string)ÇA VA", FastValUpperFunc(NewStringFastVal("ça va")).String())
+	assert.Equal("(string)tab\t", FastValLowerFunc(NewJsonStringFastVal([]byte(`TAB\t`))).String())
+	assert.Equal(BinStringValue, FastValLowerFunc(NewBinStringFastVal([]byte("abc"))).Type())
+	assert.Equal(NullValue, FastValUpperFunc(NewIntFastVal(1)).Type())
+
+	collated := FastValCollateFunc(NewBinStringFastVal([]byte("ABC")), NewStringFastVal("nocase"))
+	equals, valid := collated.Equals(NewStringFastVal("abc"))
+	assert.True(valid)
+	assert.True(equals)
+	equals, _ = NewStringFastVal("abc").Equals(collated)
+	assert.True(equals)
+	assert.Equal(InvalidValue, FastValCollateFunc(collated, NewStringFastVal("bogus")).Type())
+}
+
+func TestFastValStringAllocs(t *testing.T) {
+	assert := assert.New(t)
+
+	lhs := FastValCollateFunc(NewBinStringFastVal([]byte("Hello World")), NewStringFastVal("nocase"))
+	rhs := NewBinStringFastVal([]byte("hello WORLD"))
+	lower := NewBinStringFastVal([]byte("hello world"))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		lhs.Equals(rhs)
+		FastValLowerFunc(lower)
+	})
+	assert.Equal(0.0, allocs)
+}
+
+func TestMatchStringCollation(t *testing.T) {
+	assert := assert.New(t)
+
+	doc := []byte(`{"name": "Ça Va", "city": "MÜNCHEN", "word": "\ufb01le"}`)
+	tests := []struct {
+		filter  string
+		matched bool
+	}{
+		{`LOWER(name) = "ça va"`, true},
+		{`UPPER(name) = "ÇA VA"`, true},
+		{`name = "ça va"`, false},
+		{`COLLATE(city, "nocase") = "münchen"`, true},
+		{`COLLATE(city, "binary") = "münchen"`, false},
+		{`COLLATE(city, "nocase") > "MUNCHEN"`, true},
+		{`COLLATE(word, "nfkc") = "file"`, true},
+		{`COLLATE(word, "nfc") = "file"`, false},
+	}
+
+	for _, test := range tests {
+		_, fe, err := NewBoundedFilterExpressionParser(test.filter)
+		if !assert.Nil(err, test.filter) {
+			continue
+		}
+		expr, err := fe.OutputExpression()
+		if !assert.Nil(err, test.filter) {
+			continue
+		}
+
+		var trans Transformer
+		matched, err := NewFastMatcher(trans.Transform([]Expression{expr})).Match(doc)
+		assert.Nil(err, test.filter)
+		assert.Equal(test.matched, matched, test.filter)
+
+		matched, err = NewSlowMatcher([]Expression{expr}).Match(doc)
+		assert.Nil(err, test.filter)
+		assert.Equal(test.matched, matched, test.filter)
+	}
+
+	_, fe, err := NewBoundedFilterExpressionParser(`COLLATE(city, "bogus") = "x"`)
+	if assert.Nil(err) {
+		_, err = fe.OutputExpression()
+		assert.NotNil(err)
+	}
+
+	where, _, err := EmitSQL(EqualsExpr{FuncExpr{LowerFunc, []Expression{FieldExpr{Path: []string{"city"}}}}, ValueExpr{"x"}}, SQLOptions{})
+	assert.Nil(err)
+	assert.Equal("LOWER(`city`) = $1", where)
+}
@@ -0,0 +1,66 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+// FastValTypeFunc returns the name of the JSON type of a value, using the
+// names N1QL's TYPE() does.
+func FastValTypeFunc(val FastVal) FastVal {
+	switch {
+	case val.IsNull():
+		return NewStringFastVal("null")
+	case val.IsBoolean():
+		return NewStringFastVal("boolean")
+	case val.IsNumeric():
+		return NewStringFastVal("number")
+	case val.IsString(), val.IsTime():
+		return NewStringFastVal("string")
+	case val.IsBinary():
+		return NewStringFastVal("binary")
+	}
+
+	switch val.Type() {
+	case ArrayValue:
+		return NewStringFastVal("array")
+	case ObjectValue:
+		return NewStringFastVal("object")
+	}
+	return NewMissingFastVal()
+}
+
+// FastValArrayLengthFunc returns the number of elements in an array, or
+// null for anything which is not an array.
+func FastValArrayLengthFunc(val FastVal) FastVal {
+	if val.Type() != ArrayValue {
+		return NewNullFastVal()
+	}
+
+	var tokens jsonTokenizer
+	tokens.Reset(val.sliceData)
+
+	length := 0
+	depth := 0
+	for {
+		token, _, _, err := tokens.Step()
+		if err != nil || token == tknEnd {
+			return NewNullFastVal()
+		}
+
+		switch token {
+		case tknArrayStart, tknObjectStart:
+			depth++
+			if depth == 2 {
+				length++
+			}
+		case tknArrayEnd, tknObjectEnd:
+			depth--
+			if depth == 0 {
+				return NewIntFastVal(int64(length))
+			}
+		case tknListDelim, tknObjectKeyDelim:
+		default:
+			if depth == 1 {
+				length++
+			}
+		}
+	}
+}
@@ -0,0 +1,895 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+// DefaultFilterExpressionMaxDepth is the MaxDepth of a FilterExpressionParser
+// which does not set one.
+const DefaultFilterExpressionMaxDepth = 128
+
+// The parser backtracks between alternatives, so the total number of token
+// matches it may attempt is limited to this many per token of input.
+const filterExprMaxStepsPerToken = 1000
+
+var ErrorFilterExpressionTooDeep error = fmt.Errorf("Error: Expression is nested too deeply")
+var ErrorFilterExpressionTooComplex error = fmt.Errorf("Error: Expression is too complex to parse")
+
+// FilterExpressionParser is a recursive descent parser for the grammar
+// described at the top of filterExprParser.go.  Alternatives are tried in
+// the order in which they are listed in the grammar and the first which
+// matches is used, so the FE* structs it produces are the same ones that
+// the grammar describes.
+type FilterExpressionParser struct {
+	// MaxDepth limits how deeply parenthesis, NOT conditions and function
+	// calls may be nested within a filter expression.
+	MaxDepth int
+
+	// simpleSyntax also accepts the spellings of the simple syntax which
+	// the grammar lacks: && and || for AND and OR, and the postfix
+	// NOT LIKE and EXISTS operators.
+	simpleSyntax bool
+}
+
+// feAbort is raised to abandon parsing entirely, rather than backtracking
+// and trying any remaining alternatives.
+type feAbort struct {
+	err *ParseError
+}
+
+type feParser struct {
+	expression string
+	tokens     []lexer.Token
+	pos        int
+	depth      int
+	maxDepth   int
+	steps      int
+	maxSteps   int
+
+	simpleSyntax bool
+
+	// The furthest token which failed to match, and what was expected
+	// there, for reporting errors.
+	furthest int
+	expected []string
+}
+
+func feBool() *bool {
+	value := true
+	return &value
+}
+
+func (p *feParser) token() lexer.Token {
+	return p.tokens[p.pos]
+}
+
+func (p *feParser) abort(err error) {
+	token := p.token()
+	panic(feAbort{newParseError(p.expression, token.Pos.Offset, token.Value, nil, err)})
+}
+
+func (p *feParser) expect(expected string) {
+	p.steps++
+	if p.steps > p.maxSteps {
+		p.abort(ErrorFilterExpressionTooComplex)
+	}
+
+	if p.pos > p.furthest {
+		p.furthest = p.pos
+		p.expected = nil
+	}
+	if p.pos == p.furthest {
+		for _, existing := range p.expected {
+			if existing == expected {
+				return
+			}
+		}
+		p.expected = append(p.expected, expected)
+	}
+}
+
+func (p *feParser) enter() {
+	p.depth++
+	if p.depth > p.maxDepth {
+		p.abort(ErrorFilterExpressionTooDeep)
+	}
+}
+
+func (p *feParser) leave() {
+	p.depth--
+}
+
+// literal matches a token by its value, whatever its type.
+func (p *feParser) literal(value string) bool {
+	if token := p.token(); !token.EOF() && token.Value == value {
+		p.pos++
+		return true
+	}
+	p.expect(value)
+	return false
+}
+
+// ref matches a token of a specific type, returning its value.
+func (p *feParser) ref(tokenType rune) (string, bool) {
+	if token := p.token(); token.Type == tokenType {
+		p.pos++
+		return token.Value, true
+	}
+	p.expect("<" + strings.ToLower(scanner.TokenString(tokenType)) + ">")
+	return "", false
+}
+
+// symbol matches an operator of the simple syntax which is lexed as a
+// token per character, such as &&, requiring the characters to be adjacent.
+func (p *feParser) symbol(value string) bool {
+	start := p.pos
+	for i, char := range value {
+		token := p.token()
+		if token.EOF() || token.Value != string(char) ||
+			(i > 0 && token.Pos.Offset != p.tokens[p.pos-1].Pos.Offset+1) {
+			p.pos = start
+			p.expect(value)
+			return false
+		}
+		p.pos++
+	}
+	return true
+}
+
+// keyword matches a keyword of the grammar, or the symbol the simple
+// syntax spells it with when that is also accepted.
+func (p *feParser) keyword(word, symbol string) bool {
+	return p.literal(word) || (p.simpleSyntax && p.symbol(symbol))
+}
+
+func (p *feParser) mathNeg() *bool {
+	var mathNeg *bool
+	for p.literal("-") {
+		mathNeg = feBool()
+	}
+	return mathNeg
+}
+
+func (p *feParser) parseFilterExpression() (*FilterExpression, bool) {
+	expr, ok := p.parseInnerExpression()
+	if !ok {
+		return nil, false
+	}
+	return &FilterExpression{FilterExpr: expr}, true
+}
+
+func (p *feParser) parseInnerExpression() (*FEInnerExpression, bool) {
+	p.enter()
+	defer p.leave()
+
+	first, ok := p.parseInnerAndExpression()
+	if !ok {
+		return nil, false
+	}
+
+	expr := &FEInnerExpression{Expr: []*FEInnerAndExpression{first}}
+	for {
+		start := p.pos
+		if !p.keyword("OR", "||") {
+			break
+		}
+		next, ok := p.parseInnerAndExpression()
+		if !ok {
+			p.pos = start
+			break
+		}
+		expr.Expr = append(expr.Expr, next)
+	}
+	return expr, true
+}
+
+func (p *feParser) parseInnerAndExpression() (*FEInnerAndExpression, bool) {
+	pos := p.token().Pos
+	first, ok := p.parseSubExprOrTerm()
+	if !ok {
+		return nil, false
+	}
+
+	expr := &FEInnerAndExpression{Pos: pos, Expr: []*FESubExprOrTerm{first}}
+	for {
+		start := p.pos
+		if !p.keyword("AND", "&&") {
+			break
+		}
+		next, ok := p.parseSubExprOrTerm()
+		if !ok {
+			p.pos = start
+			break
+		}
+		expr.Expr = append(expr.Expr, next)
+	}
+	return expr, true
+}
+
+func (p *feParser) parseSubExprOrTerm() (*FESubExprOrTerm, bool) {
+	start := p.pos
+	if p.literal("(") {
+		if subExpr, ok := p.parseInnerExpression(); ok && p.literal(")") {
+			return &FESubExprOrTerm{SubExpr: subExpr}, true
+		}
+		p.pos = start
+	}
+
+	if cond, ok := p.parseCondition(); ok {
+		return &FESubExprOrTerm{Expr: cond}, true
+	}
+	return nil, false
+}
+
+func (p *feParser) parseCondition() (*FECondition, bool) {
+	p.enter()
+	defer p.leave()
+
+	start := p.pos
+	if p.literal("NOT") {
+		if not, ok := p.parseCondition(); ok {
+			return &FECondition{Not: not}, true
+		}
+		p.pos = start
+	}
+
+	if operand, ok := p.parseOperand(); ok {
+		return &FECondition{Operand: operand}, true
+	}
+	if p.simpleSyntax {
+		return p.parseSimpleCondition()
+	}
+	return nil, false
+}
+
+// parseSimpleCondition parses the postfix operators of the simple syntax,
+// building the same tree as their prefix equivalents in the grammar.
+func (p *feParser) parseSimpleCondition() (*FECondition, bool) {
+	start := p.pos
+	pos := p.token().Pos
+
+	if field, ok := p.parseField(); ok && p.literal("EXISTS") {
+		exists := &FEBooleanExpr{BooleanFunc: &FEBooleanFuncExpr{ExistsClause: &FEExistsClause{Field: field}}}
+		return &FECondition{Operand: &FEOperand{Pos: pos, BooleanExpr: exists}}, true
+	}
+	p.pos = start
+
+	if lhs, ok := p.parseLhs(); ok && p.literal("NOT") && p.literal("LIKE") {
+		if pattern, ok := p.ref(scanner.String); ok {
+			like := &FEOperand{Pos: pos, LHS: lhs, LikePattern: &pattern}
+			return &FECondition{Not: &FECondition{Operand: like}}, true
+		}
+	}
+	p.pos = start
+	return nil, false
+}
+
+func (p *feParser) parseOperand() (*FEOperand, bool) {
+	start := p.pos
+	pos := p.token().Pos
+
+	if boolExpr, ok := p.parseBooleanExpr(); ok {
+		return &FEOperand{Pos: pos, BooleanExpr: boolExpr}, true
+	}
+
+	lhs, ok := p.parseLhs()
+	if !ok {
+		return nil, false
+	}
+
+	opStart := p.pos
+	if p.literal("=") && p.literal("~") {
+		if regex, ok := p.ref(scanner.String); ok {
+			return &FEOperand{Pos: pos, LHS: lhs, LikeRegex: &regex}, true
+		}
+	}
+	p.pos = opStart
+
+	if op, ok := p.parseCompareOp(); ok {
+		if rhs, ok := p.parseRhs(); ok {
+			return &FEOperand{Pos: pos, LHS: lhs, Op: op, RHS: rhs}, true
+		}
+		p.pos = opStart
+	}
+
+	if p.literal("LIKE") {
+		if pattern, ok := p.ref(scanner.String); ok {
+			operand := &FEOperand{Pos: pos, LHS: lhs, LikePattern: &pattern}
+			escapeStart := p.pos
+			if p.literal("ESCAPE") {
+				if escape, ok := p.ref(scanner.String); ok {
+					operand.LikeEscape = &escape
+				} else {
+					p.pos = escapeStart
+				}
+			}
+			return operand, true
+		}
+		p.pos = opStart
+	}
+
+	if checkOp, ok := p.parseCheckOp(); ok {
+		return &FEOperand{Pos: pos, LHS: lhs, CheckOp: checkOp}, true
+	}
+
+	p.pos = start
+	return nil, false
+}
+
+func (p *feParser) parseBooleanExpr() (*FEBooleanExpr, bool) {
+	if boolean, ok := p.parseBoolean(); ok {
+		return &FEBooleanExpr{BooleanVal: boolean}, true
+	}
+	if boolFunc, ok := p.parseBooleanFuncExpr(); ok {
+		return &FEBooleanExpr{BooleanFunc: boolFunc}, true
+	}
+	return nil, false
+}
+
+func (p *feParser) parseBoolean() (*FEBoolean, bool) {
+	switch {
+	case p.literal("TRUE"):
+		return &FEBoolean{TVal: feBool()}, true
+	case p.literal("true"):
+		return &FEBoolean{TVal1: feBool()}, true
+	case p.literal("FALSE"):
+		return &FEBoolean{FVal: feBool()}, true
+	case p.literal("false"):
+		return &FEBoolean{FVal1: feBool()}, true
+	}
+	return nil, false
+}
+
+func (p *feParser) parseLhs() (*FELhs, bool) {
+	if constFunc, ok := p.parseConstFuncExpression(); ok {
+		return &FELhs{Func: constFunc}, true
+	}
+	if boolean, ok := p.parseBoolean(); ok {
+		return &FELhs{Bool: boolean}, true
+	}
+	if field, ok := p.parseFieldWithMath(); ok {
+		return &FELhs{FieldWMath: field}, true
+	}
+	if value, ok := p.parseValue(); ok {
+		return &FELhs{Value: value}, true
+	}
+	return nil, false
+}
+
+func (p *feParser) parseRhs() (*FERhs, bool) {
+	if constFunc, ok := p.parseConstFuncExpression(); ok {
+		return &FERhs{Func: constFunc}, true
+	}
+	if boolean, ok := p.parseBoolean(); ok {
+		return &FERhs{Bool: boolean}, true
+	}
+	if value, ok := p.parseValue(); ok {
+		return &FERhs{Value: value}, true
+	}
+	if field, ok := p.parseFieldWithMath(); ok {
+		return &FERhs{FieldWMath: field}, true
+	}
+	return nil, false
+}
+
+func (p *feParser) parseFieldWithMath() (*FEFieldWithMath, bool) {
+	if type0, ok := p.parseFieldWithMathType0(); ok {
+		return &FEFieldWithMath{Type0: type0}, true
+	}
+	if type1, ok := p.parseFieldWithMathType1(); ok {
+		return &FEFieldWithMath{Type1: type1}, true
+	}
+	if field, ok := p.parseField(); ok {
+		return &FEFieldWithMath{FieldOnly: field}, true
+	}
+	return nil, false
+}
+
+func (p *feParser) parseFieldWithMathType0() (*FEFieldWithMathType0, bool) {
+	start := p.pos
+	if mathValue, ok := p.parseMathValue(); ok {
+		if mathOp, ok := p.parseMathArithmeticOp(); ok {
+			if field, ok := p.parseField(); ok {
+				return &FEFieldWithMathType0{MathValue: mathValue, MathOp: mathOp, Field: field}, true
+			}
+		}
+	}
+	p.pos = start
+	return nil, false
+}
+
+func (p *feParser) parseFieldWithMathType1() (*FEFieldWithMathType1, bool) {
+	field, ok := p.parseField()
+	if !ok {
+		return nil, false
+	}
+
+	// Each further operation replaces the one before it, so only the last
+	// operator is kept along with the last value and last field used.
+	expr := &FEFieldWithMathType1{Field: field}
+	for {
+		start := p.pos
+		mathOp, ok := p.parseMathArithmeticOp()
+		if !ok {
+			break
+		}
+		if mathValue, ok := p.parseMathValue(); ok {
+			expr.MathValue = mathValue
+		} else if otherField, ok := p.parseField(); ok {
+			expr.OtherField = otherField
+		} else {
+			p.pos = start
+			break
+		}
+		expr.MathOp = mathOp
+	}
+	return expr, true
+}
+
+func (p *feParser) parseField() (*FEField, bool) {
+	start := p.pos
+	mathNeg := p.mathNeg()
+
+	first, ok := p.parseOnePath()
+	if !ok {
+		p.pos = start
+		return nil, false
+	}
+
+	field := &FEField{MathNeg: mathNeg, Path: []*FEOnePath{first}}
+	for {
+		pathStart := p.pos
+		if !p.literal(".") {
+			break
+		}
+		next, ok := p.parseOnePath()
+		if !ok {
+			p.pos = pathStart
+			break
+		}
+		field.Path = append(field.Path, next)
+	}
+	return field, true
+}
+
+func (p *feParser) parseOnePath() (*FEOnePath, bool) {
+	onePath := &FEOnePath{}
+	if pathFunc, ok := p.parseOnePathFuncExpr(); ok {
+		onePath.OnePathFunc = pathFunc
+	} else if strValue, ok := p.parseStringType(); ok {
+		onePath.StrValue = strValue
+	} else {
+		return nil, false
+	}
+
+	for {
+		start := p.pos
+		if !p.literal("[") {
+			break
+		}
+		index, ok := p.ref(scanner.Int)
+		if !ok || !p.literal("]") {
+			p.pos = start
+			break
+		}
+		onePath.ArrayIndexes = append(onePath.ArrayIndexes, &FEArrayIndex{ArrayIndex: index})
+	}
+	return onePath, true
+}
+
+func (p *feParser) parseOnePathFuncExpr() (*FEOnePathFuncExpr, bool) {
+	start := p.pos
+	if p.literal("META") && p.literal("(") && p.literal(")") {
+		return &FEOnePathFuncExpr{
+			OnePathFuncNoArg: &FEOnePathFuncNoArg{
+				OnePathFuncNoArgName: &FEOnePathFuncNoArgName{Meta: feBool()},
+			},
+		}, true
+	}
+	p.pos = start
+	return nil, false
+}
+
+func (p *feParser) parseStringType() (*FEStringType, bool) {
+	if value, ok := p.ref(scanner.Char); ok {
+		return &FEStringType{CharVal: value}, true
+	}
+	if value, ok := p.ref(scanner.RawString); ok {
+		return &FEStringType{RawStr: value}, true
+	}
+	if value, ok := p.ref(scanner.Ident); ok {
+		return &FEStringType{StrValue: value}, true
+	}
+	return nil, false
+}
+
+func (p *feParser) parseMathArithmeticOp() (*FEMathArithmeticOp, bool) {
+	switch {
+	case p.literal("+"):
+		return &FEMathArithmeticOp{Addition: feBool()}, true
+	case p.literal("-"):
+		return &FEMathArithmeticOp{Subtraction: feBool()}, true
+	case p.literal("*"):
+		return &FEMathArithmeticOp{Multiply: feBool()}, true
+	case p.literal("/"):
+		return &FEMathArithmeticOp{Division: feBool()}, true
+	case p.literal("%"):
+		return &FEMathArithmeticOp{Modulo: feBool()}, true
+	}
+	return nil, false
+}
+
+// feDecimalValue parses a number as a decimal, for numbers which are too
+// long to be held exactly by an int or float64.  Numbers written in other
+// bases are left to strconv.
+func feDecimalValue(value string) (*big.Rat, bool) {
+	if strings.ContainsAny(value, "xXbBoO_") || len(value) > 1 && value[0] == '0' && value[1] != '.' {
+		return nil, false
+	}
+	return parseDecimal(value)
+}
+
+func (p *feParser) parseMathValue() (*FEMathValue, bool) {
+	start := p.pos
+	mathNeg := p.mathNeg()
+
+	if value, ok := p.ref(scanner.Int); ok {
+		intValue, err := strconv.ParseInt(value, 0, strconv.IntSize)
+		if errors.Is(err, strconv.ErrRange) {
+			if decimal, ok := feDecimalValue(value); ok {
+				return &FEMathValue{MathNeg: mathNeg, DecimalValue: decimal}, true
+			}
+		}
+		if err != nil {
+			p.pos--
+			p.abort(fmt.Errorf("invalid integer %q: %s", value, err))
+		}
+		converted := int(intValue)
+		return &FEMathValue{MathNeg: mathNeg, IntValue: &converted}, true
+	}
+	if value, ok := p.ref(scanner.Float); ok {
+		if numberLiteralIsInexact([]byte(value)) {
+			if decimal, ok := feDecimalValue(value); ok {
+				return &FEMathValue{MathNeg: mathNeg, DecimalValue: decimal}, true
+			}
+		}
+		floatValue, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			p.pos--
+			p.abort(fmt.Errorf("invalid float %q: %s", value, err))
+		}
+		return &FEMathValue{MathNeg: mathNeg, FloatValue: &floatValue}, true
+	}
+
+	p.pos = start
+	return nil, false
+}
+
+func (p *feParser) parseValue() (*FEValue, bool) {
+	if mathValue, ok := p.parseMathValue(); ok {
+		return &FEValue{MathVal: mathValue}, true
+	}
+	if value, ok := p.ref(scanner.String); ok {
+		return &FEValue{StrValue: &value}, true
+	}
+	return nil, false
+}
+
+func (p *feParser) parseOpChar() (*FEOpChar, bool) {
+	switch {
+	case p.literal("!"):
+		return &FEOpChar{Not: feBool()}, true
+	case p.literal("="):
+		return &FEOpChar{Equal: feBool()}, true
+	case p.literal("<"):
+		return &FEOpChar{LessThan: feBool()}, true
+	case p.literal(">"):
+		return &FEOpChar{GreaterThan: feBool()}, true
+	}
+	return nil, false
+}
+
+func (p *feParser) parseCompareOp() (*FECompareOp, bool) {
+	opChars0, ok := p.parseOpChar()
+	if !ok {
+		return nil, false
+	}
+	opChars1, _ := p.parseOpChar()
+	return &FECompareOp{OpChars0: opChars0, OpChars1: opChars1}, true
+}
+
+func (p *feParser) parseCheckOp() (*FECheckOp, bool) {
+	start := p.pos
+	if !p.literal("IS") {
+		return nil, false
+	}
+
+	checkOp := &FECheckOp{}
+	if p.literal("NOT") {
+		checkOp.Not = feBool()
+	}
+
+	switch {
+	case p.literal("NULL"):
+		checkOp.Null = feBool()
+	case p.literal("MISSING"):
+		checkOp.Missing = feBool()
+	default:
+		p.pos = start
+		return nil, false
+	}
+	return checkOp, true
+}
+
+func (p *feParser) parseConstFuncExpression() (*FEConstFuncExpression, bool) {
+	p.enter()
+	defer p.leave()
+
+	start := p.pos
+	expr := &FEConstFuncExpression{MathNeg: p.mathNeg()}
+
+	if noArg, ok := p.parseConstFuncNoArg(); ok {
+		expr.ConstFuncNoArg = noArg
+	} else if oneArg, ok := p.parseConstFuncOneArg(); ok {
+		expr.ConstFuncOneArg = oneArg
+	} else if twoArgs, ok := p.parseConstFuncTwoArgs(); ok {
+		expr.ConstFuncTwoArgs = twoArgs
+	} else {
+		p.pos = start
+		return nil, false
+	}
+	return expr, true
+}
+
+func (p *feParser) parseConstFuncNoArg() (*FEConstFuncNoArg, bool) {
+	start := p.pos
+
+	name := &FEConstFuncNoArgName{}
+	switch {
+	case p.literal("PI"):
+		name.Pi = feBool()
+	case p.literal("E"):
+		name.E = feBool()
+	default:
+		return nil, false
+	}
+
+	if p.literal("(") && p.literal(")") {
+		return &FEConstFuncNoArg{ConstFuncNoArgName: name}, true
+	}
+	p.pos = start
+	return nil, false
+}
+
+func (p *feParser) parseConstFuncOneArgName() (*FEConstFuncOneArgName, bool) {
+	name := &FEConstFuncOneArgName{}
+	switch {
+	case p.literal("ABS"):
+		name.Abs = feBool()
+	case p.literal("ACOS"):
+		name.Acos = feBool()
+	case p.literal("ASIN"):
+		name.Asin = feBool()
+	case p.literal("ATAN"):
+		name.Atan = feBool()
+	case p.literal("CEIL"):
+		name.Ceil = feBool()
+	case p.literal("COS"):
+		name.Cos = feBool()
+	case p.literal("DATE"):
+		name.Date = feBool()
+	case p.literal("DEGREES"):
+		name.Degrees = feBool()
+	case p.literal("EXP"):
+		name.Exp = feBool()
+	case p.literal("FLOOR"):
+		name.Floor = feBool()
+	case p.literal("LOG"):
+		name.Log = feBool()
+	case p.literal("LN"):
+		name.Ln = feBool()
+	case p.literal("LOWER"):
+		name.Lower = feBool()
+	case p.literal("SIN"):
+		name.Sine = feBool()
+	case p.literal("TAN"):
+		name.Tangent = feBool()
+	case p.literal("RADIANS"):
+		name.Radians = feBool()
+	case p.literal("ROUND"):
+		name.Round = feBool()
+	case p.literal("SQRT"):
+		name.Sqrt = feBool()
+	case p.literal("UPPER"):
+		name.Upper = feBool()
+	default:
+		return nil, false
+	}
+	return name, true
+}
+
+func (p *feParser) parseConstFuncOneArg() (*FEConstFuncOneArg, bool) {
+	start := p.pos
+	if name, ok := p.parseConstFuncOneArgName(); ok && p.literal("(") {
+		if arg, ok := p.parseConstFuncArgument(); ok && p.literal(")") {
+			return &FEConstFuncOneArg{ConstFuncOneArgName: name, Argument: arg}, true
+		}
+	}
+	p.pos = start
+	return nil, false
+}
+
+func (p *feParser) parseConstFuncTwoArgs() (*FEConstFuncTwoArgs, bool) {
+	start := p.pos
+
+	name := &FEConstFuncTwoArgsName{}
+	switch {
+	case p.literal("ATAN2"):
+		name.Atan2 = feBool()
+	case p.literal("POW"):
+		name.Power = feBool()
+	case p.literal("COLLATE"):
+		name.Collate = feBool()
+	default:
+		return nil, false
+	}
+
+	if p.literal("(") {
+		if arg0, ok := p.parseConstFuncArgument(); ok && p.literal(",") {
+			if arg1, ok := p.parseConstFuncArgument(); ok && p.literal(")") {
+				return &FEConstFuncTwoArgs{ConstFuncTwoArgsName: name, Argument0: arg0, Argument1: arg1}, true
+			}
+		}
+	}
+	p.pos = start
+	return nil, false
+}
+
+func (p *feParser) parseConstFuncArgument() (*FEConstFuncArgument, bool) {
+	if subFunc, ok := p.parseConstFuncExpression(); ok {
+		return &FEConstFuncArgument{SubFunc: subFunc}, true
+	}
+	if field, ok := p.parseFieldWithMath(); ok {
+		return &FEConstFuncArgument{FieldWMath: field}, true
+	}
+	if value, ok := p.parseValue(); ok {
+		return &FEConstFuncArgument{Argument: value}, true
+	}
+	return nil, false
+}
+
+func (p *feParser) parseConstFuncArgumentRHS() (*FEConstFuncArgumentRHS, bool) {
+	if subFunc, ok := p.parseConstFuncExpression(); ok {
+		return &FEConstFuncArgumentRHS{SubFunc: subFunc}, true
+	}
+	if value, ok := p.parseValue(); ok {
+		return &FEConstFuncArgumentRHS{Argument: value}, true
+	}
+	return nil, false
+}
+
+func (p *feParser) parseBooleanFuncExpr() (*FEBooleanFuncExpr, bool) {
+	if twoArgs, ok := p.parseBooleanFuncTwoArgs(); ok {
+		return &FEBooleanFuncExpr{BooleanFuncTwoArgs: twoArgs}, true
+	}
+	if exists, ok := p.parseExistsClause(); ok {
+		return &FEBooleanFuncExpr{ExistsClause: exists}, true
+	}
+	return nil, false
+}
+
+func (p *feParser) parseBooleanFuncTwoArgs() (*FEBooleanFuncTwoArgs, bool) {
+	start := p.pos
+	if p.literal("REGEXP_CONTAINS") && p.literal("(") {
+		if arg0, ok := p.parseConstFuncArgument(); ok && p.literal(",") {
+			if arg1, ok := p.parseConstFuncArgumentRHS(); ok && p.literal(")") {
+				return &FEBooleanFuncTwoArgs{
+					BooleanFuncTwoArgsName: &FEBooleanFuncTwoArgsName{RegexContains: feBool()},
+					Argument0:              arg0,
+					Argument1:              arg1,
+				}, true
+			}
+		}
+	}
+	p.pos = start
+	return nil, false
+}
+
+func (p *feParser) parseExistsClause() (*FEExistsClause, bool) {
+	start := p.pos
+	if p.literal("EXISTS") && p.literal("(") {
+		if field, ok := p.parseField(); ok && p.literal(")") {
+			return &FEExistsClause{Field: field}, true
+		}
+	}
+	p.pos = start
+	return nil, false
+}
+
+func (p *feParser) unexpectedError() *ParseError {
+	token := p.tokens[p.furthest]
+
+	var quoted []string
+	for _, expected := range p.expected {
+		quoted = append(quoted, strconv.Quote(expected))
+	}
+
+	value := token.Value
+	if token.EOF() {
+		value = "<EOF>"
+	}
+	err := fmt.Errorf("unexpected %q (expected %s)", value, strings.Join(quoted, " | "))
+
+	parseErr := newParseError(p.expression, token.Pos.Offset, "", p.expected, err)
+	if !token.EOF() {
+		parseErr.Token = token.Value
+	}
+	return parseErr
+}
+
+func lexFilterExpression(expression string) ([]lexer.Token, error) {
+	lex := lexer.LexString(expression)
+
+	var tokens []lexer.Token
+	for {
+		token, err := lex.Next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+		if token.EOF() {
+			return tokens, nil
+		}
+	}
+}
+
+// ParseString parses a filter expression into fe, replacing anything which
+// it previously held.  Errors are always returned as a *ParseError.
+func (parser *FilterExpressionParser) ParseString(expression string, fe *FilterExpression) (err error) {
+	tokens, err := lexFilterExpression(expression)
+	if err != nil {
+		return newLexerParseError(expression, err)
+	}
+
+	p := &feParser{
+		expression: expression,
+		tokens:     tokens,
+		maxDepth:   parser.MaxDepth,
+		maxSteps:   filterExprMaxStepsPerToken * len(tokens),
+
+		simpleSyntax: parser.simpleSyntax,
+	}
+	if p.maxDepth <= 0 {
+		p.maxDepth = DefaultFilterExpressionMaxDepth
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			abort, ok := r.(feAbort)
+			if !ok {
+				panic(r)
+			}
+			err = abort.err
+		}
+	}()
+
+	parsed, ok := p.parseFilterExpression()
+	if !ok || !p.token().EOF() {
+		if ok {
+			p.expect("<EOF>")
+		}
+		return p.unexpectedError()
+	}
+
+	*fe = *parsed
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/participle"
+	"github.com/stretchr/testify/assert"
+)
+
+var grammarParserOnce sync.Once
+var grammarParser *participle.Parser
+
+// parseWithGrammar parses a filter using participle and the grammar in the
+// struct tags of the FE* types, which the hand written parser must agree
+// with.
+func parseWithGrammar(t testing.TB, expression string) (fe *FilterExpression, err error) {
+	grammarParserOnce.Do(func() {
+		var buildErr error
+		grammarParser, buildErr = participle.Build(&FilterExpression{})
+		if buildErr != nil {
+			t.Fatalf("failed to build grammar: %v", buildErr)
+		}
+	})
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New("panic from participle")
+		}
+	}()
+
+	fe = &FilterExpression{}
+	err = grammarParser.ParseString(expression, fe)
+	return
+}
+
+var filterParserSeeds = []string{
+	"`field` = TRUE",
+	"TRUE OR FALSE AND NOT FALSE",
+	"(TRUE AND FALSE OR TRUE) AND FALSE OR TRUE",
+	`name = "x" AND (age >= 5 OR NOT age < 2)`,
+	`a.b[0][1].c <> -5.5 AND a IS NOT NULL OR b IS MISSING`,
+	`META().id = "x" AND EXISTS(a.b) AND REGEXP_CONTAINS(a, "^x")`,
+	`ABS(a) > POW(2, 3) AND -PI() < ATAN2(a.b, -1) AND DATE(a) = DATE("2019-01-01")`,
+	`a + 5 = b * c AND 5 - a >= 3 AND a % 2 = 1 AND a = b + 1 - c`,
+	`'x' = 'xy' AND "a" = a AND 0x10 = 010`,
+	`NOT = 1 AND IS IS NULL`,
+	`name = "TRUE"`,
+	`REGEXP_CONTAINS(ABS(a - 1), ROUND(2))`,
+	`META().xattrs._sync.rev LIKE "^1-" OR NOT a.b LIKE 5 OR LIKE LIKE "x"`,
+	`a =~ "^x" OR a = ~ "x" OR a == "x" OR a LIKE "x%" ESCAPE "!" OR b LIKE "%"`,
+	`a LIKE "x" ESCAPE 5`,
+}
+
+func checkFilterParserAgainstGrammar(t *testing.T, expression string) {
+	var parser FilterExpressionParser
+	fe := &FilterExpression{}
+	err := parser.ParseString(expression, fe)
+
+	expected, expectedErr := parseWithGrammar(t, expression)
+	if expectedErr != nil {
+		// Anything which the grammar cannot parse may fail, but must fail
+		// gracefully.
+		if err != nil {
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("unexpected error type for %q: %T", expression, err)
+			}
+		}
+		return
+	}
+
+	if err != nil {
+		t.Fatalf("failed to parse %q which the grammar accepts: %v", expression, err)
+	}
+	if !reflect.DeepEqual(expected, fe) {
+		t.Fatalf("parsed %q differently to the grammar:\n%v\n%v", expression, expected, fe)
+	}
+}
+
+func TestFilterExpressionParserMatchesGrammar(t *testing.T) {
+	for _, expression := range filterParserSeeds {
+		checkFilterParserAgainstGrammar(t, expression)
+	}
+}
+
+func TestFilterExpressionParserLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	nested := strings.Repeat("(", 50) + "a = 1" + strings.Repeat(")", 50)
+	_, _, err := NewBoundedFilterExpressionParser(nested)
+	assert.Nil(err)
+
+	for _, expression := range []string{
+		strings.Repeat("(", 10000) + "a = 1" + strings.Repeat(")", 10000),
+		strings.Repeat("NOT ", 10000) + "a = 1",
+		"a = " + strings.Repeat("ABS(", 10000) + "1" + strings.Repeat(")", 10000),
+	} {
+		_, _, err = NewBoundedFilterExpressionParser(expression)
+		assert.True(errors.Is(err, ErrorFilterExpressionTooDeep))
+	}
+
+	// Long but shallow expressions are fine
+	_, _, err = NewBoundedFilterExpressionParser(strings.Repeat("a = 1 AND ", 10000) + "a = 1")
+	assert.Nil(err)
+	_, _, err = NewBoundedFilterExpressionParser("a = " + strings.Repeat("-", 10000) + "1")
+	assert.Nil(err)
+
+	parser := FilterExpressionParser{MaxDepth: 6}
+	assert.Nil(parser.ParseString("(((a = 1)))", &FilterExpression{}))
+	err = parser.ParseString("((((a = 1))))", &FilterExpression{})
+	assert.True(errors.Is(err, ErrorFilterExpressionTooDeep))
+}
+
+func TestNewFilterExpressionParser(t *testing.T) {
+	assert := assert.New(t)
+
+	// The participle parser is still returned for existing callers, while
+	// the expression itself is parsed with the usual limits
+	parser, fe, err := NewFilterExpressionParser(`name = "x" AND age > 5`)
+	assert.Nil(err)
+	assert.NotNil(parser)
+	_, expectedFe, err := NewBoundedFilterExpressionParser(`name = "x" AND age > 5`)
+	assert.Nil(err)
+	assert.Equal(expectedFe, fe)
+
+	grammarFe := &FilterExpression{}
+	assert.Nil(parser.ParseString(`name = "x" AND age > 5`, grammarFe))
+	assert.Equal(expectedFe, grammarFe)
+
+	_, _, err = NewFilterExpressionParser(strings.Repeat("(", 10000) + "a = 1" + strings.Repeat(")", 10000))
+	assert.True(errors.Is(err, ErrorFilterExpressionTooDeep))
+}
+
+func FuzzFilterExpressionParser(f *testing.F) {
+	for _, seed := range filterParserSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, expression string) {
+		if len(expression) > 512 {
+			return
+		}
+		checkFilterParserAgainstGrammar(t, expression)
+	})
+}
@@ -5,7 +5,9 @@ package gojsonsm
 import (
 	"fmt"
 	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
 	"math"
+	"math/big"
 	"strings"
 )
 
@@ -16,7 +18,8 @@ import (
 // InnerAndExpression       = SubExprOrTerm { "AND" SubExprOrTerm }
 // SubExprOrTerm            = "(" InnerExpression ")" | Condition
 // Condition                = ( [ "NOT" ] Condition ) | Operand
-// Operand                  = BooleanExpr | ( LHS ( CheckOp | ( CompareOp RHS) ) )
+// Operand                  = BooleanExpr | ( LHS ( ( "=~" @String ) | ( CompareOp RHS) | LikeExpr | CheckOp ) )
+// LikeExpr                 = "LIKE" @String [ "ESCAPE" @String ]
 // BooleanExpr              = Boolean | BooleanFuncExpr
 // LHS                      = ConstFuncExpr | Boolean | FieldWithMath | Value
 // RHS                      = ConstFuncExpr | Boolean | Value | FieldWithMath
@@ -36,7 +39,7 @@ import (
 // ConstFuncOneArg          = ConstFuncOneArgName "(" ConstFuncArgument ")"
 // ConstFuncOneArgName      = "ABS" | "ACOS"...
 // ConstFuncTwoArgs         = ConstFuncTwoArgsName "(" ConstFuncArgument "," ConstFuncArgument ")"
-// ConstFuncTwoArgsName     = "ATAN2" | "POW"
+// ConstFuncTwoArgsName     = "ATAN2" | "POW" | "COLLATE"
 // ConstFuncArgument        = FieldWithMath | Value | ConstFuncExpr
 // ConstFuncArgumentRHS     = Value
 // PathFuncExpression       = OnePathFuncNoArg
@@ -100,6 +103,7 @@ func (f *FEInnerExpression) OutputExpression() (Expression, error) {
 }
 
 type FEInnerAndExpression struct {
+	Pos  lexer.Position
 	Expr []*FESubExprOrTerm `@@ { "AND" @@ }`
 }
 
@@ -242,10 +246,14 @@ func (f *FECondition) OutputExpression() (Expression, error) {
 }
 
 type FEOperand struct {
+	Pos         lexer.Position
 	BooleanExpr *FEBooleanExpr `@@ |`
 	LHS         *FELhs         `( @@ (`
+	LikeRegex   *string        `( "=" "~" @String ) | `
 	Op          *FECompareOp   `( @@`
 	RHS         *FERhs         `@@ ) | `
+	LikePattern *string        `( "LIKE" @String`
+	LikeEscape  *string        `[ "ESCAPE" @String ] ) | `
 	CheckOp     *FECheckOp     `@@ ) )`
 }
 
@@ -256,6 +264,12 @@ func (feo *FEOperand) String() string {
 		return fmt.Sprintf("%v %v", feo.LHS.String(), feo.CheckOp.String())
 	} else if feo.LHS != nil && feo.Op != nil && feo.RHS != nil {
 		return fmt.Sprintf("%v %v %v", feo.LHS.String(), feo.Op.String(), feo.RHS.String())
+	} else if feo.LHS != nil && feo.LikeRegex != nil {
+		return fmt.Sprintf("%v %v %v", feo.LHS.String(), OperatorRegexMatch, *feo.LikeRegex)
+	} else if feo.LHS != nil && feo.LikePattern != nil && feo.LikeEscape != nil {
+		return fmt.Sprintf("%v %v %v %v %v", feo.LHS.String(), OperatorLike, *feo.LikePattern, OperatorLikeEscape, *feo.LikeEscape)
+	} else if feo.LHS != nil && feo.LikePattern != nil {
+		return fmt.Sprintf("%v %v %v", feo.LHS.String(), OperatorLike, *feo.LikePattern)
 	} else {
 		return "?? (FEOperand)"
 	}
@@ -279,6 +293,27 @@ func (f *FEOperand) OutputExpression() (Expression, error) {
 				return nil, err
 			}
 			return f.Op.OutputExpression(lhsExpr, rhsExpr)
+		} else if f.LikeRegex != nil {
+			var rhsExpr Expression = RegexExpr{*f.LikeRegex}
+			if tokenIsPcreValueType(*f.LikeRegex) {
+				rhsExpr, err = MakePcreExpression(*f.LikeRegex)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return LikeExpr{lhsExpr, rhsExpr}, nil
+		} else if f.LikePattern != nil {
+			escape := DefaultLikeEscape
+			if f.LikeEscape != nil {
+				escape, err = ParseLikeEscape(*f.LikeEscape)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if _, err = CompileLikePattern(*f.LikePattern, escape); err != nil {
+				return nil, err
+			}
+			return LikeExpr{lhsExpr, LikePatternExpr{*f.LikePattern, escape}}, nil
 		} else {
 			return nil, fmt.Errorf("Invalid FEOperand %v", f.String())
 		}
@@ -590,19 +625,28 @@ func (fef *FEField) String() string {
 }
 
 func (f *FEField) OutputExpression() (Expression, error) {
-	var outExpr FieldExpr
+	var path []string
 
-	for _, onePath := range f.Path {
+	for i, onePath := range f.Path {
 		pathName, arrays, err := onePath.OutputOnePath()
 		if err != nil {
-			return outExpr, err
+			return FieldExpr{}, err
+		}
+		// META() is only meaningful as the first element of a path, it
+		// switches the path over to the document metadata
+		if i > 0 || onePath.OnePathFunc == nil {
+			path = append(path, pathName)
 		}
-		outExpr.Path = append(outExpr.Path, pathName)
 		for _, arrIdx := range arrays {
-			outExpr.Path = append(outExpr.Path, arrIdx)
+			path = append(path, arrIdx)
 		}
 	}
 
+	var outExpr Expression = FieldExpr{Path: path}
+	if len(f.Path) > 0 && f.Path[0].OnePathFunc != nil {
+		outExpr = MetaExpr{path}
+	}
+
 	if f.MathNeg != nil {
 		var mathOutExpr FuncExpr
 		// Only thing is a negation of the field value
@@ -715,8 +759,7 @@ func (n *FEOnePathFuncNoArgName) String() string {
 	}
 }
 
-// There's currently no special Expression for META function, but it's useful to have a parser gramar for it
-// as it is being used internally
+// META() is output by FEField as the root of a MetaExpr rather than on its own
 func (f *FEOnePathFuncNoArgName) OutputExpression() (Expression, error) {
 	return nil, fmt.Errorf("Not supported (FEOnePathFuncNoArgName) %v", f.String())
 }
@@ -765,10 +808,21 @@ type FEMathValue struct {
 	MathNeg    *bool    `{ @"-" }`
 	IntValue   *int     `( @Int |`
 	FloatValue *float64 `@Float )`
+	// Numbers which an int or float64 cannot hold exactly
+	DecimalValue *big.Rat
+}
+
+func (f *FEMathValue) decimal() *big.Rat {
+	if f.MathNeg != nil && *f.MathNeg {
+		return new(big.Rat).Neg(f.DecimalValue)
+	}
+	return f.DecimalValue
 }
 
 func (f *FEMathValue) String() string {
-	if f.IntValue != nil {
+	if f.DecimalValue != nil {
+		return formatDecimal(f.decimal())
+	} else if f.IntValue != nil {
 		outputVal := *f.IntValue
 		if f.MathNeg != nil && *f.MathNeg {
 			outputVal *= -1
@@ -786,7 +840,9 @@ func (f *FEMathValue) String() string {
 }
 
 func (f *FEMathValue) OutputExpression() (Expression, error) {
-	if f.IntValue != nil {
+	if f.DecimalValue != nil {
+		return ValueExpr{f.decimal()}, nil
+	} else if f.IntValue != nil {
 		outputVal := *f.IntValue
 		if f.MathNeg != nil && *f.MathNeg {
 			outputVal *= -1
@@ -1241,11 +1297,13 @@ type FEConstFuncOneArgName struct {
 	Floor   *bool `@"FLOOR" |`
 	Log     *bool `@"LOG" |`
 	Ln      *bool `@"LN" |`
+	Lower   *bool `@"LOWER" |`
 	Sine    *bool `@"SIN" |`
 	Tangent *bool `@"TAN" |`
 	Radians *bool `@"RADIANS" |`
 	Round   *bool `@"ROUND" |`
-	Sqrt    *bool `@"SQRT"`
+	Sqrt    *bool `@"SQRT" |`
+	Upper   *bool `@"UPPER"`
 }
 
 func (arg *FEConstFuncOneArgName) String() string {
@@ -1273,6 +1331,8 @@ func (arg *FEConstFuncOneArgName) String() string {
 		return FuncLog
 	} else if arg.Ln != nil && *arg.Ln == true {
 		return FuncLn
+	} else if arg.Lower != nil && *arg.Lower == true {
+		return FuncLower
 	} else if arg.Sine != nil && *arg.Sine == true {
 		return FuncSin
 	} else if arg.Tangent != nil && *arg.Tangent == true {
@@ -1283,6 +1343,8 @@ func (arg *FEConstFuncOneArgName) String() string {
 		return FuncRound
 	} else if arg.Sqrt != nil && *arg.Sqrt == true {
 		return FuncSqrt
+	} else if arg.Upper != nil && *arg.Upper == true {
+		return FuncUpper
 	} else {
 		return "?? (FEConstFuncOneArgName)"
 	}
@@ -1313,6 +1375,8 @@ func (arg *FEConstFuncOneArgName) OutputExpression() (string, error) {
 		return MathFuncLog, nil
 	} else if arg.Ln != nil && *arg.Ln == true {
 		return MathFuncLn, nil
+	} else if arg.Lower != nil && *arg.Lower == true {
+		return LowerFunc, nil
 	} else if arg.Sine != nil && *arg.Sine == true {
 		return MathFuncSin, nil
 	} else if arg.Tangent != nil && *arg.Tangent == true {
@@ -1323,6 +1387,8 @@ func (arg *FEConstFuncOneArgName) OutputExpression() (string, error) {
 		return MathFuncRound, nil
 	} else if arg.Sqrt != nil && *arg.Sqrt == true {
 		return MathFuncSqrt, nil
+	} else if arg.Upper != nil && *arg.Upper == true {
+		return UpperFunc, nil
 	} else {
 		return "?? (FEConstFuncOneArgName)", ErrorNotFound
 	}
@@ -1361,12 +1427,24 @@ func (f *FEConstFuncTwoArgs) OutputExpression() (Expression, error) {
 	}
 	outExpr.Params = append(outExpr.Params, arg0)
 	outExpr.Params = append(outExpr.Params, arg1)
-	return outExpr, nil
+
+	// The collation must be named by a string so that it can be checked here
+	if name == CollateFunc {
+		value, ok := arg1.(ValueExpr)
+		collationName, isString := value.Value.(string)
+		if !ok || !isString {
+			return outExpr, fmt.Errorf("Invalid collation specified: %v", f.Argument1.String())
+		}
+		_, err = ParseCollation(collationName)
+	}
+
+	return outExpr, err
 }
 
 type FEConstFuncTwoArgsName struct {
-	Atan2 *bool `@"ATAN2" |`
-	Power *bool `@"POW"`
+	Atan2   *bool `@"ATAN2" |`
+	Power   *bool `@"POW" |`
+	Collate *bool `@"COLLATE"`
 }
 
 func (arg *FEConstFuncTwoArgsName) String() string {
@@ -1374,6 +1452,8 @@ func (arg *FEConstFuncTwoArgsName) String() string {
 		return FuncAtan2
 	} else if arg.Power != nil && *arg.Power == true {
 		return FuncPower
+	} else if arg.Collate != nil && *arg.Collate == true {
+		return FuncCollate
 	} else {
 		return "?? (FEConstFuncTwoArgsName)"
 	}
@@ -1384,6 +1464,8 @@ func (arg *FEConstFuncTwoArgsName) OutputExpression() (string, error) {
 		return MathFuncAtan2, nil
 	} else if arg.Power != nil && *arg.Power == true {
 		return MathFuncPow, nil
+	} else if arg.Collate != nil && *arg.Collate == true {
+		return CollateFunc, nil
 	} else {
 		return "?? (FEConstFuncTwoArgsName)", ErrorNotFound
 	}
@@ -1500,35 +1582,66 @@ func (f *FEExistsClause) OutputExpression() (Expression, error) {
 	return nil, fmt.Errorf("Invalid FEExistsClause %v", f.String())
 }
 
-func parserWrapper(parser *participle.Parser, expression string, fe *FilterExpression, err *error) {
-	defer func() {
-		if r := recover(); r != nil {
-			*err = fmt.Errorf("Error from parser: %v", r)
-		}
-	}()
-
-	*err = parser.ParseString(expression, fe)
-}
-
+// NewFilterExpressionParser parses a filter expression, returning a
+// participle parser for the grammar of the FE* types along with the result.
+// The expression itself is parsed by a FilterExpressionParser, and the
+// participle parser is only built for callers which use it directly.
+//
+// Deprecated: the returned participle parser has no limit on how deeply
+// expressions nest, so calling ParseString on it can still overflow the
+// stack.  Use NewBoundedFilterExpressionParser instead.
 func NewFilterExpressionParser(expression string) (*participle.Parser, *FilterExpression, error) {
 	fe := &FilterExpression{}
 	if len(expression) == 0 {
-		return nil, fe, ErrorEmptyInput
+		return nil, fe, newParseError(expression, 0, "", nil, ErrorEmptyInput)
 	}
 
-	parser, err := participle.Build(fe)
+	parser, err := participle.Build(&FilterExpression{})
 	if err != nil {
 		return parser, fe, err
 	}
 
-	// Use a wrapper so we can recover any panic and set the error gracefully
-	parserWrapper(parser, expression, fe, &err)
+	var boundedParser FilterExpressionParser
+	err = boundedParser.ParseString(expression, fe)
+	return parser, fe, err
+}
+
+// NewBoundedFilterExpressionParser parses a filter expression using a
+// FilterExpressionParser with the default limits, which is returned along
+// with the result.
+func NewBoundedFilterExpressionParser(expression string) (*FilterExpressionParser, *FilterExpression, error) {
+	fe := &FilterExpression{}
+	if len(expression) == 0 {
+		return nil, fe, newParseError(expression, 0, "", nil, ErrorEmptyInput)
+	}
 
+	parser := &FilterExpressionParser{}
+	err := parser.ParseString(expression, fe)
 	return parser, fe, err
 }
 
 func GetFilterExpressionMatcher(expression string) (Matcher, error) {
-	_, fe, err := NewFilterExpressionParser(expression)
+	_, fe, err := NewBoundedFilterExpressionParser(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	expr, err := fe.OutputExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	var trans Transformer
+	matchDef := trans.Transform([]Expression{expr})
+
+	matcher := NewFastMatcher(matchDef)
+	return matcher, nil
+}
+
+// GetFilterExpressionMatcherWithSchema builds a matcher for a filter after
+// validating it against the schema of the documents it will be matching.
+func GetFilterExpressionMatcherWithSchema(expression string, schema *JSONSchema) (Matcher, error) {
+	_, fe, err := NewBoundedFilterExpressionParser(expression)
 	if err != nil {
 		return nil, err
 	}
@@ -1538,6 +1651,11 @@ func GetFilterExpressionMatcher(expression string) (Matcher, error) {
 		return nil, err
 	}
 
+	err = ValidateExpressions([]Expression{expr}, schema)
+	if err != nil {
+		return nil, err
+	}
+
 	var trans Transformer
 	matchDef := trans.Transform([]Expression{expr})
 
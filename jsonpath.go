@@ -0,0 +1,620 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// jsonPathMaxDepth limits how deeply parenthesis, negations, filters and
+// function calls may be nested within a JSONPath query.
+const jsonPathMaxDepth = 128
+
+// jpAbort is raised to abandon parsing a JSONPath query.
+type jpAbort struct {
+	err *ParseError
+}
+
+// jpOperand is something which appears within a filter.  value is set when
+// it can be compared, and test when it can be used as a condition itself.
+type jpOperand struct {
+	value Expression
+	test  Expression
+	pos   int
+}
+
+type jpParser struct {
+	text    string
+	pos     int
+	depth   int
+	current VariableID
+	nextVar VariableID
+}
+
+func (p *jpParser) tokenAt(pos int) string {
+	if pos >= len(p.text) {
+		return ""
+	}
+	_, size := utf8.DecodeRuneInString(p.text[pos:])
+	return p.text[pos : pos+size]
+}
+
+func (p *jpParser) fail(pos int, format string, args ...interface{}) {
+	panic(jpAbort{newParseError(p.text, pos, p.tokenAt(pos), nil, fmt.Errorf(format, args...))})
+}
+
+func (p *jpParser) enter() {
+	p.depth++
+	if p.depth > jsonPathMaxDepth {
+		panic(jpAbort{newParseError(p.text, p.pos, p.tokenAt(p.pos), nil, ErrorFilterExpressionTooDeep)})
+	}
+}
+
+func (p *jpParser) leave() {
+	p.depth--
+}
+
+func (p *jpParser) newVar() VariableID {
+	p.nextVar++
+	return p.nextVar
+}
+
+func (p *jpParser) peek() byte {
+	if p.pos >= len(p.text) {
+		return 0
+	}
+	return p.text[p.pos]
+}
+
+func (p *jpParser) consume(token string) bool {
+	if len(p.text)-p.pos >= len(token) && p.text[p.pos:p.pos+len(token)] == token {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *jpParser) expect(token string) {
+	if !p.consume(token) {
+		p.fail(p.pos, "expected `%s`", token)
+	}
+}
+
+func (p *jpParser) skipBlank() {
+	for {
+		switch p.peek() {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func jpIsDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func jpIsNameFirst(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_' || r >= 0x80
+}
+
+// parseSegments parses the segments of a query which starts at base.  A
+// query without any filter selectors is singular and is returned as the
+// field it refers to.  Otherwise, test is set to a condition which is true
+// when the query selects any nodes.
+func (p *jpParser) parseSegments(base FieldExpr) (field FieldExpr, test Expression) {
+	// The path is copied once and then extended in place, as copying it
+	// for every segment makes long queries quadratic.
+	field = FieldExpr{base.Root, append([]string(nil), base.Path...)}
+	for {
+		start := p.pos
+		p.skipBlank()
+		segmentPos := p.pos
+
+		switch {
+		case p.consume(".."):
+			p.fail(segmentPos, "descendant segments are not supported")
+		case p.consume("."):
+			if p.peek() == '*' {
+				p.fail(p.pos, "wildcard selectors are not supported")
+			}
+			field.Path = append(field.Path, p.parseMemberName())
+		case p.consume("["):
+			p.skipBlank()
+			if p.peek() == '?' {
+				if field.Root == 0 && len(field.Path) == 0 {
+					p.fail(p.pos, "filter selectors are not supported on `$`, "+
+						"as they only select the elements of arrays and not the members of objects")
+				}
+				p.consume("?")
+				return field, p.parseFilterSelector(field)
+			}
+			field.Path = append(field.Path, p.parseSelector())
+			p.endSelector()
+		default:
+			p.pos = start
+			return field, nil
+		}
+	}
+}
+
+func (p *jpParser) endSelector() {
+	p.skipBlank()
+	if p.peek() == ',' {
+		p.fail(p.pos, "multiple selectors in one segment are not supported")
+	}
+	p.expect("]")
+}
+
+func (p *jpParser) parseMemberName() string {
+	start := p.pos
+	for p.pos < len(p.text) {
+		r, size := utf8.DecodeRuneInString(p.text[p.pos:])
+		if !jpIsNameFirst(r) && (p.pos == start || r > 0x7f || !jpIsDigit(byte(r))) {
+			break
+		}
+		p.pos += size
+	}
+	if p.pos == start {
+		p.fail(start, "expected a member name")
+	}
+	return p.text[start:p.pos]
+}
+
+// parseSelector parses a name or index selector, returning it as a path
+// element of a FieldExpr.
+func (p *jpParser) parseSelector() string {
+	start := p.pos
+	switch c := p.peek(); {
+	case c == '\'' || c == '"':
+		return p.parseString()
+	case c == '*':
+		p.fail(start, "wildcard selectors are not supported")
+	case c == ':':
+		p.fail(start, "array slice selectors are not supported")
+	case c == '-' || jpIsDigit(c):
+		p.consume("-")
+		digits := p.pos
+		for jpIsDigit(p.peek()) {
+			p.pos++
+		}
+		if p.pos == digits || (p.text[digits] == '0' && p.pos-digits > 1) {
+			p.fail(start, "invalid index")
+		}
+		p.skipBlank()
+		if p.peek() == ':' {
+			p.fail(start, "array slice selectors are not supported")
+		}
+		if p.text[start] == '-' {
+			p.fail(start, "negative indexes are not supported")
+		}
+		index, err := strconv.ParseUint(p.text[digits:p.pos], 10, 31)
+		if err != nil {
+			p.fail(start, "invalid index")
+		}
+		return "[" + strconv.FormatUint(index, 10) + "]"
+	}
+	p.fail(start, "expected a selector")
+	return ""
+}
+
+// parseFilterSelector parses the rest of a filter selector applied to the
+// elements of field, along with any segments which follow it.
+func (p *jpParser) parseFilterSelector(field FieldExpr) Expression {
+	elemVar := p.newVar()
+	outer := p.current
+	p.current = elemVar
+
+	filter := p.parseLogicalOr()
+	p.endSelector()
+
+	rest, test := p.parseSegments(FieldExpr{elemVar, nil})
+	p.current = outer
+
+	switch {
+	case test != nil:
+		filter = AndExpr{filter, test}
+	case len(rest.Path) > 0:
+		filter = AndExpr{filter, ExistsExpr{rest}}
+	}
+	return AnyInExpr{elemVar, field, filter}
+}
+
+func (p *jpParser) parseLogicalOr() Expression {
+	p.enter()
+	defer p.leave()
+
+	exprs := OrExpr{p.parseLogicalAnd()}
+	for {
+		p.skipBlank()
+		if !p.consume("||") {
+			break
+		}
+		exprs = append(exprs, p.parseLogicalAnd())
+	}
+	if len(exprs) == 1 {
+		return exprs[0]
+	}
+	return exprs
+}
+
+func (p *jpParser) parseLogicalAnd() Expression {
+	exprs := AndExpr{p.parseBasic()}
+	for {
+		p.skipBlank()
+		if !p.consume("&&") {
+			break
+		}
+		exprs = append(exprs, p.parseBasic())
+	}
+	if len(exprs) == 1 {
+		return exprs[0]
+	}
+	return exprs
+}
+
+func (p *jpParser) parseBasic() Expression {
+	p.enter()
+	defer p.leave()
+
+	p.skipBlank()
+	if p.consume("!") {
+		p.skipBlank()
+		if p.consume("(") {
+			return NotExpr{p.parseParens()}
+		}
+		operand := p.parseOperand()
+		if operand.test == nil {
+			p.fail(operand.pos, "expected a query or function which can be negated")
+		}
+		p.skipBlank()
+		if p.parseComparisonOp() != "" {
+			p.fail(operand.pos, "a comparison must be in parentheses to be negated")
+		}
+		return NotExpr{operand.test}
+	}
+	if p.consume("(") {
+		return p.parseParens()
+	}
+
+	lhs := p.parseOperand()
+	p.skipBlank()
+	opPos := p.pos
+	op := p.parseComparisonOp()
+	if op == "" {
+		if lhs.test == nil {
+			p.fail(lhs.pos, "expected a comparison")
+		}
+		return lhs.test
+	}
+
+	rhs := p.parseOperand()
+	for _, operand := range []jpOperand{lhs, rhs} {
+		if operand.value == nil {
+			p.fail(operand.pos, "expected a literal, singular query or function which returns a value")
+		}
+	}
+
+	// Literals are kept on the right hand side
+	_, lhsLiteral := lhs.value.(ValueExpr)
+	_, rhsLiteral := rhs.value.(ValueExpr)
+	if lhsLiteral && rhsLiteral {
+		p.fail(opPos, "comparing two literals is not supported")
+	}
+	if lhsLiteral {
+		lhs, rhs = rhs, lhs
+		switch op {
+		case "<":
+			op = ">"
+		case "<=":
+			op = ">="
+		case ">":
+			op = "<"
+		case ">=":
+			op = "<="
+		}
+	}
+
+	switch op {
+	case "==":
+		return EqualsExpr{lhs.value, rhs.value}
+	case "!=":
+		// A missing field is not equal to anything
+		return NotExpr{EqualsExpr{lhs.value, rhs.value}}
+	case "<":
+		return LessThanExpr{lhs.value, rhs.value}
+	case "<=":
+		return LessEqualsExpr{lhs.value, rhs.value}
+	case ">":
+		return GreaterThanExpr{lhs.value, rhs.value}
+	default:
+		return GreaterEqualsExpr{lhs.value, rhs.value}
+	}
+}
+
+func (p *jpParser) parseParens() Expression {
+	expr := p.parseLogicalOr()
+	p.skipBlank()
+	p.expect(")")
+	return expr
+}
+
+func (p *jpParser) parseComparisonOp() string {
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(op) {
+			return op
+		}
+	}
+	if p.peek() == '=' {
+		p.fail(p.pos, "expected `==`")
+	}
+	return ""
+}
+
+func (p *jpParser) parseOperand() jpOperand {
+	p.skipBlank()
+	start := p.pos
+
+	switch c := p.peek(); {
+	case c == '@' || c == '$':
+		root := FieldExpr{p.current, nil}
+		if c == '$' {
+			root.Root = 0
+		}
+		p.pos++
+		field, test := p.parseSegments(root)
+		if test != nil {
+			return jpOperand{test: test, pos: start}
+		}
+		return jpOperand{value: field, test: ExistsExpr{field}, pos: start}
+	case c == '\'' || c == '"':
+		return jpOperand{value: ValueExpr{p.parseString()}, pos: start}
+	case c == '-' || jpIsDigit(c):
+		return jpOperand{value: ValueExpr{p.parseNumber()}, pos: start}
+	case c >= 'a' && c <= 'z':
+		for c := p.peek(); c >= 'a' && c <= 'z' || c == '_' || jpIsDigit(c); c = p.peek() {
+			p.pos++
+		}
+		name := p.text[start:p.pos]
+		if p.consume("(") {
+			return p.parseFunction(name, start)
+		}
+		switch name {
+		case "true":
+			return jpOperand{value: ValueExpr{true}, pos: start}
+		case "false":
+			return jpOperand{value: ValueExpr{false}, pos: start}
+		case "null":
+			return jpOperand{value: ValueExpr{nil}, pos: start}
+		}
+	}
+	p.fail(start, "expected a query, literal or function")
+	return jpOperand{}
+}
+
+func (p *jpParser) parseFunction(name string, start int) jpOperand {
+	p.enter()
+	defer p.leave()
+
+	var args []jpOperand
+	p.skipBlank()
+	if !p.consume(")") {
+		for {
+			args = append(args, p.parseOperand())
+			p.skipBlank()
+			if p.consume(")") {
+				break
+			}
+			p.expect(",")
+		}
+	}
+
+	argCount := map[string]int{"length": 1, "count": 1, "value": 1, "match": 2, "search": 2}
+	count, ok := argCount[name]
+	if !ok {
+		p.fail(start, "unknown function `%s`", name)
+	}
+	if len(args) != count {
+		p.fail(start, "%s() takes %d argument(s)", name, count)
+	}
+
+	singular := func(arg jpOperand) FieldExpr {
+		field, ok := arg.value.(FieldExpr)
+		if !ok {
+			p.fail(arg.pos, "%s() only supports a singular query as its first argument", name)
+		}
+		return field
+	}
+
+	switch name {
+	case "length":
+		// Only arrays have their length counted
+		return jpOperand{value: FuncExpr{ArrayLengthFunc, []Expression{singular(args[0])}}, pos: start}
+	case "value":
+		return jpOperand{value: singular(args[0]), pos: start}
+	case "match", "search":
+		field := singular(args[0])
+		literal, _ := args[1].value.(ValueExpr)
+		pattern, ok := literal.Value.(string)
+		if !ok {
+			p.fail(args[1].pos, "%s() requires a string literal pattern", name)
+		}
+		if name == "match" {
+			pattern = "^(?:" + pattern + ")$"
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			p.fail(args[1].pos, "invalid pattern: %v", err)
+		}
+		return jpOperand{test: LikeExpr{field, RegexExpr{pattern}}, pos: start}
+	}
+	p.fail(start, "%s() is not supported", name)
+	return jpOperand{}
+}
+
+func (p *jpParser) parseNumber() interface{} {
+	start := p.pos
+	p.consume("-")
+	digits := p.pos
+	for jpIsDigit(p.peek()) {
+		p.pos++
+	}
+	if p.pos == digits || (p.text[digits] == '0' && p.pos-digits > 1) {
+		p.fail(start, "invalid number")
+	}
+
+	isFloat := false
+	if p.consume(".") {
+		isFloat = true
+		fraction := p.pos
+		for jpIsDigit(p.peek()) {
+			p.pos++
+		}
+		if p.pos == fraction {
+			p.fail(start, "invalid number")
+		}
+	}
+	if c := p.peek(); c == 'e' || c == 'E' {
+		isFloat = true
+		p.pos++
+		if c := p.peek(); c == '+' || c == '-' {
+			p.pos++
+		}
+		exponent := p.pos
+		for jpIsDigit(p.peek()) {
+			p.pos++
+		}
+		if p.pos == exponent {
+			p.fail(start, "invalid number")
+		}
+	}
+
+	text := p.text[start:p.pos]
+	if !isFloat {
+		if value, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return value
+		}
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		p.fail(start, "invalid number")
+	}
+	return value
+}
+
+func (p *jpParser) parseString() string {
+	start := p.pos
+	quote := p.text[p.pos]
+	p.pos++
+
+	var out []byte
+	for {
+		if p.pos >= len(p.text) {
+			p.fail(start, "unterminated string")
+		}
+		c := p.text[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return string(out)
+		case c < 0x20:
+			p.fail(p.pos, "control characters in strings must be escaped")
+		case c != '\\':
+			out = append(out, c)
+			p.pos++
+			continue
+		}
+
+		escapePos := p.pos
+		p.pos++
+		switch c := p.peek(); c {
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case '/', '\\', quote:
+			out = append(out, c)
+		case 'u':
+			p.pos++
+			r := p.parseHex4(escapePos)
+			if utf16.IsSurrogate(r) {
+				if !p.consume(`\u`) {
+					p.fail(escapePos, "invalid surrogate pair")
+				}
+				r = utf16.DecodeRune(r, p.parseHex4(escapePos))
+				if r == utf8.RuneError {
+					p.fail(escapePos, "invalid surrogate pair")
+				}
+			}
+			out = utf8.AppendRune(out, r)
+			continue
+		default:
+			p.fail(escapePos, "invalid escape sequence")
+		}
+		p.pos++
+	}
+}
+
+func (p *jpParser) parseHex4(escapePos int) rune {
+	if len(p.text)-p.pos < 4 {
+		p.fail(escapePos, "invalid escape sequence")
+	}
+	value, err := strconv.ParseUint(p.text[p.pos:p.pos+4], 16, 32)
+	if err != nil {
+		p.fail(escapePos, "invalid escape sequence")
+	}
+	p.pos += 4
+	return rune(value)
+}
+
+// ParseJSONPathFilter converts an RFC 9535 JSONPath query which uses a
+// filter selector, such as `$.books[?@.price < 10]`, into an expression
+// which matches documents the query selects at least one node from.
+//
+// Each filter selector becomes an AnyInExpr over the elements of the array
+// it is applied to, with `@` bound to the loop variable, so filters select
+// nothing from objects where RFC 9535 would select their member values.
+// As the document itself is usually an object, filters on `$` are rejected
+// rather than quietly never matching.  Negating a nested query, as in
+// `$[?!@.items[?@.qty > 0]]`, gives a NOT of an AnyInExpr rather than an
+// EveryInExpr, since JSONPath treats a missing array as selecting nothing.
+//
+// Besides filters, only name and index selectors are supported.  Wildcard,
+// slice and descendant selectors, and queries without a filter, are
+// rejected.  length() only counts the elements of arrays and count() is
+// not supported.  Errors are always a *ParseError.
+func ParseJSONPathFilter(path string) (expr Expression, err error) {
+	p := &jpParser{text: path}
+
+	defer func() {
+		if r := recover(); r != nil {
+			abort, ok := r.(jpAbort)
+			if !ok {
+				panic(r)
+			}
+			expr, err = nil, abort.err
+		}
+	}()
+
+	if !p.consume("$") {
+		p.fail(0, "expected `$`")
+	}
+	_, test := p.parseSegments(FieldExpr{0, nil})
+	if p.pos < len(p.text) {
+		p.fail(p.pos, "unexpected `%s`", p.tokenAt(p.pos))
+	}
+	if test == nil {
+		p.fail(0, "query does not contain a filter selector")
+	}
+	return test, nil
+}
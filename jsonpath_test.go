@@ -0,0 +1,185 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJSONPathFilter(t *testing.T) {
+	tests := []struct {
+		path    string
+		matches []string
+		misses  []string
+	}{
+		{
+			`$.books[?@.price < 10 && @.category == 'fiction']`,
+			[]string{`{"books": [{"price": 20}, {"price": 8.5, "category": "fiction"}]}`},
+			[]string{`{"books": [{"price": 8, "category": "poetry"}, {"price": 12, "category": "fiction"}]}`,
+				`{"books": []}`, `{}`},
+		},
+		{
+			`$.store.book[?@.author && (@.year >= 2000 || @["in print"] == true)]`,
+			[]string{`{"store": {"book": [{"author": "A", "year": 1990, "in print": true}]}}`,
+				`{"store": {"book": [{"author": null, "year": 2001}]}}`},
+			[]string{`{"store": {"book": [{"year": 2001}, {"author": "A", "year": 1999}]}}`},
+		},
+		{
+			`$['a'][0][?10 > @ && @ != 3]`,
+			[]string{`{"a": [[3, 5]]}`},
+			[]string{`{"a": [[3, 10]]}`, `{"a": [[3], [5]]}`},
+		},
+		{
+			`$.orders[?@.status != "done"].items[?@.qty > $.limit]`,
+			[]string{`{"limit": 2, "orders": [{"status": "done", "items": [{"qty": 5}]}, {"items": [{"qty": 3}]}]}`},
+			[]string{`{"limit": 2, "orders": [{"status": "done", "items": [{"qty": 5}]}, {"items": [{"qty": 2}]}]}`,
+				`{"orders": [{"items": [{"qty": 3}]}]}`},
+		},
+		{
+			`$.users[?@.tags[?@ == "admin"] && !@.banned[?@ == true]].name`,
+			[]string{`{"users": [{"name": "a", "tags": ["x", "admin"]}]}`,
+				`{"users": [{"name": "a", "tags": ["admin"], "banned": [false]}]}`},
+			[]string{`{"users": [{"tags": ["admin"]}]}`,
+				`{"users": [{"name": "a", "tags": ["admin"], "banned": [true]}]}`,
+				`{"users": [{"name": "a", "tags": ["x"]}]}`},
+		},
+		{
+			`$.xs[?!(@.a == 1) && !@.b]`,
+			[]string{`{"xs": [{"a": 2}]}`, `{"xs": [{"c": 1}]}`},
+			[]string{`{"xs": [{"a": 1}]}`, `{"xs": [{"a": 2, "b": false}]}`},
+		},
+		{
+			`$.xs[?length(@.ys) >= 2 && match(@.id, "[a-z]+") && search(@.note, 'fo+')]`,
+			[]string{`{"xs": [{"ys": [1, 2], "id": "abc", "note": "a foo"}]}`},
+			[]string{`{"xs": [{"ys": [1], "id": "abc", "note": "a foo"}]}`,
+				`{"xs": [{"ys": [1, 2], "id": "abc1", "note": "a foo"}]}`,
+				`{"xs": [{"ys": [1, 2], "id": "abc", "note": "bar"}]}`,
+				`{"xs": [{"ys": "ab", "id": "abc", "note": "foo"}]}`},
+		},
+		{
+			`$.xs[?value(@.n) == -1.5e0 || @.s == "é\"" || @.z == null]`,
+			[]string{`{"xs": [{"n": -1.5}]}`, `{"xs": [{"s": "é\""}]}`, `{"xs": [{"z": null}]}`},
+			[]string{`{"xs": [{"n": 1.5}]}`, `{"xs": [{"s": "e"}]}`, `{"xs": [{"y": null}]}`},
+		},
+	}
+
+	for _, test := range tests {
+		expr, err := ParseJSONPathFilter(test.path)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", test.path, err)
+		}
+
+		var trans Transformer
+		fast := NewFastMatcher(trans.Transform([]Expression{expr}))
+		slow := NewSlowMatcher([]Expression{expr})
+
+		for _, doc := range append(append([]string{}, test.matches...), test.misses...) {
+			expected := false
+			for _, match := range test.matches {
+				if doc == match {
+					expected = true
+				}
+			}
+
+			for _, m := range []Matcher{fast, slow} {
+				m.Reset()
+				matched, err := m.Match([]byte(doc))
+				if err != nil {
+					t.Fatalf("failed to match %s: %v", doc, err)
+				}
+				if matched != expected {
+					t.Errorf("%T: %s matched %v, expected %v\npath: %s\nexpression: %v",
+						m, doc, matched, expected, test.path, expr)
+				}
+			}
+		}
+	}
+}
+
+func TestParseJSONPathFilterTree(t *testing.T) {
+	assert := assert.New(t)
+
+	expr, err := ParseJSONPathFilter(`$.a[?@.b[1] == 'x']`)
+	assert.Nil(err)
+	assert.Equal(AnyInExpr{1, FieldExpr{0, []string{"a"}},
+		EqualsExpr{FieldExpr{1, []string{"b", "[1]"}}, ValueExpr{"x"}}}, expr)
+}
+
+func TestParseJSONPathFilterLongQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	// Long queries are built without copying the path for each segment
+	expr, err := ParseJSONPathFilter(`$.a[?@` + strings.Repeat(".b", 20000) + strings.Repeat("[0]", 20000) + ` == 1]`)
+	if assert.Nil(err) {
+		assert.Len(expr.(AnyInExpr).SubExpr.(EqualsExpr).Lhs.(FieldExpr).Path, 40000)
+	}
+}
+
+func TestParseJSONPathFilterErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		path string
+		err  string
+	}{
+		{`$.a.b`, "1:1: query does not contain a filter selector"},
+		{`a[?@.b]`, "1:1: expected `$`"},
+		{`$..a[?@.b]`, "1:2: descendant segments are not supported"},
+		{`$.*[?@.b]`, "1:3: wildcard selectors are not supported"},
+		{`$[1:2][?@.b]`, "1:3: array slice selectors are not supported"},
+		{`$[-1][?@.b]`, "1:3: negative indexes are not supported"},
+		{`$['a','b'][?@.b]`, "1:6: multiple selectors in one segment are not supported"},
+		{`$[?@.b]`, "1:3: filter selectors are not supported on `$`, " +
+			"as they only select the elements of arrays and not the members of objects"},
+		{`$.a[?@.a = 1]`, "1:10: expected `==`"},
+		{`$.a[?@.a == 1`, "1:14: expected `]`"},
+		{`$.a[?@.a == 1] x`, "1:15: unexpected ` `"},
+		{`$.a[?!@.a == 1]`, "1:7: a comparison must be in parentheses to be negated"},
+		{`$.a[?1 == 1]`, "1:8: comparing two literals is not supported"},
+		{`$.a[?@.a[?@.b] == 1]`, "1:6: expected a literal, singular query or function which returns a value"},
+		{`$.a[?length(@.a)]`, "1:6: expected a comparison"},
+		{`$.a[?count(@.a) > 1]`, "1:6: count() is not supported"},
+		{`$.a[?foo(@.a)]`, "1:6: unknown function `foo`"},
+		{`$.a[?match(@.a)]`, "1:6: match() takes 2 argument(s)"},
+		{`$.a[?match(@.a, @.b)]`, "1:17: match() requires a string literal pattern"},
+		{`$.a[?search("a", "b")]`, "1:13: search() only supports a singular query as its first argument"},
+		{`$.a[?match(@.a, "(")]`, "1:17: invalid pattern: error parsing regexp: missing closing ): `^(?:()$`"},
+		{`$.a[?@.a == 'x\q']`, "1:15: invalid escape sequence"},
+		{`$.a[?@.a == 01]`, "1:13: invalid number"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseJSONPathFilter(test.path)
+		if !assert.NotNil(err, test.path) {
+			continue
+		}
+		assert.IsType(&ParseError{}, err)
+		assert.Equal(test.err, err.Error(), test.path)
+	}
+}
+
+func TestParseJSONPathFilterDepth(t *testing.T) {
+	assert := assert.New(t)
+
+	nested := func(open string, count int, inner string) string {
+		return `$.a[?` + strings.Repeat(open, count) + inner + strings.Repeat(")", count) + `]`
+	}
+
+	_, err := ParseJSONPathFilter(`$.a[?` + strings.Repeat("value(", 50) + "@.x" + strings.Repeat(")", 50) + ` == 1]`)
+	assert.Nil(err)
+
+	for _, path := range []string{
+		nested("(", 10000, "@.x"),
+		nested("!(", 10000, "@.x"),
+		`$.a[?` + strings.Repeat("value(", 200) + "@.x" + strings.Repeat(")", 200) + ` == 1]`,
+		`$.a[?` + strings.Repeat("value(", 1000000) + "@.x" + strings.Repeat(")", 1000000) + ` == 1]`,
+	} {
+		_, err := ParseJSONPathFilter(path)
+		assert.IsType(&ParseError{}, err)
+		assert.True(errors.Is(err, ErrorFilterExpressionTooDeep))
+	}
+}
@@ -0,0 +1,659 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONSchema is the subset of a JSON Schema (draft 2020-12) which describes
+// the shape of documents: the `type`, `properties`, `additionalProperties`,
+// `items`, `prefixItems`, `anyOf`, `oneOf`, `$ref` and `$defs` keywords, as
+// well as the boolean `true` and `false` schemas.  Keywords which constrain
+// values further than their type are ignored.
+type JSONSchema struct {
+	// Types lists the types a value may have, any type is allowed when it
+	// is empty.  The `integer` type is treated as FieldTypeNumber.
+	Types []FieldType
+
+	Properties           map[string]*JSONSchema
+	AdditionalProperties *JSONSchema
+	Items                *JSONSchema
+	PrefixItems          []*JSONSchema
+
+	// AnyOf lists alternative schemas, a value must match at least one of
+	// them.  Both `anyOf` and `oneOf` are parsed into this.
+	AnyOf []*JSONSchema
+
+	// Never is set for the `false` schema, which no value matches.
+	Never bool
+}
+
+type jsonSchemaParser struct {
+	root *JSONSchema
+	defs map[string]interface{}
+	refs map[string]*JSONSchema
+}
+
+func (p *jsonSchemaParser) parseRef(ref string) (*JSONSchema, error) {
+	if ref == "#" {
+		return p.root, nil
+	}
+
+	var name string
+	if strings.HasPrefix(ref, "#/$defs/") {
+		name = ref[len("#/$defs/"):]
+	} else if strings.HasPrefix(ref, "#/definitions/") {
+		name = ref[len("#/definitions/"):]
+	} else {
+		return nil, fmt.Errorf("unsupported $ref `%s`", ref)
+	}
+
+	if schema, ok := p.refs[name]; ok {
+		return schema, nil
+	}
+
+	def, ok := p.defs[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined $ref `%s`", ref)
+	}
+
+	// Register the schema before parsing it so that recursive references
+	// resolve to the same schema.
+	schema := &JSONSchema{}
+	p.refs[name] = schema
+	return schema, p.parseInto(schema, def)
+}
+
+func (p *jsonSchemaParser) parse(data interface{}) (*JSONSchema, error) {
+	schema := &JSONSchema{}
+	return schema, p.parseInto(schema, data)
+}
+
+func (p *jsonSchemaParser) parseList(data interface{}, keyword string) ([]*JSONSchema, error) {
+	list, ok := data.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be an array", keyword)
+	}
+
+	var schemas []*JSONSchema
+	for _, item := range list {
+		schema, err := p.parse(item)
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas, nil
+}
+
+func parseJSONSchemaType(name interface{}) (FieldType, error) {
+	switch name {
+	case "null":
+		return FieldTypeNull, nil
+	case "boolean":
+		return FieldTypeBoolean, nil
+	case "number", "integer":
+		return FieldTypeNumber, nil
+	case "string":
+		return FieldTypeString, nil
+	case "array":
+		return FieldTypeArray, nil
+	case "object":
+		return FieldTypeObject, nil
+	}
+	return FieldTypeUnknown, fmt.Errorf("unsupported type `%v`", name)
+}
+
+func (p *jsonSchemaParser) parseInto(schema *JSONSchema, data interface{}) error {
+	if allowed, ok := data.(bool); ok {
+		schema.Never = !allowed
+		return nil
+	}
+
+	fields, ok := data.(map[string]interface{})
+	if !ok {
+		return errors.New("schema must be an object or a boolean")
+	}
+
+	if ref, ok := fields["$ref"]; ok {
+		refName, ok := ref.(string)
+		if !ok {
+			return errors.New("$ref must be a string")
+		}
+		refSchema, err := p.parseRef(refName)
+		if err != nil {
+			return err
+		}
+		schema.AnyOf = append(schema.AnyOf, refSchema)
+	}
+
+	switch types := fields["type"].(type) {
+	case nil:
+	case []interface{}:
+		for _, name := range types {
+			fieldType, err := parseJSONSchemaType(name)
+			if err != nil {
+				return err
+			}
+			schema.Types = append(schema.Types, fieldType)
+		}
+	default:
+		fieldType, err := parseJSONSchemaType(types)
+		if err != nil {
+			return err
+		}
+		schema.Types = []FieldType{fieldType}
+	}
+
+	if properties, ok := fields["properties"]; ok {
+		propertyMap, ok := properties.(map[string]interface{})
+		if !ok {
+			return errors.New("properties must be an object")
+		}
+
+		schema.Properties = make(map[string]*JSONSchema)
+		for name, property := range propertyMap {
+			propertySchema, err := p.parse(property)
+			if err != nil {
+				return fmt.Errorf("property `%s`: %s", name, err)
+			}
+			schema.Properties[name] = propertySchema
+		}
+	}
+
+	var err error
+	if additional, ok := fields["additionalProperties"]; ok {
+		if schema.AdditionalProperties, err = p.parse(additional); err != nil {
+			return err
+		}
+	}
+	if items, ok := fields["items"]; ok {
+		if schema.Items, err = p.parse(items); err != nil {
+			return err
+		}
+	}
+	if prefixItems, ok := fields["prefixItems"]; ok {
+		if schema.PrefixItems, err = p.parseList(prefixItems, "prefixItems"); err != nil {
+			return err
+		}
+	}
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		if alternatives, ok := fields[keyword]; ok {
+			schemas, err := p.parseList(alternatives, keyword)
+			if err != nil {
+				return err
+			}
+			schema.AnyOf = append(schema.AnyOf, schemas...)
+		}
+	}
+
+	return nil
+}
+
+// ParseJSONSchema parses a JSON Schema document for use with
+// ValidateExpressions.
+func ParseJSONSchema(data []byte) (*JSONSchema, error) {
+	var root interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	parser := &jsonSchemaParser{
+		root: &JSONSchema{},
+		refs: make(map[string]*JSONSchema),
+	}
+	if fields, ok := root.(map[string]interface{}); ok {
+		for _, keyword := range []string{"definitions", "$defs"} {
+			if defs, ok := fields[keyword].(map[string]interface{}); ok {
+				if parser.defs == nil {
+					parser.defs = make(map[string]interface{})
+				}
+				for name, def := range defs {
+					parser.defs[name] = def
+				}
+			}
+		}
+	}
+
+	if err := parser.parseInto(parser.root, root); err != nil {
+		return nil, fmt.Errorf("invalid schema: %s", err)
+	}
+	return parser.root, nil
+}
+
+// schemaSet is the set of schemas which a value may match, resolved from
+// any `anyOf` alternatives.  A nil schemaSet allows any value.
+type schemaSet []*JSONSchema
+
+func newSchemaSet(schema *JSONSchema) schemaSet {
+	if schema == nil {
+		return nil
+	}
+
+	var set schemaSet
+	var visited map[*JSONSchema]bool
+	var add func(schema *JSONSchema) bool
+	add = func(schema *JSONSchema) bool {
+		if visited[schema] {
+			return true
+		}
+		if visited == nil {
+			visited = make(map[*JSONSchema]bool)
+		}
+		visited[schema] = true
+
+		if len(schema.AnyOf) == 0 {
+			if !schema.Never && len(schema.Types) == 0 && schema.Properties == nil &&
+				schema.AdditionalProperties == nil && schema.Items == nil && schema.PrefixItems == nil {
+				// An empty schema allows anything.
+				return false
+			}
+			set = append(set, schema)
+			return true
+		}
+
+		// Only the types of a schema are checked against its alternatives,
+		// so a schema which lists its own types is used as is and one which
+		// does not is replaced by its alternatives.
+		if len(schema.Types) > 0 {
+			set = append(set, schema)
+			return true
+		}
+		for _, alternative := range schema.AnyOf {
+			if !add(alternative) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if !add(schema) {
+		return nil
+	}
+	if set == nil {
+		// None of the alternatives allow anything.
+		return schemaSet{&JSONSchema{Never: true}}
+	}
+	return set
+}
+
+// types returns the types which a value may have, or nil if it may have
+// any type.
+func (set schemaSet) types() []FieldType {
+	if set == nil {
+		return nil
+	}
+
+	typeSet := make(map[FieldType]bool)
+	for _, schema := range set {
+		if schema.Never {
+			continue
+		}
+		if len(schema.Types) == 0 {
+			return nil
+		}
+		for _, fieldType := range schema.Types {
+			typeSet[fieldType] = true
+		}
+	}
+
+	types := []FieldType{}
+	for fieldType := range typeSet {
+		types = append(types, fieldType)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+	return types
+}
+
+func (set schemaSet) allows(fieldType FieldType) bool {
+	types := set.types()
+	if types == nil {
+		return true
+	}
+	for _, allowed := range types {
+		if allowed == fieldType {
+			return true
+		}
+	}
+	return false
+}
+
+// property returns the schemas for a field of an object, and whether the
+// field can exist at all.
+func (set schemaSet) property(name string) (schemaSet, bool) {
+	if set == nil {
+		return nil, true
+	}
+
+	var props schemaSet
+	exists := false
+	for _, schema := range set {
+		if schema.Never || !(schemaSet{schema}).allows(FieldTypeObject) {
+			continue
+		}
+
+		propSchema := schema.AdditionalProperties
+		if prop, ok := schema.Properties[name]; ok {
+			propSchema = prop
+		}
+
+		propSet := newSchemaSet(propSchema)
+		if propSet == nil {
+			return nil, true
+		}
+		if len(propSet.types()) > 0 || propSet.types() == nil {
+			exists = true
+			props = append(props, propSet...)
+		}
+	}
+	return props, exists
+}
+
+// item returns the schemas for an element of an array, where index is -1
+// for an element in an unknown position.
+func (set schemaSet) item(index int) (schemaSet, bool) {
+	if set == nil {
+		return nil, true
+	}
+
+	var items schemaSet
+	exists := false
+	for _, schema := range set {
+		if schema.Never || !(schemaSet{schema}).allows(FieldTypeArray) {
+			continue
+		}
+
+		var itemSchemas []*JSONSchema
+		if index >= 0 && index < len(schema.PrefixItems) {
+			itemSchemas = []*JSONSchema{schema.PrefixItems[index]}
+		} else {
+			if index < 0 {
+				itemSchemas = append(itemSchemas, schema.PrefixItems...)
+			}
+			itemSchemas = append(itemSchemas, schema.Items)
+		}
+
+		for _, itemSchema := range itemSchemas {
+			itemSet := newSchemaSet(itemSchema)
+			if itemSet == nil {
+				return nil, true
+			}
+			if len(itemSet.types()) > 0 || itemSet.types() == nil {
+				exists = true
+				items = append(items, itemSet...)
+			}
+		}
+	}
+	return items, exists
+}
+
+func formatFieldTypes(types []FieldType) string {
+	var names []string
+	for _, fieldType := range types {
+		names = append(names, fieldType.String())
+	}
+	if len(names) == 0 {
+		return "nothing"
+	}
+	return strings.Join(names, " or ")
+}
+
+// SchemaError describes a part of a filter which does not agree with the
+// schema of the documents it will be matched against.
+type SchemaError struct {
+	Path    string
+	Message string
+}
+
+func (err SchemaError) Error() string {
+	return fmt.Sprintf("%s: %s", err.Path, err.Message)
+}
+
+// SchemaErrors is the list of all the problems found when validating
+// expressions against a schema.
+type SchemaErrors []SchemaError
+
+func (errs SchemaErrors) Error() string {
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type schemaValidator struct {
+	slots  map[SlotID]schemaSet
+	paths  map[SlotID]string
+	errors SchemaErrors
+}
+
+func (v *schemaValidator) fail(path string, format string, args ...interface{}) {
+	v.errors = append(v.errors, SchemaError{path, fmt.Sprintf(format, args...)})
+}
+
+func parseArrayIndexElem(elem string) (int, bool) {
+	if !strings.HasPrefix(elem, "[") || !strings.HasSuffix(elem, "]") {
+		return 0, false
+	}
+	idx, err := strconv.Atoi(elem[1 : len(elem)-1])
+	if err != nil || idx < 0 {
+		return 0, false
+	}
+	return idx, true
+}
+
+func fastValFieldType(val FastVal) FieldType {
+	switch {
+	case val.IsNull():
+		return FieldTypeNull
+	case val.IsBoolean():
+		return FieldTypeBoolean
+	case val.IsNumeric():
+		return FieldTypeNumber
+	case val.IsString():
+		return FieldTypeString
+	case val.IsTime():
+		return FieldTypeTime
+	}
+	return FieldTypeUnknown
+}
+
+// refTypes returns the types which a data reference may produce during
+// matching, or nil if it may produce any type.
+func (v *schemaValidator) refTypes(ref DataRef, node schemaSet, path string) []FieldType {
+	switch ref := ref.(type) {
+	case nil, activeLitRef:
+		return node.types()
+	case SlotRef:
+		if set, ok := v.slots[ref.Slot]; ok {
+			return set.types()
+		}
+		return nil
+	case FastVal:
+		if fieldType := fastValFieldType(ref); fieldType != FieldTypeUnknown {
+			return []FieldType{fieldType}
+		}
+		return nil
+	case FuncRef:
+		expectedType, resultType := funcFieldTypes(ref.FuncName)
+
+		for _, param := range ref.Params {
+			paramTypes := v.refTypes(param, node, path)
+			if expectedType != FieldTypeUnknown && !fieldTypesCompatible(paramTypes, []FieldType{expectedType}) {
+				v.fail(v.refPath(param, path), "%s expects a %s but the field is %s",
+					ref.FuncName, expectedType, formatFieldTypes(paramTypes))
+			}
+		}
+		return []FieldType{resultType}
+	}
+	return nil
+}
+
+func (v *schemaValidator) refPath(ref DataRef, path string) string {
+	if slotRef, ok := ref.(SlotRef); ok {
+		if slotPath, ok := v.paths[slotRef.Slot]; ok {
+			return slotPath
+		}
+	}
+	return path
+}
+
+// fieldTypesCompatible checks whether values of any of the lhs types can
+// be compared with values of any of the rhs types without relying on
+// cross-type collation.  Times are compared with strings by parsing them.
+func fieldTypesCompatible(lhs, rhs []FieldType) bool {
+	if lhs == nil || rhs == nil {
+		return true
+	}
+	for _, lhsType := range lhs {
+		for _, rhsType := range rhs {
+			if lhsType == rhsType ||
+				(lhsType == FieldTypeTime && rhsType == FieldTypeString) ||
+				(lhsType == FieldTypeString && rhsType == FieldTypeTime) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v *schemaValidator) validateOp(op OpNode, node schemaSet, path string) {
+	lhsTypes := v.refTypes(op.Lhs, node, path)
+
+	switch op.Op {
+	case OpTypeExists:
+		return
+	case OpTypeMatches:
+		if !fieldTypesCompatible(lhsTypes, []FieldType{FieldTypeString}) {
+			v.fail(v.refPath(op.Lhs, path), "cannot match a regular expression against %s",
+				formatFieldTypes(lhsTypes))
+		}
+		return
+	}
+
+	rhsTypes := v.refTypes(op.Rhs, node, path)
+	if !fieldTypesCompatible(lhsTypes, rhsTypes) {
+		v.fail(v.refPath(op.Lhs, path), "cannot compare %s with %s",
+			formatFieldTypes(lhsTypes), formatFieldTypes(rhsTypes))
+	}
+}
+
+func (v *schemaValidator) validateLoop(loop LoopNode, node schemaSet, path string) {
+	target := node
+	targetPath := path
+	if slotRef, ok := loop.Target.(SlotRef); ok {
+		target = v.slots[slotRef.Slot]
+		targetPath = v.refPath(slotRef, path)
+	}
+
+	items, exists := target.item(-1)
+	if !exists {
+		v.fail(targetPath, "cannot loop over %s", formatFieldTypes(target.types()))
+		return
+	}
+
+	v.validateNode(loop.Node, items, targetPath+"[]")
+}
+
+func (v *schemaValidator) validateNode(execNode *ExecNode, node schemaSet, path string) {
+	if execNode.StoreId > 0 {
+		v.slots[execNode.StoreId] = node
+		v.paths[execNode.StoreId] = path
+	}
+
+	var elems []string
+	for elem := range execNode.Elems {
+		elems = append(elems, elem)
+	}
+	sort.Strings(elems)
+
+	for _, elem := range elems {
+		var child schemaSet
+		var exists bool
+		var childPath string
+		if idx, ok := parseArrayIndexElem(elem); ok {
+			childPath = path + elem
+			if !node.allows(FieldTypeArray) {
+				v.fail(childPath, "cannot index into %s", formatFieldTypes(node.types()))
+				continue
+			}
+			child, exists = node.item(idx)
+		} else {
+			childPath = path + "." + elem
+			if !node.allows(FieldTypeObject) {
+				v.fail(childPath, "cannot access a field of %s", formatFieldTypes(node.types()))
+				continue
+			}
+			child, exists = node.property(elem)
+		}
+
+		if !exists {
+			v.fail(childPath, "unknown field")
+			continue
+		}
+		v.validateNode(execNode.Elems[elem], child, childPath)
+	}
+
+	for _, op := range execNode.Ops {
+		v.validateOp(op, node, path)
+	}
+	for _, loop := range execNode.Loops {
+		v.validateLoop(loop, node, path)
+	}
+
+	if execNode.After != nil {
+		for _, op := range execNode.After.Ops {
+			v.validateOp(op, node, path)
+		}
+		for _, loop := range execNode.After.Loops {
+			v.validateLoop(loop, node, path)
+		}
+	}
+}
+
+// ValidateMatchDef checks the fields used by a MatchDef against a schema,
+// returning SchemaErrors describing any fields which the schema does not
+// allow, comparisons between incompatible types and indexing into values
+// which are not arrays.
+func ValidateMatchDef(def *MatchDef, schema *JSONSchema) error {
+	if def.ParseNode == nil {
+		return nil
+	}
+
+	v := &schemaValidator{
+		slots: make(map[SlotID]schemaSet),
+		paths: make(map[SlotID]string),
+	}
+	if def.MetaNode != nil {
+		// The metadata is not part of the document itself, and is checked
+		// first so that comparisons with it in the document know its type
+		v.validateNode(def.MetaNode, newSchemaSet(documentMetaSchema), "META()")
+	}
+	v.validateNode(def.ParseNode, newSchemaSet(schema), "$doc")
+
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	return nil
+}
+
+// ValidateExpressions checks a set of expressions against the schema of
+// the documents they will be matched against.
+func ValidateExpressions(exprs []Expression, schema *JSONSchema) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to transform expressions: %v", r)
+		}
+	}()
+
+	var trans Transformer
+	return ValidateMatchDef(trans.Transform(exprs), schema)
+}
@@ -0,0 +1,135 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testJSONSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string"},
+		"age": {"type": ["integer", "null"]},
+		"isActive": {"type": "boolean"},
+		"registered": {"type": "string"},
+		"address": {"$ref": "#/$defs/address"},
+		"tags": {"type": "array", "items": {"type": "string"}},
+		"point": {"type": "array", "prefixItems": [{"type": "number"}, {"type": "string"}], "items": false},
+		"friends": {"type": "array", "items": {"type": "object", "properties": {"name": {"type": "string"}}}},
+		"extra": {}
+	},
+	"additionalProperties": false,
+	"$defs": {
+		"address": {
+			"type": "object",
+			"properties": {
+				"city": {"type": "string"},
+				"parent": {"$ref": "#/$defs/address"}
+			},
+			"additionalProperties": false
+		}
+	}
+}`
+
+func TestParseJSONSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	schema, err := ParseJSONSchema([]byte(testJSONSchema))
+	assert.Nil(err)
+	assert.Equal([]FieldType{FieldTypeObject}, schema.Types)
+	assert.Equal([]FieldType{FieldTypeNumber, FieldTypeNull}, schema.Properties["age"].Types)
+	assert.True(schema.AdditionalProperties.Never)
+
+	// References resolve to a single shared schema, even when recursive
+	address := schema.Properties["address"].AnyOf[0]
+	assert.Equal(address, address.Properties["parent"].AnyOf[0])
+
+	_, err = ParseJSONSchema([]byte(`{"type": "date"}`))
+	assert.NotNil(err)
+	_, err = ParseJSONSchema([]byte(`{"$ref": "#/$defs/missing"}`))
+	assert.NotNil(err)
+	_, err = ParseJSONSchema([]byte(`{"properties": []}`))
+	assert.NotNil(err)
+}
+
+func TestValidateExpressions(t *testing.T) {
+	assert := assert.New(t)
+
+	schema, err := ParseJSONSchema([]byte(testJSONSchema))
+	assert.Nil(err)
+
+	validate := func(filter string) error {
+		_, fe, err := NewBoundedFilterExpressionParser(filter)
+		if !assert.Nil(err, filter) {
+			return nil
+		}
+		expr, err := fe.OutputExpression()
+		if !assert.Nil(err, filter) {
+			return nil
+		}
+		return ValidateExpressions([]Expression{expr}, schema)
+	}
+
+	valid := []string{
+		`name = "x" AND age > 5`,
+		`age IS NULL OR age IS NOT MISSING`,
+		`address.city = "x" AND EXISTS(address.parent.parent.city)`,
+		`DATE(registered) > DATE("2019-01-01")`,
+		`registered < "2019-01-01T00:00:00Z"`,
+		`tags[0] = "a" AND point[0] > 5 AND point[1] = "x"`,
+		`friends[1].name = "x"`,
+		`ABS(age) < 5 AND isActive = true`,
+		`REGEXP_CONTAINS(name, "^a")`,
+		`extra.anything.goes = 5`,
+	}
+	for _, filter := range valid {
+		assert.Nil(validate(filter), filter)
+	}
+
+	invalid := map[string]string{
+		`nickname = "x"`:             `$doc.nickname: unknown field`,
+		`address.town = "x"`:         `$doc.address.town: unknown field`,
+		`name = 5`:                   `$doc.name: cannot compare string with number`,
+		`age = "5"`:                  `$doc.age: cannot compare null or number with string`,
+		`name[0] = "x"`:              `$doc.name[0]: cannot index into string`,
+		`address[0] = "x"`:           `$doc.address[0]: cannot index into object`,
+		`name.first = "x"`:           `$doc.name.first: cannot access a field of string`,
+		`point[2] = 1`:               `$doc.point[2]: unknown field`,
+		`point[1] > 5`:               `$doc.point[1]: cannot compare string with number`,
+		`ABS(name) = 5`:              `$doc.name: mathAbs expects a number but the field is string`,
+		`REGEXP_CONTAINS(age, "^1")`: `$doc.age: cannot match a regular expression against null or number`,
+	}
+	for filter, expected := range invalid {
+		err := validate(filter)
+		if assert.NotNil(err, filter) {
+			assert.Equal(expected, err.Error(), filter)
+		}
+	}
+
+	// All of the problems in a filter are reported together
+	err = validate(`nickname = "x" OR name = 5`)
+	assert.Len(err, 2)
+
+	// Loops check the items of the array they iterate over
+	tags := FieldExpr{0, []string{"tags"}}
+	assert.Nil(ValidateExpressions([]Expression{
+		AnyInExpr{1, tags, EqualsExpr{FieldExpr{1, nil}, ValueExpr{"a"}}},
+	}, schema))
+	assert.Equal(`$doc.tags[]: cannot compare string with number`, ValidateExpressions([]Expression{
+		AnyInExpr{1, tags, EqualsExpr{FieldExpr{1, nil}, ValueExpr{5}}},
+	}, schema).Error())
+	assert.Equal(`$doc.name: cannot loop over string`, ValidateExpressions([]Expression{
+		AnyInExpr{1, FieldExpr{0, []string{"name"}}, EqualsExpr{FieldExpr{1, nil}, ValueExpr{5}}},
+	}, schema).Error())
+
+	_, err = GetFilterExpressionMatcherWithSchema(`address.town = "x"`, schema)
+	assert.NotNil(err)
+	matcher, err := GetFilterExpressionMatcherWithSchema(`address.city = "x"`, schema)
+	assert.Nil(err)
+	matched, err := matcher.Match([]byte(`{"address":{"city":"x"}}`))
+	assert.Nil(err)
+	assert.True(matched)
+}
@@ -22,11 +22,13 @@ const (
 	tknNull
 	tknTrue
 	tknFalse
+	// tknBinary is a binary value, which only binary encodings can express
+	tknBinary
 	tknEnd
 )
 
 func isLiteralToken(token tokenType) bool {
-	return token >= tknString && token <= tknFalse
+	return token >= tknString && token <= tknBinary
 }
 
 func tokenToText(token tokenType) string {
@@ -59,6 +61,8 @@ func tokenToText(token tokenType) string {
 		return "true"
 	case tknFalse:
 		return "false"
+	case tknBinary:
+		return "binary"
 	case tknEnd:
 		return "end"
 	}
@@ -122,6 +126,10 @@ func (tkn *jsonTokenizer) Seek(pos int) {
 	tkn.pos = pos
 }
 
+func (tkn *jsonTokenizer) Slice(start, end int) []byte {
+	return tkn.data[start:end]
+}
+
 func (tkn *jsonTokenizer) Step() (tokenType, []byte, int, error) {
 	// Bring everying local for optimization purposes
 	dataSlice := tkn.data
@@ -0,0 +1,521 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"fmt"
+	"math/big"
+	"regexp/syntax"
+	"strings"
+)
+
+// FieldType describes the type of value held by a field, as far as it is
+// relevant to how the value will be compared.
+type FieldType int
+
+const (
+	FieldTypeUnknown FieldType = iota
+	FieldTypeNull
+	FieldTypeBoolean
+	FieldTypeNumber
+	FieldTypeString
+	FieldTypeTime
+	FieldTypeArray
+	FieldTypeObject
+)
+
+func (fieldType FieldType) String() string {
+	switch fieldType {
+	case FieldTypeUnknown:
+		return "unknown"
+	case FieldTypeNull:
+		return "null"
+	case FieldTypeBoolean:
+		return "boolean"
+	case FieldTypeNumber:
+		return "number"
+	case FieldTypeString:
+		return "string"
+	case FieldTypeTime:
+		return "time"
+	case FieldTypeArray:
+		return "array"
+	case FieldTypeObject:
+		return "object"
+	}
+	return "??unknown??"
+}
+
+func (fieldType FieldType) isScalar() bool {
+	return fieldType != FieldTypeUnknown && fieldType != FieldTypeArray && fieldType != FieldTypeObject
+}
+
+// FieldSchema describes the types of the fields of the documents a filter
+// will be matched against, keyed by the dotted path of each field.  The
+// elements of an array are described using a `[]` path element, so that
+// `tags.[]` describes every element of the `tags` array.  Fields which are
+// not present in the schema may hold any type.
+type FieldSchema map[string]FieldType
+
+func (schema FieldSchema) lookup(path []string) FieldType {
+	elems := make([]string, len(path))
+	for i, elem := range path {
+		if strings.HasPrefix(elem, "[") && strings.HasSuffix(elem, "]") {
+			elem = "[]"
+		}
+		elems[i] = elem
+	}
+
+	return schema[strings.Join(elems, ".")]
+}
+
+type LintWarningKind int
+
+const (
+	// LintTypeMismatch is reported when a value is used in a way which its
+	// type does not support, such as arithmetic on a string.
+	LintTypeMismatch LintWarningKind = iota
+
+	// LintAlwaysFalse is reported for conditions which cannot be satisfied
+	// by any document.
+	LintAlwaysFalse
+
+	// LintRegexNeverMatches is reported for regular expressions and LIKE
+	// patterns which can never match the value they are applied to.
+	LintRegexNeverMatches
+
+	// LintCrossTypeCollation is reported for comparisons between values of
+	// different types, which are resolved by implicit conversion or by
+	// collation and cause MatcherCollateUsed to be reported at match time.
+	LintCrossTypeCollation
+)
+
+func (kind LintWarningKind) String() string {
+	switch kind {
+	case LintTypeMismatch:
+		return "type mismatch"
+	case LintAlwaysFalse:
+		return "always false"
+	case LintRegexNeverMatches:
+		return "regex never matches"
+	case LintCrossTypeCollation:
+		return "cross-type collation"
+	}
+	return "??unknown??"
+}
+
+// SourcePosition is a position within the text of a filter.  Lines and
+// columns start at 1, and are 0 when the position is not known.
+type SourcePosition struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (pos SourcePosition) IsValid() bool {
+	return pos.Line > 0
+}
+
+func (pos SourcePosition) String() string {
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+}
+
+type LintWarning struct {
+	Kind     LintWarningKind
+	Expr     Expression
+	Position SourcePosition
+	Message  string
+}
+
+func (warning LintWarning) String() string {
+	if warning.Position.IsValid() {
+		return fmt.Sprintf("%s: %s: %s", warning.Position, warning.Kind, warning.Message)
+	}
+	return fmt.Sprintf("%s: %s", warning.Kind, warning.Message)
+}
+
+type linter struct {
+	schema   FieldSchema
+	pos      SourcePosition
+	warnings []LintWarning
+}
+
+func (l *linter) warn(kind LintWarningKind, expr Expression, format string, args ...interface{}) {
+	l.warnings = append(l.warnings, LintWarning{
+		Kind:     kind,
+		Expr:     expr,
+		Position: l.pos,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// fieldType finds the type of a field from the schema, reporting fields
+// which can never exist because their path passes through a scalar.
+func (l *linter) fieldType(expr FieldExpr) FieldType {
+	if expr.Root != 0 || l.schema == nil {
+		return FieldTypeUnknown
+	}
+
+	for i := 1; i < len(expr.Path); i++ {
+		parentType := l.schema.lookup(expr.Path[:i])
+		if parentType.isScalar() {
+			l.warn(LintTypeMismatch, expr, "%s can never exist as %s is a %s",
+				expr, FieldExpr{expr.Root, expr.Path[:i]}, parentType)
+			return FieldTypeUnknown
+		}
+	}
+
+	return l.schema.lookup(expr.Path)
+}
+
+// metaFieldType returns the type of a field of the document metadata, the
+// contents of extended attributes are not known.
+func metaFieldType(path []string) FieldType {
+	if len(path) == 0 {
+		return FieldTypeObject
+	}
+	if len(path) == 1 {
+		if prop, ok := documentMetaSchema.Properties[path[0]]; ok {
+			return prop.Types[0]
+		}
+	}
+	return FieldTypeUnknown
+}
+
+func valueFieldType(value interface{}) FieldType {
+	switch value.(type) {
+	case nil:
+		return FieldTypeNull
+	case bool:
+		return FieldTypeBoolean
+	case string:
+		return FieldTypeString
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, *big.Rat, *big.Int:
+		return FieldTypeNumber
+	}
+	return FieldTypeUnknown
+}
+
+// funcFieldTypes returns the type a function expects its parameters to be,
+// which is FieldTypeUnknown if it accepts anything, and the type it returns.
+func funcFieldTypes(funcName string) (FieldType, FieldType) {
+	switch funcName {
+	case DateFunc:
+		return FieldTypeString, FieldTypeTime
+	case TypeFunc:
+		return FieldTypeUnknown, FieldTypeString
+	case ArrayLengthFunc:
+		return FieldTypeArray, FieldTypeNumber
+	case LowerFunc, UpperFunc, CollateFunc:
+		return FieldTypeString, FieldTypeString
+	}
+	return FieldTypeNumber, FieldTypeNumber
+}
+
+// operandType determines the type an operand will have at match time,
+// checking the parameters of any functions along the way.
+func (l *linter) operandType(expr Expression) FieldType {
+	switch expr := expr.(type) {
+	case FieldExpr:
+		return l.fieldType(expr)
+	case MetaExpr:
+		return metaFieldType(expr.Path)
+	case ValueExpr:
+		return valueFieldType(expr.Value)
+	case TimeExpr:
+		return FieldTypeTime
+	case FuncExpr:
+		expectedType, resultType := funcFieldTypes(expr.FuncName)
+
+		for _, param := range expr.Params {
+			paramType := l.operandType(param)
+			if expectedType != FieldTypeUnknown && paramType != FieldTypeUnknown && paramType != expectedType &&
+				!(expectedType == FieldTypeString && paramType == FieldTypeTime) {
+				l.warn(LintTypeMismatch, expr, "%s expects a %s but %s is a %s",
+					expr.FuncName, expectedType, param, paramType)
+			}
+		}
+		return resultType
+	}
+	return FieldTypeUnknown
+}
+
+func (l *linter) lintComparison(expr Expression, lhs, rhs Expression) {
+	lhsType := l.operandType(lhs)
+	rhsType := l.operandType(rhs)
+
+	if lhsType == FieldTypeUnknown || rhsType == FieldTypeUnknown || lhsType == rhsType {
+		return
+	}
+
+	// Anything can be compared with null, and times are compared with
+	// strings by parsing the string as a time.
+	if lhsType == FieldTypeNull || rhsType == FieldTypeNull {
+		return
+	}
+	if (lhsType == FieldTypeTime && rhsType == FieldTypeString) ||
+		(lhsType == FieldTypeString && rhsType == FieldTypeTime) {
+		return
+	}
+
+	l.warn(LintCrossTypeCollation, expr, "comparing %s (%s) with %s (%s) relies on cross-type collation",
+		lhs, lhsType, rhs, rhsType)
+}
+
+// regexMinLength returns the minimum number of characters which a regular
+// expression consumes when it matches.
+func regexMinLength(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return len(re.Rune)
+	case syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return 1
+	case syntax.OpCapture, syntax.OpPlus:
+		return regexMinLength(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min * regexMinLength(re.Sub[0])
+	case syntax.OpConcat:
+		length := 0
+		for _, sub := range re.Sub {
+			length += regexMinLength(sub)
+		}
+		return length
+	case syntax.OpAlternate:
+		length := -1
+		for _, sub := range re.Sub {
+			if subLength := regexMinLength(sub); length < 0 || subLength < length {
+				length = subLength
+			}
+		}
+		if length < 0 {
+			return 0
+		}
+		return length
+	}
+	return 0
+}
+
+// regexNeverMatches checks whether a regular expression cannot match any
+// input, such as when it has an empty character class or requires text
+// before the start or after the end of the input.
+func regexNeverMatches(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return true
+	case syntax.OpCharClass:
+		return len(re.Rune) == 0
+	case syntax.OpCapture, syntax.OpPlus:
+		return regexNeverMatches(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min > 0 && regexNeverMatches(re.Sub[0])
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if !regexNeverMatches(sub) {
+				return false
+			}
+		}
+		return true
+	case syntax.OpConcat:
+		consumed := false
+		ended := false
+		for _, sub := range re.Sub {
+			if regexNeverMatches(sub) {
+				return true
+			}
+
+			switch sub.Op {
+			case syntax.OpBeginText:
+				if consumed {
+					return true
+				}
+			case syntax.OpEndText:
+				ended = true
+			default:
+				if regexMinLength(sub) > 0 {
+					if ended {
+						return true
+					}
+					consumed = true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (l *linter) lintLike(expr LikeExpr) {
+	patternKind := "regular expressions"
+	likePattern, isLikePattern := expr.Rhs.(LikePatternExpr)
+	if isLikePattern {
+		patternKind = "LIKE patterns"
+	}
+
+	lhsType := l.operandType(expr.Lhs)
+	if lhsType != FieldTypeUnknown && lhsType != FieldTypeString {
+		l.warn(LintRegexNeverMatches, expr, "%s is a %s, but %s only match strings",
+			expr.Lhs, lhsType, patternKind)
+		return
+	}
+
+	if isLikePattern {
+		if _, err := CompileLikePattern(likePattern.Pattern, likePattern.Escape); err != nil {
+			l.warn(LintRegexNeverMatches, expr, "invalid LIKE pattern %s: %v", likePattern, err)
+		}
+		return
+	}
+
+	regex, ok := expr.Rhs.(RegexExpr)
+	if !ok {
+		return
+	}
+	pattern, ok := regex.Regex.(string)
+	if !ok {
+		return
+	}
+
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		l.warn(LintRegexNeverMatches, expr, "invalid regular expression %s: %v", regex, err)
+		return
+	}
+
+	if regexNeverMatches(parsed.Simplify()) {
+		l.warn(LintRegexNeverMatches, expr, "regular expression %s can never match", regex)
+	}
+}
+
+// lintConjunction checks for terms of an AND which contradict each other.
+func (l *linter) lintConjunction(expr AndExpr) {
+	if _, ok := OptimizeExpression(expr).(FalseExpr); !ok {
+		return
+	}
+
+	// Terms which are false by themselves are reported on their own
+	for _, term := range expr {
+		if _, ok := OptimizeExpression(term).(FalseExpr); ok {
+			return
+		}
+	}
+
+	l.warn(LintAlwaysFalse, expr, "the conditions of this AND contradict each other")
+}
+
+func (l *linter) lint(expr Expression) {
+	switch expr := expr.(type) {
+	case NotExpr:
+		l.lint(expr.SubExpr)
+	case AndExpr:
+		l.lintConjunction(expr)
+		for _, subExpr := range expr {
+			l.lint(subExpr)
+		}
+	case OrExpr:
+		for _, subExpr := range expr {
+			l.lint(subExpr)
+		}
+	case AnyInExpr:
+		l.operandType(expr.InExpr)
+		l.lint(expr.SubExpr)
+	case EveryInExpr:
+		l.operandType(expr.InExpr)
+		l.lint(expr.SubExpr)
+	case AnyEveryInExpr:
+		l.operandType(expr.InExpr)
+		l.lint(expr.SubExpr)
+	case ExistsExpr:
+		l.operandType(expr.SubExpr)
+	case NotExistsExpr:
+		l.operandType(expr.SubExpr)
+	case EqualsExpr:
+		l.lintComparison(expr, expr.Lhs, expr.Rhs)
+	case NotEqualsExpr:
+		l.lintComparison(expr, expr.Lhs, expr.Rhs)
+	case LessThanExpr:
+		l.lintComparison(expr, expr.Lhs, expr.Rhs)
+	case LessEqualsExpr:
+		l.lintComparison(expr, expr.Lhs, expr.Rhs)
+	case GreaterThanExpr:
+		l.lintComparison(expr, expr.Lhs, expr.Rhs)
+	case GreaterEqualsExpr:
+		l.lintComparison(expr, expr.Lhs, expr.Rhs)
+	case LikeExpr:
+		l.lintLike(expr)
+	}
+}
+
+// LintExpression statically checks an expression for conditions which are
+// likely to be mistakes, using the optional schema to determine the types
+// of fields.  As expressions do not record where they came from, the
+// warnings have no positions; use LintFilterExpression for those.
+func LintExpression(expr Expression, schema FieldSchema) []LintWarning {
+	l := &linter{schema: schema}
+	l.lint(expr)
+	return l.warnings
+}
+
+func (l *linter) lintFilterInner(fe *FEInnerExpression) error {
+	for _, andExpr := range fe.Expr {
+		if len(andExpr.Expr) > 1 {
+			expr, err := andExpr.OutputExpression()
+			if err != nil {
+				return err
+			}
+			if conjunction, ok := expr.(AndExpr); ok {
+				l.pos = SourcePosition{andExpr.Pos.Offset, andExpr.Pos.Line, andExpr.Pos.Column}
+				l.lintConjunction(conjunction)
+			}
+		}
+
+		for _, term := range andExpr.Expr {
+			var err error
+			if term.SubExpr != nil {
+				err = l.lintFilterInner(term.SubExpr)
+			} else if term.Expr != nil {
+				err = l.lintFilterCondition(term.Expr)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *linter) lintFilterCondition(fe *FECondition) error {
+	for fe.Not != nil {
+		fe = fe.Not
+	}
+	if fe.Operand == nil {
+		return nil
+	}
+
+	expr, err := fe.Operand.OutputExpression()
+	if err != nil {
+		return err
+	}
+
+	pos := fe.Operand.Pos
+	l.pos = SourcePosition{pos.Offset, pos.Line, pos.Column}
+	l.lint(expr)
+	return nil
+}
+
+// LintFilterExpression parses a filter expression and statically checks
+// it as LintExpression does, with each warning positioned at the condition
+// it applies to.
+func LintFilterExpression(expression string, schema FieldSchema) ([]LintWarning, error) {
+	_, fe, err := NewBoundedFilterExpressionParser(expression)
+	if err != nil {
+		return nil, err
+	}
+	if fe.FilterExpr == nil {
+		return nil, fmt.Errorf("Invalid FilterExpression")
+	}
+
+	l := &linter{schema: schema}
+	err = l.lintFilterInner(fe.FilterExpr)
+	if err != nil {
+		return nil, err
+	}
+	return l.warnings, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"regexp/syntax"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var lintTestSchema = FieldSchema{
+	"age":          FieldTypeNumber,
+	"name":         FieldTypeString,
+	"isActive":     FieldTypeBoolean,
+	"address":      FieldTypeObject,
+	"address.city": FieldTypeString,
+	"tags":         FieldTypeArray,
+	"tags.[]":      FieldTypeString,
+}
+
+func lintWarningKinds(warnings []LintWarning) []LintWarningKind {
+	var kinds []LintWarningKind
+	for _, warning := range warnings {
+		kinds = append(kinds, warning.Kind)
+	}
+	return kinds
+}
+
+func TestLintFilterExpression(t *testing.T) {
+	assert := assert.New(t)
+
+	warnings, err := LintFilterExpression(`name = "x" AND age > "5"`, lintTestSchema)
+	assert.Nil(err)
+	assert.Equal([]LintWarningKind{LintCrossTypeCollation}, lintWarningKinds(warnings))
+	assert.Equal(SourcePosition{15, 1, 16}, warnings[0].Position)
+	assert.Equal(`1:16: cross-type collation: comparing $doc.age (number) with 5 (string) relies on cross-type collation`,
+		warnings[0].String())
+
+	warnings, err = LintFilterExpression(`DATE(name) > 3`, lintTestSchema)
+	assert.Nil(err)
+	assert.Equal([]LintWarningKind{LintCrossTypeCollation}, lintWarningKinds(warnings))
+
+	warnings, err = LintFilterExpression(`ABS(name) > 3 OR tags[0] = "a"`, lintTestSchema)
+	assert.Nil(err)
+	assert.Equal([]LintWarningKind{LintTypeMismatch}, lintWarningKinds(warnings))
+
+	warnings, err = LintFilterExpression(`age = 1 AND (name = "x" OR NOT age.value = 2) AND age = 2`, lintTestSchema)
+	assert.Nil(err)
+	assert.Equal([]LintWarningKind{LintAlwaysFalse, LintTypeMismatch}, lintWarningKinds(warnings))
+	assert.Equal(SourcePosition{0, 1, 1}, warnings[0].Position)
+	assert.Equal(SourcePosition{31, 1, 32}, warnings[1].Position)
+
+	warnings, err = LintFilterExpression(`REGEXP_CONTAINS(age, "^1") AND REGEXP_CONTAINS(name, "a^b")`, lintTestSchema)
+	assert.Nil(err)
+	assert.Equal([]LintWarningKind{LintRegexNeverMatches, LintRegexNeverMatches}, lintWarningKinds(warnings))
+
+	warnings, err = LintFilterExpression(`age LIKE "1%" AND name LIKE "a_%"`, lintTestSchema)
+	assert.Nil(err)
+	if assert.Equal([]LintWarningKind{LintRegexNeverMatches}, lintWarningKinds(warnings)) {
+		assert.Contains(warnings[0].Message, "LIKE patterns only match strings")
+	}
+
+	warnings, err = LintFilterExpression(`address.city = "x" AND age > 5 AND isActive = true`, lintTestSchema)
+	assert.Nil(err)
+	assert.Empty(warnings)
+
+	_, err = LintFilterExpression(`age > `, lintTestSchema)
+	assert.NotNil(err)
+}
+
+func TestLintExpression(t *testing.T) {
+	assert := assert.New(t)
+
+	// Without a schema only constants and functions have known types
+	warnings := LintExpression(AndExpr{
+		LessThanExpr{FuncExpr{DateFunc, []Expression{FieldExpr{0, []string{"a"}}}}, ValueExpr{int64(3)}},
+		LikeExpr{FieldExpr{0, []string{"b"}}, RegexExpr{"x[^\\x00-\\x{10FFFF}]"}},
+		GreaterThanExpr{FieldExpr{0, []string{"c"}}, ValueExpr{"5"}},
+	}, nil)
+	assert.Equal([]LintWarningKind{LintCrossTypeCollation, LintRegexNeverMatches}, lintWarningKinds(warnings))
+	assert.False(warnings[0].Position.IsValid())
+
+	// Loop variables are not described by the schema
+	warnings = LintExpression(AnyInExpr{1, FieldExpr{0, []string{"tags"}},
+		EqualsExpr{FieldExpr{1, nil}, ValueExpr{int64(5)}},
+	}, lintTestSchema)
+	assert.Empty(warnings)
+
+	for pattern, neverMatches := range map[string]bool{
+		"^a|b$":                  false,
+		"a?^b":                   false,
+		"(?m)a$\nb":              false,
+		"$a":                     true,
+		"a$^":                    true,
+		"(a|b)\\Ac":              true,
+		"x|[^\\x00-\\x{10FFFF}]": false,
+	} {
+		parsed, err := syntax.Parse(pattern, syntax.Perl)
+		assert.Nil(err)
+		assert.Equal(neverMatches, regexNeverMatches(parsed.Simplify()), pattern)
+	}
+}
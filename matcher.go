@@ -7,8 +7,19 @@ const (
 	MatcherCollateUsed = 0x1
 )
 
+// Matcher evaluates a set of expressions against documents.
+//
+// Match and its variants expect the document body to be JSON, and return
+// an error rather than a result if they reach any part of it which is not.
+// Documents which are not JSON, such as binary
+// values stored alongside JSON ones, should be passed to MatchBinary
+// instead, which evaluates only the expressions on the document metadata
+// and treats every field of the body as missing.
 type Matcher interface {
 	Match([]byte) (bool, error)
+	MatchWithMeta([]byte, *DocumentMeta) (bool, error)
+	MatchWithKey([]byte, []byte) (bool, error)
+	MatchBinary([]byte, *DocumentMeta) (bool, error)
 	MatchWithStatus([]byte) (bool, int, error)
 	Reset()
 }
@@ -0,0 +1,87 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// DocumentMeta is the metadata of a document, which filters can reach
+// through META().  It is presented to them as the following object:
+//
+//	{"id": Key, "cas": Cas, "expiration": Expiry, "flags": Flags,
+//	 "xattrs": {name: Xattrs[name], ...}}
+//
+// Each extended attribute must be a complete JSON value.
+type DocumentMeta struct {
+	Key    []byte
+	Cas    uint64
+	Expiry uint32
+	Flags  uint32
+	Xattrs map[string][]byte
+}
+
+// documentMetaSchema describes the metadata object for schema validation.
+var documentMetaSchema = &JSONSchema{
+	Types: []FieldType{FieldTypeObject},
+	Properties: map[string]*JSONSchema{
+		"id":         {Types: []FieldType{FieldTypeString}},
+		"cas":        {Types: []FieldType{FieldTypeNumber}},
+		"expiration": {Types: []FieldType{FieldTypeNumber}},
+		"flags":      {Types: []FieldType{FieldTypeNumber}},
+		"xattrs":     {Types: []FieldType{FieldTypeObject}},
+	},
+	AdditionalProperties: &JSONSchema{Never: true},
+}
+
+func appendJsonString(buf []byte, str string) ([]byte, error) {
+	encoded, err := json.Marshal(str)
+	if err != nil {
+		return buf, err
+	}
+	return append(buf, encoded...), nil
+}
+
+// appendMetaObject appends the JSON object describing the metadata to buf.
+func appendMetaObject(buf []byte, meta *DocumentMeta) ([]byte, error) {
+	buf = append(buf, `{"id":`...)
+	buf, err := appendJsonString(buf, string(meta.Key))
+	if err != nil {
+		return buf, err
+	}
+
+	buf = append(buf, `,"cas":`...)
+	buf = strconv.AppendUint(buf, meta.Cas, 10)
+	buf = append(buf, `,"expiration":`...)
+	buf = strconv.AppendUint(buf, uint64(meta.Expiry), 10)
+	buf = append(buf, `,"flags":`...)
+	buf = strconv.AppendUint(buf, uint64(meta.Flags), 10)
+
+	buf = append(buf, `,"xattrs":{`...)
+	names := make([]string, 0, len(meta.Xattrs))
+	for name := range meta.Xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		value := bytes.TrimSpace(meta.Xattrs[name])
+		if len(value) == 0 {
+			return buf, fmt.Errorf("Error: Extended attribute %v has no value", name)
+		}
+
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf, err = appendJsonString(buf, name)
+		if err != nil {
+			return buf, err
+		}
+		buf = append(buf, ':')
+		buf = append(buf, value...)
+	}
+	return append(buf, "}}"...), nil
+}
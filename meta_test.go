@@ -0,0 +1,445 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterExpressionMeta(t *testing.T) {
+	assert := assert.New(t)
+
+	_, fe, err := NewBoundedFilterExpressionParser(`META().id LIKE "user::%" AND META().xattrs._sync.rev > 3`)
+	assert.Nil(err)
+	expr, err := fe.OutputExpression()
+	assert.Nil(err)
+	assert.Equal(OrExpr{AndExpr{
+		LikeExpr{MetaExpr{[]string{"id"}}, LikePatternExpr{"user::%", DefaultLikeEscape}},
+		GreaterThanExpr{MetaExpr{[]string{"xattrs", "_sync", "rev"}}, ValueExpr{3}},
+	}}, expr)
+
+	m, err := GetFilterExpressionMatcher(`META().id LIKE "user::%" AND META().xattrs._sync.rev > 3`)
+	assert.Nil(err)
+
+	doc := []byte(`{"name": "Neil"}`)
+	meta := &DocumentMeta{
+		Key:    []byte("user::1"),
+		Cas:    1553521422455865344,
+		Xattrs: map[string][]byte{"_sync": []byte(`{"rev": 4}`)},
+	}
+	match, err := m.MatchWithMeta(doc, meta)
+	assert.Nil(err)
+	assert.True(match)
+
+	m.Reset()
+	meta.Key = []byte("order::1")
+	match, err = m.MatchWithMeta(doc, meta)
+	assert.Nil(err)
+	assert.False(match)
+
+	m.Reset()
+	meta.Key = []byte("user::1")
+	meta.Xattrs["_sync"] = []byte(`{"rev": 3}`)
+	match, err = m.MatchWithMeta(doc, meta)
+	assert.Nil(err)
+	assert.False(match)
+
+	// Without metadata there is nothing for META() to refer to
+	m.Reset()
+	match, err = m.Match(doc)
+	assert.Nil(err)
+	assert.False(match)
+}
+
+func TestMatchWithMeta(t *testing.T) {
+	assert := assert.New(t)
+
+	exprs := []Expression{
+		AndExpr{
+			EqualsExpr{MetaExpr{[]string{"id"}}, ValueExpr{"a\"b"}},
+			EqualsExpr{MetaExpr{[]string{"flags"}}, FieldExpr{0, []string{"flags"}}},
+		},
+		ExistsExpr{MetaExpr{[]string{"xattrs", "_txn"}}},
+		LessThanExpr{MetaExpr{[]string{"expiration"}}, ValueExpr{100}},
+	}
+	var trans Transformer
+	fastMatcher := NewFastMatcher(trans.Transform(exprs))
+	slowMatcher := NewSlowMatcher(exprs)
+	meta := &DocumentMeta{Key: []byte(`a"b`), Expiry: 200, Flags: 33554432}
+
+	for doc, expected := range map[string]bool{
+		`{"flags": 33554432}`:              true,
+		` { "flags" : 33554432, "x": [] }`: true,
+		`{"flags": 0}`:                     false,
+		`{}`:                               false,
+		` {  } `:                           false,
+	} {
+		for _, m := range []Matcher{fastMatcher, slowMatcher} {
+			m.Reset()
+			match, err := m.MatchWithMeta([]byte(doc), meta)
+			assert.Nil(err, doc)
+			assert.Equal(expected, match, doc)
+		}
+	}
+
+	meta.Xattrs = map[string][]byte{"_txn": []byte(`null`)}
+	fastMatcher.Reset()
+	match, err := fastMatcher.MatchWithMeta([]byte(`{}`), meta)
+	assert.Nil(err)
+	assert.True(match)
+	assert.False(fastMatcher.ExpressionMatched(0))
+	assert.True(fastMatcher.ExpressionMatched(1))
+	assert.False(fastMatcher.ExpressionMatched(2))
+
+	// The metadata is kept apart from the body, which need not be an object
+	fastMatcher.Reset()
+	match, err = fastMatcher.MatchWithMeta([]byte(`[1, 2]`), meta)
+	assert.Nil(err)
+	assert.True(match)
+	_, err = fastMatcher.MatchWithMeta([]byte(`{}`), &DocumentMeta{Xattrs: map[string][]byte{"x": nil}})
+	assert.NotNil(err)
+}
+
+func TestMatchMetaNotInBody(t *testing.T) {
+	assert := assert.New(t)
+
+	exprs := []Expression{
+		EqualsExpr{MetaExpr{[]string{"id"}}, ValueExpr{"admin::1"}},
+		EqualsExpr{MetaExpr{[]string{"id"}}, FieldExpr{0, []string{"owner"}}},
+		ExistsExpr{MetaExpr{[]string{"xattrs", "_sync"}}},
+		AnyInExpr{1, MetaExpr{[]string{"xattrs", "tags"}}, EqualsExpr{FieldExpr{1, nil}, FieldExpr{0, []string{"owner"}}}},
+	}
+	var trans Transformer
+	fastMatcher := NewFastMatcher(trans.Transform(exprs))
+	slowMatcher := NewSlowMatcher(exprs)
+
+	// A body carrying a field named like the metadata is just a body
+	doc := []byte(`{"owner": "admin", "META()": {"id": "admin", "xattrs": {"_sync": 1, "tags": ["admin"]}}}`)
+	type exprMatcher interface {
+		Matcher
+		ExpressionMatched(int) bool
+	}
+	for _, m := range []exprMatcher{fastMatcher, slowMatcher} {
+		m.Reset()
+		match, err := m.Match([]byte(`{"META()": {"id": "admin::1"}}`))
+		assert.Nil(err)
+		assert.False(match)
+
+		m.Reset()
+		match, err = m.Match(doc)
+		assert.Nil(err)
+		assert.False(match)
+
+		m.Reset()
+		match, err = m.MatchWithMeta(doc, &DocumentMeta{Key: []byte("user")})
+		assert.Nil(err)
+		assert.False(match)
+
+		m.Reset()
+		match, err = m.MatchBinary(doc, &DocumentMeta{Key: []byte("user")})
+		assert.Nil(err)
+		assert.False(match)
+
+		m.Reset()
+		match, err = m.MatchWithMeta(doc, &DocumentMeta{Key: []byte("admin")})
+		assert.Nil(err)
+		assert.True(match)
+		assert.False(m.ExpressionMatched(0))
+		assert.True(m.ExpressionMatched(1))
+
+		m.Reset()
+		match, err = m.MatchWithMeta(doc, &DocumentMeta{
+			Key:    []byte("user"),
+			Xattrs: map[string][]byte{"tags": []byte(`["user", "admin"]`)},
+		})
+		assert.Nil(err)
+		assert.True(match)
+		assert.False(m.ExpressionMatched(1))
+		assert.True(m.ExpressionMatched(3))
+	}
+}
+
+func TestMatchWithMetaSinglePass(t *testing.T) {
+	assert := assert.New(t)
+
+	expr := AndExpr{
+		EqualsExpr{MetaExpr{[]string{"flags"}}, ValueExpr{1}},
+		EqualsExpr{MetaExpr{[]string{"id"}}, FieldExpr{0, []string{"owner"}}},
+	}
+	var trans Transformer
+	m := NewFastMatcher(trans.Transform([]Expression{expr}))
+	meta := &DocumentMeta{Key: []byte("admin"), Flags: 1}
+	metaData, err := appendMetaObject(nil, meta)
+	assert.Nil(err)
+
+	// The body is matched where it is, and only the metadata is buffered
+	doc := []byte(`{"name": "Neil", "owner": "admin"}`)
+	match, err := m.MatchWithMeta(doc, meta)
+	assert.Nil(err)
+	assert.True(match)
+	assert.Equal(metaData, m.metaBuf)
+	assert.Same(&m.jsonTokens, m.tokens)
+
+	// The result of the metadata is kept while the body is read, so the
+	// body cannot undo it
+	m.Reset()
+	match, err = m.MatchWithMeta(doc, &DocumentMeta{Key: []byte("admin")})
+	assert.Nil(err)
+	assert.False(match)
+
+	m.Reset()
+	_, err = m.MatchWithMeta([]byte(`{"owner": ]`), meta)
+	assert.Equal(ErrorMalformedDocument, err)
+}
+
+func TestValidateMetaExpressions(t *testing.T) {
+	assert := assert.New(t)
+
+	schema, err := ParseJSONSchema([]byte(`{"type": "object", "additionalProperties": false}`))
+	assert.Nil(err)
+
+	assert.Nil(ValidateExpressions([]Expression{
+		AndExpr{
+			LikeExpr{MetaExpr{[]string{"id"}}, LikePatternExpr{"user::%", DefaultLikeEscape}},
+			GreaterThanExpr{MetaExpr{[]string{"xattrs", "_sync", "rev"}}, ValueExpr{3}},
+		},
+	}, schema))
+
+	err = ValidateExpressions([]Expression{
+		OrExpr{
+			EqualsExpr{MetaExpr{[]string{"key"}}, ValueExpr{"a"}},
+			GreaterThanExpr{MetaExpr{[]string{"cas"}}, ValueExpr{"a"}},
+		},
+	}, schema)
+	assert.Equal(SchemaErrors{
+		{"META().cas", "cannot compare number with string"},
+		{"META().key", "unknown field"},
+	}, err)
+
+	warnings, err := LintFilterExpression(`META().expiration > "soon"`, nil)
+	assert.Nil(err)
+	assert.Equal([]LintWarningKind{LintCrossTypeCollation}, lintWarningKinds(warnings))
+}
+
+func TestParseJsonMetaExpression(t *testing.T) {
+	assert := assert.New(t)
+
+	expr, err := ParseJsonExpression([]byte(`["equals", ["meta", "xattrs", "_sync"], ["value", 1]]`))
+	assert.Nil(err)
+	assert.Equal(EqualsExpr{MetaExpr{[]string{"xattrs", "_sync"}}, ValueExpr{float64(1)}}, expr)
+	assert.Equal("META().xattrs._sync = 1", expr.String())
+}
+
+// moveFieldToMeta rewrites references to a top-level field of the document
+// into references to an extended attribute of the same name.
+func moveFieldToMeta(expr Expression, name string) Expression {
+	rewrite := func(expr Expression) Expression {
+		return moveFieldToMeta(expr, name)
+	}
+
+	switch expr := expr.(type) {
+	case FieldExpr:
+		if expr.Root == 0 && len(expr.Path) > 0 && expr.Path[0] == name {
+			return MetaExpr{append([]string{"xattrs"}, expr.Path...)}
+		}
+		return expr
+	case FuncExpr:
+		params := make([]Expression, len(expr.Params))
+		for i, param := range expr.Params {
+			params[i] = rewrite(param)
+		}
+		return FuncExpr{expr.FuncName, params}
+	case NotExpr:
+		return NotExpr{rewrite(expr.SubExpr)}
+	case AndExpr:
+		out := AndExpr{}
+		for _, subExpr := range expr {
+			out = append(out, rewrite(subExpr))
+		}
+		return out
+	case OrExpr:
+		out := OrExpr{}
+		for _, subExpr := range expr {
+			out = append(out, rewrite(subExpr))
+		}
+		return out
+	case AnyInExpr:
+		return AnyInExpr{expr.VarId, rewrite(expr.InExpr), rewrite(expr.SubExpr)}
+	case EveryInExpr:
+		return EveryInExpr{expr.VarId, rewrite(expr.InExpr), rewrite(expr.SubExpr)}
+	case AnyEveryInExpr:
+		return AnyEveryInExpr{expr.VarId, rewrite(expr.InExpr), rewrite(expr.SubExpr)}
+	case ExistsExpr:
+		return ExistsExpr{rewrite(expr.SubExpr)}
+	case NotExistsExpr:
+		return NotExistsExpr{rewrite(expr.SubExpr)}
+	case EqualsExpr:
+		return EqualsExpr{rewrite(expr.Lhs), rewrite(expr.Rhs)}
+	case NotEqualsExpr:
+		return NotEqualsExpr{rewrite(expr.Lhs), rewrite(expr.Rhs)}
+	case LessThanExpr:
+		return LessThanExpr{rewrite(expr.Lhs), rewrite(expr.Rhs)}
+	case LessEqualsExpr:
+		return LessEqualsExpr{rewrite(expr.Lhs), rewrite(expr.Rhs)}
+	case GreaterThanExpr:
+		return GreaterThanExpr{rewrite(expr.Lhs), rewrite(expr.Rhs)}
+	case GreaterEqualsExpr:
+		return GreaterEqualsExpr{rewrite(expr.Lhs), rewrite(expr.Rhs)}
+	case LikeExpr:
+		return LikeExpr{rewrite(expr.Lhs), rewrite(expr.Rhs)}
+	}
+	return expr
+}
+
+func TestMatchWithMetaRandom(t *testing.T) {
+	assert := assert.New(t)
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		expr := moveFieldToMeta(genRandomExpression(rng, 3), "a")
+
+		var trans Transformer
+		fast := NewFastMatcher(trans.Transform([]Expression{expr}))
+		slow := NewSlowMatcher([]Expression{expr})
+
+		for j := 0; j < 8; j++ {
+			var xattr bytes.Buffer
+			genRandomJsonValue(rng, 2, &xattr)
+			meta := &DocumentMeta{Xattrs: map[string][]byte{"a": xattr.Bytes()}}
+			doc := genRandomDocument(rng, 3)
+
+			fast.Reset()
+			slow.Reset()
+			fastMatched, fastErr := fast.MatchWithMeta(doc, meta)
+			slowMatched, slowErr := slow.MatchWithMeta(doc, meta)
+			assert.Nil(fastErr)
+			assert.Nil(slowErr)
+			if fastMatched != slowMatched {
+				t.Fatalf("matchers disagree: fast %v, slow %v\ndoc: %s\nxattr: %s\nexpression: %v",
+					fastMatched, slowMatched, doc, xattr.Bytes(), expr)
+			}
+		}
+	}
+}
+
+func TestMatchWithKey(t *testing.T) {
+	assert := assert.New(t)
+
+	m, err := GetFilterExpressionMatcher(`META().id =~ "^user::" AND name = "Neil"`)
+	assert.Nil(err)
+
+	match, err := m.MatchWithKey([]byte("user::1"), []byte(`{"name": "Neil"}`))
+	assert.Nil(err)
+	assert.True(match)
+
+	m.Reset()
+	match, err = m.MatchWithKey([]byte("user::1"), []byte(`{"name": "Brett"}`))
+	assert.Nil(err)
+	assert.False(match)
+
+	// When the key decides the result the body is never tokenized, so even
+	// a malformed body is not noticed
+	m.Reset()
+	match, err = m.MatchWithKey([]byte("order::1"), []byte(`{"name": ]`))
+	assert.Nil(err)
+	assert.False(match)
+
+	m, err = GetFilterExpressionMatcher(`META().id = "a" OR name = "Neil"`)
+	assert.Nil(err)
+	match, err = m.MatchWithKey([]byte("a"), []byte(`{"name": ]`))
+	assert.Nil(err)
+	assert.True(match)
+
+	m.Reset()
+	match, err = m.MatchWithKey([]byte("b"), []byte(`{"name": "Neil"}`))
+	assert.Nil(err)
+	assert.True(match)
+
+	m, err = GetFilterExpressionMatcher(`name = "Neil"`)
+	assert.Nil(err)
+	match, err = m.MatchWithKey([]byte("a"), []byte(`{"name": "Neil"}`))
+	assert.Nil(err)
+	assert.True(match)
+}
+
+func TestMatchBinary(t *testing.T) {
+	assert := assert.New(t)
+
+	body := []byte("\x00\x01\x02binary")
+	meta := &DocumentMeta{Key: []byte("a"), Flags: 33554432}
+
+	for filter, expected := range map[string]bool{
+		`META().id = "a" OR name = "Neil"`:            true,
+		`META().id = "b" OR name = "Neil"`:            false,
+		`META().id = "a" AND name = "Neil"`:           false,
+		`META().flags = 33554432 AND name IS MISSING`: true,
+		`NOT name = "Neil"`:                           true,
+		`name IS NULL`:                                false,
+		`EXISTS(META().xattrs)`:                       true,
+	} {
+		expr, err := ParseExpression(filter, ParseOptions{Dialect: DialectFilter})
+		assert.Nil(err, filter)
+
+		var trans Transformer
+		for _, m := range []Matcher{NewFastMatcher(trans.Transform([]Expression{expr})), NewSlowMatcher([]Expression{expr})} {
+			match, err := m.MatchBinary(body, meta)
+			assert.Nil(err, filter)
+			assert.Equal(expected, match, filter)
+		}
+	}
+
+	// The document itself exists even though none of its fields do, and
+	// without metadata META() is missing as well
+	exprs := []Expression{
+		ExistsExpr{FieldExpr{0, nil}},
+		NotExistsExpr{MetaExpr{[]string{"id"}}},
+	}
+	var trans Transformer
+	fastMatcher := NewFastMatcher(trans.Transform(exprs))
+	slowMatcher := NewSlowMatcher(exprs)
+	for _, m := range []Matcher{fastMatcher, slowMatcher} {
+		match, err := m.MatchBinary(body, nil)
+		assert.Nil(err)
+		assert.True(match)
+	}
+	assert.True(fastMatcher.ExpressionMatched(0))
+	assert.True(fastMatcher.ExpressionMatched(1))
+	assert.True(slowMatcher.ExpressionMatched(0))
+	assert.True(slowMatcher.ExpressionMatched(1))
+}
+
+func TestMatchBinaryRandom(t *testing.T) {
+	assert := assert.New(t)
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		expr := moveFieldToMeta(genRandomExpression(rng, 3), "a")
+
+		var trans Transformer
+		fast := NewFastMatcher(trans.Transform([]Expression{expr}))
+		slow := NewSlowMatcher([]Expression{expr})
+
+		for j := 0; j < 8; j++ {
+			var xattr bytes.Buffer
+			genRandomJsonValue(rng, 2, &xattr)
+			meta := &DocumentMeta{Xattrs: map[string][]byte{"a": xattr.Bytes()}}
+			body := make([]byte, rng.Intn(16))
+			rng.Read(body)
+
+			fast.Reset()
+			slow.Reset()
+			fastMatched, fastErr := fast.MatchBinary(body, meta)
+			slowMatched, slowErr := slow.MatchBinary(body, meta)
+			assert.Nil(fastErr)
+			assert.Nil(slowErr)
+			if fastMatched != slowMatched {
+				t.Fatalf("matchers disagree: fast %v, slow %v\nxattr: %s\nexpression: %v",
+					fastMatched, slowMatched, xattr.Bytes(), expr)
+			}
+		}
+	}
+}
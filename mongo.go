@@ -0,0 +1,581 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MongoQueryError describes a part of a MongoDB query which could not be
+// converted into an Expression.
+type MongoQueryError struct {
+	Path    string
+	Message string
+}
+
+func (err MongoQueryError) Error() string {
+	if err.Path == "" {
+		return err.Message
+	}
+	return fmt.Sprintf("%s: %s", err.Path, err.Message)
+}
+
+// mongoTypeNames maps the aliases and numbers accepted by $type onto the
+// names returned by TypeFunc.  BSON types which have no JSON equivalent are
+// left out, as documents do not keep them apart from strings.
+var mongoTypeNames = map[string]string{
+	"double":  "number",
+	"int":     "number",
+	"long":    "number",
+	"decimal": "number",
+	"number":  "number",
+	"string":  "string",
+	"object":  "object",
+	"array":   "array",
+	"binData": "binary",
+	"bool":    "boolean",
+	"null":    "null",
+	"1":       "number",
+	"2":       "string",
+	"3":       "object",
+	"4":       "array",
+	"5":       "binary",
+	"8":       "boolean",
+	"10":      "null",
+	"16":      "number",
+	"18":      "number",
+	"19":      "number",
+}
+
+type mongoConverter struct {
+	nextVar VariableID
+}
+
+func (c *mongoConverter) newVar() VariableID {
+	c.nextVar++
+	return c.nextVar
+}
+
+func mongoFail(path string, format string, args ...interface{}) error {
+	return MongoQueryError{path, fmt.Sprintf(format, args...)}
+}
+
+func sortedMongoKeys(doc map[string]interface{}) []string {
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func mongoAnd(exprs []Expression) Expression {
+	switch len(exprs) {
+	case 0:
+		return TrueExpr{}
+	case 1:
+		return exprs[0]
+	}
+	return AndExpr(exprs)
+}
+
+func mongoOr(exprs []Expression) Expression {
+	switch len(exprs) {
+	case 0:
+		return FalseExpr{}
+	case 1:
+		return exprs[0]
+	}
+	return OrExpr(exprs)
+}
+
+// mongoFieldPath splits a dotted field path, turning numeric components
+// into array indexes.
+func mongoFieldPath(key string) []string {
+	path := strings.Split(key, ".")
+	for i, elem := range path {
+		if idx, err := strconv.Atoi(elem); err == nil && idx >= 0 && strconv.Itoa(idx) == elem {
+			path[i] = "[" + elem + "]"
+		}
+	}
+	return path
+}
+
+func isMongoOperatorDoc(value interface{}) (map[string]interface{}, bool) {
+	doc, ok := value.(map[string]interface{})
+	if !ok || len(doc) == 0 || isMongoExtendedValue(doc) {
+		return nil, false
+	}
+	for key := range doc {
+		if !strings.HasPrefix(key, "$") {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+func isMongoExtendedValue(doc map[string]interface{}) bool {
+	if len(doc) != 1 {
+		return false
+	}
+	for key := range doc {
+		switch key {
+		case "$oid", "$date", "$numberInt", "$numberLong", "$numberDouble", "$numberDecimal":
+			return true
+		}
+	}
+	return false
+}
+
+func mongoNumber(num json.Number) (interface{}, error) {
+	if value, err := num.Int64(); err == nil {
+		return value, nil
+	}
+	return num.Float64()
+}
+
+// convertValue converts a value to compare against, which may use the
+// Extended JSON forms of ObjectIds, dates and numbers.
+func (c *mongoConverter) convertValue(value interface{}, path string) (Expression, error) {
+	switch value := value.(type) {
+	case nil, bool, string:
+		return ValueExpr{value}, nil
+	case json.Number:
+		num, err := mongoNumber(value)
+		if err != nil {
+			return nil, mongoFail(path, "invalid number `%s`", value)
+		}
+		return ValueExpr{num}, nil
+	case map[string]interface{}:
+		if !isMongoExtendedValue(value) {
+			break
+		}
+
+		for key, inner := range value {
+			switch key {
+			case "$oid":
+				if oid, ok := inner.(string); ok {
+					return ValueExpr{strings.ToLower(oid)}, nil
+				}
+			case "$date":
+				switch date := inner.(type) {
+				case string:
+					if _, err := GetNewTimeFastVal(date); err != nil {
+						return nil, mongoFail(path, "invalid date `%s`", date)
+					}
+					return TimeExpr{date}, nil
+				case map[string]interface{}:
+					if millis, ok := date["$numberLong"].(string); ok && len(date) == 1 {
+						ms, err := strconv.ParseInt(millis, 10, 64)
+						if err == nil {
+							return TimeExpr{time.UnixMilli(ms).UTC().Format(time.RFC3339Nano)}, nil
+						}
+					}
+				case json.Number:
+					ms, err := date.Int64()
+					if err == nil {
+						return TimeExpr{time.UnixMilli(ms).UTC().Format(time.RFC3339Nano)}, nil
+					}
+				}
+			default:
+				if str, ok := inner.(string); ok {
+					num, err := mongoNumber(json.Number(str))
+					if err == nil {
+						return ValueExpr{num}, nil
+					}
+				}
+			}
+			return nil, mongoFail(path, "invalid %s value", key)
+		}
+	}
+	return nil, mongoFail(path, "comparing against a whole object or array is not supported")
+}
+
+// traverse applies a condition to the field at path below base.  Like
+// MongoDB, any array found along the path is looked into, so a condition on
+// `a.b` also holds if `a` is an array with an element whose `b` meets it.
+// When intoLeaf is set the same is done for an array found at the end of the
+// path.  Values which are not reached through a field are never looked into.
+func (c *mongoConverter) traverse(base FieldExpr, path []string, intoLeaf bool, leaf func(Expression) Expression) Expression {
+	if len(path) == 0 {
+		direct := leaf(base)
+		if !intoLeaf || len(base.Path) == 0 {
+			return direct
+		}
+		elemVar := c.newVar()
+		return OrExpr{direct, AnyInExpr{elemVar, base, leaf(FieldExpr{elemVar, nil})}}
+	}
+
+	next := FieldExpr{base.Root, append(append([]string{}, base.Path...), path[0])}
+	direct := c.traverse(next, path[1:], intoLeaf, leaf)
+	if len(base.Path) == 0 || strings.HasPrefix(path[0], "[") {
+		return direct
+	}
+	elemVar := c.newVar()
+	return OrExpr{direct, AnyInExpr{elemVar, base, c.traverse(FieldExpr{elemVar, nil}, path, intoLeaf, leaf)}}
+}
+
+// mongoCompared returns the field as it is compared against value.  JSON
+// has no date type, so dates held as strings are read with DATE() to be
+// compared with a $date, even in CompareModeStrict.
+func mongoCompared(field Expression, value Expression) Expression {
+	if _, ok := value.(TimeExpr); ok {
+		return FuncExpr{DateFunc, []Expression{field}}
+	}
+	return field
+}
+
+func (c *mongoConverter) equals(base FieldExpr, path []string, value Expression) Expression {
+	return c.traverse(base, path, true, func(field Expression) Expression {
+		if valueExpr, ok := value.(ValueExpr); ok && valueExpr.Value == nil {
+			// Null also matches fields which are missing
+			return OrExpr{NotExistsExpr{field}, EqualsExpr{field, value}}
+		}
+		return EqualsExpr{mongoCompared(field, value), value}
+	})
+}
+
+func (c *mongoConverter) convertList(value interface{}, path string) ([]interface{}, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, mongoFail(path, "expected an array")
+	}
+	return list, nil
+}
+
+func (c *mongoConverter) convertIn(base FieldExpr, fieldPath []string, value interface{}, path string) (Expression, error) {
+	list, err := c.convertList(value, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var exprs []Expression
+	for _, item := range list {
+		itemExpr, err := c.convertValue(item, path)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, c.equals(base, fieldPath, itemExpr))
+	}
+	return mongoOr(exprs), nil
+}
+
+func (c *mongoConverter) convertRegex(base FieldExpr, fieldPath []string, pattern interface{}, options interface{}, path string) (Expression, error) {
+	patternStr, ok := pattern.(string)
+	if !ok {
+		return nil, mongoFail(path, "$regex must be a string")
+	}
+
+	if options != nil {
+		optionsStr, ok := options.(string)
+		if !ok {
+			return nil, mongoFail(path, "$options must be a string")
+		}
+		for _, option := range optionsStr {
+			if !strings.ContainsRune("ims", option) {
+				return nil, mongoFail(path, "unsupported $regex option `%c`", option)
+			}
+		}
+		if optionsStr != "" {
+			patternStr = "(?" + optionsStr + ")" + patternStr
+		}
+	}
+
+	if _, err := regexp.Compile(patternStr); err != nil {
+		return nil, mongoFail(path, "invalid $regex: %s", err)
+	}
+	return c.traverse(base, fieldPath, true, func(field Expression) Expression {
+		return LikeExpr{field, RegexExpr{patternStr}}
+	}), nil
+}
+
+func (c *mongoConverter) convertElemMatch(base FieldExpr, fieldPath []string, value interface{}, path string) (Expression, error) {
+	doc, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, mongoFail(path, "$elemMatch must be an object")
+	}
+
+	// The condition is converted again for each array it is applied to, so
+	// that every loop has its own variable
+	var convertErr error
+	expr := c.traverse(base, fieldPath, false, func(field Expression) Expression {
+		elemVar := c.newVar()
+		var cond Expression
+		var err error
+		if ops, ok := isMongoOperatorDoc(doc); ok {
+			cond, err = c.convertOperators(FieldExpr{elemVar, nil}, nil, ops, path)
+		} else {
+			cond, err = c.convertQuery(FieldExpr{elemVar, nil}, doc, path)
+		}
+		if err != nil {
+			convertErr = err
+			return FalseExpr{}
+		}
+		return AnyInExpr{elemVar, field, cond}
+	})
+	if convertErr != nil {
+		return nil, convertErr
+	}
+	return expr, nil
+}
+
+func (c *mongoConverter) convertAll(base FieldExpr, fieldPath []string, value interface{}, path string) (Expression, error) {
+	list, err := c.convertList(value, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return FalseExpr{}, nil
+	}
+
+	var exprs []Expression
+	for _, item := range list {
+		if doc, ok := item.(map[string]interface{}); ok && len(doc) == 1 && doc["$elemMatch"] != nil {
+			expr, err := c.convertElemMatch(base, fieldPath, doc["$elemMatch"], path)
+			if err != nil {
+				return nil, err
+			}
+			exprs = append(exprs, expr)
+			continue
+		}
+
+		itemExpr, err := c.convertValue(item, path)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, c.equals(base, fieldPath, itemExpr))
+	}
+	return mongoAnd(exprs), nil
+}
+
+func (c *mongoConverter) convertType(base FieldExpr, fieldPath []string, value interface{}, path string) (Expression, error) {
+	types, ok := value.([]interface{})
+	if !ok {
+		types = []interface{}{value}
+	}
+
+	var exprs []Expression
+	for _, typeValue := range types {
+		typeName, ok := mongoTypeNames[fmt.Sprint(typeValue)]
+		if !ok {
+			return nil, mongoFail(path, "unsupported $type `%v`", typeValue)
+		}
+		exprs = append(exprs, c.traverse(base, fieldPath, true, func(field Expression) Expression {
+			return EqualsExpr{FuncExpr{TypeFunc, []Expression{field}}, ValueExpr{typeName}}
+		}))
+	}
+	return mongoOr(exprs), nil
+}
+
+func (c *mongoConverter) convertSize(base FieldExpr, fieldPath []string, value interface{}, path string) (Expression, error) {
+	num, ok := value.(json.Number)
+	if !ok {
+		return nil, mongoFail(path, "$size must be a number")
+	}
+	size, err := num.Int64()
+	if err != nil || size < 0 {
+		return nil, mongoFail(path, "$size must be a non-negative integer")
+	}
+	return c.traverse(base, fieldPath, false, func(field Expression) Expression {
+		return EqualsExpr{FuncExpr{ArrayLengthFunc, []Expression{field}}, ValueExpr{size}}
+	}), nil
+}
+
+// convertOperators converts a document of operators, such as
+// `{"$gt": 1, "$lt": 5}`, which all apply to the field at fieldPath.
+func (c *mongoConverter) convertOperators(base FieldExpr, fieldPath []string, ops map[string]interface{}, path string) (Expression, error) {
+	var exprs []Expression
+	for _, op := range sortedMongoKeys(ops) {
+		value := ops[op]
+
+		var expr Expression
+		var err error
+		switch op {
+		case "$eq", "$ne":
+			var valueExpr Expression
+			valueExpr, err = c.convertValue(value, path)
+			if err == nil {
+				expr = c.equals(base, fieldPath, valueExpr)
+				if op == "$ne" {
+					expr = NotExpr{expr}
+				}
+			}
+		case "$gt", "$gte", "$lt", "$lte":
+			var valueExpr Expression
+			valueExpr, err = c.convertValue(value, path)
+			if err == nil {
+				expr = c.traverse(base, fieldPath, true, func(field Expression) Expression {
+					field = mongoCompared(field, valueExpr)
+					switch op {
+					case "$gt":
+						return GreaterThanExpr{field, valueExpr}
+					case "$gte":
+						return GreaterEqualsExpr{field, valueExpr}
+					case "$lt":
+						return LessThanExpr{field, valueExpr}
+					}
+					return LessEqualsExpr{field, valueExpr}
+				})
+			}
+		case "$in", "$nin":
+			expr, err = c.convertIn(base, fieldPath, value, path)
+			if err == nil && op == "$nin" {
+				expr = NotExpr{expr}
+			}
+		case "$exists":
+			expr = c.traverse(base, fieldPath, false, func(field Expression) Expression {
+				return ExistsExpr{field}
+			})
+			if exists, ok := value.(bool); ok && !exists {
+				expr = NotExpr{expr}
+			} else if num, ok := value.(json.Number); ok && num.String() == "0" {
+				expr = NotExpr{expr}
+			}
+		case "$regex":
+			expr, err = c.convertRegex(base, fieldPath, value, ops["$options"], path)
+		case "$options":
+			if _, ok := ops["$regex"]; !ok {
+				err = mongoFail(path, "$options requires $regex")
+			}
+		case "$not":
+			notOps, ok := isMongoOperatorDoc(value)
+			if !ok {
+				err = mongoFail(path, "$not must be a document of operators")
+				break
+			}
+			expr, err = c.convertOperators(base, fieldPath, notOps, path)
+			if err == nil {
+				expr = NotExpr{expr}
+			}
+		case "$elemMatch":
+			expr, err = c.convertElemMatch(base, fieldPath, value, path)
+		case "$all":
+			expr, err = c.convertAll(base, fieldPath, value, path)
+		case "$size":
+			expr, err = c.convertSize(base, fieldPath, value, path)
+		case "$type":
+			expr, err = c.convertType(base, fieldPath, value, path)
+		default:
+			err = mongoFail(path, "unsupported operator `%s`", op)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if expr != nil {
+			exprs = append(exprs, expr)
+		}
+	}
+	return mongoAnd(exprs), nil
+}
+
+func (c *mongoConverter) convertQueryList(base FieldExpr, value interface{}, path string) ([]Expression, error) {
+	list, err := c.convertList(value, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, mongoFail(path, "expected a non-empty array")
+	}
+
+	var exprs []Expression
+	for i, item := range list {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		doc, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, mongoFail(itemPath, "expected a query document")
+		}
+		expr, err := c.convertQuery(base, doc, itemPath)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+	return exprs, nil
+}
+
+// convertQuery converts a query document, whose fields are relative to
+// base.
+func (c *mongoConverter) convertQuery(base FieldExpr, query map[string]interface{}, path string) (Expression, error) {
+	var exprs []Expression
+	for _, key := range sortedMongoKeys(query) {
+		value := query[key]
+
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+
+		switch key {
+		case "$and", "$or", "$nor":
+			list, err := c.convertQueryList(base, value, keyPath)
+			if err != nil {
+				return nil, err
+			}
+			switch key {
+			case "$and":
+				exprs = append(exprs, mongoAnd(list))
+			case "$or":
+				exprs = append(exprs, mongoOr(list))
+			default:
+				exprs = append(exprs, NotExpr{mongoOr(list)})
+			}
+			continue
+		}
+		if strings.HasPrefix(key, "$") {
+			return nil, mongoFail(keyPath, "unsupported operator `%s`", key)
+		}
+
+		fieldPath := mongoFieldPath(key)
+		var expr Expression
+		var err error
+		if ops, ok := isMongoOperatorDoc(value); ok {
+			expr, err = c.convertOperators(base, fieldPath, ops, keyPath)
+		} else {
+			var valueExpr Expression
+			valueExpr, err = c.convertValue(value, keyPath)
+			if err == nil {
+				expr = c.equals(base, fieldPath, valueExpr)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+	return mongoAnd(exprs), nil
+}
+
+// ParseMongoQuery converts a MongoDB query document, such as
+// `{"age": {"$gt": 21}, "tags": {"$in": ["a"]}}`, into an Expression.  As
+// in MongoDB, conditions on a field also hold when the field is an array
+// with an element meeting them, and numeric components of a field path
+// index into arrays.  Anything which cannot be converted is reported as a
+// MongoQueryError.
+//
+// MongoDB never compares values of different types, so the expression only
+// matches the same documents as the query when it is transformed with
+// Transformer{CompareMode: CompareModeStrict}, or matched by a SlowMatcher
+// with the same CompareMode.  Under the default CompareModeCollate,
+// {"a": {"$gt": "5"}} would also match {"a": 6}.
+func ParseMongoQuery(data []byte) (Expression, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var query map[string]interface{}
+	if err := decoder.Decode(&query); err != nil {
+		return nil, err
+	}
+	if query == nil {
+		return nil, mongoFail("", "query must be an object")
+	}
+
+	var c mongoConverter
+	return c.convertQuery(FieldExpr{}, query, "")
+}
@@ -0,0 +1,210 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMongoQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		matches []string
+		misses  []string
+	}{
+		{
+			`{"age": {"$gt": 21}, "tags": {"$in": ["a"]}}`,
+			[]string{`{"age": 30, "tags": ["b", "a"]}`, `{"age": 22, "tags": "a"}`},
+			[]string{`{"age": 21, "tags": ["a"]}`, `{"age": 30, "tags": ["b"]}`, `{"age": 30}`},
+		},
+		{
+			`{"name": "Neil", "age": {"$gte": 18, "$lt": 65}}`,
+			[]string{`{"name": "Neil", "age": 18}`},
+			[]string{`{"name": "Neil", "age": 65}`, `{"name": "Nick", "age": 30}`},
+		},
+		{
+			`{"$or": [{"a": 1}, {"b": {"$lte": 2}}], "c": {"$ne": 3}}`,
+			[]string{`{"a": 1}`, `{"b": 2, "c": 4}`, `{"a": 1, "c": [4, 5]}`},
+			[]string{`{"a": 2, "b": 3}`, `{"a": 1, "c": 3}`, `{"a": 1, "c": [2, 3]}`},
+		},
+		{
+			`{"$and": [{"a": {"$eq": 1}}], "$nor": [{"b": true}]}`,
+			[]string{`{"a": 1, "b": false}`, `{"a": [0, 1]}`},
+			[]string{`{"a": 1, "b": true}`, `{"a": 2}`},
+		},
+		{
+			`{"a": null}`,
+			[]string{`{"a": null}`, `{"b": 1}`, `{"a": [1, null]}`},
+			[]string{`{"a": 1}`},
+		},
+		{
+			`{"a": {"$nin": [1, 2]}, "b": {"$exists": true}, "c": {"$exists": false}}`,
+			[]string{`{"a": 3, "b": null}`, `{"b": 1}`},
+			[]string{`{"a": [3, 2], "b": 1}`, `{"a": 3}`, `{"a": 3, "b": 1, "c": 1}`},
+		},
+		{
+			`{"name": {"$regex": "^ne", "$options": "i"}, "tags": {"$not": {"$regex": "x"}}}`,
+			[]string{`{"name": "Neil"}`, `{"name": "neil", "tags": ["a", "b"]}`},
+			[]string{`{"name": "Anne"}`, `{"name": "Neil", "tags": ["a", "xy"]}`},
+		},
+		{
+			`{"friends.name": "Bob", "address.city": "Paris"}`,
+			[]string{
+				`{"friends": [{"name": "Ann"}, {"name": "Bob"}], "address": {"city": "Paris"}}`,
+				`{"friends": {"name": "Bob"}, "address": [{"city": "Paris"}]}`,
+			},
+			[]string{`{"friends": [{"name": "Ann"}], "address": {"city": "Paris"}}`},
+		},
+		{
+			`{"scores": {"$elemMatch": {"$gte": 80, "$lt": 85}}}`,
+			[]string{`{"scores": [70, 82]}`},
+			[]string{`{"scores": [70, 90]}`, `{"scores": 82}`},
+		},
+		{
+			`{"items": {"$elemMatch": {"sku": "x", "qty": {"$gt": 1}}}}`,
+			[]string{`{"items": [{"sku": "y", "qty": 5}, {"sku": "x", "qty": 2}]}`},
+			[]string{`{"items": [{"sku": "y", "qty": 5}, {"sku": "x", "qty": 1}]}`},
+		},
+		{
+			`{"tags": {"$all": ["a", "b"]}, "points": {"$size": 2}, "points.0": 7}`,
+			[]string{`{"tags": ["b", "c", "a"], "points": [7, 8]}`},
+			[]string{`{"tags": ["a", "c"], "points": [7, 8]}`, `{"tags": ["a", "b"], "points": [7]}`,
+				`{"tags": ["a", "b"], "points": [8, 7]}`},
+		},
+		{
+			`{"a": {"$type": "string"}, "b": {"$type": ["array", 8]}, "c": {"$type": "number"}}`,
+			[]string{`{"a": "x", "b": [1], "c": 1.5}`, `{"a": "x", "b": false, "c": [1]}`},
+			[]string{`{"a": 1, "b": [1], "c": 1}`, `{"a": "x", "b": 1, "c": 1}`, `{"a": "x", "b": true}`},
+		},
+		{
+			`{"_id": {"$oid": "5F1D7A3B9C8E4A2B1C0D9E8F"}, "n": {"$numberLong": "5"},` +
+				` "at": {"$gt": {"$date": "2020-01-01T00:00:00Z"}}}`,
+			[]string{`{"_id": "5f1d7a3b9c8e4a2b1c0d9e8f", "n": 5, "at": "2021-06-01T00:00:00Z"}`},
+			[]string{`{"_id": "5f1d7a3b9c8e4a2b1c0d9e8f", "n": 5, "at": "2019-06-01T00:00:00Z"}`},
+		},
+		{
+			`{}`,
+			[]string{`{}`, `{"a": 1}`, `[1]`},
+			nil,
+		},
+		{
+			`{"a": {"$in": []}}`,
+			nil,
+			[]string{`{}`, `{"a": 1}`, `{"a": []}`},
+		},
+		{
+			`{"a": {"$all": []}}`,
+			nil,
+			[]string{`{}`, `{"a": []}`, `{"a": [1]}`},
+		},
+		{
+			`{"a": {"$gt": "5"}}`,
+			[]string{`{"a": "6"}`, `{"a": ["x"]}`},
+			[]string{`{"a": 6}`, `{"a": "4"}`, `{"a": true}`, `{"a": [6]}`},
+		},
+		{
+			`{"a": {"$lt": 5}}`,
+			[]string{`{"a": 4.5}`, `{"a": [9, 1]}`},
+			[]string{`{"a": "1"}`, `{"a": null}`, `{"a": false}`},
+		},
+	}
+
+	for _, test := range tests {
+		expr, err := ParseMongoQuery([]byte(test.query))
+		if err != nil {
+			t.Fatalf("failed to convert %s: %v", test.query, err)
+		}
+
+		// MongoDB's comparisons are matched by the strict compare mode
+		trans := Transformer{CompareMode: CompareModeStrict}
+		fast := NewFastMatcher(trans.Transform([]Expression{expr}))
+		slow := NewSlowMatcher([]Expression{expr})
+		slow.CompareMode = CompareModeStrict
+
+		for _, doc := range append(append([]string{}, test.matches...), test.misses...) {
+			expected := false
+			for _, match := range test.matches {
+				if doc == match {
+					expected = true
+				}
+			}
+
+			for _, m := range []Matcher{fast, slow} {
+				m.Reset()
+				matched, err := m.Match([]byte(doc))
+				if err != nil {
+					t.Fatalf("failed to match %s: %v", doc, err)
+				}
+				if matched != expected {
+					t.Errorf("%T: %s matched %v, expected %v\nquery: %s\nexpression: %v",
+						m, doc, matched, expected, test.query, expr)
+				}
+			}
+		}
+	}
+}
+
+func TestParseMongoQueryEmpty(t *testing.T) {
+	assert := assert.New(t)
+
+	expr, err := ParseMongoQuery([]byte(`{}`))
+	assert.Nil(err)
+	assert.Equal(TrueExpr{}, expr)
+
+	// Constant expressions leave nothing to parse the document with
+	var trans Transformer
+	def := trans.Transform([]Expression{expr, FalseExpr{}})
+	assert.Nil(def.ParseNode)
+	m := NewFastMatcher(def)
+	matched, err := m.Match([]byte(`{"a": 1}`))
+	assert.Nil(err)
+	assert.True(matched)
+	assert.True(m.ExpressionMatched(0))
+	assert.False(m.ExpressionMatched(1))
+
+	expr, err = ParseMongoQuery([]byte(`{"a": {"$all": []}}`))
+	assert.Nil(err)
+	assert.Equal(FalseExpr{}, expr)
+
+	m = NewFastMatcher(trans.Transform([]Expression{expr}))
+	matched, err = m.MatchBinary([]byte("a"), nil)
+	assert.Nil(err)
+	assert.False(matched)
+}
+
+func TestParseMongoQueryErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{`{"$where": "this.a > 1"}`, "$where: unsupported operator `$where`"},
+		{`{"a": {"$near": [1, 2]}}`, "a: unsupported operator `$near`"},
+		{`{"$or": [{"a": {"$mod": [2, 0]}}]}`, "$or[0].a: unsupported operator `$mod`"},
+		{`{"a": {"$type": "objectId"}}`, "a: unsupported $type `objectId`"},
+		{`{"a": {"$regex": "x", "$options": "x"}}`, "a: unsupported $regex option `x`"},
+		{`{"a": {"$regex": "("}}`, "a: invalid $regex: error parsing regexp: missing closing ): `(`"},
+		{`{"a": {"$options": "i"}}`, "a: $options requires $regex"},
+		{`{"a": {"$size": -1}}`, "a: $size must be a non-negative integer"},
+		{`{"a": {"b": 1}}`, "a: comparing against a whole object or array is not supported"},
+		{`{"a": {"$in": 1}}`, "a: expected an array"},
+		{`{"$or": []}`, "$or: expected a non-empty array"},
+		{`{"a": {"$not": 1}}`, "a: $not must be a document of operators"},
+		{`{"a": {"$elemMatch": {"b": {"$foo": 1}}}}`, "a.b: unsupported operator `$foo`"},
+		{`[]`, ""},
+	}
+
+	for _, test := range tests {
+		_, err := ParseMongoQuery([]byte(test.query))
+		if !assert.NotNil(err, test.query) {
+			continue
+		}
+		if test.err != "" {
+			assert.IsType(MongoQueryError{}, err)
+			assert.Equal(test.err, err.Error())
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+const msgpackTimestampExt = -1
+
+// msgpackDecoder decodes documents encoded as MessagePack.  Timestamps are
+// decoded as RFC 3339 strings, and other extension types are not supported.
+type msgpackDecoder struct {
+	timestamp []byte
+}
+
+func (d *msgpackDecoder) reset() {
+}
+
+func (d *msgpackDecoder) decodeBreak(data []byte, pos int) (int, bool, error) {
+	return pos, false, nil
+}
+
+// msgpackUint reads a big endian unsigned integer of the given size.
+func msgpackUint(data []byte, pos int, size int) (uint64, int, error) {
+	if len(data)-pos < size {
+		return 0, pos, errBinaryUnexpectedEnd
+	}
+	switch size {
+	case 1:
+		return uint64(data[pos]), pos + 1, nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(data[pos:])), pos + 2, nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(data[pos:])), pos + 4, nil
+	}
+	return binary.BigEndian.Uint64(data[pos:]), pos + 8, nil
+}
+
+func (d *msgpackDecoder) decodeTimestamp(payload []byte) ([]byte, error) {
+	var ts time.Time
+	switch len(payload) {
+	case 4:
+		ts = time.Unix(int64(binary.BigEndian.Uint32(payload)), 0)
+	case 8:
+		value := binary.BigEndian.Uint64(payload)
+		ts = time.Unix(int64(value&0x3ffffffff), int64(value>>34))
+	case 12:
+		ts = time.Unix(int64(binary.BigEndian.Uint64(payload[4:])), int64(binary.BigEndian.Uint32(payload)))
+	default:
+		return nil, fmt.Errorf("invalid MessagePack timestamp of %d bytes", len(payload))
+	}
+
+	d.timestamp = ts.UTC().AppendFormat(d.timestamp[:0], time.RFC3339Nano)
+	return d.timestamp, nil
+}
+
+func (d *msgpackDecoder) decodeItem(data []byte, pos int, item *binaryItem) (int, error) {
+	if pos >= len(data) {
+		return pos, errBinaryUnexpectedEnd
+	}
+	initial := data[pos]
+	pos++
+
+	var size int
+	var length uint64
+	var err error
+
+	switch {
+	case initial <= 0x7f:
+		item.kind = binaryItemInt
+		item.i = int64(initial)
+		return pos, nil
+	case initial >= 0xe0:
+		item.kind = binaryItemInt
+		item.i = int64(int8(initial))
+		return pos, nil
+	case initial <= 0x8f:
+		item.kind = binaryItemMap
+		length = uint64(initial & 0x0f)
+	case initial <= 0x9f:
+		item.kind = binaryItemArray
+		length = uint64(initial & 0x0f)
+	case initial <= 0xbf:
+		item.kind = binaryItemString
+		length = uint64(initial & 0x1f)
+	}
+
+	switch initial {
+	case 0xc0:
+		item.kind = binaryItemNull
+		return pos, nil
+	case 0xc2:
+		item.kind = binaryItemFalse
+		return pos, nil
+	case 0xc3:
+		item.kind = binaryItemTrue
+		return pos, nil
+	case 0xc4, 0xc5, 0xc6:
+		item.kind = binaryItemBytes
+		size = 1 << (initial - 0xc4)
+	case 0xd9, 0xda, 0xdb:
+		item.kind = binaryItemString
+		size = 1 << (initial - 0xd9)
+	case 0xdc, 0xdd:
+		item.kind = binaryItemArray
+		size = 2 << (initial - 0xdc)
+	case 0xde, 0xdf:
+		item.kind = binaryItemMap
+		size = 2 << (initial - 0xde)
+	case 0xca:
+		bits, next, err := msgpackUint(data, pos, 4)
+		if err != nil {
+			return pos, err
+		}
+		item.kind = binaryItemFloat
+		item.f = float64(math.Float32frombits(uint32(bits)))
+		return next, nil
+	case 0xcb:
+		bits, next, err := msgpackUint(data, pos, 8)
+		if err != nil {
+			return pos, err
+		}
+		item.kind = binaryItemFloat
+		item.f = math.Float64frombits(bits)
+		return next, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		value, next, err := msgpackUint(data, pos, 1<<(initial-0xcc))
+		if err != nil {
+			return pos, err
+		}
+		if value <= math.MaxInt64 {
+			item.kind = binaryItemInt
+			item.i = int64(value)
+		} else {
+			item.kind = binaryItemUint
+			item.u = value
+		}
+		return next, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		width := 1 << (initial - 0xd0)
+		value, next, err := msgpackUint(data, pos, width)
+		if err != nil {
+			return pos, err
+		}
+		// Sign extend from the width of the encoded value
+		shift := 64 - 8*uint(width)
+		item.kind = binaryItemInt
+		item.i = int64(value<<shift) >> shift
+		return next, nil
+	case 0xc7, 0xc8, 0xc9, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.decodeExt(data, pos, initial, item)
+	case 0xc1:
+		return pos, fmt.Errorf("invalid MessagePack type 0xc1")
+	}
+
+	if size > 0 {
+		length, pos, err = msgpackUint(data, pos, size)
+		if err != nil {
+			return pos, err
+		}
+	}
+
+	switch item.kind {
+	case binaryItemString, binaryItemBytes:
+		if length > uint64(len(data)-pos) {
+			return pos, errBinaryUnexpectedEnd
+		}
+		item.str = data[pos : pos+int(length)]
+		pos += int(length)
+	case binaryItemArray:
+		// Every entry takes at least a byte
+		if length > uint64(len(data)-pos) {
+			return pos, errBinaryUnexpectedEnd
+		}
+		item.length = int(length)
+	case binaryItemMap:
+		if length > uint64(len(data)-pos)/2 {
+			return pos, errBinaryUnexpectedEnd
+		}
+		item.length = int(length)
+	}
+	return pos, nil
+}
+
+func (d *msgpackDecoder) decodeExt(data []byte, pos int, initial byte, item *binaryItem) (int, error) {
+	var length uint64
+	var err error
+	if initial >= 0xd4 {
+		length = 1 << (initial - 0xd4)
+	} else {
+		length, pos, err = msgpackUint(data, pos, 1<<(initial-0xc7))
+		if err != nil {
+			return pos, err
+		}
+	}
+
+	if pos >= len(data) || length > uint64(len(data)-pos-1) {
+		return pos, errBinaryUnexpectedEnd
+	}
+	extType := int8(data[pos])
+	payload := data[pos+1 : pos+1+int(length)]
+	if extType != msgpackTimestampExt {
+		return pos, fmt.Errorf("unsupported MessagePack extension type %d", extType)
+	}
+
+	str, err := d.decodeTimestamp(payload)
+	if err != nil {
+		return pos, err
+	}
+	item.kind = binaryItemString
+	item.str = str
+	return pos + 1 + int(length), nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+// ParseError describes where a filter failed to parse.  Offset is the byte
+// offset of the offending token within the filter, while Line and Column
+// start at 1 and count characters.  Both are 0 when the position of the
+// error is not known, such as for errors found after the filter has been
+// fully parsed.  Err holds the underlying error, which for the simple
+// parser is one of the ErrorXxx sentinels.
+type ParseError struct {
+	Offset   int
+	Line     int
+	Column   int
+	Token    string
+	Expected []string
+	Err      error
+}
+
+func newParseError(expression string, offset int, token string, expected []string, err error) *ParseError {
+	if offset > len(expression) {
+		offset = len(expression)
+	}
+
+	line := 1 + strings.Count(expression[:offset], "\n")
+	lineStart := strings.LastIndex(expression[:offset], "\n") + 1
+	column := 1 + utf8.RuneCountInString(expression[lineStart:offset])
+
+	return &ParseError{
+		Offset:   offset,
+		Line:     line,
+		Column:   column,
+		Token:    token,
+		Expected: expected,
+		Err:      err,
+	}
+}
+
+func (err *ParseError) HasPosition() bool {
+	return err.Line > 0
+}
+
+func (err *ParseError) Error() string {
+	if !err.HasPosition() {
+		return err.Err.Error()
+	}
+	return fmt.Sprintf("%d:%d: %v", err.Line, err.Column, err.Err)
+}
+
+func (err *ParseError) Unwrap() error {
+	return err.Err
+}
+
+// newLexerParseError converts an error from lexing a filter expression
+// into a ParseError.
+func newLexerParseError(expression string, err error) *ParseError {
+	lexErr, ok := err.(*lexer.Error)
+	if !ok {
+		return &ParseError{Err: err}
+	}
+	return newParseError(expression, lexErr.Pos.Offset, "", nil, errors.New(lexErr.Message))
+}
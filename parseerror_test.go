@@ -0,0 +1,82 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimpleParserParseError(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := ParseSimpleExpression("age >= 5 && name == \"x\")")
+	var parseErr *ParseError
+	assert.True(errors.As(err, &parseErr))
+	assert.True(errors.Is(err, ErrorParenMismatch))
+	assert.NotEqual(ErrorParenMismatch, err)
+	assert.Equal(23, parseErr.Offset)
+	assert.Equal(1, parseErr.Line)
+	assert.Equal(24, parseErr.Column)
+	assert.Equal(")", parseErr.Token)
+	assert.Equal("1:24: "+ErrorParenMismatch.Error(), err.Error())
+
+	// Unclosed parenthesis are reported at the end of the input
+	_, err = ParseSimpleExpression("(age >= 5 &&\n  name == \"x\"")
+	assert.True(errors.As(err, &parseErr))
+	assert.True(errors.Is(err, ErrorParenMismatch))
+	assert.Equal(26, parseErr.Offset)
+	assert.Equal(2, parseErr.Line)
+	assert.Equal(14, parseErr.Column)
+	assert.Equal("", parseErr.Token)
+
+	_, err = ParseSimpleExpression("`field`[0a] == 1")
+	assert.True(errors.As(err, &parseErr))
+	assert.True(errors.Is(err, ErrorLeadingZeroes))
+	assert.Equal(0, parseErr.Offset)
+	assert.Equal("`field`[0a]", parseErr.Token)
+	assert.Contains(parseErr.Expected, "<field>")
+
+	_, err = ParseSimpleExpression("age >= 5 name")
+	assert.True(errors.As(err, &parseErr))
+	assert.Equal(9, parseErr.Offset)
+	assert.Equal("name", parseErr.Token)
+	assert.Contains(parseErr.Expected, TokenOperatorAnd)
+}
+
+func TestFilterParserParseError(t *testing.T) {
+	assert := assert.New(t)
+
+	_, _, err := NewBoundedFilterExpressionParser(`name = "x" AND EXISTS name`)
+	var parseErr *ParseError
+	assert.True(errors.As(err, &parseErr))
+	assert.Equal(22, parseErr.Offset)
+	assert.Equal(1, parseErr.Line)
+	assert.Equal(23, parseErr.Column)
+	assert.Equal("name", parseErr.Token)
+	assert.Equal([]string{"(", "[", ".", "+", "-", "*", "/", "%", "=", "!", "<", ">", "LIKE", "IS"}, parseErr.Expected)
+
+	_, _, err = NewBoundedFilterExpressionParser("name = \"x\"\nAND age >")
+	assert.True(errors.As(err, &parseErr))
+	assert.Equal(2, parseErr.Line)
+	assert.Equal(10, parseErr.Column)
+	assert.Equal("", parseErr.Token)
+	assert.NotEmpty(parseErr.Expected)
+
+	_, _, err = NewBoundedFilterExpressionParser("")
+	assert.True(errors.As(err, &parseErr))
+	assert.True(errors.Is(err, ErrorEmptyInput))
+	assert.Equal(1, parseErr.Column)
+}
+
+func TestFilterParserLexerError(t *testing.T) {
+	assert := assert.New(t)
+
+	_, _, err := NewBoundedFilterExpressionParser("name = \"x")
+	var parseErr *ParseError
+	assert.True(errors.As(err, &parseErr))
+	assert.Equal(1, parseErr.Line)
+	assert.True(parseErr.Column > 1)
+}
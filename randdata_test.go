@@ -0,0 +1,253 @@
+// Copyright 2018 Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"bytes"
+	"math/rand"
+)
+
+// The generators below produce random documents and expressions which
+// deliberately share a small vocabulary of field names and values, so that
+// expressions actually hit the documents they are matched against.  They
+// are used to compare the FastMatcher against the SlowMatcher.
+
+var randFieldNames = []string{"a", "b", "c", "d"}
+
+var randJsonNumbers = []string{
+	"0", "1", "-1", "2", "10", "-0", "0.5", "-2.5", "3.0", "1e3", "1E-2", "12345678901",
+}
+
+var randJsonStrings = []string{
+	`""`, `"a"`, `"b"`, `"ab"`, `"B"`, `"1"`, `"2.5"`, `"true"`, `"null"`,
+	`"2019-01-01T00:00:00Z"`, `"2020-06-15"`, `"\u0061"`, `"a\"b"`, `"a\\b"`, `"é"`, `"\u00e9"`,
+}
+
+var randValues = []interface{}{
+	nil, true, false,
+	int64(0), int64(1), int64(-1), int64(2), int64(10),
+	float64(0.5), float64(-2.5), float64(3), float64(1000),
+	"", "a", "b", "ab", "B", "1", "2.5", "true", "é", "a\"b",
+}
+
+var randRegexes = []string{
+	"^a", "b$", "a|b", "^[0-9]+$", ".", "^$", "\\d", "(?i)^b",
+}
+
+var randTimes = []string{
+	"2019-01-01T00:00:00Z", "2020-06-15", "2000-01-01T12:30:00+01:00",
+}
+
+func genRandomJsonValue(rng *rand.Rand, depth int, out *bytes.Buffer) {
+	maxKind := 7
+	if depth <= 0 {
+		maxKind = 5
+	}
+
+	switch rng.Intn(maxKind) {
+	case 0:
+		switch rng.Intn(3) {
+		case 0:
+			out.WriteString("null")
+		case 1:
+			out.WriteString("true")
+		default:
+			out.WriteString("false")
+		}
+	case 1, 2:
+		out.WriteString(randJsonNumbers[rng.Intn(len(randJsonNumbers))])
+	case 3, 4:
+		out.WriteString(randJsonStrings[rng.Intn(len(randJsonStrings))])
+	case 5:
+		out.WriteByte('[')
+		numElems := rng.Intn(4)
+		for i := 0; i < numElems; i++ {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			genRandomJsonValue(rng, depth-1, out)
+		}
+		out.WriteByte(']')
+	default:
+		genRandomJsonObject(rng, depth-1, out)
+	}
+}
+
+func genRandomJsonObject(rng *rand.Rand, depth int, out *bytes.Buffer) {
+	out.WriteByte('{')
+	numFields := 0
+	for _, fieldName := range randFieldNames {
+		if rng.Intn(3) == 0 {
+			continue
+		}
+		if numFields > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(`"` + fieldName + `":`)
+		genRandomJsonValue(rng, depth, out)
+		numFields++
+	}
+	out.WriteByte('}')
+}
+
+// genRandomDocument generates a random JSON object with a nesting depth of
+// at most depth levels.
+func genRandomDocument(rng *rand.Rand, depth int) []byte {
+	var out bytes.Buffer
+	genRandomJsonObject(rng, depth, &out)
+	return out.Bytes()
+}
+
+type randExprGenerator struct {
+	rng     *rand.Rand
+	nextVar VariableID
+}
+
+func (g *randExprGenerator) pathElem() string {
+	if g.rng.Intn(6) == 0 {
+		if g.rng.Intn(2) == 0 {
+			return "[0]"
+		}
+		return "[1]"
+	}
+	return randFieldNames[g.rng.Intn(len(randFieldNames))]
+}
+
+func (g *randExprGenerator) field(scope VariableID) FieldExpr {
+	pathLen := 1 + g.rng.Intn(2)
+	if scope != 0 {
+		// Loop variables may also be referenced directly
+		pathLen = g.rng.Intn(3)
+	}
+
+	path := make([]string, pathLen)
+	for i := range path {
+		path[i] = g.pathElem()
+	}
+	return FieldExpr{scope, path}
+}
+
+func (g *randExprGenerator) value() ValueExpr {
+	return ValueExpr{randValues[g.rng.Intn(len(randValues))]}
+}
+
+// fieldPair returns two fields neither of which is a prefix of the other,
+// as the Transformer cannot place such comparisons.
+func (g *randExprGenerator) fieldPair(scope VariableID) (FieldExpr, FieldExpr) {
+	for {
+		lhs := g.field(scope)
+		rhs := g.field(scope)
+
+		isPrefix := true
+		for i := 0; i < len(lhs.Path) && i < len(rhs.Path); i++ {
+			if lhs.Path[i] != rhs.Path[i] {
+				isPrefix = false
+				break
+			}
+		}
+		if !isPrefix {
+			return lhs, rhs
+		}
+	}
+}
+
+func (g *randExprGenerator) operands(scope VariableID) (Expression, Expression) {
+	switch g.rng.Intn(6) {
+	case 0:
+		return g.fieldPair(scope)
+	case 1:
+		return g.value(), g.field(scope)
+	case 2:
+		oneArgFuncs := []string{MathFuncAbs, MathFuncCeil, MathFuncFloor, MathFuncRound, MathFuncNeg, MathFuncSqrt}
+		funcName := oneArgFuncs[g.rng.Intn(len(oneArgFuncs))]
+		return FuncExpr{funcName, []Expression{g.field(scope)}}, g.value()
+	case 3:
+		twoArgFuncs := []string{MathFuncAdd, MathFuncSub, MathFuncMul, MathFuncDiv, MathFuncMod, MathFuncPow}
+		funcName := twoArgFuncs[g.rng.Intn(len(twoArgFuncs))]
+		constant := ValueExpr{int64(g.rng.Intn(3))}
+		if g.rng.Intn(2) == 0 {
+			constant = ValueExpr{float64(g.rng.Intn(3)) + 0.5}
+		}
+		return FuncExpr{funcName, []Expression{g.field(scope), constant}}, g.value()
+	case 4:
+		return FuncExpr{DateFunc, []Expression{g.field(scope)}}, TimeExpr{randTimes[g.rng.Intn(len(randTimes))]}
+	}
+	return g.field(scope), g.value()
+}
+
+func (g *randExprGenerator) comparison(scope VariableID) Expression {
+	lhs, rhs := g.operands(scope)
+	switch g.rng.Intn(7) {
+	case 0:
+		return EqualsExpr{lhs, rhs}
+	case 1:
+		return NotEqualsExpr{lhs, rhs}
+	case 2:
+		return LessThanExpr{lhs, rhs}
+	case 3:
+		return LessEqualsExpr{lhs, rhs}
+	case 4:
+		return GreaterThanExpr{lhs, rhs}
+	case 5:
+		return GreaterEqualsExpr{lhs, rhs}
+	}
+	return LikeExpr{g.field(scope), RegexExpr{randRegexes[g.rng.Intn(len(randRegexes))]}}
+}
+
+func (g *randExprGenerator) loop(scope VariableID, depth int) Expression {
+	inExpr := g.field(scope)
+	if scope != 0 && len(inExpr.Path) == 0 {
+		inExpr.Path = []string{g.pathElem()}
+	}
+
+	g.nextVar++
+	varID := g.nextVar
+	subExpr := g.expression(varID, depth-1)
+
+	switch g.rng.Intn(3) {
+	case 0:
+		return AnyInExpr{varID, inExpr, subExpr}
+	case 1:
+		return EveryInExpr{varID, inExpr, subExpr}
+	}
+	return AnyEveryInExpr{varID, inExpr, subExpr}
+}
+
+func (g *randExprGenerator) expression(scope VariableID, depth int) Expression {
+	maxKind := 10
+	if depth <= 0 {
+		maxKind = 6
+	}
+
+	switch g.rng.Intn(maxKind) {
+	case 0:
+		return ExistsExpr{g.field(scope)}
+	case 1:
+		return NotExistsExpr{g.field(scope)}
+	case 2, 3, 4, 5:
+		return g.comparison(scope)
+	case 6:
+		return NotExpr{g.expression(scope, depth-1)}
+	case 7:
+		return g.loop(scope, depth)
+	case 8:
+		expr := AndExpr{}
+		for i := 2 + g.rng.Intn(2); i > 0; i-- {
+			expr = append(expr, g.expression(scope, depth-1))
+		}
+		return expr
+	}
+
+	expr := OrExpr{}
+	for i := 2 + g.rng.Intn(2); i > 0; i-- {
+		expr = append(expr, g.expression(scope, depth-1))
+	}
+	return expr
+}
+
+// genRandomExpression generates a random expression against the documents
+// produced by genRandomDocument, with a nesting depth of at most depth.
+func genRandomExpression(rng *rand.Rand, depth int) Expression {
+	gen := &randExprGenerator{rng: rng}
+	return gen.expression(0, depth)
+}
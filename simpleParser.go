@@ -260,6 +260,7 @@ func (os *opSeeker) seekInternal(curIdx int) {
 
 type expressionParserContext struct {
 	// For token reading
+	expression           string
 	tokens               []string
 	currentTokenIndex    int
 	advTokenPositionOnly bool // This flag is set once, and the corresponding method will toggle it off automatically
@@ -311,6 +312,7 @@ const (
 func NewExpressionParserCtx(strExpression string) (*expressionParserContext, error) {
 	subCtx := NewParserSubContext()
 	ctx := &expressionParserContext{
+		expression:        strExpression,
 		tokens:            strings.Fields(strExpression),
 		subCtx:            subCtx,
 		treeHeadIndex:     -1,
@@ -342,6 +344,7 @@ const (
 	TokenTypeValue    ParseTokenType = iota
 	TokenTypeRegex    ParseTokenType = iota
 	TokenTypePcre     ParseTokenType = iota
+	TokenTypeLike     ParseTokenType = iota
 	TokenTypeParen    ParseTokenType = iota
 	TokenTypeEndParen ParseTokenType = iota
 	TokenTypeTrue     ParseTokenType = iota
@@ -361,6 +364,8 @@ func (ptt ParseTokenType) String() string {
 		return "TokenTypeRegex"
 	case TokenTypePcre:
 		return "TokenTypePcre"
+	case TokenTypeLike:
+		return "TokenTypeLike"
 	case TokenTypeParen:
 		return "TokenTypeParen"
 	case TokenTypeEndParen:
@@ -387,9 +392,10 @@ func (ptt ParseTokenType) isOpType() bool {
 	return ptt == TokenTypeOperator
 }
 
-// Regex is a type of special "value", and functions can act as values too
+// Regex and LIKE patterns are types of special "value", and functions can act as values too
 func (ptt ParseTokenType) isValueType() bool {
-	return ptt == TokenTypeValue || ptt == TokenTypeRegex || ptt == TokenTypeFunc || ptt == TokenTypePcre
+	return ptt == TokenTypeValue || ptt == TokenTypeRegex || ptt == TokenTypeFunc || ptt == TokenTypePcre ||
+		ptt == TokenTypeLike
 }
 
 // Operator types
@@ -433,8 +439,6 @@ func replaceOpTokenIfNecessary(token string) string {
 		return TokenOperatorOr
 	case TokenOperatorAnd2:
 		return TokenOperatorAnd
-	case TokenOperatorLike2:
-		return TokenOperatorLike
 	}
 	return token
 }
@@ -494,7 +498,7 @@ func (opCtx opTokenContext) isCompareOp() bool {
 }
 
 func (opCtx opTokenContext) isLikeOp() bool {
-	return opCtx == matchOp
+	return opCtx == matchOp || opCtx == likeOp
 }
 
 func (opCtx *opTokenContext) clear() {
@@ -610,8 +614,10 @@ func (ctx *expressionParserContext) checkAndMarkDetailedOpToken(token string) {
 		ctx.subCtx.opTokenContext = chainOp
 	} else if tokenIsCompareOpType(token) {
 		ctx.subCtx.opTokenContext = compareOp
-	} else if tokenIsLikeType(token) {
+	} else if token == TokenOperatorLike {
 		ctx.subCtx.opTokenContext = matchOp
+	} else if tokenIsLikeType(token) {
+		ctx.subCtx.opTokenContext = likeOp
 	} else if tokenIsOpOnlyType(token) {
 		ctx.subCtx.opTokenContext = noFieldOp
 	}
@@ -702,9 +708,12 @@ func (ctx *expressionParserContext) getCurrentTokenParenHelper(token string) (st
 }
 
 func (ctx *expressionParserContext) getTokenValueSubtype() ParseTokenType {
-	if ctx.subCtx.opTokenContext.isLikeOp() {
+	switch ctx.subCtx.opTokenContext {
+	case matchOp:
 		return TokenTypeRegex
-	} else {
+	case likeOp:
+		return TokenTypeLike
+	default:
 		return TokenTypeValue
 	}
 }
@@ -716,7 +725,8 @@ func (ctx *expressionParserContext) getValueTokenHelper(delim string) (string, P
 	token = strings.TrimPrefix(token, delim)
 	token = strings.TrimSuffix(token, delim)
 
-	if ctx.getTokenValueSubtype() != TokenTypeValue {
+	switch ctx.getTokenValueSubtype() {
+	case TokenTypeRegex:
 		_, err := regexp.Compile(token)
 		if err != nil {
 			if tokenIsPcreValueType(token) {
@@ -724,6 +734,11 @@ func (ctx *expressionParserContext) getValueTokenHelper(delim string) (string, P
 			}
 			return token, TokenTypeRegex, err
 		}
+	case TokenTypeLike:
+		_, err := CompileLikePattern(token, DefaultLikeEscape)
+		if err != nil {
+			return token, TokenTypeLike, err
+		}
 	}
 
 	return token, ctx.getTokenValueSubtype(), nil
@@ -1311,6 +1326,8 @@ func (ctx *expressionParserContext) outputNode(node ParserTreeNode, pos int) (Ex
 		return ctx.outputFunc(pos)
 	case TokenTypePcre:
 		return ctx.outputPcre(node)
+	case TokenTypeLike:
+		return ctx.outputLikePattern(node)
 	default:
 		return emptyExpression, fmt.Errorf("Error: Invalid Node token type: %v", node.tokenType.String())
 	}
@@ -1328,8 +1345,11 @@ func outputValueInternal(data interface{}) (Expression, error) {
 	var outputData interface{} = data
 	var err error
 	if strData, ok := data.(string); ok && valueNumRegex.MatchString(strData) {
-		if intNumRegex.MatchString(strData) {
+		if intNumRegex.MatchString(strData) && !intLiteralOverflows([]byte(strData)) {
 			outputData, err = strconv.ParseInt(strData, 10, 64)
+		} else if numberLiteralIsInexact([]byte(strData)) {
+			// Keep numbers which would lose precision as exact decimals
+			outputData, _ = parseDecimal(strData)
 		} else {
 			outputData, err = strconv.ParseFloat(strData, 64)
 		}
@@ -1350,6 +1370,10 @@ func (ctx *expressionParserContext) outputPcre(node ParserTreeNode) (Expression,
 	return PcreExpr{node.data}, nil
 }
 
+func (ctx *expressionParserContext) outputLikePattern(node ParserTreeNode) (Expression, error) {
+	return LikePatternExpr{fmt.Sprintf("%v", node.data), DefaultLikeEscape}, nil
+}
+
 func (ctx *expressionParserContext) outputField(pos int) (Expression, error) {
 	var out FieldExpr
 	path, ok := ctx.fieldTokenPaths[pos]
@@ -1393,7 +1417,7 @@ func (ctx *expressionParserContext) outputFunc(pos int) (Expression, error) {
 			if err != nil {
 				return out, fmt.Errorf("Error: Unable to output subFx: %v", err)
 			}
-			out.Params = append(out.Params, subFuncExpr.(FuncExpr))
+			out.Params = append(out.Params, subFuncExpr)
 		} else if fieldTokens, isField := helper.args[curLevel][i].([]string); isField {
 			var argField FieldExpr
 			argField.Path = fieldTokens
@@ -1436,7 +1460,7 @@ func (ctx *expressionParserContext) outputOp(node ParserTreeNode, pos int) (Expr
 		return ctx.outputGreaterThan(node, pos)
 	case TokenOperatorGreaterThanEq:
 		return ctx.outputGreaterThanEq(node, pos)
-	case TokenOperatorLike:
+	case TokenOperatorLike, TokenOperatorLike2:
 		return ctx.outputLike(node, pos)
 	case flattenToken(TokenOperatorNotLike):
 		return ctx.outputNotLike(node, pos)
@@ -1736,15 +1760,70 @@ func (helper *funcOutputHelper) makeNewFuncLevel() int {
 	return helper.lvlMarker
 }
 
+// Tokens are only ever split into smaller pieces as the expression is parsed,
+// so the offset of a token can be found by walking the tokens before it
+func (ctx *expressionParserContext) tokenOffset(index int) int {
+	if index >= len(ctx.tokens) {
+		return len(ctx.expression)
+	}
+
+	offset := 0
+	for i := 0; i <= index; i++ {
+		if found := strings.Index(ctx.expression[offset:], ctx.tokens[i]); found >= 0 {
+			offset += found
+		}
+		if i < index {
+			offset += len(ctx.tokens[i])
+		}
+	}
+	return offset
+}
+
+// The tokens which could have been accepted in the current mode
+func (ctx *expressionParserContext) expectedTokens() []string {
+	switch ctx.subCtx.currentMode {
+	case fieldMode:
+		return []string{"<field>", "(", "true", "false"}
+	case opMode:
+		return []string{TokenOperatorEqual, TokenOperatorEqual2, TokenOperatorNotEqual, TokenOperatorLessThan,
+			TokenOperatorLessThanEq, TokenOperatorGreaterThan, TokenOperatorGreaterThanEq, TokenOperatorLike,
+			TokenOperatorLike2, strings.Join(TokenOperatorNotLike, " "), TokenOperatorExists, strings.Join(TokenOperatorIsNull, " "),
+			strings.Join(TokenOperatorIsNotNull, " "), strings.Join(TokenOperatorIsMissing, " ")}
+	case valueMode:
+		return []string{"<value>"}
+	case chainMode:
+		return []string{TokenOperatorAnd, TokenOperatorAnd2, TokenOperatorOr, TokenOperatorOr2, ")"}
+	}
+	return nil
+}
+
+func (ctx *expressionParserContext) newParseError(err error) *ParseError {
+	var token string
+	if ctx.currentTokenIndex < len(ctx.tokens) {
+		token = ctx.tokens[ctx.currentTokenIndex]
+	}
+	return newParseError(ctx.expression, ctx.tokenOffset(ctx.currentTokenIndex), token, ctx.expectedTokens(), err)
+}
+
 // MAIN
+
+// ParseSimpleExpression parses an expression written in the simple syntax.
+// Errors are returned as a *ParseError which wraps one of the ErrorXxx
+// sentinels, so they no longer compare equal to the sentinels themselves.
+// Callers checking for a specific error should use errors.Is, such as
+// errors.Is(err, ErrorParenMismatch), rather than comparing with ==.
 func ParseSimpleExpression(strExpression string) (Expression, error) {
 	ctx, err := NewExpressionParserCtx(strExpression)
 	ctx.enableShortCircuitEvalIfPossible()
 	err = ctx.parse()
 
 	if err != nil {
-		return emptyExpression, err
+		return emptyExpression, ctx.newParseError(err)
 	}
 
-	return ctx.outputExpression()
+	expr, err := ctx.outputExpression()
+	if err != nil {
+		return expr, &ParseError{Err: err}
+	}
+	return expr, nil
 }
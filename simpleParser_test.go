@@ -13,7 +13,7 @@ import (
 
 func TestContextParserToken(t *testing.T) {
 	assert := assert.New(t)
-	testString := "name.first == \"Neil\" || (age < 50) || (true) && `someStr` LIKE \"a(?<!foo)\""
+	testString := "name.first == \"Neil\" || (age < 50) || (true) && `someStr` =~ \"a(?<!foo)\""
 	ctx, err := NewExpressionParserCtx(testString)
 
 	// name.first
@@ -110,7 +110,7 @@ func TestContextParserToken(t *testing.T) {
 	assert.Nil(err)
 	ctx.advanceToken()
 
-	// LIKE
+	// =~
 	_, tokenType, err = ctx.getCurrentToken()
 	assert.Equal(tokenType, (ParseTokenType)(TokenTypeOperator))
 	assert.Nil(err)
@@ -516,7 +516,7 @@ func TestContextParserMultiwordToken(t *testing.T) {
 
 	// abc
 	token, tokenType, err = ctx.getCurrentToken()
-	assert.Equal(tokenType, (ParseTokenType)(TokenTypeRegex))
+	assert.Equal(tokenType, (ParseTokenType)(TokenTypeLike))
 	assert.Nil(err)
 	assert.Equal("abc", token)
 }
@@ -626,7 +626,7 @@ func TestContextParserMultiwordToken3(t *testing.T) {
 
 func TestContextParserMatch(t *testing.T) {
 	assert := assert.New(t)
-	testString := "name.first LIKE \"Ne[a|i]l\""
+	testString := "name.first =~ \"Ne[a|i]l\""
 	ctx, err := NewExpressionParserCtx(testString)
 
 	// `name`.`first`
@@ -635,7 +635,7 @@ func TestContextParserMatch(t *testing.T) {
 	assert.Nil(err)
 	ctx.advanceToken()
 
-	// LIKE
+	// =~
 	token, tokenType, err := ctx.getCurrentToken()
 	assert.Equal(tokenType, (ParseTokenType)(TokenTypeOperator))
 	assert.Equal("=~", token)
@@ -651,6 +651,36 @@ func TestContextParserMatch(t *testing.T) {
 
 }
 
+func TestContextParserLikePattern(t *testing.T) {
+	assert := assert.New(t)
+	testString := "name.first LIKE \"Ne_l%\""
+	ctx, err := NewExpressionParserCtx(testString)
+
+	// `name`.`first`
+	_, tokenType, err := ctx.getCurrentToken()
+	assert.Equal(tokenType, (ParseTokenType)(TokenTypeField))
+	assert.Nil(err)
+	ctx.advanceToken()
+
+	// LIKE
+	token, tokenType, err := ctx.getCurrentToken()
+	assert.Equal(tokenType, (ParseTokenType)(TokenTypeOperator))
+	assert.Equal("LIKE", token)
+	assert.Nil(err)
+	ctx.advanceToken()
+	assert.True(ctx.subCtx.opTokenContext.isLikeOp())
+
+	// Ne_l%
+	token, tokenType, err = ctx.getCurrentToken()
+	assert.Equal(tokenType, (ParseTokenType)(TokenTypeLike))
+	assert.Nil(err)
+	assert.Equal("Ne_l%", token)
+
+	ctx, err = NewExpressionParserCtx("name.first LIKE \"Ne\\\"")
+	assert.Nil(err)
+	assert.NotNil(ctx.parse())
+}
+
 func TestContextParserWSField(t *testing.T) {
 	assert := assert.New(t)
 	testString := "name.`first and last` ==  \"Neil Huang\""
@@ -1390,13 +1420,13 @@ func TestParserExpressionOutputMatchNotNeg(t *testing.T) {
 		["not",
 			["like",
 			    ["field", "name", "first"],
-			    ["regex", "Ne[a|i]l"]
+			    ["likepattern", "Ne_l"]
 			]
 	    ]`)
 
 	jsonExpr, err := ParseJsonExpression(matchJson)
 	assert.Nil(err)
-	strExpr := "`name`.`first` NOT LIKE \"Ne[a|i]l\""
+	strExpr := "`name`.`first` NOT LIKE \"Ne_l\""
 
 	ctx, err := NewExpressionParserCtx(strExpr)
 	assert.Nil(err)
@@ -1455,13 +1485,13 @@ func TestParserExpressionOutputNotMatch(t *testing.T) {
 		["not",
 			["like",
 			    ["field", "name", "first"],
-			    ["regex", "Ne[a|i]l"]
+			    ["likepattern", "Ne_l"]
 			]
 	    ]`)
 
 	jsonExpr, err := ParseJsonExpression(matchJson)
 	assert.Nil(err)
-	strExpr := "`name`.`first` NOT LIKE \"Ne[a|i]l\""
+	strExpr := "`name`.`first` NOT LIKE \"Ne_l\""
 
 	ctx, err := NewExpressionParserCtx(strExpr)
 	assert.Nil(err)
@@ -3,15 +3,128 @@
 package gojsonsm
 
 import (
+	"bytes"
 	"encoding/json"
-	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 )
 
+// slowValue is a fully decoded document value.  It holds the FastVal which
+// the FastMatcher would produce for the same position in the document, along
+// with any children for objects and arrays.
+type slowValue struct {
+	val    FastVal
+	fields map[string]*slowValue
+	elems  []*slowValue
+}
+
+func newSlowValue(data []byte) (*slowValue, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("unexpected end of input")
+	}
+
+	switch data[0] {
+	case '{':
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+
+		value := &slowValue{
+			val:    NewObjectFastVal(data),
+			fields: make(map[string]*slowValue, len(fields)),
+		}
+		for key, fieldData := range fields {
+			field, err := newSlowValue(fieldData)
+			if err != nil {
+				return nil, err
+			}
+			value.fields[key] = field
+		}
+		return value, nil
+	case '[':
+		var elems []json.RawMessage
+		if err := json.Unmarshal(data, &elems); err != nil {
+			return nil, err
+		}
+
+		value := &slowValue{
+			val:   NewArrayFastVal(data),
+			elems: make([]*slowValue, len(elems)),
+		}
+		for i, elemData := range elems {
+			elem, err := newSlowValue(elemData)
+			if err != nil {
+				return nil, err
+			}
+			value.elems[i] = elem
+		}
+		return value, nil
+	}
+
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("invalid JSON literal: %s", data)
+	}
+
+	// Literals are parsed through the same literal parser as the FastMatcher
+	// uses so that both matchers see identical types for every value.
+	var token tokenType
+	switch data[0] {
+	case '"':
+		token = tknString
+		if bytes.IndexByte(data, '\\') >= 0 {
+			token = tknEscString
+		}
+	case 't':
+		token = tknTrue
+	case 'f':
+		token = tknFalse
+	case 'n':
+		token = tknNull
+	default:
+		token = tknInteger
+		if bytes.IndexAny(data, ".eE") >= 0 {
+			token = tknNumber
+		}
+	}
+
+	parser := &fastLitParser{}
+	return &slowValue{
+		val: parser.Parse(token, data),
+	}, nil
+}
+
+// elemByPath finds an array element using the same "[n]" path elements
+// that the FastMatcher uses to index into arrays.
+func (value *slowValue) elemByPath(field string) *slowValue {
+	if !strings.HasPrefix(field, "[") || !strings.HasSuffix(field, "]") {
+		return nil
+	}
+
+	idx, err := strconv.Atoi(field[1 : len(field)-1])
+	if err != nil || idx < 0 || idx >= len(value.elems) || fmt.Sprintf("[%d]", idx) != field {
+		return nil
+	}
+	return value.elems[idx]
+}
+
+// SlowMatcher is a simple recursive evaluator of expressions against fully
+// decoded documents.  It is intended to serve as a reference implementation
+// of the semantics which the FastMatcher implements, and follows the same
+// collation rules as it by performing all comparisons using FastVal.
 type SlowMatcher struct {
 	exprs       []Expression
 	exprMatches []bool
-	vars        map[VariableID]interface{}
+	vars        map[VariableID]*slowValue
+	collateUsed bool
+
+	// StrictMath has the same meaning as it does for a MatchDef.
+	StrictMath bool
+
+	// CompareMode has the same meaning as it does for a Transformer.
+	CompareMode CompareMode
 }
 
 func NewSlowMatcher(exprs []Expression) *SlowMatcher {
@@ -21,30 +134,60 @@ func NewSlowMatcher(exprs []Expression) *SlowMatcher {
 	}
 }
 
-func (m *SlowMatcher) resolveFieldParam(expr FieldExpr) (interface{}, error) {
-	rootVal := m.vars[expr.Root]
+func (m *SlowMatcher) resolveFieldParam(expr FieldExpr) *slowValue {
+	curVal := m.vars[expr.Root]
+	if curVal == nil {
+		if expr.Root == metaVariableID {
+			// Documents matched without metadata have nothing for META()
+			return nil
+		}
+		panic("reference to out-of-context variable was encountered")
+	}
 
-	curVal := rootVal
 	for _, field := range expr.Path {
-		if mapVal, ok := curVal.(map[string]interface{}); ok {
-			curVal = mapVal[field]
+		if curVal.fields != nil {
+			curVal = curVal.fields[field]
+		} else if curVal.elems != nil {
+			curVal = curVal.elemByPath(field)
 		} else {
-			return NewNullFastVal(), errors.New("invalid path")
+			curVal = nil
+		}
+
+		if curVal == nil {
+			return nil
 		}
 	}
 
-	return curVal, nil
+	return curVal
 }
 
-func (m *SlowMatcher) resolveParam(expr Expression) (interface{}, error) {
+func (m *SlowMatcher) resolveParam(expr Expression) (FastVal, error) {
 	switch expr := expr.(type) {
 	case FieldExpr:
-		return m.resolveFieldParam(expr)
-	case ValueExpr:
-		return expr.Value, nil
+		value := m.resolveFieldParam(expr)
+		if value == nil {
+			return NewMissingFastVal(), nil
+		}
+		return value.val, nil
+	case MetaExpr:
+		return m.resolveParam(expr.fieldExpr())
+	case FuncExpr:
+		params := make([]FastVal, len(expr.Params))
+		for i, paramExpr := range expr.Params {
+			param, err := m.resolveParam(paramExpr)
+			if err != nil {
+				return NewInvalidFastVal(), err
+			}
+			params[i] = param
+		}
+		result := callFastValFunc(expr.FuncName, params)
+		if m.StrictMath {
+			return result, checkFastValMath(expr.FuncName, params, result)
+		}
+		return result, nil
 	}
 
-	panic("unexpected param expression")
+	return newUserFastVal(expr)
 }
 
 func (m *SlowMatcher) matchOrExpr(expr OrExpr) (bool, error) {
@@ -81,189 +224,139 @@ func (m *SlowMatcher) matchAndExpr(expr AndExpr) (bool, error) {
 	return true, nil
 }
 
-func (m *SlowMatcher) compareExprs(lhs Expression, rhs Expression) (int, error) {
-	lhsVal, err := m.resolveParam(lhs)
-	if err != nil {
-		return 0, err
-	}
-
-	rhsVal, err := m.resolveParam(rhs)
+func (m *SlowMatcher) matchNotExpr(expr NotExpr) (bool, error) {
+	res, err := m.matchOne(expr.SubExpr)
 	if err != nil {
-		return 0, err
-	}
-
-	switch lhsVal := lhsVal.(type) {
-	case string:
-		switch rhsVal := rhsVal.(type) {
-		case string:
-			return strings.Compare(lhsVal, rhsVal), nil
-		}
-		return 0, errors.New("invalid type comparisons")
-	case float64:
-		switch rhsVal := rhsVal.(type) {
-		case float64:
-			if lhsVal < rhsVal {
-				return -1, nil
-			} else if lhsVal > rhsVal {
-				return 1, nil
-			}
-			return 0, nil
-		}
-		return 0, errors.New("invalid type comparisons")
-	case bool:
-		switch rhsVal := rhsVal.(type) {
-		case bool:
-			if lhsVal == true && rhsVal == false {
-				return 1, nil
-			} else if lhsVal == false && rhsVal == true {
-				return -1, nil
-			}
-			return 0, nil
-		}
-	case nil:
-		switch rhsVal.(type) {
-		case nil:
-			return 0, nil
-		}
-		return -1, nil
+		return false, err
 	}
 
-	return 0, errors.New("unexpected lhs type")
+	return !res, nil
 }
 
-func (m *SlowMatcher) matchAnyInExpr(expr AnyInExpr) (bool, error) {
-	vals, err := m.resolveParam(expr.InExpr)
-	if err != nil {
-		return false, err
+func (m *SlowMatcher) matchLoop(loopType LoopType, varID VariableID, inExpr, subExpr Expression) (bool, error) {
+	if metaExpr, ok := inExpr.(MetaExpr); ok {
+		inExpr = metaExpr.fieldExpr()
+	}
+	inField, ok := inExpr.(FieldExpr)
+	if !ok {
+		return false, fmt.Errorf("unexpected loop target expression %T", inExpr)
 	}
 
-	switch vals := vals.(type) {
-	case map[string]interface{}:
-		for _, val := range vals {
-			m.vars[expr.VarId] = val
-			res, err := m.matchOne(expr.SubExpr)
-			delete(m.vars, expr.VarId)
+	// Only arrays are iterated, anything else fails to match at all
+	vals := m.resolveFieldParam(inField)
+	if vals == nil || vals.elems == nil {
+		return false, nil
+	}
 
-			if err != nil {
-				return false, err
-			}
+	anyMatched := false
+	for _, val := range vals.elems {
+		m.vars[varID] = val
+		res, err := m.matchOne(subExpr)
+		delete(m.vars, varID)
 
-			if res {
-				return true, nil
-			}
+		if err != nil {
+			return false, err
 		}
 
-		return false, nil
-	case []interface{}:
-		for _, val := range vals {
-			m.vars[expr.VarId] = val
-			res, err := m.matchOne(expr.SubExpr)
-			delete(m.vars, expr.VarId)
-
-			if err != nil {
-				return false, err
-			}
-
-			if res {
+		if res {
+			anyMatched = true
+			if loopType == LoopTypeAny {
 				return true, nil
 			}
+		} else if loopType != LoopTypeAny {
+			return false, nil
 		}
+	}
 
+	switch loopType {
+	case LoopTypeAny:
 		return false, nil
+	case LoopTypeEvery:
+		return true, nil
+	case LoopTypeAnyEvery:
+		return anyMatched, nil
 	}
 
-	panic("unexpected any in param type")
+	panic("invalid loop mode")
 }
 
-func (m *SlowMatcher) matchEqualsExpr(expr EqualsExpr) (bool, error) {
-	val, err := m.compareExprs(expr.Lhs, expr.Rhs)
-	if err != nil {
-		return false, err
+func (m *SlowMatcher) matchExistsExpr(expr ExistsExpr) (bool, error) {
+	if metaExpr, ok := expr.SubExpr.(MetaExpr); ok {
+		return m.matchExistsExpr(ExistsExpr{metaExpr.fieldExpr()})
 	}
-
-	return val == 0, nil
-}
-
-func (m *SlowMatcher) matchNotEqualsExpr(expr NotEqualsExpr) (bool, error) {
-	val, err := m.compareExprs(expr.Lhs, expr.Rhs)
-	if err != nil {
-		return false, err
+	field, ok := expr.SubExpr.(FieldExpr)
+	if !ok {
+		return false, fmt.Errorf("unexpected exists expression %T", expr.SubExpr)
 	}
 
-	return val != 0, nil
+	return m.resolveFieldParam(field) != nil, nil
 }
 
-func (m *SlowMatcher) matchLessThanExpr(expr LessThanExpr) (bool, error) {
-	val, err := m.compareExprs(expr.Lhs, expr.Rhs)
+func (m *SlowMatcher) matchOp(op OpType, lhs Expression, rhs Expression) (bool, error) {
+	lhsVal, err := m.resolveParam(lhs)
 	if err != nil {
 		return false, err
 	}
 
-	return val < 0, nil
-}
-
-func (m *SlowMatcher) matchLessEqualsExpr(expr LessEqualsExpr) (bool, error) {
-	val, err := m.compareExprs(expr.Lhs, expr.Rhs)
+	rhsVal, err := m.resolveParam(rhs)
 	if err != nil {
 		return false, err
 	}
 
-	return val <= 0, nil
-}
-
-func (m *SlowMatcher) matchGreaterThanExpr(expr GreaterThanExpr) (bool, error) {
-	val, err := m.compareExprs(expr.Lhs, expr.Rhs)
-	if err != nil {
-		return false, err
+	// Comparisons involving a missing value never match
+	if lhsVal.IsMissing() || rhsVal.IsMissing() {
+		return false, nil
 	}
 
-	return val > 0, nil
-}
-
-func (m *SlowMatcher) matchGreaterEqualsExpr(expr GreaterEqualsExpr) (bool, error) {
-	val, err := m.compareExprs(expr.Lhs, expr.Rhs)
-	if err != nil {
-		return false, err
+	res, valid := evalOpWithMode(op, m.CompareMode, lhsVal, rhsVal)
+	if !valid {
+		m.collateUsed = true
 	}
 
-	return val >= 0, nil
+	return res, nil
 }
 
 func (m *SlowMatcher) matchOne(expr Expression) (bool, error) {
 	switch expr := expr.(type) {
+	case TrueExpr:
+		return true, nil
+	case FalseExpr:
+		return false, nil
 	case OrExpr:
 		return m.matchOrExpr(expr)
 	case AndExpr:
 		return m.matchAndExpr(expr)
+	case NotExpr:
+		return m.matchNotExpr(expr)
 	case AnyInExpr:
-		return m.matchAnyInExpr(expr)
+		return m.matchLoop(LoopTypeAny, expr.VarId, expr.InExpr, expr.SubExpr)
+	case EveryInExpr:
+		return m.matchLoop(LoopTypeEvery, expr.VarId, expr.InExpr, expr.SubExpr)
+	case AnyEveryInExpr:
+		return m.matchLoop(LoopTypeAnyEvery, expr.VarId, expr.InExpr, expr.SubExpr)
+	case ExistsExpr:
+		return m.matchExistsExpr(expr)
+	case NotExistsExpr:
+		res, err := m.matchExistsExpr(ExistsExpr{expr.SubExpr})
+		return !res, err
 	case EqualsExpr:
-		return m.matchEqualsExpr(expr)
+		return m.matchOp(OpTypeEquals, expr.Lhs, expr.Rhs)
 	case NotEqualsExpr:
-		return m.matchNotEqualsExpr(expr)
+		res, err := m.matchOp(OpTypeEquals, expr.Lhs, expr.Rhs)
+		return !res, err
 	case LessThanExpr:
-		return m.matchLessThanExpr(expr)
+		return m.matchOp(OpTypeLessThan, expr.Lhs, expr.Rhs)
 	case LessEqualsExpr:
-		return m.matchLessEqualsExpr(expr)
+		return m.matchOp(OpTypeLessEquals, expr.Lhs, expr.Rhs)
 	case GreaterThanExpr:
-		return m.matchGreaterThanExpr(expr)
+		return m.matchOp(OpTypeGreaterThan, expr.Lhs, expr.Rhs)
 	case GreaterEqualsExpr:
-		return m.matchGreaterEqualsExpr(expr)
+		return m.matchOp(OpTypeGreaterEquals, expr.Lhs, expr.Rhs)
+	case LikeExpr:
+		return m.matchOp(OpTypeMatches, expr.Lhs, expr.Rhs)
 	}
 
-	panic("unexpected expression")
-}
-
-func (m *SlowMatcher) matchOneRootExpr(expr Expression) (bool, error) {
-	// We do this to match the Matcher requirement that all non-root
-	// expressions be already compressed of all constant values.
-	switch expr.(type) {
-	case TrueExpr:
-		return true, nil
-	case FalseExpr:
-		return false, nil
-	}
-	return m.matchOne(expr)
+	panic(fmt.Sprintf("unexpected expression type %T", expr))
 }
 
 func (m *SlowMatcher) Reset() {
@@ -273,43 +366,82 @@ func (m *SlowMatcher) Reset() {
 	for i := range m.exprMatches {
 		m.exprMatches[i] = false
 	}
+	m.collateUsed = false
 }
 
 func (m *SlowMatcher) Match(data []byte) (bool, error) {
-	var parsedData interface{}
-	if err := json.Unmarshal(data, &parsedData); err != nil {
+	doc, err := newSlowValue(data)
+	if err != nil {
 		return false, err
 	}
+	return m.matchDocument(doc, nil)
+}
 
+func (m *SlowMatcher) matchDocument(doc *slowValue, meta *DocumentMeta) (bool, error) {
 	if m.vars == nil {
-		m.vars = make(map[VariableID]interface{})
+		m.vars = make(map[VariableID]*slowValue)
+	}
+	m.vars[0] = doc
+	defer delete(m.vars, 0)
+
+	if meta != nil {
+		metaData, err := appendMetaObject(nil, meta)
+		if err != nil {
+			return false, err
+		}
+		m.vars[metaVariableID], err = newSlowValue(metaData)
+		if err != nil {
+			return false, err
+		}
+		defer delete(m.vars, metaVariableID)
 	}
-	m.vars[0] = parsedData
 
+	// The document matches if any of the expressions match it, and a
+	// constant TrueExpr always does, whatever the others evaluate to.
 	matched := false
 	for i, expr := range m.exprs {
-		res, err := m.matchOneRootExpr(expr)
+		res, err := m.matchOne(expr)
 		if err != nil {
 			return false, err
 		}
 
 		m.exprMatches[i] = res
-
-		if i == 0 && res {
+		if res {
 			matched = true
-		} else if !res {
-			matched = false
 		}
 	}
 
-	delete(m.vars, 0)
 	return matched, nil
 }
 
+func (m *SlowMatcher) MatchWithMeta(data []byte, meta *DocumentMeta) (bool, error) {
+	doc, err := newSlowValue(data)
+	if err != nil {
+		return false, err
+	}
+	return m.matchDocument(doc, meta)
+}
+
+func (m *SlowMatcher) MatchWithKey(key []byte, data []byte) (bool, error) {
+	return m.MatchWithMeta(data, &DocumentMeta{Key: key})
+}
+
+// MatchBinary matches a document whose body is not JSON.  The document is
+// a binary value with no fields, and META() refers to meta if any is given.
+func (m *SlowMatcher) MatchBinary(data []byte, meta *DocumentMeta) (bool, error) {
+	doc := &slowValue{
+		val: NewBinaryFastVal(data),
+	}
+	return m.matchDocument(doc, meta)
+}
+
 func (m *SlowMatcher) MatchWithStatus(data []byte) (bool, int, error) {
-	// pass through
+	var statusFlags int
 	matched, err := m.Match(data)
-	return matched, MatcherNoStatus, err
+	if m.collateUsed {
+		statusFlags |= MatcherCollateUsed
+	}
+	return matched, statusFlags, err
 }
 
 func (m *SlowMatcher) ExpressionMatched(expressionIdx int) bool {
@@ -0,0 +1,174 @@
+// Copyright 2018 Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func checkMatcherParity(t *testing.T, exprs []Expression, docs ...[]byte) {
+	var def *MatchDef
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("failed to transform expression: %v\n%v", r, exprs)
+			}
+		}()
+
+		var trans Transformer
+		def = trans.Transform(exprs)
+	}()
+
+	fast := NewFastMatcher(def)
+	slow := NewSlowMatcher(exprs)
+
+	for _, doc := range docs {
+		fast.Reset()
+		slow.Reset()
+
+		fastMatched, fastErr := fast.Match(doc)
+		slowMatched, slowErr := slow.Match(doc)
+		if fastErr != nil || slowErr != nil {
+			t.Fatalf("unexpected errors: fast %v, slow %v\ndoc: %s", fastErr, slowErr, doc)
+		}
+
+		if fastMatched != slowMatched {
+			t.Fatalf("matchers disagree: fast %v, slow %v\ndoc: %s\nexpressions: %v", fastMatched, slowMatched, doc, exprs)
+		}
+
+		for i, expr := range exprs {
+			if def.MatchBuckets[i] < 0 {
+				continue
+			}
+			if fast.ExpressionMatched(i) != slow.ExpressionMatched(i) {
+				t.Fatalf("matchers disagree on expression %d: fast %v, slow %v\ndoc: %s\nexpression:\n%v",
+					i, fast.ExpressionMatched(i), slow.ExpressionMatched(i), doc, expr)
+			}
+		}
+	}
+}
+
+func TestSlowMatcherParity(t *testing.T) {
+	docs := []string{
+		`{"a":1,"b":[1,2,{"c":"x"}],"c":{"d":null},"d":"2019-01-01T00:00:00Z"}`,
+		`{"a":"1","b":[],"c":{},"d":true}`,
+		`{"a":-2.5,"b":[{"a":"ab"},{"a":"B"}],"c":{"a":[3.0,1e3]}}`,
+		`{}`,
+	}
+
+	exprs := []Expression{
+		NotExpr{EqualsExpr{FieldExpr{0, []string{"a"}}, ValueExpr{int64(1)}}},
+		NotExistsExpr{FieldExpr{0, []string{"c", "d"}}},
+		EveryInExpr{1, FieldExpr{0, []string{"b"}}, NotExpr{EqualsExpr{FieldExpr{1, []string{"a"}}, ValueExpr{"B"}}}},
+		AnyEveryInExpr{1, FieldExpr{0, []string{"b"}}, ExistsExpr{FieldExpr{1, []string{"a"}}}},
+		LikeExpr{FieldExpr{0, []string{"b", "[1]", "a"}}, RegexExpr{"^a"}},
+		GreaterThanExpr{FuncExpr{DateFunc, []Expression{FieldExpr{0, []string{"d"}}}}, TimeExpr{"2018-01-01"}},
+		LessThanExpr{FuncExpr{MathFuncAbs, []Expression{FieldExpr{0, []string{"a"}}}}, ValueExpr{int64(2)}},
+		EqualsExpr{FieldExpr{0, []string{"c"}}, FieldExpr{0, []string{"b", "[2]"}}},
+		GreaterEqualsExpr{FieldExpr{0, []string{"a"}}, ValueExpr{"1"}},
+	}
+
+	var docBytes [][]byte
+	for _, doc := range docs {
+		docBytes = append(docBytes, []byte(doc))
+	}
+
+	checkMatcherParity(t, exprs, docBytes...)
+	for _, expr := range exprs {
+		checkMatcherParity(t, []Expression{expr}, docBytes...)
+	}
+
+	// Constant expressions decide the result alongside the others
+	for _, mixed := range [][]Expression{
+		{TrueExpr{}, exprs[0]},
+		{exprs[0], TrueExpr{}},
+		{FalseExpr{}, exprs[0]},
+		{exprs[0], FalseExpr{}, TrueExpr{}},
+	} {
+		checkMatcherParity(t, mixed, docBytes...)
+	}
+}
+
+func TestSlowMatcherStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	m := NewSlowMatcher([]Expression{
+		GreaterThanExpr{FieldExpr{0, []string{"a"}}, ValueExpr{int64(123)}},
+	})
+
+	matched, status, err := m.MatchWithStatus([]byte(`{"a":"x"}`))
+	assert.Nil(err)
+	assert.True(matched)
+	assert.Equal(MatcherCollateUsed, status)
+}
+
+func TestSlowMatcherRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		expr := genRandomExpression(rng, 3)
+
+		docs := make([][]byte, 8)
+		for j := range docs {
+			docs[j] = genRandomDocument(rng, 3)
+		}
+
+		checkMatcherParity(t, []Expression{expr}, docs...)
+	}
+}
+
+func FuzzMatcherParity(f *testing.F) {
+	for seed := int64(0); seed < 16; seed++ {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		rng := rand.New(rand.NewSource(seed))
+
+		exprs := make([]Expression, 1+rng.Intn(3))
+		for i := range exprs {
+			exprs[i] = genRandomExpression(rng, 3)
+		}
+
+		docs := make([][]byte, 8)
+		for i := range docs {
+			docs[i] = genRandomDocument(rng, 3)
+		}
+
+		checkMatcherParity(t, exprs, docs...)
+	})
+}
+
+func FuzzMatcherParityDocument(f *testing.F) {
+	f.Add(int64(0), []byte(`{"a":1,"b":[1,"2",{"c":null}]}`))
+	f.Add(int64(1), []byte(`{"a":{"b":"x"},"c":[[1],[]],"d":-0.5}`))
+	f.Add(int64(2), []byte(`{"b":[1,2,3],"d":{"b":[{}]}}`))
+
+	f.Fuzz(func(t *testing.T, seed int64, data []byte) {
+		// Documents are normalized to remove duplicate keys, which JSON
+		// leaves undefined and the matchers handle differently.
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+
+		var parsed map[string]interface{}
+		if err := decoder.Decode(&parsed); err != nil || parsed == nil || decoder.More() {
+			return
+		}
+		doc, err := json.Marshal(parsed)
+		if err != nil {
+			return
+		}
+
+		rng := rand.New(rand.NewSource(seed))
+		expr := genRandomExpression(rng, 3)
+
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			checkMatcherParity(t, []Expression{expr}, doc)
+		})
+	})
+}
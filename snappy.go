@@ -0,0 +1,185 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"encoding/binary"
+)
+
+const (
+	snappyTagLiteral = 0
+	snappyTagCopy1   = 1
+	snappyTagCopy2   = 2
+	snappyTagCopy4   = 3
+
+	// snappyMaxRatio bounds how much larger than its input a valid block
+	// can claim to be.  The densest element copies 64 bytes for 3 bytes of
+	// input, so anything beyond this is rejected before allocating for it.
+	snappyMaxRatio = 32
+
+	// snappyStepSize is how much more of a document is decompressed each
+	// time the tokenizer runs out
+	snappyStepSize = 4096
+)
+
+// snappyDecoder decompresses a block in the Snappy format a step at a time,
+// into a buffer which is kept between documents.
+type snappyDecoder struct {
+	src    []byte
+	srcPos int
+	dst    []byte
+	dstLen int
+}
+
+func (d *snappyDecoder) Reset(src []byte) error {
+	dstLen, n := binary.Uvarint(src)
+	if n <= 0 || dstLen > uint64(len(src))*snappyMaxRatio {
+		return ErrorMalformedCompression
+	}
+
+	d.src = src
+	d.srcPos = n
+	d.dstLen = int(dstLen)
+	if cap(d.dst) < d.dstLen {
+		d.dst = make([]byte, 0, d.dstLen)
+	}
+	d.dst = d.dst[:0]
+	return nil
+}
+
+func (d *snappyDecoder) Done() bool {
+	return len(d.dst) == d.dstLen
+}
+
+// Decode decompresses until at least target bytes of the document are
+// available, or the whole document has been.
+func (d *snappyDecoder) Decode(target int) error {
+	src := d.src
+	for len(d.dst) < target && len(d.dst) < d.dstLen {
+		if d.srcPos >= len(src) {
+			return ErrorMalformedCompression
+		}
+		tag := src[d.srcPos]
+		pos := d.srcPos + 1
+
+		var length, offset int
+		switch tag & 3 {
+		case snappyTagLiteral:
+			length = int(tag >> 2)
+			if length >= 60 {
+				size := length - 59
+				if len(src)-pos < size {
+					return ErrorMalformedCompression
+				}
+				length = 0
+				for i := size - 1; i >= 0; i-- {
+					length = length<<8 | int(src[pos+i])
+				}
+				pos += size
+			}
+			length++
+			if length > len(src)-pos || length > d.dstLen-len(d.dst) {
+				return ErrorMalformedCompression
+			}
+			d.dst = append(d.dst, src[pos:pos+length]...)
+			d.srcPos = pos + length
+			continue
+		case snappyTagCopy1:
+			if len(src)-pos < 1 {
+				return ErrorMalformedCompression
+			}
+			length = 4 + int(tag>>2)&7
+			offset = int(tag&0xe0)<<3 | int(src[pos])
+			pos++
+		case snappyTagCopy2:
+			if len(src)-pos < 2 {
+				return ErrorMalformedCompression
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[pos:]))
+			pos += 2
+		case snappyTagCopy4:
+			if len(src)-pos < 4 {
+				return ErrorMalformedCompression
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[pos:]))
+			pos += 4
+		}
+
+		if offset <= 0 || offset > len(d.dst) || length > d.dstLen-len(d.dst) {
+			return ErrorMalformedCompression
+		}
+		// Copies may overlap the bytes they produce, so go a byte at a time
+		copyPos := len(d.dst) - offset
+		for i := 0; i < length; i++ {
+			d.dst = append(d.dst, d.dst[copyPos+i])
+		}
+		d.srcPos = pos
+	}
+
+	if d.Done() && d.srcPos != len(src) {
+		return ErrorMalformedCompression
+	}
+	return nil
+}
+
+// snappyTokenizer tokenizes a Snappy compressed JSON document, only
+// decompressing as much of it as has been tokenized.
+type snappyTokenizer struct {
+	json    jsonTokenizer
+	decoder snappyDecoder
+}
+
+func (tkn *snappyTokenizer) Reset(data []byte) error {
+	err := tkn.decoder.Reset(data)
+	if err != nil {
+		return err
+	}
+	tkn.json.Reset(tkn.decoder.dst)
+	return nil
+}
+
+// DecodeAll decompresses the rest of the document.
+func (tkn *snappyTokenizer) DecodeAll() error {
+	err := tkn.decoder.Decode(tkn.decoder.dstLen)
+	tkn.json.data = tkn.decoder.dst
+	tkn.json.dataLen = len(tkn.decoder.dst)
+	return err
+}
+
+func (tkn *snappyTokenizer) Position() int {
+	return tkn.json.Position()
+}
+
+func (tkn *snappyTokenizer) Seek(pos int) {
+	tkn.json.Seek(pos)
+}
+
+func (tkn *snappyTokenizer) Slice(start, end int) []byte {
+	return tkn.json.Slice(start, end)
+}
+
+func (tkn *snappyTokenizer) Step() (tokenType, []byte, int, error) {
+	start := tkn.json.Position()
+	for {
+		token, tokenData, tokenDataLen, err := tkn.json.Step()
+
+		// A token which reaches the end of the decompressed data may carry
+		// on past it, so it is only complete once the data goes further
+		if tkn.decoder.Done() ||
+			(err == nil && token != tknEnd && tkn.json.Position() < tkn.json.dataLen) {
+			return token, tokenData, tokenDataLen, err
+		}
+
+		// The buffer never grows beyond its initial capacity, so the
+		// tokens already returned remain valid
+		err = tkn.decoder.Decode(len(tkn.decoder.dst) + snappyStepSize)
+		if err != nil {
+			return tknUnknown, nil, 0, err
+		}
+		tkn.json.data = tkn.decoder.dst
+		tkn.json.dataLen = len(tkn.decoder.dst)
+		tkn.json.Seek(start)
+	}
+}
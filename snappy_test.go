@@ -0,0 +1,233 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func appendSnappyLiteral(buf []byte, literal []byte) []byte {
+	if len(literal) == 0 {
+		return buf
+	}
+
+	n := len(literal) - 1
+	switch {
+	case n < 60:
+		buf = append(buf, byte(n)<<2|snappyTagLiteral)
+	case n < 1<<8:
+		buf = append(buf, 60<<2|snappyTagLiteral, byte(n))
+	case n < 1<<16:
+		buf = append(buf, 61<<2|snappyTagLiteral, byte(n), byte(n>>8))
+	default:
+		buf = append(buf, 62<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	}
+	return append(buf, literal...)
+}
+
+func appendSnappyCopy(buf []byte, offset int, length int) []byte {
+	for length > 0 {
+		chunk := length
+		if chunk > 64 {
+			chunk = 64
+		}
+		length -= chunk
+
+		switch {
+		case chunk >= 4 && chunk <= 11 && offset < 1<<11:
+			buf = append(buf, byte(offset>>8)<<5|byte(chunk-4)<<2|snappyTagCopy1, byte(offset))
+		case offset < 1<<16:
+			buf = append(buf, byte(chunk-1)<<2|snappyTagCopy2)
+			buf = binary.LittleEndian.AppendUint16(buf, uint16(offset))
+		default:
+			buf = append(buf, byte(chunk-1)<<2|snappyTagCopy4)
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(offset))
+		}
+	}
+	return buf
+}
+
+// appendSnappyBlock compresses data in the Snappy block format, copying
+// any run of four or more bytes which has been seen before.
+func appendSnappyBlock(buf []byte, data []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+
+	seen := make(map[uint32]int)
+	literalStart := 0
+	i := 0
+	for i+4 <= len(data) {
+		key := binary.LittleEndian.Uint32(data[i:])
+		prev, found := seen[key]
+		seen[key] = i
+		if !found {
+			i++
+			continue
+		}
+
+		length := 4
+		for i+length < len(data) && data[prev+length] == data[i+length] {
+			length++
+		}
+		buf = appendSnappyLiteral(buf, data[literalStart:i])
+		buf = appendSnappyCopy(buf, i-prev, length)
+		i += length
+		literalStart = i
+	}
+	return appendSnappyLiteral(buf, data[literalStart:])
+}
+
+func genRandomLetters(rng *rand.Rand, n int) []byte {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = byte('a' + rng.Intn(26))
+	}
+	return out
+}
+
+func TestSnappyDecoder(t *testing.T) {
+	assert := assert.New(t)
+
+	rng := rand.New(rand.NewSource(1))
+	inputs := [][]byte{
+		{},
+		[]byte("a"),
+		bytes.Repeat([]byte("a"), 1000),
+		bytes.Repeat([]byte("abcdefgh"), 5000),
+		genRandomLetters(rng, 70000),
+		append(genRandomLetters(rng, 300), bytes.Repeat(genRandomLetters(rng, 100), 700)...),
+	}
+
+	var decoder snappyDecoder
+	for _, input := range inputs {
+		compressed := appendSnappyBlock(nil, input)
+
+		assert.Nil(decoder.Reset(compressed))
+		assert.Nil(decoder.Decode(len(input)))
+		assert.True(decoder.Done())
+		assert.True(bytes.Equal(input, decoder.dst))
+
+		// Decoding in steps gives the same result
+		assert.Nil(decoder.Reset(compressed))
+		for !decoder.Done() {
+			assert.Nil(decoder.Decode(len(decoder.dst) + 100))
+		}
+		assert.True(bytes.Equal(input, decoder.dst))
+	}
+}
+
+func TestMatchSnappyRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		expr := genRandomExpression(rng, 3)
+
+		var trans Transformer
+		m := NewFastMatcher(trans.Transform([]Expression{expr}))
+
+		for j := 0; j < 8; j++ {
+			doc := genRandomDocument(rng, 3)
+			compressed := appendSnappyBlock(nil, doc)
+
+			m.Reset()
+			expected, err := m.Match(doc)
+			if err != nil {
+				t.Fatalf("failed to match %s: %v", doc, err)
+			}
+
+			for _, earlyExit := range []bool{false, true} {
+				m.Reset()
+				matched, err := m.MatchSnappy(compressed, earlyExit)
+				if err != nil {
+					t.Fatalf("failed to match compressed document %s: %v", doc, err)
+				}
+				if matched != expected {
+					t.Fatalf("compressed document matched %v, but JSON matched %v\ndoc: %s\nexpression: %v",
+						matched, expected, doc, expr)
+				}
+			}
+		}
+	}
+}
+
+func TestMatchSnappyEarlyExit(t *testing.T) {
+	assert := assert.New(t)
+
+	rng := rand.New(rand.NewSource(1))
+	doc := []byte(`{"a":1,"pad":"` + string(genRandomLetters(rng, 4*snappyStepSize)) + `"}`)
+	compressed := appendSnappyBlock(nil, doc)
+	// Cutting the end off leaves a block which is only invalid at the end
+	truncated := compressed[:len(compressed)-10]
+
+	m, err := GetFilterExpressionMatcher(`a = 1`)
+	assert.Nil(err)
+	fm := m.(*FastMatcher)
+
+	match, err := fm.MatchSnappy(truncated, true)
+	assert.Nil(err)
+	assert.True(match)
+	assert.Less(len(fm.snappyTokens.decoder.dst), len(doc))
+
+	fm.Reset()
+	_, err = fm.MatchSnappy(truncated, false)
+	assert.Equal(ErrorMalformedCompression, err)
+
+	// Fields past what has been decompressed are still found
+	m, err = GetFilterExpressionMatcher(`b = 2`)
+	assert.Nil(err)
+	fm = m.(*FastMatcher)
+	doc = append(doc[:len(doc)-1], `,"b":2}`...)
+	match, err = fm.MatchSnappy(appendSnappyBlock(nil, doc), true)
+	assert.Nil(err)
+	assert.True(match)
+	assert.Equal(len(doc), len(fm.snappyTokens.decoder.dst))
+}
+
+func TestMatchSnappyErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	var trans Transformer
+	m := NewFastMatcher(trans.Transform([]Expression{
+		NotExistsExpr{FieldExpr{0, []string{"missing"}}},
+	}))
+
+	for _, data := range [][]byte{
+		{},
+		{0x80},
+		{0xff, 0xff, 0xff, 0xff, 0x0f, 0x00},
+		{0x02, 0x04, '{'},
+		{0x02, 0x00, '{'},
+		{0x02, 0x04, '{', '}', 0x00},
+		{0x02, 0x00, '{', 0x01, 0x01},
+		{0x03, 0x00, '{', 0x01, 0x00},
+		{0x03, 0x00, '{', 0x06, 0x02, 0x00},
+		{0x02, 0xf0},
+		{0x02, 0x04, '{', '"'},
+	} {
+		m.Reset()
+		_, err := m.MatchSnappy(data, false)
+		assert.NotNil(err, "%x", data)
+	}
+}
+
+func FuzzMatchSnappy(f *testing.F) {
+	f.Add(appendSnappyBlock(nil, []byte(`{"a":[1,2,{"a":2}],"b":"aaaaaaaa"}`)))
+
+	exprs := []Expression{
+		NotExistsExpr{FieldExpr{0, []string{"missing"}}},
+		AnyInExpr{1, FieldExpr{0, []string{"a"}}, EqualsExpr{FieldExpr{1, nil}, ValueExpr{int64(2)}}},
+		EqualsExpr{FieldExpr{0, []string{"a"}}, FieldExpr{0, []string{"b"}}},
+	}
+	var trans Transformer
+	m := NewFastMatcher(trans.Transform(exprs))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, earlyExit := range []bool{false, true} {
+			m.Reset()
+			m.MatchSnappy(data, earlyExit)
+		}
+	})
+}
@@ -0,0 +1,558 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// SQLDialect selects the flavour of SQL which EmitSQL writes.
+type SQLDialect int
+
+const (
+	// SQLDialectN1QL writes a N1QL WHERE clause with $1, $2, ...
+	// placeholders for its parameters.
+	SQLDialectN1QL SQLDialect = iota
+
+	// SQLDialectJSON writes standard SQL which reads fields from a JSON
+	// column with JSON_VALUE and JSON_EXISTS, with ? placeholders for its
+	// parameters.  Loops and metadata have no equivalent in it.
+	SQLDialectJSON
+)
+
+type SQLOptions struct {
+	Dialect SQLDialect
+
+	// Alias qualifies the fields of the document in N1QL, which is needed
+	// when the document may have fields named the same as the loop
+	// variables v1, v2, ... which loops introduce.  For SQLDialectJSON it
+	// is the JSON column which holds the document, written as given, and
+	// must be set.
+	Alias string
+}
+
+// SQLEmitError is returned by EmitSQL for expressions which have no
+// equivalent in the chosen dialect.
+type SQLEmitError struct {
+	Expr    Expression
+	Message string
+}
+
+func (err SQLEmitError) Error() string {
+	return err.Message
+}
+
+var sqlN1QLFuncNames = map[string]string{
+	MathFuncAbs:     "ABS",
+	MathFuncAcos:    "ACOS",
+	MathFuncAsin:    "ASIN",
+	MathFuncAtan:    "ATAN",
+	MathFuncAtan2:   "ATAN2",
+	MathFuncCeil:    "CEIL",
+	MathFuncCos:     "COS",
+	MathFuncDegrees: "DEGREES",
+	MathFuncExp:     "EXP",
+	MathFuncFloor:   "FLOOR",
+	MathFuncLog:     "LOG",
+	MathFuncLn:      "LN",
+	MathFuncPow:     "POWER",
+	MathFuncRadians: "RADIANS",
+	MathFuncRound:   "ROUND",
+	MathFuncSin:     "SIN",
+	MathFuncSqrt:    "SQRT",
+	MathFuncTan:     "TAN",
+	DateFunc:        "STR_TO_MILLIS",
+	TypeFunc:        "TYPE",
+	ArrayLengthFunc: "ARRAY_LENGTH",
+	LowerFunc:       "LOWER",
+	UpperFunc:       "UPPER",
+}
+
+var sqlJSONFuncNames = map[string]string{
+	MathFuncAbs:   "ABS",
+	MathFuncAcos:  "ACOS",
+	MathFuncAsin:  "ASIN",
+	MathFuncAtan:  "ATAN",
+	MathFuncCeil:  "CEIL",
+	MathFuncCos:   "COS",
+	MathFuncExp:   "EXP",
+	MathFuncFloor: "FLOOR",
+	MathFuncLog:   "LOG10",
+	MathFuncLn:    "LN",
+	MathFuncPow:   "POWER",
+	MathFuncSin:   "SIN",
+	MathFuncSqrt:  "SQRT",
+	MathFuncTan:   "TAN",
+	LowerFunc:     "LOWER",
+	UpperFunc:     "UPPER",
+}
+
+var sqlInfixOps = map[string]string{
+	MathFuncAdd: "+",
+	MathFuncSub: "-",
+	MathFuncMul: "*",
+	MathFuncDiv: "/",
+	MathFuncMod: "%",
+}
+
+type sqlEmitter struct {
+	opts   SQLOptions
+	out    strings.Builder
+	params []interface{}
+}
+
+func (e *sqlEmitter) fail(expr Expression, format string, args ...interface{}) {
+	panic(SQLEmitError{expr, fmt.Sprintf(format, args...)})
+}
+
+// likePattern writes a SQL LIKE.  N1QL already uses \ as its escape
+// character, but standard SQL has none unless ESCAPE names one.
+func (e *sqlEmitter) likePattern(expr LikeExpr, pattern LikePatternExpr) {
+	if _, err := CompileLikePattern(pattern.Pattern, pattern.Escape); err != nil {
+		e.fail(expr, "%v", err)
+	}
+
+	e.operand(expr.Lhs, false)
+	e.out.WriteString(" LIKE ")
+	e.param(sqlLikePattern(pattern))
+	if !e.isN1QL() {
+		e.out.WriteString(` ESCAPE '\'`)
+	}
+}
+
+// sqlLikePattern rewrites a LIKE pattern to use \ as its escape character.
+func sqlLikePattern(pattern LikePatternExpr) string {
+	if pattern.Escape == DefaultLikeEscape {
+		return pattern.Pattern
+	}
+
+	var out strings.Builder
+	escaped := false
+	for _, char := range pattern.Pattern {
+		switch {
+		case escaped:
+			if char == '%' || char == '_' || char == DefaultLikeEscape {
+				out.WriteRune(DefaultLikeEscape)
+			}
+			out.WriteRune(char)
+			escaped = false
+		case pattern.Escape != 0 && char == pattern.Escape:
+			escaped = true
+		case char == DefaultLikeEscape:
+			out.WriteString(`\\`)
+		default:
+			out.WriteRune(char)
+		}
+	}
+	return out.String()
+}
+
+func (e *sqlEmitter) isN1QL() bool {
+	return e.opts.Dialect == SQLDialectN1QL
+}
+
+func (e *sqlEmitter) dialectName() string {
+	if e.isN1QL() {
+		return "N1QL"
+	}
+	return "SQL/JSON"
+}
+
+func (e *sqlEmitter) param(value interface{}) {
+	e.params = append(e.params, value)
+	if e.isN1QL() {
+		e.out.WriteString("$" + strconv.Itoa(len(e.params)))
+	} else {
+		e.out.WriteString("?")
+	}
+}
+
+func sqlIsIndex(elem string) bool {
+	if len(elem) < 3 || elem[0] != '[' || elem[len(elem)-1] != ']' {
+		return false
+	}
+	_, err := strconv.ParseUint(elem[1:len(elem)-1], 10, 31)
+	return err == nil
+}
+
+func sqlIsNumber(value interface{}) bool {
+	switch value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, *big.Rat, *big.Int:
+		return true
+	}
+	return false
+}
+
+// sqlIsNumeric reports whether an operand is known to be a number, which
+// decides how fields are read from a JSON column.
+func sqlIsNumeric(expr Expression) bool {
+	switch expr := expr.(type) {
+	case ValueExpr:
+		return sqlIsNumber(expr.Value)
+	case FuncExpr:
+		_, resultType := funcFieldTypes(expr.FuncName)
+		return resultType == FieldTypeNumber
+	}
+	return false
+}
+
+func (e *sqlEmitter) n1qlIdentifier(name string) {
+	e.out.WriteString("`" + strings.ReplaceAll(name, "`", "``") + "`")
+}
+
+func (e *sqlEmitter) n1qlPath(path []string) {
+	for _, elem := range path {
+		if sqlIsIndex(elem) {
+			e.out.WriteString(elem)
+			continue
+		}
+		e.out.WriteString(".")
+		e.n1qlIdentifier(elem)
+	}
+}
+
+// jsonPath returns a field as a SQL/JSON path, quoted as a SQL string.
+func (e *sqlEmitter) jsonPath(field FieldExpr, filter string) string {
+	if field.Root != 0 {
+		e.fail(field, "loop variables have no SQL/JSON equivalent")
+	}
+
+	path := "$"
+	for _, elem := range field.Path {
+		if sqlIsIndex(elem) {
+			path += elem
+			continue
+		}
+		elem = strings.ReplaceAll(elem, `\`, `\\`)
+		path += `."` + strings.ReplaceAll(elem, `"`, `\"`) + `"`
+	}
+	return "'" + strings.ReplaceAll(path+filter, "'", "''") + "'"
+}
+
+func (e *sqlEmitter) field(field FieldExpr, numeric bool) {
+	if !e.isN1QL() {
+		returning := ""
+		if numeric {
+			returning = " RETURNING DOUBLE PRECISION"
+		}
+		fmt.Fprintf(&e.out, "JSON_VALUE(%s, %s%s)", e.opts.Alias, e.jsonPath(field, ""), returning)
+		return
+	}
+
+	switch {
+	case field.Root != 0:
+		e.out.WriteString("v" + strconv.Itoa(int(field.Root)))
+	case e.opts.Alias != "":
+		e.n1qlIdentifier(e.opts.Alias)
+	case len(field.Path) == 0 || sqlIsIndex(field.Path[0]):
+		e.fail(field, "the whole document can only be referred to when an alias is given")
+	default:
+		e.n1qlIdentifier(field.Path[0])
+		e.n1qlPath(field.Path[1:])
+		return
+	}
+	e.n1qlPath(field.Path)
+}
+
+// operand writes a value which is compared or passed to a function.
+func (e *sqlEmitter) operand(expr Expression, numeric bool) {
+	switch expr := expr.(type) {
+	case ValueExpr:
+		e.param(expr.Value)
+	case TimeExpr:
+		if e.isN1QL() {
+			e.out.WriteString("STR_TO_MILLIS(")
+			e.param(expr.Time)
+			e.out.WriteString(")")
+		} else {
+			e.out.WriteString("CAST(")
+			e.param(expr.Time)
+			e.out.WriteString(" AS TIMESTAMP)")
+		}
+	case FieldExpr:
+		e.field(expr, numeric)
+	case MetaExpr:
+		if !e.isN1QL() {
+			e.fail(expr, "document metadata has no SQL/JSON equivalent")
+		}
+		e.out.WriteString("META(")
+		if e.opts.Alias != "" {
+			e.n1qlIdentifier(e.opts.Alias)
+		}
+		e.out.WriteString(")")
+		e.n1qlPath(expr.Path)
+	case FuncExpr:
+		e.function(expr)
+	default:
+		e.fail(expr, "%s cannot be used as a value", expr)
+	}
+}
+
+func (e *sqlEmitter) function(expr FuncExpr) {
+	if op, ok := sqlInfixOps[expr.FuncName]; ok && len(expr.Params) == 2 {
+		if op == "%" && !e.isN1QL() {
+			e.out.WriteString("MOD(")
+			e.operand(expr.Params[0], true)
+			e.out.WriteString(", ")
+			e.operand(expr.Params[1], true)
+			e.out.WriteString(")")
+			return
+		}
+		e.out.WriteString("(")
+		e.operand(expr.Params[0], true)
+		e.out.WriteString(" " + op + " ")
+		e.operand(expr.Params[1], true)
+		e.out.WriteString(")")
+		return
+	}
+
+	switch {
+	case expr.FuncName == MathFuncNeg && len(expr.Params) == 1:
+		e.out.WriteString("-(")
+		e.operand(expr.Params[0], true)
+		e.out.WriteString(")")
+		return
+	case expr.FuncName == MathFuncPi && len(expr.Params) == 0:
+		if e.isN1QL() {
+			e.out.WriteString("PI()")
+			return
+		}
+	case expr.FuncName == MathFuncE && len(expr.Params) == 0:
+		if e.isN1QL() {
+			e.out.WriteString("E()")
+			return
+		}
+	case expr.FuncName == DateFunc && len(expr.Params) == 1 && !e.isN1QL():
+		e.out.WriteString("CAST(")
+		e.operand(expr.Params[0], false)
+		e.out.WriteString(" AS TIMESTAMP)")
+		return
+	}
+
+	names := sqlJSONFuncNames
+	if e.isN1QL() {
+		names = sqlN1QLFuncNames
+	}
+	name, ok := names[expr.FuncName]
+	if !ok {
+		e.fail(expr, "function %s has no %s equivalent", expr.FuncName, e.dialectName())
+	}
+
+	paramType, _ := funcFieldTypes(expr.FuncName)
+	e.out.WriteString(name + "(")
+	for i, param := range expr.Params {
+		if i > 0 {
+			e.out.WriteString(", ")
+		}
+		e.operand(param, paramType == FieldTypeNumber)
+	}
+	e.out.WriteString(")")
+}
+
+// jsonFilter writes a comparison against a literal which SQL/JSON can only
+// express as a path filter, such as a boolean or null.
+func (e *sqlEmitter) jsonFilter(expr Expression, lhs Expression, literal string) {
+	field, ok := lhs.(FieldExpr)
+	if !ok {
+		e.fail(expr, "only fields can be compared with %s in SQL/JSON", literal)
+	}
+	fmt.Fprintf(&e.out, "JSON_EXISTS(%s, %s)", e.opts.Alias, e.jsonPath(field, " ? (@ == "+literal+")"))
+}
+
+func (e *sqlEmitter) comparison(expr Expression, lhs, rhs Expression, op string) {
+	for _, operands := range [][2]Expression{{lhs, rhs}, {rhs, lhs}} {
+		value, ok := operands[1].(ValueExpr)
+		if !ok {
+			continue
+		}
+
+		switch value.Value.(type) {
+		case nil:
+			if op != "=" {
+				e.fail(expr, "null can only be compared for equality")
+			}
+			if !e.isN1QL() {
+				e.jsonFilter(expr, operands[0], "null")
+				return
+			}
+			e.operand(operands[0], false)
+			e.out.WriteString(" IS NULL")
+			return
+		case bool:
+			if !e.isN1QL() {
+				if op != "=" {
+					e.fail(expr, "booleans can only be compared for equality in SQL/JSON")
+				}
+				e.jsonFilter(expr, operands[0], strconv.FormatBool(value.Value.(bool)))
+				return
+			}
+		}
+	}
+
+	numeric := sqlIsNumeric(lhs) || sqlIsNumeric(rhs)
+	e.operand(lhs, numeric)
+	e.out.WriteString(" " + op + " ")
+	e.operand(rhs, numeric)
+}
+
+func (e *sqlEmitter) exists(expr Expression, subExpr Expression, exists bool) {
+	if e.isN1QL() {
+		e.operand(subExpr, false)
+		if exists {
+			e.out.WriteString(" IS NOT MISSING")
+		} else {
+			e.out.WriteString(" IS MISSING")
+		}
+		return
+	}
+
+	field, ok := subExpr.(FieldExpr)
+	if !ok {
+		e.fail(expr, "only fields can be tested for existence in SQL/JSON")
+	}
+	if !exists {
+		e.out.WriteString("NOT ")
+	}
+	fmt.Fprintf(&e.out, "JSON_EXISTS(%s, %s)", e.opts.Alias, e.jsonPath(field, ""))
+}
+
+func (e *sqlEmitter) loop(keyword string, varId VariableID, inExpr, subExpr Expression) {
+	if !e.isN1QL() {
+		e.fail(inExpr, "loops have no SQL/JSON equivalent")
+	}
+	fmt.Fprintf(&e.out, "%s v%d IN ", keyword, varId)
+	e.operand(inExpr, false)
+	e.out.WriteString(" SATISFIES ")
+	e.condition(subExpr)
+	e.out.WriteString(" END")
+}
+
+func (e *sqlEmitter) conditions(exprs []Expression, op string) {
+	if len(exprs) == 0 {
+		e.fail(nil, "empty %s expression", op)
+	}
+	for i, expr := range exprs {
+		if i > 0 {
+			e.out.WriteString(" " + op + " ")
+		}
+		switch expr.(type) {
+		case AndExpr, OrExpr:
+			e.out.WriteString("(")
+			e.condition(expr)
+			e.out.WriteString(")")
+		default:
+			e.condition(expr)
+		}
+	}
+}
+
+func (e *sqlEmitter) condition(expr Expression) {
+	switch expr := expr.(type) {
+	case TrueExpr:
+		if e.isN1QL() {
+			e.out.WriteString("TRUE")
+		} else {
+			e.out.WriteString("1 = 1")
+		}
+	case FalseExpr:
+		if e.isN1QL() {
+			e.out.WriteString("FALSE")
+		} else {
+			e.out.WriteString("1 = 0")
+		}
+	case AndExpr:
+		e.conditions(expr, "AND")
+	case OrExpr:
+		e.conditions(expr, "OR")
+	case NotExpr:
+		// Comparisons with missing fields are false rather than unknown, so
+		// their negation is true
+		if e.isN1QL() {
+			e.out.WriteString("NOT IFMISSINGORNULL(")
+			e.condition(expr.SubExpr)
+			e.out.WriteString(", FALSE)")
+		} else {
+			e.out.WriteString("NOT COALESCE(")
+			e.condition(expr.SubExpr)
+			e.out.WriteString(", FALSE)")
+		}
+	case ExistsExpr:
+		e.exists(expr, expr.SubExpr, true)
+	case NotExistsExpr:
+		e.exists(expr, expr.SubExpr, false)
+	case EqualsExpr:
+		e.comparison(expr, expr.Lhs, expr.Rhs, "=")
+	case NotEqualsExpr:
+		e.condition(NotExpr{EqualsExpr{expr.Lhs, expr.Rhs}})
+	case LessThanExpr:
+		e.comparison(expr, expr.Lhs, expr.Rhs, "<")
+	case LessEqualsExpr:
+		e.comparison(expr, expr.Lhs, expr.Rhs, "<=")
+	case GreaterThanExpr:
+		e.comparison(expr, expr.Lhs, expr.Rhs, ">")
+	case GreaterEqualsExpr:
+		e.comparison(expr, expr.Lhs, expr.Rhs, ">=")
+	case LikeExpr:
+		if pattern, ok := expr.Rhs.(LikePatternExpr); ok {
+			e.likePattern(expr, pattern)
+			break
+		}
+		regex, ok := expr.Rhs.(RegexExpr)
+		if !ok {
+			e.fail(expr, "only regular expressions in Go syntax can be used with %s", e.dialectName())
+		}
+		if e.isN1QL() {
+			e.out.WriteString("REGEXP_CONTAINS(")
+		} else {
+			e.out.WriteString("REGEXP_LIKE(")
+		}
+		e.operand(expr.Lhs, false)
+		e.out.WriteString(", ")
+		e.param(regex.Regex)
+		e.out.WriteString(")")
+	case AnyInExpr:
+		e.loop("ANY", expr.VarId, expr.InExpr, expr.SubExpr)
+	case EveryInExpr:
+		e.loop("EVERY", expr.VarId, expr.InExpr, expr.SubExpr)
+	case AnyEveryInExpr:
+		e.loop("ANY AND EVERY", expr.VarId, expr.InExpr, expr.SubExpr)
+	default:
+		e.fail(expr, "%s is not a condition", expr)
+	}
+}
+
+// EmitSQL converts an expression into the condition of a WHERE clause,
+// along with the parameters its placeholders refer to.  Loops become
+// ANY ... SATISFIES in N1QL and regular expressions become
+// REGEXP_CONTAINS, or REGEXP_LIKE for SQL/JSON.  LIKE patterns are always
+// written with \ as their escape character.  The condition is true
+// for the documents the expression matches, with NOT and != matching
+// documents which are missing the fields involved as they do here.
+//
+// For SQL/JSON, fields are read with JSON_VALUE as strings unless they
+// are compared to a number, so comparing two fields compares their text.
+// Expressions which cannot be written in the chosen dialect return a
+// SQLEmitError.
+func EmitSQL(expr Expression, opts SQLOptions) (where string, params []interface{}, err error) {
+	if opts.Dialect != SQLDialectN1QL && opts.Alias == "" {
+		return "", nil, SQLEmitError{nil, "the JSON column must be given as the alias"}
+	}
+
+	e := &sqlEmitter{opts: opts}
+
+	defer func() {
+		if r := recover(); r != nil {
+			emitErr, ok := r.(SQLEmitError)
+			if !ok {
+				panic(r)
+			}
+			where, params, err = "", nil, emitErr
+		}
+	}()
+
+	e.condition(expr)
+	return e.out.String(), e.params, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmitSQL(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		filter string
+		n1ql   string
+		json   string
+		params []interface{}
+
+		// SQL/JSON writes booleans into paths rather than as parameters
+		noJSONParams bool
+	}{
+		{
+			`a = 1 AND (b.c > "x" OR NOT d[1] < 2.5)`,
+			"`a` = $1 AND (`b`.`c` > $2 OR NOT IFMISSINGORNULL(`d`[1] < $3, FALSE))",
+			`JSON_VALUE(doc, '$."a"' RETURNING DOUBLE PRECISION) = ? AND (JSON_VALUE(doc, '$."b"."c"') > ? OR ` +
+				`NOT COALESCE(JSON_VALUE(doc, '$."d"[1]' RETURNING DOUBLE PRECISION) < ?, FALSE))`,
+			[]interface{}{int64(1), "x", 2.5},
+			false,
+		},
+		{
+			`a != true AND e IS NULL AND f IS MISSING AND g EXISTS`,
+			"NOT IFMISSINGORNULL(`a` = $1, FALSE) AND `e` IS NULL AND `f` IS MISSING AND `g` IS NOT MISSING",
+			`NOT COALESCE(JSON_EXISTS(doc, '$."a" ? (@ == true)'), FALSE) AND JSON_EXISTS(doc, '$."e" ? (@ == null)') AND ` +
+				`NOT JSON_EXISTS(doc, '$."f"') AND JSON_EXISTS(doc, '$."g"')`,
+			[]interface{}{true},
+			true,
+		},
+		{
+			`a * 3 >= 9 AND a % 2 = 1 AND -b < 0 AND POW(a, 2) < 3 AND DATE(t) > DATE("2020-01-01T00:00:00Z")`,
+			"(`a` * $1) >= $2 AND (`a` % $3) = $4 AND -(`b`) < $5 AND POWER(`a`, $6) < $7 AND " +
+				"STR_TO_MILLIS(`t`) > STR_TO_MILLIS($8)",
+			`(JSON_VALUE(doc, '$."a"' RETURNING DOUBLE PRECISION) * ?) >= ? AND ` +
+				`MOD(JSON_VALUE(doc, '$."a"' RETURNING DOUBLE PRECISION), ?) = ? AND ` +
+				`-(JSON_VALUE(doc, '$."b"' RETURNING DOUBLE PRECISION)) < ? AND ` +
+				`POWER(JSON_VALUE(doc, '$."a"' RETURNING DOUBLE PRECISION), ?) < ? AND ` +
+				`CAST(JSON_VALUE(doc, '$."t"') AS TIMESTAMP) > CAST(? AS TIMESTAMP)`,
+			[]interface{}{int64(3), int64(9), int64(2), int64(1), int64(0), int64(2), int64(3), "2020-01-01T00:00:00Z"},
+			false,
+		},
+		{
+			`REGEXP_CONTAINS(name, "^ne") AND ` + "`it's`" + ` = "x"`,
+			"REGEXP_CONTAINS(`name`, $1) AND `it's` = $2",
+			`REGEXP_LIKE(JSON_VALUE(doc, '$."name"'), ?) AND JSON_VALUE(doc, '$."it''s"') = ?`,
+			[]interface{}{"^ne", "x"},
+			false,
+		},
+		{
+			`name LIKE "Jo%" AND NOT code LIKE "a!_\\%" ESCAPE "!"`,
+			"`name` LIKE $1 AND NOT IFMISSINGORNULL(`code` LIKE $2, FALSE)",
+			`JSON_VALUE(doc, '$."name"') LIKE ? ESCAPE '\' AND ` +
+				`NOT COALESCE(JSON_VALUE(doc, '$."code"') LIKE ? ESCAPE '\', FALSE)`,
+			[]interface{}{"Jo%", `a\_\\%`},
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		expr, err := ParseExpression(test.filter, ParseOptions{})
+		if !assert.Nil(err, test.filter) {
+			continue
+		}
+
+		where, params, err := EmitSQL(expr, SQLOptions{})
+		assert.Nil(err, test.filter)
+		assert.Equal(test.n1ql, where)
+		assert.Equal(test.params, params)
+
+		where, params, err = EmitSQL(expr, SQLOptions{Dialect: SQLDialectJSON, Alias: "doc"})
+		assert.Nil(err, test.filter)
+		assert.Equal(test.json, where)
+		if test.noJSONParams {
+			assert.Nil(params)
+		} else {
+			assert.Equal(test.params, params)
+		}
+	}
+}
+
+func TestEmitSQLN1QL(t *testing.T) {
+	assert := assert.New(t)
+
+	expr := AndExpr{
+		AnyInExpr{1, FieldExpr{0, []string{"tags"}}, EqualsExpr{FieldExpr{1, nil}, ValueExpr{"a"}}},
+		EveryInExpr{2, FieldExpr{0, []string{"xs"}},
+			AnyEveryInExpr{3, FieldExpr{2, []string{"ys"}},
+				LessThanExpr{FieldExpr{3, []string{"z"}}, FieldExpr{2, []string{"max"}}}}},
+		OrExpr{
+			EqualsExpr{MetaExpr{[]string{"xattrs", "rev"}}, ValueExpr{"1"}},
+			EqualsExpr{FuncExpr{TypeFunc, []Expression{FieldExpr{0, nil}}}, ValueExpr{"object"}},
+		},
+	}
+
+	where, params, err := EmitSQL(expr, SQLOptions{Alias: "d"})
+	assert.Nil(err)
+	assert.Equal("ANY v1 IN `d`.`tags` SATISFIES v1 = $1 END AND "+
+		"EVERY v2 IN `d`.`xs` SATISFIES ANY AND EVERY v3 IN v2.`ys` SATISFIES v3.`z` < v2.`max` END END AND "+
+		"(META(`d`).`xattrs`.`rev` = $2 OR TYPE(`d`) = $3)", where)
+	assert.Equal([]interface{}{"a", "1", "object"}, params)
+
+	_, _, err = EmitSQL(expr, SQLOptions{})
+	assert.Equal("the whole document can only be referred to when an alias is given", err.Error())
+}
+
+func TestEmitSQLErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	jsonOpts := SQLOptions{Dialect: SQLDialectJSON, Alias: "doc"}
+	tests := []struct {
+		expr Expression
+		opts SQLOptions
+		err  string
+	}{
+		{TrueExpr{}, SQLOptions{Dialect: SQLDialectJSON}, "the JSON column must be given as the alias"},
+		{AnyInExpr{1, FieldExpr{0, []string{"a"}}, ExistsExpr{FieldExpr{1, nil}}}, jsonOpts,
+			"loops have no SQL/JSON equivalent"},
+		{EqualsExpr{MetaExpr{[]string{"id"}}, ValueExpr{"a"}}, jsonOpts,
+			"document metadata has no SQL/JSON equivalent"},
+		{EqualsExpr{FuncExpr{TypeFunc, []Expression{FieldExpr{0, []string{"a"}}}}, ValueExpr{"string"}}, jsonOpts,
+			"function type has no SQL/JSON equivalent"},
+		{LessThanExpr{FieldExpr{0, []string{"a"}}, ValueExpr{true}}, jsonOpts,
+			"booleans can only be compared for equality in SQL/JSON"},
+		{LessThanExpr{FieldExpr{0, []string{"a"}}, ValueExpr{nil}}, SQLOptions{},
+			"null can only be compared for equality"},
+		{LikeExpr{FieldExpr{0, []string{"a"}}, PcreExpr{"a"}}, SQLOptions{},
+			"only regular expressions in Go syntax can be used with N1QL"},
+		{OrExpr{}, SQLOptions{}, "empty OR expression"},
+		{FieldExpr{0, []string{"a"}}, SQLOptions{}, "$doc.a is not a condition"},
+	}
+
+	for _, test := range tests {
+		where, params, err := EmitSQL(test.expr, test.opts)
+		assert.IsType(SQLEmitError{}, err)
+		if assert.NotNil(err) {
+			assert.Equal(test.err, err.Error())
+		}
+		assert.Equal("", where)
+		assert.Nil(params)
+	}
+}
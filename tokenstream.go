@@ -0,0 +1,49 @@
+// Copyright 2024-Present Couchbase, Inc. All rights reserved.
+
+package gojsonsm
+
+import (
+	"fmt"
+)
+
+// DocumentFormat is the encoding of a document passed to MatchFormat.
+type DocumentFormat int
+
+const (
+	FormatJSON DocumentFormat = iota
+	FormatCBOR
+	FormatMsgPack
+	FormatBSON
+)
+
+func (format DocumentFormat) String() string {
+	switch format {
+	case FormatJSON:
+		return "json"
+	case FormatCBOR:
+		return "cbor"
+	case FormatMsgPack:
+		return "msgpack"
+	case FormatBSON:
+		return "bson"
+	}
+	return fmt.Sprintf("DocumentFormat(%d)", int(format))
+}
+
+var ErrorUnknownDocumentFormat error = fmt.Errorf("Error: Unknown document format")
+
+// tokenStream is the sequence of JSON tokens which the FastMatcher walks
+// while matching a document.
+//
+// Step returns the next token along with its JSON text and the distance the
+// stream position moved over the token itself, so that the position of a
+// token is always the position after it minus that distance.  Binary tokens,
+// which have no JSON equivalent, return their raw bytes instead of text.  Positions are
+// otherwise opaque, and may only be passed back to Seek or Slice.  Slice
+// returns the JSON text of the tokens between two positions.
+type tokenStream interface {
+	Position() int
+	Seek(pos int)
+	Step() (tokenType, []byte, int, error)
+	Slice(start, end int) []byte
+}
@@ -63,8 +63,17 @@ type Transformer struct {
 	RootExec  *ExecNode
 	RootTree  binTree
 
+	// MetaExec is the root of the expressions which only use META(), and
+	// is matched against the document metadata rather than the document.
+	MetaExec    *ExecNode
+	metaContext *compileContext
+
 	ContextStack    []*compileContext
 	ActiveBucketIdx BucketID
+
+	// CompareMode is recorded against every comparison op which is built,
+	// and decides how values of different types are compared.
+	CompareMode CompareMode
 }
 
 func (t *Transformer) getExecNode(field resolvedFieldRef) *ExecNode {
@@ -153,6 +162,8 @@ func (t *Transformer) gatherResolvedFieldRefs(expr Expression) []resolvedFieldRe
 func (t *Transformer) getContext(varID VariableID) *compileContext {
 	if varID == 0 {
 		return nil
+	} else if varID == metaVariableID {
+		return t.metaContext
 	}
 
 	for i := len(t.ContextStack) - 1; i >= 0; i++ {
@@ -171,11 +182,15 @@ func (t *Transformer) resolveRef(fieldExpr FieldExpr) resolvedFieldRef {
 	}
 }
 
-func (t *Transformer) findFieldRefsBestRoot(fieldRefs []resolvedFieldRef) (resolvedFieldRef, bool) {
-	var currentContext *compileContext
+func (t *Transformer) currentContext() *compileContext {
 	if len(t.ContextStack) > 0 {
-		currentContext = t.ContextStack[len(t.ContextStack)-1]
+		return t.ContextStack[len(t.ContextStack)-1]
 	}
+	return nil
+}
+
+func (t *Transformer) findFieldRefsBestRoot(fieldRefs []resolvedFieldRef) (resolvedFieldRef, bool) {
+	currentContext := t.currentContext()
 
 	var contextFields []resolvedFieldRef
 	for _, fieldRef := range fieldRefs {
@@ -184,7 +199,21 @@ func (t *Transformer) findFieldRefsBestRoot(fieldRefs []resolvedFieldRef) (resol
 		}
 	}
 
+	// Expressions which only refer to the metadata are rooted beneath it,
+	// anything else which uses it reads the metadata from a slot.
+	if len(contextFields) == 0 && currentContext == nil {
+		currentContext = t.metaContext
+		for _, fieldRef := range fieldRefs {
+			if fieldRef.Context == currentContext {
+				contextFields = append(contextFields, fieldRef)
+			}
+		}
+	}
+
 	if len(contextFields) == 0 {
+		if currentContext == t.metaContext {
+			currentContext = nil
+		}
 		return resolvedFieldRef{
 			Context: currentContext,
 			Path:    []string{},
@@ -235,6 +264,26 @@ func (ref *nodeRef) AddOp(op OpNode) {
 	}
 }
 
+// AddSharedOp adds an op to the node unless an identical op is already
+// present, in which case that op is made to also resolve the new op's bucket.
+func (ref *nodeRef) AddSharedOp(op OpNode) {
+	var ops []OpNode
+	if ref.node != nil {
+		ops = ref.node.Ops
+	} else if ref.after != nil {
+		ops = ref.after.Ops
+	}
+
+	for i := range ops {
+		if ops[i].Op == op.Op && ops[i].Mode == op.Mode && dataRefEquals(ops[i].Lhs, op.Lhs) && dataRefEquals(ops[i].Rhs, op.Rhs) {
+			ops[i].Fanout = append(ops[i].Fanout, op.BucketIdx)
+			return
+		}
+	}
+
+	ref.AddOp(op)
+}
+
 func (ref *nodeRef) AddLoop(loop LoopNode) {
 	// TODO(brett19): This function currently validates that there
 	// is only 1 valid possible loop target used depending on which
@@ -279,21 +328,10 @@ func (t *Transformer) pickBaseNode(expr Expression) nodeRef {
 	}
 }
 
-func (t *Transformer) makeDataRefRecurse(expr Expression, context nodeRef, isRoot bool) (DataRef, error) {
+// newUserFastVal builds the user-defined FastVal used to represent a
+// constant from the expression during matching.
+func newUserFastVal(expr Expression) (FastVal, error) {
 	switch expr := expr.(type) {
-	case FieldExpr:
-		resField := t.resolveRef(expr)
-		fieldNode := t.getExecNode(resField)
-		if context.node == fieldNode {
-			if isRoot {
-				return nil, nil
-			} else {
-				return activeLitRef{}, nil
-			}
-		}
-
-		slot := t.storeExecNode(fieldNode)
-		return SlotRef{slot}, nil
 	case ValueExpr:
 		val := NewFastVal(expr.Value)
 		if val.IsString() {
@@ -304,7 +342,7 @@ func (t *Transformer) makeDataRefRecurse(expr Expression, context nodeRef, isRoo
 	case RegexExpr:
 		regex, err := regexp.Compile(expr.Regex.(string))
 		if err != nil {
-			return nil, errors.New("failed to compile RegexExpr: " + err.Error())
+			return NewInvalidFastVal(), errors.New("failed to compile RegexExpr: " + err.Error())
 		}
 		val := NewFastVal(regex)
 		val.userDefined = true
@@ -314,6 +352,42 @@ func (t *Transformer) makeDataRefRecurse(expr Expression, context nodeRef, isRoo
 		val := NewFastVal(pcreWrapper)
 		val.userDefined = true
 		return val, err
+	case LikePatternExpr:
+		pattern, err := CompileLikePattern(expr.Pattern, expr.Escape)
+		if err != nil {
+			return NewInvalidFastVal(), err
+		}
+		val := NewFastVal(pattern)
+		val.userDefined = true
+		return val, nil
+	case TimeExpr:
+		val, err := GetNewTimeFastVal(expr.Time.(string))
+		val.userDefined = true
+		return val, err
+	}
+
+	return NewInvalidFastVal(), errors.New("unsupported constant expression")
+}
+
+func (t *Transformer) makeDataRefRecurse(expr Expression, context nodeRef, isRoot bool) (DataRef, error) {
+	switch expr := expr.(type) {
+	case FieldExpr:
+		resField := t.resolveRef(expr)
+		fieldNode := t.getExecNode(resField)
+		if context.node == fieldNode {
+			if isRoot {
+				return nil, nil
+			} else {
+				return activeLitRef{}, nil
+			}
+		}
+
+		slot := t.storeExecNode(fieldNode)
+		return SlotRef{slot}, nil
+	case MetaExpr:
+		return t.makeDataRefRecurse(expr.fieldExpr(), context, isRoot)
+	case ValueExpr, RegexExpr, PcreExpr, LikePatternExpr, TimeExpr:
+		return newUserFastVal(expr)
 	case FuncExpr:
 		var params []DataRef
 
@@ -329,10 +403,6 @@ func (t *Transformer) makeDataRefRecurse(expr Expression, context nodeRef, isRoo
 			FuncName: expr.FuncName,
 			Params:   params,
 		}, nil
-	case TimeExpr:
-		val, err := GetNewTimeFastVal(expr.Time.(string))
-		val.userDefined = true
-		return val, err
 	}
 
 	return nil, errors.New("unsupported expression in parameter")
@@ -429,6 +499,15 @@ func (t *Transformer) transformLoop(expr Expression, loopType LoopType, varID Va
 		panic(err)
 	}
 
+	// A loop over the metadata which also uses the document can only run
+	// once the document has been read, from a slot holding the metadata.
+	if loopTarget != nil && baseNode.node != nil {
+		baseNode = nodeRef{
+			node:  nil,
+			after: t.getAfterNode(t.getExecNode(resolvedFieldRef{Context: t.currentContext()})),
+		}
+	}
+
 	baseBucketIdx := t.ActiveBucketIdx
 	t.RootTree.data[baseBucketIdx].NodeType = nodeTypeLoop
 	t.newBucket()
@@ -473,11 +552,13 @@ func (t *Transformer) transformExists(expr ExistsExpr) *ExecNode {
 		panic(err)
 	}
 
-	baseNode.AddOp(OpNode{
+	baseNode.AddSharedOp(OpNode{
 		t.ActiveBucketIdx,
 		OpTypeExists,
 		lhsDataRef,
 		nil,
+		t.CompareMode,
+		nil,
 	})
 
 	return nil
@@ -504,11 +585,24 @@ func (t *Transformer) transformComparison(expr Expression, op OpType, lhs, rhs E
 		panic(err)
 	}
 
-	baseNode.AddOp(OpNode{
+	// Constants are kept on the right hand side so that the same comparison
+	// written either way around can share a single op.
+	if _, lhsIsConst := lhsRef.(FastVal); lhsIsConst {
+		if _, rhsIsConst := rhsRef.(FastVal); !rhsIsConst {
+			if mirroredOp, ok := mirrorOpType(op); ok {
+				lhsRef, rhsRef = rhsRef, lhsRef
+				op = mirroredOp
+			}
+		}
+	}
+
+	baseNode.AddSharedOp(OpNode{
 		t.ActiveBucketIdx,
 		op,
 		lhsRef,
 		rhsRef,
+		t.CompareMode,
+		nil,
 	})
 
 	return nil
@@ -585,6 +679,11 @@ var AlwaysFalseIdent = -2
 
 func (t *Transformer) Transform(exprs []Expression) *MatchDef {
 	t.RootExec = &ExecNode{}
+	t.MetaExec = &ExecNode{}
+	t.metaContext = &compileContext{
+		Var:  metaVariableID,
+		Node: t.MetaExec,
+	}
 	t.ContextStack = nil
 	t.BucketIdx = 1
 	t.ActiveBucketIdx = 0
@@ -644,8 +743,14 @@ func (t *Transformer) Transform(exprs []Expression) *MatchDef {
 		}
 	}
 
+	var metaExec *ExecNode
+	if t.RootExec != nil && !t.MetaExec.isEmpty() {
+		metaExec = t.MetaExec
+	}
+
 	return &MatchDef{
 		ParseNode:    t.RootExec,
+		MetaNode:     metaExec,
 		MatchTree:    t.RootTree,
 		MatchBuckets: exprBucketIDs,
 		NumBuckets:   int(t.BucketIdx),